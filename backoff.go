@@ -0,0 +1,101 @@
+package goscraper
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackoffStrategy decides how long the client waits between attempts,
+// starting from the configured RetryDelay. The zero value is
+// ExponentialBackoff.
+type BackoffStrategy struct {
+	linear bool
+}
+
+var (
+	// ExponentialBackoff waits a random time of up to RetryDelay doubled
+	// for every attempt made so far ("full jitter"), capped at
+	// maxRetryBackoff, so that clients retrying together spread out.
+	ExponentialBackoff = BackoffStrategy{}
+	// LinearBackoff waits RetryDelay times the number of attempts made.
+	LinearBackoff = BackoffStrategy{linear: true}
+)
+
+const (
+	// maxRetryBackoff caps the exponential backoff ceiling.
+	maxRetryBackoff = time.Minute
+	// maxRetryAfter is the longest Retry-After that is waited out. A site
+	// asking for longer is not retried.
+	maxRetryAfter = 5 * time.Minute
+)
+
+// delay returns the wait after the attempt numbered attempt, counting from
+// zero, has failed.
+func (b BackoffStrategy) delay(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	if b.linear {
+		return base * time.Duration(attempt+1)
+	}
+
+	ceiling := base
+	for i := 0; i < attempt && ceiling < maxRetryBackoff; i++ {
+		ceiling *= 2
+	}
+	if ceiling > maxRetryBackoff {
+		ceiling = maxRetryBackoff
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// retryDelay returns how long to wait before retrying after resp, which may
+// be nil: the backoff delay, or the response's Retry-After if that is
+// longer.
+func (c *Client) retryDelay(attempt int, resp *http.Response) time.Duration {
+	delay := c.config.Backoff.delay(c.config.RetryDelay, attempt)
+	if wait, ok := retryAfter(resp); ok && wait > delay {
+		delay = wait
+	}
+	return delay
+}
+
+// retryAfter reads the Retry-After header of a 429 or 503 response, given
+// either in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if seconds > int64(maxRetryAfter/time.Second) {
+			return maxRetryAfter + time.Second, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// retryAfterTooLong reports whether resp asks to be retried later than is
+// worth waiting for.
+func retryAfterTooLong(resp *http.Response) bool {
+	wait, ok := retryAfter(resp)
+	return ok && wait > maxRetryAfter
+}
@@ -0,0 +1,91 @@
+package goscraper
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// forEachConcurrent calls fn for every index in [0, n) using at most
+// concurrency goroutines. Indexes not yet started when ctx is cancelled are
+// passed to skip instead.
+func forEachConcurrent(ctx context.Context, n, concurrency int, fn func(i int), skip func(i int)) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > n {
+		concurrency = n
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			skip(i)
+			continue
+		}
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			skip(i)
+		}
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// SmartScrapeMany runs SmartScrape over urls with up to MaxConcurrency
+// requests in flight, all sharing one scraper and so one rate limit. opts
+// are applied on top of the StealthScrape defaults. Results and errors are
+// index-aligned with urls: for each index exactly one of them is non-nil.
+func SmartScrapeMany(ctx context.Context, urls []string, opts ...Option) ([]*SmartData, []error) {
+	options := append([]Option{
+		WithStealth(true),
+		WithUserAgentRotation(true),
+		WithRandomHeaders(true),
+		WithHumanDelay(true),
+		WithTimeout(45 * time.Second),
+		WithRateLimit(2 * time.Second),
+		WithMaxRetries(3),
+	}, opts...)
+	scraper := New(options...)
+	extractor := NewSmartExtractor()
+
+	responses, errs := scraper.GetMany(ctx, urls)
+	results := make([]*SmartData, len(urls))
+	for i, resp := range responses {
+		// Error pages come with their response, but are not extracted.
+		if errs[i] == nil {
+			results[i] = extractor.ExtractSmart(resp)
+		}
+	}
+
+	return results, errs
+}
+
+// GetMany fetches urls through a pool of at most MaxConcurrency workers that
+// share the scraper's rate limit. Responses and errors are index-aligned with
+// urls; a failing URL does not stop the others. As with GetWithContext, an
+// error status yields both the response and a *ScrapeError. URLs not yet
+// started when ctx is cancelled get ctx.Err().
+func (s *DefaultScraper) GetMany(ctx context.Context, urls []string) ([]*Response, []error) {
+	responses := make([]*Response, len(urls))
+	errs := make([]error, len(urls))
+	forEachConcurrent(ctx, len(urls), s.config.MaxConcurrency, func(i int) {
+		responses[i], errs[i] = s.GetWithContext(ctx, urls[i])
+	}, func(i int) {
+		errs[i] = ctx.Err()
+	})
+
+	return responses, errs
+}
@@ -0,0 +1,133 @@
+package goscraper
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ramusaaa/goscraper/pkg/stealth"
+	"go.uber.org/zap"
+)
+
+// BlockType classifies why a site refused a request.
+type BlockType string
+
+const (
+	BlockForbidden    BlockType = "403"
+	BlockRateLimited  BlockType = "429"
+	BlockCloudflareJS BlockType = "cloudflare-js"
+	BlockCaptcha      BlockType = "captcha"
+	BlockDataDome     BlockType = "datadome"
+)
+
+var captchaMarkers = []string{"g-recaptcha", "recaptcha/api.js", "h-captcha", "hcaptcha.com", "cf-turnstile"}
+
+// classifyBlock tells which kind of block resp is, if any. body is the start
+// of the decoded response body. Bot-protection vendors are recognised before
+// the bare status codes so the more specific type wins.
+func classifyBlock(resp *http.Response, body []byte) (BlockType, bool) {
+	if resp.Header.Get("X-DataDome") != "" || strings.Contains(strings.ToLower(resp.Header.Get("Server")), "datadome") ||
+		bytes.Contains(body, []byte("captcha-delivery.com")) {
+		return BlockDataDome, true
+	}
+	if stealth.DetectCloudflareChallenge(resp, body) {
+		return BlockCloudflareJS, true
+	}
+	for _, marker := range captchaMarkers {
+		if bytes.Contains(body, []byte(marker)) {
+			return BlockCaptcha, true
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return BlockRateLimited, true
+	case http.StatusForbidden:
+		return BlockForbidden, true
+	}
+	return "", false
+}
+
+// blockStats counts blocks per host and type.
+type blockStats struct {
+	mu     sync.Mutex
+	counts map[string]map[BlockType]int
+}
+
+func newBlockStats() *blockStats {
+	return &blockStats{counts: make(map[string]map[BlockType]int)}
+}
+
+func (s *blockStats) add(host string, blockType BlockType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byType := s.counts[host]
+	if byType == nil {
+		byType = make(map[BlockType]int)
+		s.counts[host] = byType
+	}
+	byType[blockType]++
+}
+
+func (s *blockStats) snapshot() map[string]map[BlockType]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := make(map[string]map[BlockType]int, len(s.counts))
+	for host, byType := range s.counts {
+		copied := make(map[BlockType]int, len(byType))
+		for blockType, count := range byType {
+			copied[blockType] = count
+		}
+		snapshot[host] = copied
+	}
+	return snapshot
+}
+
+// observeBlock classifies a response and, when it is a block, counts it and
+// reports it to the configured logger and metrics. Only error statuses are
+// inspected, since block pages served with 200 are too rare to justify
+// sniffing every body.
+func (c *Client) observeBlock(resp *http.Response, proxy *url.URL) {
+	if resp == nil || resp.StatusCode < 400 {
+		return
+	}
+	blockType, ok := classifyBlock(resp, stealth.SniffBody(resp))
+	if !ok {
+		return
+	}
+	c.recordBlock(resp, blockType, proxy)
+}
+
+func (c *Client) recordBlock(resp *http.Response, blockType BlockType, proxy *url.URL) {
+	host := resp.Request.URL.Hostname()
+	c.blocks.add(host, blockType)
+
+	if c.config.Metrics != nil {
+		c.config.Metrics.RecordBlock(host, string(blockType))
+	}
+
+	fields := []zap.Field{
+		zap.String("host", host),
+		zap.String("url", resp.Request.URL.String()),
+		zap.String("block_type", string(blockType)),
+		zap.Int("status", resp.StatusCode),
+	}
+	if proxy != nil {
+		fields = append(fields, zap.String("proxy", proxy.Redacted()))
+	}
+	c.logger().Warn("Request blocked", fields...)
+}
+
+// BlockStats returns how often each host blocked requests, by block type.
+// Blocks the stealth client gets past, e.g. by solving a JS challenge, are
+// counted too.
+func (c *Client) BlockStats() map[string]map[BlockType]int {
+	return c.blocks.snapshot()
+}
+
+// BlockStats returns how often each host blocked requests, by block type.
+func (s *DefaultScraper) BlockStats() map[string]map[BlockType]int {
+	return s.client.BlockStats()
+}
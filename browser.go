@@ -0,0 +1,47 @@
+package goscraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ramusaaa/goscraper/pkg/browser"
+)
+
+// ScrapeWithBrowser renders rawURL in an engine from manager's pool and
+// returns the page like Get does, so pages that need JavaScript can go
+// through the same extractors. With a waitSelector the HTML is read once
+// that element is visible; otherwise once the page has loaded.
+//
+// The engines don't expose the HTTP status or headers of the document, so
+// a rendered page is reported as 200 with no headers. The per-phase
+// timeouts of the manager's browser.Config apply.
+func ScrapeWithBrowser(ctx context.Context, manager *browser.Manager, rawURL, waitSelector string) (*Response, error) {
+	start := time.Now()
+
+	html, err := manager.FetchHTML(ctx, rawURL, browser.FetchOptions{WaitSelector: waitSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render URL: %w", err)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		doc.Url = u
+	}
+
+	return &Response{
+		URL:        rawURL,
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{},
+		Body:       html,
+		Document:   doc,
+		LoadTime:   time.Since(start),
+	}, nil
+}
@@ -1,52 +1,220 @@
 package goscraper
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"sync/atomic"
 	"time"
 
+	"github.com/ramusaaa/goscraper/internal"
 	"github.com/ramusaaa/goscraper/pkg/stealth"
+	"go.uber.org/zap"
 )
 
 type Client struct {
 	httpClient    *http.Client
 	config        *Config
-	lastReq       time.Time
+	limiter       *rateLimiter
 	stealthClient *stealth.BotDetectionEvasion
+	proxies       []*url.URL
+	proxyIdx      uint32
+	userAgents    *stealth.UserAgentProvider
+	bans          *proxyBans
+	blocks        *blockStats
+	robots        *robotsCache
 }
 
+type proxyContextKey struct{}
+
+// ErrSlowOrigin is returned when an origin does not send its first response
+// byte within the WithMaxTimeToFirstByte limit.
+var ErrSlowOrigin = fmt.Errorf("slow origin")
+
 func NewClient(config *Config) *Client {
 	transport := &http.Transport{
 		MaxIdleConns:        100,
 		MaxIdleConnsPerHost: 10,
 		IdleConnTimeout:     90 * time.Second,
+		DisableKeepAlives:   config.DisableKeepAlives,
 	}
 
-	if config.ProxyURL != "" {
-		proxyURL, err := url.Parse(config.ProxyURL)
-		if err == nil {
-			transport.Proxy = http.ProxyURL(proxyURL)
-		}
+	if len(config.InsecureHosts) > 0 {
+		transport.TLSClientConfig = newHostAwareTLSConfig(config.InsecureHosts)
+	}
+	if config.ForceHTTP2 || config.DisableHTTP2 {
+		stealth.ConfigureHTTP2(transport, !config.DisableHTTP2)
+	}
+	if len(config.InsecureHosts) > 0 {
+		transport.DialTLSContext = hostAwareTLSDialer(transport.TLSClientConfig, config.InsecureHosts, config.TLSFingerprint)
+	} else if config.TLSFingerprint != "" {
+		transport.DialTLSContext = stealth.TLSProfileDialer(config.TLSFingerprint, transport.TLSClientConfig)
+	}
+
+	proxies := parseProxies(config)
+	if len(proxies) > 0 {
+		transport.Proxy = proxyFromContext
 	}
 
 	client := &http.Client{
 		Transport: transport,
 		Timeout:   config.Timeout,
+		Jar:       config.CookieJar,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if len(via) >= config.MaxRedirects {
-				return fmt.Errorf("stopped after %d redirects", config.MaxRedirects)
+				return fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, config.MaxRedirects)
 			}
-			return nil
+			return config.RedirectPolicy.check(req, via)
 		},
 	}
 
-	return &Client{
+	var userAgents *stealth.UserAgentProvider
+	if config.UserAgentSource != "" {
+		userAgents = stealth.NewUserAgentProvider(config.UserAgentSource, config.UserAgentRefresh)
+	}
+
+	var bans *proxyBans
+	if config.ProxyBanCooldown > 0 {
+		bans = newProxyBans(config.ProxyBanCooldown)
+	}
+
+	var c *Client
+	c = &Client{
 		httpClient:    client,
 		config:        config,
-		stealthClient: stealth.NewBotDetectionEvasion(),
+		stealthClient: stealth.NewBotDetectionEvasion(func(sc *stealth.StealthConfig) {
+			sc.DisableKeepAlives = config.DisableKeepAlives
+			sc.UserAgentProvider = userAgents
+			sc.AcceptEncoding = acceptEncoding()
+			sc.TLSProfile = config.TLSFingerprint
+			sc.TLSConfig = transport.TLSClientConfig
+			if len(config.InsecureHosts) > 0 {
+				sc.DialTLSContext = transport.DialTLSContext
+			}
+			sc.ForceHTTP2 = config.ForceHTTP2
+			sc.DisableHTTP2 = config.DisableHTTP2
+			sc.JSChallengeBypass = config.JSChallengeSolver != nil
+			sc.ChallengeSolver = config.JSChallengeSolver
+			// Stealth blocks are only recorded here, once per attempt,
+			// whether or not the stealth client gets past them.
+			sc.OnBlocked = func(resp *http.Response, body []byte) {
+				if blockType, ok := classifyBlock(resp, body); ok {
+					proxy, _ := resp.Request.Context().Value(proxyContextKey{}).(*url.URL)
+					c.recordBlock(resp, blockType, proxy)
+				}
+			}
+		}),
+		limiter:       newRateLimiter(config.RateLimit, config.RateBurst),
+		proxies:       proxies,
+		userAgents:    userAgents,
+		bans:          bans,
+		blocks:        newBlockStats(),
+	}
+	if config.RespectRobots {
+		c.robots = newRobotsCache()
+	}
+	return c
+}
+
+func (c *Client) randomUserAgent() string {
+	if c.userAgents != nil {
+		return c.userAgents.Random()
 	}
+	return stealth.RandomUserAgent()
+}
+
+func parseProxies(config *Config) []*url.URL {
+	raw := config.Proxies
+	if len(raw) == 0 && config.ProxyURL != "" {
+		raw = []string{config.ProxyURL}
+	}
+
+	var proxies []*url.URL
+	for _, p := range raw {
+		if proxyURL, err := url.Parse(p); err == nil {
+			proxies = append(proxies, proxyURL)
+		}
+	}
+	return proxies
+}
+
+// proxyFromContext lets each attempt pick its own proxy while sharing one
+// transport (and its connection pool) across the whole pool.
+func proxyFromContext(req *http.Request) (*url.URL, error) {
+	if proxyURL, ok := req.Context().Value(proxyContextKey{}).(*url.URL); ok {
+		return proxyURL, nil
+	}
+	return nil, nil
+}
+
+// nextProxy picks the next proxy in round-robin order, skipping proxies
+// banned for host. When every proxy is banned it falls back to plain
+// rotation rather than failing the request.
+func (c *Client) nextProxy(host string) *url.URL {
+	if len(c.proxies) == 0 {
+		return nil
+	}
+
+	var first *url.URL
+	for range c.proxies {
+		var idx uint32
+		if c.config.DisableProxyRotation {
+			idx = atomic.LoadUint32(&c.proxyIdx)
+		} else {
+			idx = atomic.AddUint32(&c.proxyIdx, 1) - 1
+		}
+		proxy := c.proxies[idx%uint32(len(c.proxies))]
+		if c.bans == nil || !c.bans.banned(proxy, host) {
+			return proxy
+		}
+		if c.config.DisableProxyRotation {
+			atomic.CompareAndSwapUint32(&c.proxyIdx, idx, idx+1)
+		}
+		if first == nil {
+			first = proxy
+		}
+	}
+	return first
+}
+
+// proxyFailed moves a client without proxy rotation off proxy after a
+// connection error, unless another request already has.
+func (c *Client) proxyFailed(proxy *url.URL) {
+	if !c.config.DisableProxyRotation || len(c.proxies) == 0 {
+		return
+	}
+	idx := atomic.LoadUint32(&c.proxyIdx)
+	if c.proxies[idx%uint32(len(c.proxies))] == proxy {
+		atomic.CompareAndSwapUint32(&c.proxyIdx, idx, idx+1)
+	}
+}
+
+// isProxyError reports whether err means the proxy itself could not be
+// reached, as opposed to the target site failing.
+func isProxyError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect")
+}
+
+// recordBan remembers that proxy was blocked by host.
+func (c *Client) recordBan(proxy *url.URL, host string, resp *http.Response) {
+	if c.bans != nil && proxy != nil && resp != nil && isBanResponse(resp) {
+		c.bans.ban(proxy, host)
+	}
+}
+
+// ProxyBans lists the (proxy, host) pairs currently being avoided.
+func (c *Client) ProxyBans() []ProxyBan {
+	if c.bans == nil {
+		return nil
+	}
+	return c.bans.active()
 }
 
 func (c *Client) Get(url string) (*http.Response, error) {
@@ -54,53 +222,306 @@ func (c *Client) Get(url string) (*http.Response, error) {
 }
 
 func (c *Client) GetWithContext(ctx context.Context, url string) (*http.Response, error) {
-	c.applyRateLimit()
+	return c.send(ctx, "GET", url, nil, nil)
+}
+
+// send issues a request with the configured rate limit, proxies, retries and
+// headers; headers override the configured ones and body is resent on every
+// attempt. Stealth mode only handles plain GETs, so anything else bypasses it.
+func (c *Client) send(ctx context.Context, method, url string, body []byte, headers map[string]string) (*http.Response, error) {
+	start := time.Now()
+	c.logger().Debug("Request started", zap.String("method", method), zap.String("url", url))
+
+	resp, err := c.sendWithRetries(ctx, method, url, body, headers)
+	c.logFinished(method, url, start, resp, err)
+	return resp, err
+}
 
-	if c.config.EnableStealth {
-		return c.stealthClient.MakeRequest(url)
+func (c *Client) sendWithRetries(ctx context.Context, method, url string, body []byte, headers map[string]string) (*http.Response, error) {
+	userAgent := c.config.UserAgent
+	if ua, ok := headers["User-Agent"]; ok {
+		userAgent = ua
+	}
+	if err := c.checkRobots(ctx, url, userAgent); err != nil {
+		return nil, err
+	}
+
+	waited, err := c.limiter.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if waited > 0 {
+		c.logger().Debug("Waited for rate limit", zap.String("url", url), zap.Duration("wait", waited))
+	}
+
+	if c.config.Metrics != nil {
+		defer c.config.Metrics.TrackInFlight(requestHost(url))()
+	}
+
+	if c.useStealth(method, body) {
+		return c.stealthGet(ctx, url, headers)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("User-Agent", c.config.UserAgent)
-	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	if c.config.RotateUA {
+		req.Header.Set("User-Agent", c.randomUserAgent())
+	} else {
+		req.Header.Set("User-Agent", c.config.UserAgent)
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding())
+	if referer := c.refererFor(ctx, req.URL); referer != "" {
+		req.Header.Set("Referer", referer)
+	}
 	
 	for key, value := range c.config.Headers {
 		req.Header.Set(key, value)
 	}
 
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
 	for _, cookie := range c.config.Cookies {
 		req.AddCookie(cookie)
 	}
 
+	if err := c.runRequestHooks(req); err != nil {
+		return nil, err
+	}
+
+	host := req.URL.Hostname()
+	proxy := c.nextProxy(host)
+
 	var resp *http.Response
+	attempts := 0
 	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
-		resp, err = c.httpClient.Do(req)
-		if err == nil && resp.StatusCode < 500 {
+		attempts++
+		if attempt > 0 && c.config.RotateOnRetry {
+			proxy = c.nextProxy(host)
+			req.Header.Set("User-Agent", c.randomUserAgent())
+		} else if attempt > 0 && proxy != nil && isProxyError(err) {
+			c.proxyFailed(proxy)
+			proxy = c.nextProxy(host)
+		}
+
+		attemptCtx := ctx
+		if proxy != nil {
+			attemptCtx = context.WithValue(ctx, proxyContextKey{}, proxy)
+		}
+
+		c.logAttempt(url, attempt, req.Header.Get("User-Agent"), proxy)
+		attemptReq := req.WithContext(attemptCtx)
+		if body != nil {
+			attemptReq.Body = io.NopCloser(bytes.NewReader(body))
+			attemptReq.ContentLength = int64(len(body))
+			attemptReq.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+		}
+
+		resp, err = c.do(attemptReq)
+		c.recordBan(proxy, host, resp)
+		c.observeBlock(resp, proxy)
+		if err == nil && !c.shouldRetry(resp) {
+			if err = c.checkContentType(resp); err == nil || !c.config.RotateOnRetry {
+				break
+			}
+		}
+		var policyErr *RedirectPolicyError
+		if errors.As(err, &policyErr) || errors.Is(err, ErrTooManyRedirects) {
+			// Following the same redirects again would be rejected again.
+			break
+		}
+
+		if ctx.Err() != nil {
+			// The attempt failed because the caller gave up; retrying can't help.
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+
+		if retryAfterTooLong(resp) {
 			break
 		}
 
 		if attempt < c.config.MaxRetries {
-			time.Sleep(c.config.RetryDelay * time.Duration(attempt+1))
+			c.recordRetry(host, resp, err)
+			delay := c.retryDelay(attempt, resp)
+			c.logRetry(url, attempt, resp, err, delay)
+			if resp != nil {
+				resp.Body.Close()
+				resp = nil
+			}
+			if sleepErr := internal.SleepContext(ctx, delay); sleepErr != nil {
+				return nil, sleepErr
+			}
 		}
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("request failed after %d attempts: %w", c.config.MaxRetries+1, err)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if attempts == 1 {
+			// Not retried, e.g. a rejected redirect or content type.
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+		return nil, fmt.Errorf("request failed after %d attempts: %w", attempts, err)
 	}
 
 	return resp, nil
 }
 
-func (c *Client) applyRateLimit() {
-	if c.config.RateLimit > 0 {
-		elapsed := time.Since(c.lastReq)
-		if elapsed < c.config.RateLimit {
-			time.Sleep(c.config.RateLimit - elapsed)
+// useStealth reports whether a request goes through the stealth client,
+// which only sends plain GETs.
+func (c *Client) useStealth(method string, body []byte) bool {
+	return c.config.EnableStealth && method == "GET" && body == nil
+}
+
+// checkContentType applies WithExpectedContentType to a successful response.
+// Error statuses are left alone so callers still see the real failure.
+func (c *Client) checkContentType(resp *http.Response) error {
+	if resp.StatusCode >= 400 {
+		return nil
+	}
+	return checkContentType(resp, c.config.ExpectedContentType)
+}
+
+// do sends a single attempt, aborting it with ErrSlowOrigin when
+// MaxTimeToFirstByte is set and the origin has not started responding in time.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	limit := c.config.MaxTimeToFirstByte
+	if limit <= 0 {
+		return c.httpClient.Do(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	var slow atomic.Bool
+	timer := time.AfterFunc(limit, func() {
+		slow.Store(true)
+		cancel()
+	})
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			timer.Stop()
+		},
+	}
+
+	resp, err := c.httpClient.Do(req.WithContext(httptrace.WithClientTrace(ctx, trace)))
+	if err != nil {
+		timer.Stop()
+		cancel()
+		if slow.Load() {
+			return nil, fmt.Errorf("%w: no response from %s within %s", ErrSlowOrigin, req.URL.Host, limit)
 		}
-		c.lastReq = time.Now()
+		return nil, err
 	}
-}
\ No newline at end of file
+
+	// The body is still streaming, so the attempt context may only be
+	// released once the caller is done with it.
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// stealthGet sends the request through the stealth client. It only retries
+// when RotateOnRetry is set or a proxy can't be reached, since the stealth
+// client already repeats blocked requests itself and a fresh User-Agent is
+// chosen per request.
+func (c *Client) stealthGet(ctx context.Context, rawURL string, headers map[string]string) (*http.Response, error) {
+	var host, referer string
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Hostname()
+		referer = c.refererFor(ctx, u)
+	}
+
+	// Configured headers, cookies and hooks apply on top of the stealth
+	// ones, as they do for the standard client.
+	opts := stealth.RequestOptions{
+		Referer: referer,
+		Header:  make(http.Header),
+		Cookies: c.config.Cookies,
+		Jar:     c.config.CookieJar,
+		Prepare: c.runRequestHooks,
+	}
+	for key, value := range c.config.Headers {
+		opts.Header.Set(key, value)
+	}
+	for key, value := range headers {
+		opts.Header.Set(key, value)
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
+		proxy := c.nextProxy(host)
+		c.logAttempt(rawURL, attempt, "", proxy)
+		// The proxy travels with the request for OnBlocked to report.
+		attemptCtx := ctx
+		if proxy != nil {
+			attemptCtx = context.WithValue(ctx, proxyContextKey{}, proxy)
+		}
+		opts.Proxy = proxy
+		resp, err = c.stealthClient.MakeRequestWithOptions(attemptCtx, rawURL, opts)
+		c.recordBan(proxy, host, resp)
+		if err == nil && !c.shouldRetry(resp) {
+			if err = c.checkContentType(resp); err == nil || !c.config.RotateOnRetry {
+				break
+			}
+		}
+
+		proxyDown := proxy != nil && isProxyError(err)
+		if proxyDown {
+			c.proxyFailed(proxy)
+		}
+		if (!c.config.RotateOnRetry && !proxyDown) || attempt == c.config.MaxRetries || retryAfterTooLong(resp) {
+			break
+		}
+		c.recordRetry(host, resp, err)
+
+		delay := c.retryDelay(attempt, resp)
+		c.logRetry(rawURL, attempt, resp, err, delay)
+		if resp != nil {
+			resp.Body.Close()
+			resp = nil
+		}
+		if sleepErr := internal.SleepContext(ctx, delay); sleepErr != nil {
+			return nil, sleepErr
+		}
+	}
+
+	if err != nil && resp != nil {
+		resp.Body.Close()
+		resp = nil
+	}
+	return resp, err
+}
+
+func (c *Client) shouldRetry(resp *http.Response) bool {
+	if resp.StatusCode >= 500 {
+		return true
+	}
+	// The site said when to come back.
+	if _, ok := retryAfter(resp); ok {
+		return true
+	}
+	if c.config.RotateOnRetry {
+		return resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
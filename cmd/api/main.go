@@ -9,6 +9,7 @@ import (
 	"github.com/ramusaaa/routix"
 	"github.com/ramusaaa/goscraper"
 	"github.com/ramusaaa/goscraper/config"
+	"github.com/ramusaaa/goscraper/pkg/browser"
 )
 
 type ScrapeRequest struct {
@@ -16,6 +17,11 @@ type ScrapeRequest struct {
 	Options map[string]string `json:"options,omitempty"`
 }
 
+type ScreenshotRequest struct {
+	URL      string `json:"url"`
+	FullPage bool   `json:"full_page,omitempty"`
+}
+
 type ScrapeResponse struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
@@ -24,6 +30,7 @@ type ScrapeResponse struct {
 
 type APIServer struct {
 	scraper *goscraper.GoScraper
+	browser *browser.Manager
 	config  *config.Config
 }
 
@@ -32,18 +39,36 @@ func NewAPIServer(cfg *config.Config) *APIServer {
 	
 	options = append(options, goscraper.WithStealth(cfg.Browser.Stealth))
 	options = append(options, goscraper.WithTimeout(cfg.Server.ReadTimeout))
-	options = append(options, goscraper.WithRateLimit(cfg.RateLimit.Delay))
+	if cfg.RateLimit.RequestsPerSecond > 0 {
+		options = append(options, goscraper.WithRequestsPerSecond(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.BurstSize))
+	} else {
+		options = append(options, goscraper.WithRateLimit(cfg.RateLimit.Delay))
+	}
 	
 	if cfg.Browser.UserAgent != "" {
 		options = append(options, goscraper.WithUserAgent(cfg.Browser.UserAgent))
 	}
 	
 	if cfg.Proxy.Enabled && len(cfg.Proxy.URLs) > 0 {
-		options = append(options, goscraper.WithProxy(cfg.Proxy.URLs[0]))
+		options = append(options,
+			goscraper.WithProxies(cfg.Proxy.URLs...),
+			goscraper.WithProxyRotation(cfg.Proxy.Rotation),
+		)
 	}
 
+	// Browsers are only started when a screenshot is first requested.
+	browserManager := browser.NewManager(&browser.Config{
+		Engine:         browser.EngineType(cfg.Browser.Engine),
+		Headless:       cfg.Browser.Headless,
+		UserAgent:      cfg.Browser.UserAgent,
+		ViewportWidth:  1920,
+		ViewportHeight: 1080,
+		Timeout:        cfg.Server.WriteTimeout,
+	}, cfg.Browser.PoolSize)
+
 	return &APIServer{
 		scraper: goscraper.NewGoScraper(options...),
+		browser: browserManager,
 		config:  cfg,
 	}
 }
@@ -115,6 +140,36 @@ func (s *APIServer) handleSmartScrape(ctx *routix.Context) error {
 	})
 }
 
+func (s *APIServer) handleScreenshot(ctx *routix.Context) error {
+	var req ScreenshotRequest
+	if err := ctx.ParseJSON(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ScrapeResponse{
+			Success: false,
+			Error:   "Invalid JSON",
+		})
+	}
+
+	if req.URL == "" {
+		return ctx.JSON(http.StatusBadRequest, ScrapeResponse{
+			Success: false,
+			Error:   "URL is required",
+		})
+	}
+
+	png, err := s.browser.Screenshot(ctx.Request.Context(), req.URL, req.FullPage)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, ScrapeResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	ctx.SetHeader("Content-Type", "image/png")
+	ctx.Response.WriteHeader(http.StatusOK)
+	_, err = ctx.Response.Write(png)
+	return err
+}
+
 func (s *APIServer) handleHealth(ctx *routix.Context) error {
 	return ctx.JSON(http.StatusOK, ScrapeResponse{
 		Success: true,
@@ -184,6 +239,7 @@ func main() {
 	
 	app.POST("/api/scrape", server.handleScrape)
 	app.POST("/api/smart-scrape", server.handleSmartScrape)
+	app.POST("/api/screenshot", server.handleScreenshot)
 	app.GET("/health", server.handleHealth)
 	app.GET("/config", server.handleConfig)
 
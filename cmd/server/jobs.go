@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// jobPriorities are the priority topics jobs are spread over. Jobs with any
+// other priority go to priority 0.
+var jobPriorities = []int{0, 5, 10}
+
+const (
+	// scrapeCacheTTL is how long scraped data is reused for jobs on the
+	// same URL.
+	scrapeCacheTTL = time.Hour
+
+	// maxTrackedJobs bounds how many jobs /api/v1/jobs lists.
+	maxTrackedJobs = 1000
+)
+
+// ScrapeRequest is the body of POST /api/v1/scrape. Render loads the page in
+// a browser instead of fetching it over HTTP, waiting for WaitSelector if set.
+type ScrapeRequest struct {
+	URL          string            `json:"url"`
+	Method       string            `json:"method,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Body         string            `json:"body,omitempty"`
+	Priority     int               `json:"priority,omitempty"`
+	Render       bool              `json:"render,omitempty"`
+	WaitSelector string            `json:"wait_selector,omitempty"`
+}
+
+type JobSummary struct {
+	JobID  string    `json:"job_id"`
+	Status JobStatus `json:"status"`
+}
+
+// jobTracker remembers the state of the jobs submitted to or run on this
+// node, newest last. Results themselves live in the ResultStore.
+type jobTracker struct {
+	mu     sync.Mutex
+	states map[string]JobStatus
+	order  []string
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{states: make(map[string]JobStatus)}
+}
+
+func (t *jobTracker) set(jobID string, status JobStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.states[jobID]; !ok {
+		t.order = append(t.order, jobID)
+		if len(t.order) > maxTrackedJobs {
+			delete(t.states, t.order[0])
+			t.order = t.order[1:]
+		}
+	}
+	t.states[jobID] = status
+}
+
+// list returns the tracked jobs, newest first.
+func (t *jobTracker) list() []JobSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	jobs := make([]JobSummary, 0, len(t.order))
+	for i := len(t.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, JobSummary{JobID: t.order[i], Status: t.states[t.order[i]]})
+	}
+	return jobs
+}
+
+func (t *jobTracker) counts() map[JobStatus]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := map[JobStatus]int{
+		JobStatusQueued:    0,
+		JobStatusRunning:   0,
+		JobStatusCompleted: 0,
+		JobStatusFailed:    0,
+	}
+	for _, status := range t.states {
+		counts[status]++
+	}
+	return counts
+}
+
+func newJobID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// decodeCached converts a value read back from the cache, which comes back
+// as decoded JSON, into out.
+func decodeCached(value interface{}, out interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// updateJob records a job's state both locally and in the ResultStore, so
+// other nodes can answer for it too.
+func (s *Server) updateJob(ctx context.Context, result *JobResult) error {
+	s.tracker.set(result.JobID, result.Status)
+	return s.results.Put(ctx, result)
+}
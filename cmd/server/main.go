@@ -2,15 +2,21 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/ramusaaa/goscraper"
 	"github.com/ramusaaa/goscraper/pkg/ai"
 	"github.com/ramusaaa/goscraper/pkg/browser"
 	"github.com/ramusaaa/goscraper/pkg/cache"
@@ -29,7 +35,41 @@ type Server struct {
 	browser     *browser.Manager
 	coordinator cluster.Coordinator
 	aiExtractor *ai.AIExtractor
+	results     ResultStore
+	jobs        *queue.PriorityQueue
+	tracker     *jobTracker
 	httpServer  *http.Server
+	activeJobs  atomic.Int64
+
+	// stealthScraper fetches plain GET jobs and plainScraper everything
+	// else. They are shared by all jobs so that rate limits and pooled
+	// connections carry over from one job to the next.
+	stealthScraper *goscraper.DefaultScraper
+	plainScraper   *goscraper.DefaultScraper
+}
+
+type ServerOption func(*Server)
+
+// WithJobResultStore overrides where completed job results are persisted.
+func WithJobResultStore(store ResultStore) ServerOption {
+	return func(s *Server) {
+		s.results = store
+	}
+}
+
+// WithJobQueue overrides the queue jobs are sent through, Kafka by default.
+func WithJobQueue(q queue.Queue) ServerOption {
+	return func(s *Server) {
+		s.queue = q
+	}
+}
+
+// WithCache overrides the cache shared by scraped pages and job results,
+// Redis by default.
+func WithCache(c cache.Cache) ServerOption {
+	return func(s *Server) {
+		s.cache = c
+	}
 }
 
 type Config struct {
@@ -49,6 +89,14 @@ type Config struct {
 	OpenAIKey string `json:"openai_key"`
 	
 	MetricsPort int `json:"metrics_port"`
+	
+	// ReadinessTimeout bounds each dependency check of the readiness probe.
+	ReadinessTimeout time.Duration `json:"readiness_timeout"`
+
+	// HeartbeatInterval is how often the node reports its load to the
+	// coordinator, which keeps an idle node from being reported failed.
+	// Zero means a third of cluster.DefaultNodeTTL.
+	HeartbeatInterval time.Duration `json:"heartbeat_interval"`
 }
 
 func main() {
@@ -66,14 +114,23 @@ func main() {
 		logger.Fatal("Failed to load config", zap.Error(err))
 	}
 
-	server, err := NewServer(config, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var opts []ServerOption
+	if config.PostgresURL != "" {
+		store, err := openPostgresResultStore(ctx, config.PostgresURL)
+		if err != nil {
+			logger.Fatal("Failed to open Postgres result store", zap.Error(err))
+		}
+		opts = append(opts, WithJobResultStore(store))
+	}
+
+	server, err := NewServer(config, logger, opts...)
 	if err != nil {
 		logger.Fatal("Failed to create server", zap.Error(err))
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	if err := server.Start(ctx); err != nil {
 		logger.Fatal("Failed to start server", zap.Error(err))
 	}
@@ -88,16 +145,20 @@ func main() {
 	}
 }
 
-func NewServer(config *Config, logger *zap.Logger) (*Server, error) {
+func NewServer(config *Config, logger *zap.Logger, opts ...ServerOption) (*Server, error) {
 	metrics := monitoring.NewMetrics(logger)
 
-	redisCache := cache.NewRedisCache(
-		config.RedisURL,
-		"", 
-		0,  
-		"goscraper",
-		24*time.Hour,
-	)
+	// Without Redis the cache is local to this node.
+	var sharedCache cache.Cache = cache.NewMemoryCache(24*time.Hour, 0)
+	if config.RedisURL != "" {
+		sharedCache = cache.NewRedisCache(
+			config.RedisURL,
+			"", 
+			0,  
+			"goscraper",
+			24*time.Hour,
+		)
+	}
 
 	kafkaConfig := &queue.KafkaConfig{
 		Brokers:       config.KafkaBrokers,
@@ -144,16 +205,52 @@ func NewServer(config *Config, logger *zap.Logger) (*Server, error) {
 	}
 	aiExtractor := ai.NewAIExtractor(aiConfig)
 
-	return &Server{
+	server := &Server{
 		config:      config,
 		logger:      logger,
 		metrics:     metrics,
-		cache:       redisCache,
+		cache:       sharedCache,
 		queue:       kafkaQueue,
 		browser:     browserManager,
 		coordinator: coordinator,
 		aiExtractor: aiExtractor,
-	}, nil
+		tracker:     newJobTracker(),
+
+		stealthScraper: newStealthJobScraper(),
+		plainScraper:   goscraper.New(goscraper.WithTimeout(45 * time.Second)),
+	}
+
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	server.jobs = queue.NewPriorityQueue(server.queue, jobPriorities)
+
+	if server.results == nil {
+		server.results = server.defaultResultStore()
+	}
+
+	return server, nil
+}
+
+// newStealthJobScraper returns a scraper with the settings SmartScrape
+// uses, for fetching plain GET jobs.
+func newStealthJobScraper() *goscraper.DefaultScraper {
+	return goscraper.New(
+		goscraper.WithTimeout(45*time.Second),
+		goscraper.WithStealth(true),
+		goscraper.WithUserAgentRotation(true),
+		goscraper.WithRandomHeaders(true),
+		goscraper.WithHumanDelay(true),
+		goscraper.WithRateLimit(2*time.Second),
+		goscraper.WithMaxRetries(3),
+	)
+}
+
+// defaultResultStore keeps results in the shared cache. Postgres is used
+// when main passes a PostgresResultStore with WithJobResultStore.
+func (s *Server) defaultResultStore() ResultStore {
+	return NewCacheResultStore(s.cache, 24*time.Hour)
 }
 
 func (s *Server) Start(ctx context.Context) error {
@@ -195,6 +292,7 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 
 	go s.startJobWorker(ctx)
+	go s.heartbeat(ctx)
 
 	go func() {
 		s.logger.Info("Starting HTTP server", zap.String("addr", s.httpServer.Addr))
@@ -216,11 +314,22 @@ func (s *Server) Stop(ctx context.Context) error {
 	if err := s.coordinator.UnregisterNode(ctx, s.config.NodeID); err != nil {
 		s.logger.Error("Failed to unregister node", zap.Error(err))
 	}
+	if closer, ok := s.coordinator.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			s.logger.Error("Failed to close coordinator", zap.Error(err))
+		}
+	}
 
 	if err := s.queue.Close(); err != nil {
 		s.logger.Error("Failed to close queue", zap.Error(err))
 	}
 
+	for _, scraper := range []*goscraper.DefaultScraper{s.stealthScraper, s.plainScraper} {
+		if scraper != nil {
+			scraper.Close()
+		}
+	}
+
 	return nil
 }
 
@@ -230,25 +339,103 @@ func (s *Server) setupRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/status", s.handleStatus)
 	mux.HandleFunc("/api/v1/nodes", s.handleNodes)
 	
-	mux.HandleFunc("/health", s.handleHealth)
+	// /healthz is the liveness probe; /readyz (and /health, which load
+	// balancers tend to use) only succeed while the dependencies are up.
+	ready := monitoring.ReadinessHandler(s.readinessChecks(), s.readinessTimeout())
+	mux.Handle("/healthz", monitoring.LivenessHandler())
+	mux.Handle("/readyz", ready)
+	mux.Handle("/health", ready)
 	
 	mux.Handle("/metrics", s.metrics.Handler())
 }
 
+// handleScrape queues a job for the URL and answers with its ID; poll
+// /api/v1/jobs?id=<job_id> for the result.
 func (s *Server) handleScrape(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status": "ok"}`))
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, `{"error": "method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ScrapeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" {
+		http.Error(w, `{"error": "url is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	job := &queue.ScrapingJob{
+		ID:        newJobID(),
+		URL:       req.URL,
+		Method:    req.Method,
+		Headers:   req.Headers,
+		Body:      req.Body,
+		Priority:  req.Priority,
+		CreatedAt: time.Now(),
+	}
+	if req.Render {
+		job.Metadata = map[string]interface{}{
+			"render":        true,
+			"wait_selector": req.WaitSelector,
+		}
+	}
+
+	// The job is recorded before it is queued so a fast worker can't
+	// finish it before it exists.
+	if err := s.updateJob(r.Context(), &JobResult{JobID: job.ID, URL: job.URL, Status: JobStatusQueued}); err != nil {
+		s.logger.Error("Failed to record job", zap.String("job_id", job.ID), zap.Error(err))
+		http.Error(w, `{"error": "failed to record job"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := s.jobs.Enqueue(r.Context(), job); err != nil {
+		s.logger.Error("Failed to enqueue job", zap.String("job_id", job.ID), zap.Error(err))
+		s.updateJob(r.Context(), &JobResult{JobID: job.ID, URL: job.URL, Status: JobStatusFailed, Error: err.Error(), CompletedAt: time.Now()})
+		http.Error(w, `{"error": "failed to enqueue job"}`, http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(JobSummary{JobID: job.ID, Status: JobStatusQueued})
 }
 
+// handleJobs returns one job's result with ?id=, otherwise the jobs this
+// node has seen, newest first.
 func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"jobs": []}`))
+	jobID := r.URL.Query().Get("id")
+	if jobID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"jobs": s.tracker.list()})
+		return
+	}
+
+	result, err := s.results.Get(r.Context(), jobID)
+	if err != nil {
+		if errors.Is(err, ErrResultNotFound) {
+			http.Error(w, `{"error": "job not found"}`, http.StatusNotFound)
+			return
+		}
+		s.logger.Error("Failed to load job result", zap.String("job_id", jobID), zap.Error(err))
+		http.Error(w, `{"error": "failed to load job result"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
 
+// handleStatus reports the node and how many of its jobs are in each state.
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	// Implementation IS HERE
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status": "healthy"}`))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "healthy",
+		"node_id": s.config.NodeID,
+		"jobs":    s.tracker.counts(),
+	})
 }
 
 func (s *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
@@ -257,19 +444,67 @@ func (s *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"nodes": []}`))
 }
 
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+// pinger is implemented by the cache, queue and coordinator backends that
+// can check their connection.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// readinessChecks collects the dependencies the node needs to serve traffic.
+// Backends without a Ping method are not checked.
+func (s *Server) readinessChecks() map[string]monitoring.HealthCheck {
+	checks := make(map[string]monitoring.HealthCheck)
+	for name, dependency := range map[string]interface{}{
+		"cache":       s.cache,
+		"queue":       s.queue,
+		"coordinator": s.coordinator,
+	} {
+		if p, ok := dependency.(pinger); ok {
+			checks[name] = p.Ping
+		}
+	}
+	return checks
+}
+
+func (s *Server) readinessTimeout() time.Duration {
+	if s.config.ReadinessTimeout > 0 {
+		return s.config.ReadinessTimeout
+	}
+	return 2 * time.Second
 }
 
 func (s *Server) startJobWorker(ctx context.Context) {
-	jobQueue := queue.NewJobQueue(s.queue, "scraping-jobs")
-	
-	err := jobQueue.Subscribe(ctx, func(ctx context.Context, job *queue.ScrapingJob) error {
+	err := s.jobs.Subscribe(ctx, func(ctx context.Context, job *queue.ScrapingJob) error {
 		s.logger.Info("Processing job", zap.String("job_id", job.ID))
-		
-		// Implementation IS HERE
-		
+		s.reportLoad(ctx, 1)
+		defer s.finishJob(ctx, job.ID)
+
+		if err := s.updateJob(ctx, &JobResult{JobID: job.ID, URL: job.URL, Status: JobStatusRunning}); err != nil {
+			s.logger.Warn("Failed to mark job running", zap.String("job_id", job.ID), zap.Error(err))
+		}
+
+		result := &JobResult{
+			JobID:  job.ID,
+			URL:    job.URL,
+			Status: JobStatusCompleted,
+		}
+
+		data, err := s.scrapeJob(ctx, job)
+		if err != nil {
+			result.Status = JobStatusFailed
+			result.Error = err.Error()
+			s.metrics.QueueProcessed.WithLabelValues("scraping-jobs", "failed").Inc()
+		} else {
+			result.Data = data
+			s.metrics.QueueProcessed.WithLabelValues("scraping-jobs", "completed").Inc()
+		}
+		result.CompletedAt = time.Now()
+
+		if err := s.updateJob(ctx, result); err != nil {
+			s.logger.Error("Failed to store job result", zap.String("job_id", job.ID), zap.Error(err))
+			return err
+		}
+
 		return nil
 	})
 	
@@ -278,6 +513,118 @@ func (s *Server) startJobWorker(ctx context.Context) {
 	}
 }
 
+// jobReleaser is implemented by coordinators that claim capacity on a node
+// for each job they distribute.
+type jobReleaser interface {
+	ReleaseJob(ctx context.Context, jobID string) error
+}
+
+// finishJob reports a job done: the node's load drops and the capacity the
+// coordinator claimed for the job is given back.
+func (s *Server) finishJob(ctx context.Context, jobID string) {
+	s.reportLoad(ctx, -1)
+	if releaser, ok := s.coordinator.(jobReleaser); ok {
+		if err := releaser.ReleaseJob(ctx, jobID); err != nil {
+			s.logger.Warn("Failed to release job", zap.String("job_id", jobID), zap.Error(err))
+		}
+	}
+}
+
+// reportLoad changes the number of jobs this node is running by delta and
+// tells the coordinator.
+func (s *Server) reportLoad(ctx context.Context, delta int64) {
+	load := &cluster.NodeLoad{ActiveJobs: int(s.activeJobs.Add(delta))}
+	if err := s.coordinator.UpdateNodeLoad(ctx, s.config.NodeID, load); err != nil {
+		s.logger.Warn("Failed to report node load", zap.Error(err))
+	}
+}
+
+// heartbeat reports the node's load every HeartbeatInterval until ctx is
+// done, so that its LastSeen stays fresh while no jobs finish.
+func (s *Server) heartbeat(ctx context.Context) {
+	interval := s.config.HeartbeatInterval
+	if interval <= 0 {
+		interval = cluster.DefaultNodeTTL / 3
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reportLoad(ctx, 0)
+		}
+	}
+}
+
+// scrapeJob renders jobs that ask for it in a browser, fetches plain GET
+// jobs with SmartScrape's stealth settings and sends anything with a
+// method, body or headers of its own as it is. Data from GETs is cached by
+// URL.
+func (s *Server) scrapeJob(ctx context.Context, job *queue.ScrapingJob) (*goscraper.SmartData, error) {
+	method := strings.ToUpper(job.Method)
+	render, _ := job.Metadata["render"].(bool)
+	cacheable := (method == "" || method == http.MethodGet) && job.Body == "" && len(job.Headers) == 0
+	cacheKey := "scrape:" + job.URL
+	if render {
+		cacheKey = "scrape:rendered:" + job.URL
+	}
+
+	if cacheable {
+		if item, err := s.cache.Get(ctx, cacheKey); err == nil {
+			var data goscraper.SmartData
+			if err := decodeCached(item.Value, &data); err == nil {
+				return &data, nil
+			}
+		}
+	}
+
+	data, err := s.fetchJob(ctx, job, method, render)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheable {
+		if err := s.cache.Set(ctx, cacheKey, data, scrapeCacheTTL); err != nil {
+			s.logger.Warn("Failed to cache scraped data", zap.String("url", job.URL), zap.Error(err))
+		}
+	}
+	return data, nil
+}
+
+func (s *Server) fetchJob(ctx context.Context, job *queue.ScrapingJob, method string, render bool) (*goscraper.SmartData, error) {
+	if render {
+		waitSelector, _ := job.Metadata["wait_selector"].(string)
+		resp, err := goscraper.ScrapeWithBrowser(ctx, s.browser, job.URL, waitSelector)
+		if err != nil {
+			return nil, err
+		}
+		return goscraper.NewSmartExtractor().ExtractSmart(resp), nil
+	}
+
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	scraper := s.plainScraper
+	if method == http.MethodGet && job.Body == "" && len(job.Headers) == 0 {
+		scraper = s.stealthScraper
+	}
+
+	var body io.Reader
+	if job.Body != "" {
+		body = strings.NewReader(job.Body)
+	}
+
+	resp, err := scraper.Do(ctx, method, job.URL, body, job.Headers)
+	if err != nil {
+		return nil, err
+	}
+	return goscraper.NewSmartExtractor().ExtractSmart(resp), nil
+}
+
 func loadConfig(filename string) (*Config, error) {
 	config := &Config{
 		Host:            "0.0.0.0",
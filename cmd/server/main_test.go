@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ramusaaa/goscraper/pkg/cache"
+	"github.com/ramusaaa/goscraper/pkg/cluster"
+	"github.com/ramusaaa/goscraper/pkg/queue"
+)
+
+// jsonCache is a cache.MemoryCache whose values round-trip through JSON,
+// the way they do in RedisCache.
+type jsonCache struct {
+	*cache.MemoryCache
+}
+
+func newJSONCache() jsonCache {
+	return jsonCache{cache.NewMemoryCache(time.Hour, 0)}
+}
+
+func (c jsonCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	return c.MemoryCache.Set(ctx, key, decoded, ttl)
+}
+
+func TestScrapeJobsRunThroughQueue(t *testing.T) {
+	var pageHits int32
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&pageHits, 1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Queued Page</title></head><body><p>Hello</p></body></html>`))
+	}))
+	defer site.Close()
+
+	server, err := NewServer(&Config{NodeID: "test-node", BrowserPoolSize: 1}, zap.NewNop(),
+		WithJobQueue(queue.NewMemoryQueue(0)),
+		WithCache(newJSONCache()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server.startJobWorker(ctx)
+
+	submit := func() string {
+		rec := httptest.NewRecorder()
+		server.handleScrape(rec, httptest.NewRequest(http.MethodPost, "/api/v1/scrape", strings.NewReader(`{"url": "`+site.URL+`/"}`)))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+		}
+		var summary JobSummary
+		if err := json.NewDecoder(rec.Body).Decode(&summary); err != nil || summary.JobID == "" {
+			t.Fatalf("expected a job ID, got %s (%v)", rec.Body, err)
+		}
+		return summary.JobID
+	}
+	wait := func(jobID string) *JobResult {
+		deadline := time.Now().Add(20 * time.Second)
+		for time.Now().Before(deadline) {
+			rec := httptest.NewRecorder()
+			server.handleJobs(rec, httptest.NewRequest(http.MethodGet, "/api/v1/jobs?id="+jobID, nil))
+			var result JobResult
+			if rec.Code == http.StatusOK && json.NewDecoder(rec.Body).Decode(&result) == nil &&
+				(result.Status == JobStatusCompleted || result.Status == JobStatusFailed) {
+				return &result
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("job %s did not finish", jobID)
+		return nil
+	}
+
+	first := wait(submit())
+	if first.Status != JobStatusCompleted || first.Data == nil || first.Data.Title != "Queued Page" {
+		t.Fatalf("unexpected result %+v", first)
+	}
+
+	second := wait(submit())
+	if second.Status != JobStatusCompleted || second.Data == nil || second.Data.Title != "Queued Page" {
+		t.Fatalf("unexpected cached result %+v", second)
+	}
+	if hits := atomic.LoadInt32(&pageHits); hits != 1 {
+		t.Errorf("expected the second job to be served from the cache, got %d fetches", hits)
+	}
+
+	rec := httptest.NewRecorder()
+	server.handleStatus(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	var status struct {
+		Jobs map[JobStatus]int `json:"jobs"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Jobs[JobStatusCompleted] != 2 || status.Jobs[JobStatusQueued] != 0 {
+		t.Errorf("unexpected job counts %v", status.Jobs)
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleJobs(rec, httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil))
+	var list struct {
+		Jobs []JobSummary `json:"jobs"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Jobs) != 2 || list.Jobs[0].JobID != second.JobID {
+		t.Errorf("expected both jobs newest first, got %v", list.Jobs)
+	}
+}
+
+// loadCounter is a cluster.Coordinator that only counts load reports.
+type loadCounter struct {
+	cluster.Coordinator
+	reports atomic.Int32
+}
+
+func (c *loadCounter) UpdateNodeLoad(ctx context.Context, nodeID string, load *cluster.NodeLoad) error {
+	c.reports.Add(1)
+	return nil
+}
+
+func TestIdleNodeSendsHeartbeats(t *testing.T) {
+	coordinator := &loadCounter{}
+	server := &Server{
+		config:      &Config{NodeID: "idle-node", HeartbeatInterval: 10 * time.Millisecond},
+		logger:      zap.NewNop(),
+		coordinator: coordinator,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.heartbeat(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for coordinator.reports.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if coordinator.reports.Load() < 3 {
+		t.Fatalf("expected repeated load reports without any jobs, got %d", coordinator.reports.Load())
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat did not stop with its context")
+	}
+}
+
+func TestCancelledJobStopsFetching(t *testing.T) {
+	release := make(chan struct{})
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer site.Close()
+	defer close(release)
+
+	server := &Server{config: &Config{NodeID: "test-node"}, logger: zap.NewNop(), stealthScraper: newStealthJobScraper()}
+	defer server.stealthScraper.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := server.fetchJob(ctx, &queue.ScrapingJob{URL: site.URL + "/"}, http.MethodGet, false)
+	if err == nil {
+		t.Fatal("expected the cancelled fetch to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the fetch to stop with its context, took %v", elapsed)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/ramusaaa/goscraper"
+	"github.com/ramusaaa/goscraper/pkg/cache"
+)
+
+var ErrResultNotFound = errors.New("job result not found")
+
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+type JobResult struct {
+	JobID       string               `json:"job_id"`
+	URL         string               `json:"url"`
+	Status      JobStatus            `json:"status"`
+	Data        *goscraper.SmartData `json:"data,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	CompletedAt time.Time            `json:"completed_at,omitempty"`
+}
+
+type ResultStore interface {
+	Put(ctx context.Context, result *JobResult) error
+	Get(ctx context.Context, jobID string) (*JobResult, error)
+}
+
+type CacheResultStore struct {
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+func NewCacheResultStore(c cache.Cache, ttl time.Duration) *CacheResultStore {
+	return &CacheResultStore{
+		cache: c,
+		ttl:   ttl,
+	}
+}
+
+func (s *CacheResultStore) Put(ctx context.Context, result *JobResult) error {
+	return s.cache.Set(ctx, s.key(result.JobID), result, s.ttl)
+}
+
+func (s *CacheResultStore) Get(ctx context.Context, jobID string) (*JobResult, error) {
+	item, err := s.cache.Get(ctx, s.key(jobID))
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) || errors.Is(err, cache.ErrCacheExpired) {
+			return nil, ErrResultNotFound
+		}
+		return nil, err
+	}
+
+	// Values come back from the cache as decoded JSON, so round-trip them
+	// into the concrete type.
+	data, err := json.Marshal(item.Value)
+	if err != nil {
+		return nil, fmt.Errorf("marshal cached result: %w", err)
+	}
+
+	var result JobResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal cached result: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (s *CacheResultStore) key(jobID string) string {
+	return "job-result:" + jobID
+}
+
+// postgresDriver is the database/sql driver PostgresURL is opened with, the
+// one pgx registers from its stdlib package.
+const postgresDriver = "pgx"
+
+// openPostgresResultStore connects to dsn and prepares its results table.
+func openPostgresResultStore(ctx context.Context, dsn string) (*PostgresResultStore, error) {
+	db, err := sql.Open(postgresDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres: %w", err)
+	}
+	store, err := NewPostgresResultStore(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// PostgresResultStore keeps results in a single JSONB table. The caller owns
+// the *sql.DB and is responsible for registering a Postgres driver.
+type PostgresResultStore struct {
+	db *sql.DB
+}
+
+func NewPostgresResultStore(ctx context.Context, db *sql.DB) (*PostgresResultStore, error) {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS job_results (
+			job_id       TEXT PRIMARY KEY,
+			result       JSONB NOT NULL,
+			completed_at TIMESTAMPTZ NOT NULL
+		)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job_results table: %w", err)
+	}
+
+	return &PostgresResultStore{db: db}, nil
+}
+
+func (s *PostgresResultStore) Put(ctx context.Context, result *JobResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO job_results (job_id, result, completed_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (job_id) DO UPDATE
+		SET result = EXCLUDED.result, completed_at = EXCLUDED.completed_at`,
+		result.JobID, data, result.CompletedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store job result: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresResultStore) Get(ctx context.Context, jobID string) (*JobResult, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `SELECT result FROM job_results WHERE job_id = $1`, jobID).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrResultNotFound
+		}
+		return nil, fmt.Errorf("failed to load job result: %w", err)
+	}
+
+	var result JobResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal result: %w", err)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ramusaaa/goscraper"
+)
+
+// fakePostgres is a database/sql driver that understands the statements
+// PostgresResultStore sends, keeping rows in a map.
+type fakePostgres struct {
+	mu   sync.Mutex
+	rows map[string][]byte
+}
+
+func (d *fakePostgres) Open(name string) (driver.Conn, error) {
+	return &fakeConn{db: d}, nil
+}
+
+type fakeConn struct {
+	db *fakePostgres
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: strings.Join(strings.Fields(query), " ")}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not supported") }
+
+type fakeStmt struct {
+	db    *fakePostgres
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE IF NOT EXISTS job_results"):
+	case strings.HasPrefix(s.query, "INSERT INTO job_results") && strings.Contains(s.query, "ON CONFLICT (job_id) DO UPDATE"):
+		s.db.rows[args[0].(string)] = args[1].([]byte)
+	default:
+		return nil, errors.New("unexpected statement: " + s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT result FROM job_results WHERE job_id = $1") {
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	data, ok := s.db.rows[args[0].(string)]
+	return &fakeRows{data: data, done: !ok}, nil
+}
+
+type fakeRows struct {
+	data []byte
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"result"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.data
+	return nil
+}
+
+var registerFakePostgres sync.Once
+
+func TestPostgresResultStore(t *testing.T) {
+	if _, err := openPostgresResultStore(context.Background(), "postgres://localhost/scraper"); err == nil {
+		t.Fatal("expected opening Postgres without a linked driver to fail")
+	}
+
+	fake := &fakePostgres{rows: make(map[string][]byte)}
+	registerFakePostgres.Do(func() { sql.Register("fake-postgres", fake) })
+	db, err := sql.Open("fake-postgres", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	store, err := NewPostgresResultStore(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	testResultStore(t, store)
+}
+
+func TestPostgresDriverIsLinked(t *testing.T) {
+	if !slices.Contains(sql.Drivers(), postgresDriver) {
+		t.Fatalf("expected the %q driver to be registered, got %v", postgresDriver, sql.Drivers())
+	}
+}
+
+func TestCacheResultStore(t *testing.T) {
+	testResultStore(t, NewCacheResultStore(newJSONCache(), time.Hour))
+}
+
+func testResultStore(t *testing.T, store ResultStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrResultNotFound) {
+		t.Fatalf("expected ErrResultNotFound, got %v", err)
+	}
+
+	completed := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.Put(ctx, &JobResult{JobID: "job-1", URL: "https://example.com/", Status: JobStatusRunning}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := store.Put(ctx, &JobResult{
+		JobID:       "job-1",
+		URL:         "https://example.com/",
+		Status:      JobStatusCompleted,
+		Data:        &goscraper.SmartData{Title: "Example"},
+		CompletedAt: completed,
+	}); err != nil {
+		t.Fatalf("updating a result failed: %v", err)
+	}
+
+	result, err := store.Get(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if result.Status != JobStatusCompleted || result.Data == nil || result.Data.Title != "Example" || !result.CompletedAt.Equal(completed) {
+		t.Errorf("expected the updated result, got %+v", result)
+	}
+}
@@ -2,47 +2,92 @@ package goscraper
 
 import (
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/ramusaaa/goscraper/pkg/browser"
+	"github.com/ramusaaa/goscraper/pkg/cache"
+	"github.com/ramusaaa/goscraper/pkg/monitoring"
+	"github.com/ramusaaa/goscraper/pkg/stealth"
+	"go.uber.org/zap"
 )
 
 type Config struct {
-	Timeout         time.Duration
-	MaxRedirects    int
-	UserAgent       string
-	Headers         map[string]string
-	Cookies         []*http.Cookie
+	Timeout            time.Duration
+	MaxTimeToFirstByte time.Duration
+	MaxRedirects       int
+	RedirectPolicy     RedirectPolicy
+	UserAgent          string
+	Headers            map[string]string
+	Referer            string
+	RefererPolicy      RefererPolicy
+	Cookies            []*http.Cookie
+	CookieJar          http.CookieJar
 	
 	RateLimit       time.Duration
+	RateBurst       int
 	MaxConcurrency  int
+	MemoryBudget    uint64
 	
 	MaxRetries      int
 	RetryDelay      time.Duration
+	Backoff         BackoffStrategy
+	
+	ProxyURL             string
+	Proxies              []string
+	DisableProxyRotation bool
+	RotateOnRetry        bool
+	ProxyBanCooldown     time.Duration
+	InsecureHosts        []string
+	DisableKeepAlives    bool
+	ForceHTTP2           bool
+	DisableHTTP2         bool
 	
-	ProxyURL        string
+	MaxHTMLNodes        int
+	MaxResponseSize     int64
+	ExpectedContentType string
+	HTMLPreprocessors   []HTMLPreprocessor
+	RespectRobots       bool
+	RequestHooks        []RequestHook
+	ResponseHooks       []ResponseHook
 	
 	EnableJS        bool
 	JSTimeout       time.Duration
 	
-	EnableStealth   bool
-	RotateUA        bool
-	RandomHeaders   bool
-	HumanDelay      bool
+	EnableStealth     bool
+	JSChallengeSolver stealth.ChallengeSolver
+	TLSFingerprint    string
+	RotateUA          bool
+	UserAgentSource   string
+	UserAgentRefresh  time.Duration
+	SchemaSource      string
+	SchemaRefresh     time.Duration
+	RandomHeaders     bool
+	HumanDelay        bool
+	
+	Cache    cache.Cache
+	CacheTTL time.Duration
+	
+	Logger  *zap.Logger
+	Metrics *monitoring.Metrics
 }
 
 type Option func(*Config)
 
 func DefaultConfig() *Config {
 	return &Config{
-		Timeout:        30 * time.Second,
-		MaxRedirects:   10,
-		UserAgent:      UserAgentDefault,
-		Headers:        make(map[string]string),
-		RateLimit:      100 * time.Millisecond,
-		MaxConcurrency: 10,
-		MaxRetries:     3,
-		RetryDelay:     1 * time.Second,
-		EnableJS:       false,
-		JSTimeout:      10 * time.Second,
+		Timeout:           30 * time.Second,
+		MaxRedirects:      10,
+		UserAgent:         UserAgentDefault,
+		Headers:           make(map[string]string),
+		RateLimit:         100 * time.Millisecond,
+		MaxConcurrency:    10,
+		MaxRetries:        3,
+		RetryDelay:        1 * time.Second,
+		EnableJS:          false,
+		JSTimeout:         10 * time.Second,
+		HTMLPreprocessors: []HTMLPreprocessor{FixCommonHTML},
+		MaxResponseSize:   DefaultMaxResponseSize,
 	}
 }
 
@@ -66,24 +111,107 @@ func WithHeaders(headers map[string]string) Option {
 	}
 }
 
+// WithReferer sends referer as the Referer of every request, trimmed as
+// the RefererPolicy requires. Requests the Crawler makes refer to the page
+// that linked to them instead. Stealth requests send it too, with a
+// Sec-Fetch-Site header to match.
+func WithReferer(referer string) Option {
+	return func(c *Config) {
+		c.Referer = referer
+	}
+}
+
+// WithRefererPolicy sets how much of the referring URL is sent, and to
+// which sites. The default is RefererStrictOriginWhenCrossOrigin.
+func WithRefererPolicy(policy RefererPolicy) Option {
+	return func(c *Config) {
+		c.RefererPolicy = policy
+	}
+}
+
 func WithRateLimit(delay time.Duration) Option {
 	return func(c *Config) {
 		c.RateLimit = delay
 	}
 }
 
+// WithMaxConcurrency caps how many requests GetMany and SmartScrapeMany have
+// in flight at once.
+func WithMaxConcurrency(n int) Option {
+	return func(c *Config) {
+		c.MaxConcurrency = n
+	}
+}
+
+// WithRequestsPerSecond limits requests to rps per second on average while
+// allowing bursts of up to burst back-to-back requests. It replaces the delay
+// set by WithRateLimit.
+func WithRequestsPerSecond(rps, burst int) Option {
+	return func(c *Config) {
+		c.RateLimit = 0
+		if rps > 0 {
+			c.RateLimit = time.Second / time.Duration(rps)
+		}
+		c.RateBurst = burst
+	}
+}
+
 func WithMaxRetries(retries int) Option {
 	return func(c *Config) {
 		c.MaxRetries = retries
 	}
 }
 
+// WithBackoff sets how the wait between retries grows from RetryDelay:
+// ExponentialBackoff, the default, or LinearBackoff. Either way a 429 or 503
+// response's Retry-After is waited out if it asks for longer.
+func WithBackoff(strategy BackoffStrategy) Option {
+	return func(c *Config) {
+		c.Backoff = strategy
+	}
+}
+
 func WithProxy(proxyURL string) Option {
 	return func(c *Config) {
 		c.ProxyURL = proxyURL
 	}
 }
 
+// WithProxies configures a pool of proxies that requests are spread across
+// in round-robin order. It takes precedence over WithProxy.
+func WithProxies(proxyURLs ...string) Option {
+	return func(c *Config) {
+		c.Proxies = append(c.Proxies, proxyURLs...)
+	}
+}
+
+// WithProxyRotation controls how requests use the WithProxies pool. Enabled,
+// the default, each request goes through the next proxy in turn. Disabled,
+// requests stick to one proxy and only move on when it can't be connected
+// to or is banned. Either way a connection error retries on the next proxy.
+func WithProxyRotation(enabled bool) Option {
+	return func(c *Config) {
+		c.DisableProxyRotation = !enabled
+	}
+}
+
+// WithRotateOnRetry switches to the next proxy in the pool and picks a fresh
+// User-Agent on every retry attempt, and also retries 403/429 responses.
+func WithRotateOnRetry(enabled bool) Option {
+	return func(c *Config) {
+		c.RotateOnRetry = enabled
+	}
+}
+
+// WithProxyBanDetection remembers proxies that a host answered with 403 or
+// 429 and stops using them for that host, but not for others, until cooldown
+// has passed. Current bans are reported by DefaultScraper.ProxyBans.
+func WithProxyBanDetection(cooldown time.Duration) Option {
+	return func(c *Config) {
+		c.ProxyBanCooldown = cooldown
+	}
+}
+
 func WithJavaScript(enabled bool) Option {
 	return func(c *Config) {
 		c.EnableJS = enabled
@@ -96,6 +224,35 @@ func WithStealth(enabled bool) Option {
 	}
 }
 
+// WithJSChallengeBypass lets stealth mode hand Cloudflare JS challenges to
+// solver, usually a browser.ChallengeSolver, and then carry on over plain
+// HTTP with the clearance cookies and User-Agent it obtained.
+func WithJSChallengeBypass(solver stealth.ChallengeSolver) Option {
+	return func(c *Config) {
+		c.JSChallengeSolver = solver
+	}
+}
+
+// WithChallengeSolver solves JS challenges with browsers from manager. It is
+// shorthand for WithJSChallengeBypass(browser.NewChallengeSolver(manager)).
+// Challenges are recognised by Cloudflare's headers and by the markers in
+// the challenge page itself.
+func WithChallengeSolver(manager *browser.Manager) Option {
+	return WithJSChallengeBypass(browser.NewChallengeSolver(manager))
+}
+
+// WithTLSFingerprint makes HTTPS connections with the named TLS profile so
+// that the ClientHello mimics a browser's instead of Go's:
+// stealth.TLSProfileChrome or stealth.TLSProfileFirefox, or a profile
+// registered with stealth.RegisterTLSProfile. Browser profiles speak
+// HTTP/1.1. Requests through a proxy keep Go's handshake. Requests fail
+// with stealth.ErrUnknownTLSProfile while the profile is not registered.
+func WithTLSFingerprint(profile string) Option {
+	return func(c *Config) {
+		c.TLSFingerprint = profile
+	}
+}
+
 func WithUserAgentRotation(enabled bool) Option {
 	return func(c *Config) {
 		c.RotateUA = enabled
@@ -112,4 +269,225 @@ func WithHumanDelay(enabled bool) Option {
 	return func(c *Config) {
 		c.HumanDelay = enabled
 	}
-}
\ No newline at end of file
+}
+
+// WithInsecureHosts disables TLS certificate verification for the listed
+// hosts only, e.g. internal services with self-signed certificates. Hosts
+// match exactly, ignoring case: subdomains have to be listed too. IP
+// addresses can be listed like names, but HTTPS requests to IP addresses
+// cannot be verified through a proxy and fail there.
+func WithInsecureHosts(hosts []string) Option {
+	return func(c *Config) {
+		c.InsecureHosts = append(c.InsecureHosts, hosts...)
+	}
+}
+
+// WithHTMLPreprocessor adds a function that rewrites every page's HTML
+// before it is parsed. Preprocessors run in the order they were added,
+// after FixCommonHTML. Only the parsed Document sees the rewritten HTML;
+// Response.Body holds the page as fetched.
+func WithHTMLPreprocessor(preprocess HTMLPreprocessor) Option {
+	return func(c *Config) {
+		c.HTMLPreprocessors = append(c.HTMLPreprocessors, preprocess)
+	}
+}
+
+// WithCookieString sends the cookies in s, a Cookie header value such as
+// "k1=v1; k2=v2", with every request.
+func WithCookieString(s string) Option {
+	return func(c *Config) {
+		c.Cookies = append(c.Cookies, parseCookieString(s)...)
+	}
+}
+
+// WithCookieHeader is WithCookieString for a whole header line copied from
+// a browser's developer tools, with or without the leading "Cookie:".
+func WithCookieHeader(raw string) Option {
+	raw = strings.TrimSpace(raw)
+	if name, value, ok := strings.Cut(raw, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "Cookie") {
+		raw = value
+	}
+	return WithCookieString(raw)
+}
+
+// WithCookieJar keeps the cookies responses set in jar and sends them back
+// on later requests, e.g. a jar from net/http/cookiejar. Cookies from
+// WithCookieString are sent as well. With WithStealth the jar takes the
+// place of the stealth client's per-site sessions.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c *Config) {
+		c.CookieJar = jar
+	}
+}
+
+// WithRequestHook adds a hook run on every request just before it is sent,
+// after the configured headers and cookies are set. Hooks run in the order
+// they were added, and an error aborts the request. With WithStealth they
+// run after the stealth headers are set, once per attempt.
+func WithRequestHook(hook RequestHook) Option {
+	return func(c *Config) {
+		c.RequestHooks = append(c.RequestHooks, hook)
+	}
+}
+
+// WithResponseHook adds a hook run on every Response before it is
+// returned, including ones served by WithCache. Hooks run in the order they
+// were added, and an error fails the request. A hook that rewrites Body
+// does not update Document.
+func WithResponseHook(hook ResponseHook) Option {
+	return func(c *Config) {
+		c.ResponseHooks = append(c.ResponseHooks, hook)
+	}
+}
+
+// WithRespectRobots makes every request check the site's robots.txt first.
+// Disallowed URLs fail with a *RobotsDisallowedError (ErrDisallowedByRobots)
+// without being requested, and requests to a site are spaced by its
+// Crawl-delay on top of the rate limit. robots.txt is cached per site for a
+// day and matched against the configured User-Agent.
+func WithRespectRobots(enabled bool) Option {
+	return func(c *Config) {
+		c.RespectRobots = enabled
+	}
+}
+
+// WithMaxHTMLNodes rejects documents with more than n HTML nodes with
+// ErrDocumentTooComplex. Zero means no limit.
+func WithMaxHTMLNodes(n int) Option {
+	return func(c *Config) {
+		c.MaxHTMLNodes = n
+	}
+}
+
+// WithMaxResponseSize fails responses whose body, once decompressed, is
+// larger than bytes with ErrResponseTooLarge, instead of reading all of it
+// into memory. The default is DefaultMaxResponseSize; zero means no limit.
+func WithMaxResponseSize(bytes int64) Option {
+	return func(c *Config) {
+		c.MaxResponseSize = bytes
+	}
+}
+
+// WithExpectedContentType fails responses whose Content-Type is not mime
+// with ErrUnexpectedContentType, e.g. an HTML login page returned where JSON
+// was expected. A mismatch is retried on the next proxy when
+// WithRotateOnRetry is set.
+func WithExpectedContentType(mime string) Option {
+	return func(c *Config) {
+		c.ExpectedContentType = mime
+	}
+}
+
+// WithDisableKeepAlives opens a fresh TCP/TLS connection for every request,
+// trading throughput for fewer signals that tie requests together.
+func WithDisableKeepAlives(disabled bool) Option {
+	return func(c *Config) {
+		c.DisableKeepAlives = disabled
+	}
+}
+
+// WithHTTP2 makes HTTPS connections, stealth ones included, offer HTTP/2
+// over ALPN as the browsers whose user agents are sent do, or only HTTP/1.1
+// when disabled. Without it, HTTP/2 is only used where Go's transport
+// would use it by default.
+func WithHTTP2(enabled bool) Option {
+	return func(c *Config) {
+		c.ForceHTTP2 = enabled
+		c.DisableHTTP2 = !enabled
+	}
+}
+
+// WithMaxTimeToFirstByte abandons an attempt with ErrSlowOrigin when the
+// origin has not started responding within d. Unlike WithTimeout it does not
+// limit how long the body takes to download. Slow attempts are retried, on
+// the next proxy when WithRotateOnRetry is set.
+func WithMaxTimeToFirstByte(d time.Duration) Option {
+	return func(c *Config) {
+		c.MaxTimeToFirstByte = d
+	}
+}
+
+// WithUserAgentSource loads the User-Agent rotation list from a URL or file
+// and refreshes it every interval, falling back to the built-in list until it
+// loads. It applies to WithUserAgentRotation, WithRotateOnRetry and stealth mode.
+func WithUserAgentSource(source string, interval time.Duration) Option {
+	return func(c *Config) {
+		c.UserAgentSource = source
+		c.UserAgentRefresh = interval
+	}
+}
+
+// WithSchemaSource loads the extraction schema used by
+// DefaultScraper.ExtractWithSchema from a URL or JSON file when the scraper
+// is created and refreshes it every interval. A schema that fails to load or
+// validate never replaces the one in use.
+func WithSchemaSource(source string, interval time.Duration) Option {
+	return func(c *Config) {
+		c.SchemaSource = source
+		c.SchemaRefresh = interval
+	}
+}
+
+// WithRedirectPolicy restricts which redirects are followed, e.g.
+// WithRedirectPolicy(SameHostOnly) or WithRedirectPolicy(MaxPerHost(2)).
+// Violations fail the request with a *RedirectPolicyError.
+func WithRedirectPolicy(policy RedirectPolicy) Option {
+	return func(c *Config) {
+		c.RedirectPolicy = policy
+	}
+}
+
+// WithMemoryBudget makes the scraper self-limit when the process heap nears
+// bytes: close to the budget requests run one at a time, a WithCache
+// cache.MemoryCache is cleared and the idle browsers of WithChallengeSolver
+// are closed, and once over it new requests, or responses that would not
+// fit, fail with ErrMemoryPressure. Heap usage is sampled in the background
+// until the scraper's Close is called.
+func WithMemoryBudget(bytes uint64) Option {
+	return func(c *Config) {
+		c.MemoryBudget = bytes
+	}
+}
+
+// WithCache serves GET requests from c when it holds a response for the
+// same URL and relevant headers (Accept, Accept-Language, Authorization and
+// Cookie), and stores successful responses in it for ttl. Responses marked
+// Cache-Control: no-store are not stored, and requests sending that header
+// bypass the cache. Hits and misses are recorded with WithMetrics.
+func WithCache(c cache.Cache, ttl time.Duration) Option {
+	return func(config *Config) {
+		config.Cache = c
+		config.CacheTTL = ttl
+	}
+}
+
+// WithLogger sets the logger scraper events are reported to, such as
+// requests being blocked. At debug level it also traces every request: its
+// start and outcome, each attempt with the User-Agent and proxy used,
+// retries and rate limit waits. Nothing is logged by default.
+func WithLogger(logger *zap.Logger) Option {
+	return func(c *Config) {
+		c.Logger = logger
+	}
+}
+
+// WithDebug logs scraper events, debug traces included, to stderr in a
+// human-readable format. It replaces a logger set by WithLogger.
+func WithDebug() Option {
+	return func(c *Config) {
+		logger, err := zap.NewDevelopment()
+		if err != nil {
+			return
+		}
+		c.Logger = logger
+	}
+}
+
+// WithMetrics records scraper events in metrics: every request's count,
+// duration, size and status per host, retries, requests in flight and
+// blocks. Without it nothing is recorded.
+func WithMetrics(metrics *monitoring.Metrics) Option {
+	return func(c *Config) {
+		c.Metrics = metrics
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,6 +16,8 @@ type Config struct {
 	Cache    CacheConfig    `json:"cache,omitempty"`
 	Proxy    ProxyConfig    `json:"proxy,omitempty"`
 	RateLimit RateLimitConfig `json:"rate_limit"`
+
+	validators []func(*Config) error
 }
 
 type ServerConfig struct {
@@ -182,8 +185,24 @@ func GetConfigPath() string {
 	return "goscraper.json"
 }
 
-// Validate validates the configuration
+// AddValidator registers an extra check run by Validate, for deployment
+// policies such as "a proxy is required in production"
+func (c *Config) AddValidator(validator func(*Config) error) {
+	c.validators = append(c.validators, validator)
+}
+
+// Validate validates the configuration. Errors from the built-in checks and
+// every validator added with AddValidator are reported together.
 func (c *Config) Validate() error {
+	errs := []error{c.validateBuiltin()}
+	for _, validator := range c.validators {
+		errs = append(errs, validator(c))
+	}
+	return errors.Join(errs...)
+}
+
+// validateBuiltin checks the invariants every deployment needs
+func (c *Config) validateBuiltin() error {
 	if c.AI.Enabled {
 		if len(c.AI.Models) == 0 {
 			return fmt.Errorf("AI is enabled but no models configured")
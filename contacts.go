@@ -0,0 +1,177 @@
+package goscraper
+
+import (
+	"net/mail"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+type ContactInfo struct {
+	Emails         []string        `json:"emails,omitempty"`
+	Phones         []string        `json:"phones,omitempty"`
+	Addresses      []string        `json:"addresses,omitempty"`
+	SocialProfiles []SocialProfile `json:"social_profiles,omitempty"`
+}
+
+type SocialProfile struct {
+	Network string `json:"network"`
+	URL     string `json:"url"`
+}
+
+var socialNetworks = map[string]string{
+	"facebook.com":  "facebook",
+	"fb.com":        "facebook",
+	"twitter.com":   "twitter",
+	"x.com":         "twitter",
+	"instagram.com": "instagram",
+	"linkedin.com":  "linkedin",
+}
+
+// Share and intent endpoints point at the social network, not at a profile.
+var socialSharePaths = regexp.MustCompile(`(?i)^/(sharer|share|intent|sharearticle|dialog|plugins|tr)\b`)
+
+var emailAssetSuffixes = []string{".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp"}
+
+// ExtractContacts gathers the contact details published on a page: emails
+// and phone numbers (from mailto:/tel: links, JSON-LD and the page text),
+// postal addresses (JSON-LD PostalAddress and address markup) and social
+// profile links. Every list is validated and deduplicated.
+func ExtractContacts(resp *Response) ContactInfo {
+	parser := responseParser(resp)
+	var info ContactInfo
+
+	emails := newStringSet()
+	phones := newStringSet()
+	addresses := newStringSet()
+
+	resp.Document.Find(`a[href^="mailto:"]`).Each(func(i int, s *goquery.Selection) {
+		address := strings.TrimPrefix(s.AttrOr("href", ""), "mailto:")
+		if idx := strings.Index(address, "?"); idx >= 0 {
+			address = address[:idx]
+		}
+		emails.add(validEmail(address))
+	})
+	resp.Document.Find(`a[href^="tel:"]`).Each(func(i int, s *goquery.Selection) {
+		phones.add(validPhone(strings.TrimPrefix(s.AttrOr("href", ""), "tel:")))
+	})
+
+	for _, obj := range parser.ExtractJSONLD() {
+		emails.add(validEmail(strings.TrimPrefix(jsonLDString(obj, "email"), "mailto:")))
+		phones.add(validPhone(jsonLDString(obj, "telephone")))
+		if jsonLDHasType(obj, "PostalAddress") {
+			addresses.add(jsonLDPostalAddress(obj))
+		} else if _, ok := obj["address"]; ok {
+			addresses.add(jsonLDAddress(obj))
+		}
+		for _, profile := range jsonLDStrings(obj, "sameAs") {
+			info.SocialProfiles = appendSocialProfile(info.SocialProfiles, profile)
+		}
+	}
+
+	for _, email := range extractEmails(resp.Body) {
+		emails.add(validEmail(email))
+	}
+	for _, phone := range extractPhoneNumbers(parser.doc.Find("body").Text()) {
+		phones.add(validPhone(phone))
+	}
+
+	resp.Document.Find(`address, [itemprop="address"], .h-adr, .p-adr`).Each(func(i int, s *goquery.Selection) {
+		addresses.add(strings.Join(strings.Fields(s.Text()), " "))
+	})
+
+	resp.Document.Find("a[href]").Each(func(i int, s *goquery.Selection) {
+		info.SocialProfiles = appendSocialProfile(info.SocialProfiles, resolveURL(resp.URL, s.AttrOr("href", "")))
+	})
+
+	info.Emails = emails.values
+	info.Phones = phones.values
+	info.Addresses = addresses.values
+	return info
+}
+
+func validEmail(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if unescaped, err := url.QueryUnescape(raw); err == nil {
+		raw = unescaped
+	}
+	addr, err := mail.ParseAddress(raw)
+	if err != nil || !strings.Contains(addr.Address, ".") {
+		return ""
+	}
+
+	email := strings.ToLower(addr.Address)
+	// Retina asset names such as logo@2x.png look like addresses.
+	for _, suffix := range emailAssetSuffixes {
+		if strings.HasSuffix(email, suffix) {
+			return ""
+		}
+	}
+	return email
+}
+
+// validPhone normalizes a phone number to its digits (keeping a leading +)
+// and rejects values too short or too long to be an E.164 number.
+func validPhone(raw string) string {
+	raw = strings.TrimSpace(raw)
+	var b strings.Builder
+	for i, r := range raw {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else if r == '+' && i == 0 {
+			b.WriteRune(r)
+		}
+	}
+
+	phone := b.String()
+	digits := len(strings.TrimPrefix(phone, "+"))
+	if digits < 7 || digits > 15 {
+		return ""
+	}
+	return phone
+}
+
+func appendSocialProfile(profiles []SocialProfile, link string) []SocialProfile {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return profiles
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	network, ok := socialNetworks[host]
+	if !ok || path.Clean("/"+u.Path) == "/" || socialSharePaths.MatchString(u.Path) {
+		return profiles
+	}
+
+	normalized := "https://" + host + strings.TrimSuffix(u.Path, "/")
+	for _, existing := range profiles {
+		if strings.EqualFold(existing.URL, normalized) {
+			return profiles
+		}
+	}
+	return append(profiles, SocialProfile{Network: network, URL: normalized})
+}
+
+// stringSet keeps the first occurrence of each non-empty value, comparing
+// case-insensitively.
+type stringSet struct {
+	seen   map[string]bool
+	values []string
+}
+
+func newStringSet() *stringSet {
+	return &stringSet{seen: make(map[string]bool)}
+}
+
+func (s *stringSet) add(value string) {
+	key := strings.ToLower(value)
+	if value == "" || s.seen[key] {
+		return
+	}
+	s.seen[key] = true
+	s.values = append(s.values, value)
+}
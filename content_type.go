@@ -0,0 +1,98 @@
+package goscraper
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrUnexpectedContentType is returned when WithExpectedContentType is set
+// and a response carries a different media type.
+var ErrUnexpectedContentType = errors.New("unexpected content type")
+
+// checkContentType verifies resp against the expected media type. The
+// expectation may use a wildcard subtype ("text/*"), and a structured
+// syntax suffix satisfies its base type, so "application/problem+json"
+// matches "application/json".
+func checkContentType(resp *http.Response, expected string) error {
+	if expected == "" {
+		return nil
+	}
+
+	header := resp.Header.Get("Content-Type")
+	actual, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		actual = strings.ToLower(strings.TrimSpace(header))
+	}
+	want, _, err := mime.ParseMediaType(expected)
+	if err != nil {
+		want = strings.ToLower(strings.TrimSpace(expected))
+	}
+
+	if mediaTypeMatches(actual, want) {
+		return nil
+	}
+	return fmt.Errorf("%w: got %q from %s, want %q", ErrUnexpectedContentType, header, resp.Request.URL, expected)
+}
+
+func mediaTypeMatches(actual, want string) bool {
+	if actual == want {
+		return true
+	}
+
+	wantType, wantSub, _ := strings.Cut(want, "/")
+	actualType, actualSub, _ := strings.Cut(actual, "/")
+	if wantType != actualType {
+		return false
+	}
+	if wantSub == "*" {
+		return true
+	}
+	if i := strings.LastIndex(actualSub, "+"); i >= 0 {
+		return actualSub[i+1:] == wantSub
+	}
+	return false
+}
+
+// ErrNonHTMLContent is returned instead of a parsed document when a response
+// body sniffs as binary data (an image, PDF, archive, ...) rather than text.
+// The error is a *NonHTMLContentError carrying the raw body.
+var ErrNonHTMLContent = errors.New("non-HTML content")
+
+// NonHTMLContentError reports a response that was not parsed because its
+// body is not text. Body holds the decoded bytes as received.
+type NonHTMLContentError struct {
+	URL         string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+func (e *NonHTMLContentError) Error() string {
+	return fmt.Sprintf("%s: %s sniffed as %s", ErrNonHTMLContent, e.URL, e.ContentType)
+}
+
+func (e *NonHTMLContentError) Unwrap() error {
+	return ErrNonHTMLContent
+}
+
+// sniffContentType reports the media type of body according to
+// http.DetectContentType, and whether it is text that goquery can parse
+// meaningfully: HTML, XML, JSON or any other text/* type.
+func sniffContentType(body []byte) (string, bool) {
+	detected := http.DetectContentType(body)
+	mediaType, _, err := mime.ParseMediaType(detected)
+	if err != nil {
+		mediaType = detected
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "xml"),
+		strings.HasSuffix(mediaType, "json"):
+		return detected, true
+	}
+	return detected, false
+}
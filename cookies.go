@@ -0,0 +1,13 @@
+package goscraper
+
+import (
+	"net/http"
+	"strings"
+)
+
+// parseCookieString parses the name=value pairs of a Cookie header value,
+// as copied from a browser. Malformed pairs are skipped.
+func parseCookieString(raw string) []*http.Cookie {
+	header := http.Header{"Cookie": {strings.TrimSpace(raw)}}
+	return (&http.Request{Header: header}).Cookies()
+}
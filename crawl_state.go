@@ -0,0 +1,143 @@
+package goscraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ramusaaa/goscraper/pkg/cache"
+)
+
+var ErrCrawlStateNotFound = errors.New("crawl state not found")
+
+type CrawlTarget struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+	// Referer is the page the URL was linked from, empty for the seed.
+	Referer string `json:"referer,omitempty"`
+}
+
+// CrawlState is a checkpoint of a crawl: what is left to fetch, what has
+// already been fetched and how many pages count against MaxPages.
+type CrawlState struct {
+	ID        string        `json:"id"`
+	Seed      string        `json:"seed"`
+	Frontier  []CrawlTarget `json:"frontier"`
+	Visited   []string      `json:"visited"`
+	Pages     int           `json:"pages"`
+	Done      bool          `json:"done"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+type CrawlStateStore interface {
+	Save(ctx context.Context, state *CrawlState) error
+	Load(ctx context.Context, id string) (*CrawlState, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// FileCrawlStateStore writes one JSON file per crawl into a directory.
+type FileCrawlStateStore struct {
+	dir string
+}
+
+func NewFileCrawlStateStore(dir string) *FileCrawlStateStore {
+	return &FileCrawlStateStore{dir: dir}
+}
+
+func (f *FileCrawlStateStore) Save(ctx context.Context, state *CrawlState) error {
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal crawl state: %w", err)
+	}
+
+	// Write then rename so a crash mid-checkpoint never leaves a torn file.
+	path := f.path(state.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write crawl state: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func (f *FileCrawlStateStore) Load(ctx context.Context, id string) (*CrawlState, error) {
+	data, err := os.ReadFile(f.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrCrawlStateNotFound
+		}
+		return nil, fmt.Errorf("failed to read crawl state: %w", err)
+	}
+
+	var state CrawlState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse crawl state: %w", err)
+	}
+	return &state, nil
+}
+
+func (f *FileCrawlStateStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(f.path(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *FileCrawlStateStore) path(id string) string {
+	return filepath.Join(f.dir, filepath.Base(id)+".json")
+}
+
+// CacheCrawlStateStore keeps crawl state in a cache.Cache such as
+// cache.RedisCache, so a crawl can resume on a different machine.
+type CacheCrawlStateStore struct {
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+func NewCacheCrawlStateStore(c cache.Cache, ttl time.Duration) *CacheCrawlStateStore {
+	return &CacheCrawlStateStore{
+		cache: c,
+		ttl:   ttl,
+	}
+}
+
+func (s *CacheCrawlStateStore) Save(ctx context.Context, state *CrawlState) error {
+	return s.cache.Set(ctx, s.key(state.ID), state, s.ttl)
+}
+
+func (s *CacheCrawlStateStore) Load(ctx context.Context, id string) (*CrawlState, error) {
+	item, err := s.cache.Get(ctx, s.key(id))
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) || errors.Is(err, cache.ErrCacheExpired) {
+			return nil, ErrCrawlStateNotFound
+		}
+		return nil, err
+	}
+
+	data, err := json.Marshal(item.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var state CrawlState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse crawl state: %w", err)
+	}
+	return &state, nil
+}
+
+func (s *CacheCrawlStateStore) Delete(ctx context.Context, id string) error {
+	return s.cache.Delete(ctx, s.key(id))
+}
+
+func (s *CacheCrawlStateStore) key(id string) string {
+	return "crawl-state:" + id
+}
@@ -0,0 +1,328 @@
+package goscraper
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.uber.org/zap"
+)
+
+type CrawlOptions struct {
+	// Scraper fetches every page; nil uses New() with default options.
+	Scraper Scraper
+
+	MaxDepth   int
+	MaxPages   int
+	SameDomain bool
+
+	// NextPageSelector restricts link following to anchors matching it,
+	// e.g. "a.next" for paginated listings. Empty follows every link.
+	NextPageSelector string
+	// FollowLink further filters absolute link URLs.
+	FollowLink func(link string) bool
+
+	// StateStore persists the crawl frontier so it can be resumed with
+	// ResumeCrawl. StateID names the saved state; CheckpointEvery sets how
+	// many pages are fetched between checkpoints (default 50).
+	StateStore      CrawlStateStore
+	StateID         string
+	CheckpointEvery int
+
+	// Logger receives a warning for every checkpoint StateStore fails to
+	// save, after which the crawl carries on. Nil discards them.
+	Logger *zap.Logger
+
+	// DedupWindow suppresses results whose ItemKey matches one of the last
+	// DedupWindow emitted results. ItemKey defaults to the URL the page was
+	// served from after redirects, so links redirecting to the same page
+	// are emitted once.
+	DedupWindow int
+	ItemKey     func(*CrawlResult) string
+
+	// DedupByCanonical treats pages declaring the same <link rel=canonical>
+	// as one page: once a canonical URL has been processed, other URLs
+	// pointing at it are neither emitted nor followed.
+	DedupByCanonical bool
+}
+
+type CrawlResult struct {
+	URL      string
+	Depth    int
+	Response *Response
+	Err      error
+}
+
+type Crawler struct {
+	scraper Scraper
+	opts    CrawlOptions
+}
+
+func NewCrawler(opts CrawlOptions) *Crawler {
+	scraper := opts.Scraper
+	if scraper == nil {
+		scraper = New()
+	}
+	if opts.CheckpointEvery <= 0 {
+		opts.CheckpointEvery = 50
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+
+	return &Crawler{
+		scraper: scraper,
+		opts:    opts,
+	}
+}
+
+// Crawl starts a breadth-first crawl from seed and streams every fetched
+// page. The channel is closed when the frontier is exhausted, a limit is
+// reached or ctx is cancelled.
+func (c *Crawler) Crawl(ctx context.Context, seed string) (<-chan *CrawlResult, error) {
+	seedURL, err := url.Parse(seed)
+	if err != nil || seedURL.Host == "" {
+		return nil, fmt.Errorf("invalid seed URL: %s", seed)
+	}
+
+	state := &CrawlState{
+		ID:       c.opts.StateID,
+		Seed:     seed,
+		Frontier: []CrawlTarget{{URL: normalizeCrawlURL(seedURL), Depth: 0}},
+	}
+
+	return c.run(ctx, state), nil
+}
+
+// Resume continues a crawl from the state saved under stateID.
+func (c *Crawler) Resume(ctx context.Context, stateID string) (<-chan *CrawlResult, error) {
+	if c.opts.StateStore == nil {
+		return nil, fmt.Errorf("resuming a crawl requires a StateStore")
+	}
+
+	state, err := c.opts.StateStore.Load(ctx, stateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load crawl state %s: %w", stateID, err)
+	}
+	c.opts.StateID = stateID
+
+	return c.run(ctx, state), nil
+}
+
+// ResumeCrawl loads the crawl saved under stateID from opts.StateStore and
+// continues it with the given options.
+func ResumeCrawl(ctx context.Context, stateID string, opts CrawlOptions) (<-chan *CrawlResult, error) {
+	return NewCrawler(opts).Resume(ctx, stateID)
+}
+
+func (c *Crawler) run(ctx context.Context, state *CrawlState) <-chan *CrawlResult {
+	results := make(chan *CrawlResult)
+
+	go func() {
+		defer close(results)
+
+		visited := make(map[string]bool, len(state.Visited))
+		for _, u := range state.Visited {
+			visited[u] = true
+		}
+		queued := make(map[string]bool, len(state.Frontier))
+		for _, target := range state.Frontier {
+			queued[target.URL] = true
+		}
+
+		seedHost := ""
+		if seedURL, err := url.Parse(state.Seed); err == nil {
+			seedHost = strings.TrimPrefix(seedURL.Hostname(), "www.")
+		}
+
+		var dedup *DedupWindow
+		if c.opts.DedupWindow > 0 {
+			dedup = NewDedupWindow(c.opts.DedupWindow)
+		}
+
+		sinceCheckpoint := 0
+		for len(state.Frontier) > 0 {
+			if c.opts.MaxPages > 0 && state.Pages >= c.opts.MaxPages {
+				break
+			}
+			if ctx.Err() != nil {
+				c.checkpoint(state)
+				return
+			}
+
+			// The target stays in the frontier until its result is delivered
+			// and its links are queued, so a checkpoint taken when the crawl
+			// is cancelled half way through a page still holds it.
+			target := state.Frontier[0]
+			if visited[target.URL] {
+				popTarget(state, queued)
+				continue
+			}
+
+			fetchCtx := ctx
+			if target.Referer != "" {
+				fetchCtx = ContextWithReferer(ctx, target.Referer)
+			}
+			resp, err := c.scraper.GetWithContext(fetchCtx, target.URL)
+			if ctx.Err() != nil {
+				c.checkpoint(state)
+				return
+			}
+			result := &CrawlResult{URL: target.URL, Depth: target.Depth, Response: resp, Err: err}
+
+			canonical := ""
+			if err == nil && c.opts.DedupByCanonical {
+				if canonical = canonicalURL(resp); canonical == target.URL {
+					canonical = ""
+				}
+			}
+
+			if canonical == "" || !visited[canonical] {
+				if key := c.itemKey(result); dedup == nil || key == "" || !dedup.Seen(key) {
+					select {
+					case results <- result:
+					case <-ctx.Done():
+						c.checkpoint(state)
+						return
+					}
+				}
+
+				if err == nil && (c.opts.MaxDepth <= 0 || target.Depth < c.opts.MaxDepth) {
+					for _, link := range c.links(resp) {
+						if visited[link] || queued[link] || !c.follow(link, seedHost) {
+							continue
+						}
+						queued[link] = true
+						state.Frontier = append(state.Frontier, CrawlTarget{URL: link, Depth: target.Depth + 1, Referer: finalURL(resp)})
+					}
+				}
+			}
+
+			popTarget(state, queued)
+			visited[target.URL] = true
+			state.Visited = append(state.Visited, target.URL)
+			state.Pages++
+			if canonical != "" && !visited[canonical] {
+				visited[canonical] = true
+				state.Visited = append(state.Visited, canonical)
+			}
+
+			sinceCheckpoint++
+			if sinceCheckpoint >= c.opts.CheckpointEvery {
+				c.checkpoint(state)
+				sinceCheckpoint = 0
+			}
+		}
+
+		// A crawl stopped by MaxPages can still be resumed.
+		state.Done = len(state.Frontier) == 0
+		c.checkpoint(state)
+	}()
+
+	return results
+}
+
+// popTarget removes the first target from the frontier.
+func popTarget(state *CrawlState, queued map[string]bool) {
+	delete(queued, state.Frontier[0].URL)
+	state.Frontier = state.Frontier[1:]
+}
+
+func (c *Crawler) itemKey(result *CrawlResult) string {
+	if c.opts.ItemKey != nil {
+		return c.opts.ItemKey(result)
+	}
+	if result.Response != nil {
+		if u, err := url.Parse(finalURL(result.Response)); err == nil {
+			return normalizeCrawlURL(u)
+		}
+	}
+	return result.URL
+}
+
+func (c *Crawler) links(resp *Response) []string {
+	if resp == nil || resp.Document == nil {
+		return nil
+	}
+
+	selector := "a[href]"
+	if c.opts.NextPageSelector != "" {
+		selector = c.opts.NextPageSelector
+	}
+
+	var links []string
+	base := responseParser(resp).BaseURL()
+	resp.Document.Find(selector).Each(func(i int, s *goquery.Selection) {
+		href, exists := s.Attr("href")
+		if !exists {
+			return
+		}
+		u, err := url.Parse(resolveURL(base, href))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		links = append(links, normalizeCrawlURL(u))
+	})
+	return links
+}
+
+func (c *Crawler) follow(link, seedHost string) bool {
+	if c.opts.SameDomain {
+		u, err := url.Parse(link)
+		if err != nil || strings.TrimPrefix(u.Hostname(), "www.") != seedHost {
+			return false
+		}
+	}
+	if c.opts.FollowLink != nil && !c.opts.FollowLink(link) {
+		return false
+	}
+	return true
+}
+
+func (c *Crawler) checkpoint(state *CrawlState) {
+	if c.opts.StateStore == nil || c.opts.StateID == "" {
+		return
+	}
+	state.ID = c.opts.StateID
+	state.UpdatedAt = time.Now()
+
+	// Checkpoints are best-effort and must not be skipped just because the
+	// crawl context was cancelled, which is exactly when they matter most.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.opts.StateStore.Save(ctx, state); err != nil {
+		c.opts.Logger.Warn("Failed to checkpoint crawl",
+			zap.String("state_id", state.ID),
+			zap.Int("pages", state.Pages),
+			zap.Error(err),
+		)
+	}
+}
+
+// canonicalURL returns the page's absolute, normalized canonical URL.
+func canonicalURL(resp *Response) string {
+	if resp == nil || resp.Document == nil {
+		return ""
+	}
+
+	parser := responseParser(resp)
+	href := parser.ExtractCanonical()
+	if href == "" {
+		return ""
+	}
+	u, err := url.Parse(resolveURL(parser.BaseURL(), href))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return normalizeCrawlURL(u)
+}
+
+func normalizeCrawlURL(u *url.URL) string {
+	normalized := *u
+	normalized.Fragment = ""
+	normalized.Host = strings.ToLower(normalized.Host)
+	return normalized.String()
+}
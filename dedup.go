@@ -0,0 +1,84 @@
+package goscraper
+
+import "context"
+
+// DedupWindow remembers the last size keys it has seen. Older keys are
+// forgotten, so memory stays bounded however long a stream runs.
+type DedupWindow struct {
+	size int
+	keys []string
+	next int
+	seen map[string]int
+}
+
+func NewDedupWindow(size int) *DedupWindow {
+	if size <= 0 {
+		size = 1
+	}
+	return &DedupWindow{
+		size: size,
+		keys: make([]string, 0, size),
+		seen: make(map[string]int, size),
+	}
+}
+
+// Seen reports whether key is in the window and records it if not.
+func (w *DedupWindow) Seen(key string) bool {
+	if w.seen[key] > 0 {
+		return true
+	}
+
+	if len(w.keys) < w.size {
+		w.keys = append(w.keys, key)
+	} else {
+		evicted := w.keys[w.next]
+		if w.seen[evicted]--; w.seen[evicted] <= 0 {
+			delete(w.seen, evicted)
+		}
+		w.keys[w.next] = key
+		w.next = (w.next + 1) % w.size
+	}
+	w.seen[key]++
+	return false
+}
+
+func (w *DedupWindow) Size() int {
+	return w.size
+}
+
+// DedupStream forwards values from in, dropping any whose key was among the
+// last window keys seen. Values with an empty key are always forwarded. The
+// returned channel is closed once in is closed or ctx is done, so a consumer
+// that stops reading should cancel ctx.
+func DedupStream[T any](ctx context.Context, in <-chan T, window int, key func(T) string) <-chan T {
+	out := make(chan T)
+
+	go func() {
+		defer close(out)
+
+		seen := NewDedupWindow(window)
+		for {
+			var v T
+			select {
+			case next, ok := <-in:
+				if !ok {
+					return
+				}
+				v = next
+			case <-ctx.Done():
+				return
+			}
+
+			if k := key(v); k != "" && seen.Seen(k) {
+				continue
+			}
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
@@ -1,7 +1,17 @@
 package goscraper
 
 import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
 )
 
 type ContentType string
@@ -100,42 +110,286 @@ func NewContentDetector() *ContentDetector {
 	}
 }
 
+// Weights of the places a keyword can appear. The title, meta tags and URL
+// describe the page itself, while class names and body text also cover
+// navigation, footers and widgets, so they count for less.
+const (
+	domainWeight = 10.0
+	metaWeight   = 3.0
+	urlWeight    = 4.0
+	markupWeight = 1.0
+
+	// markupCap limits how often one keyword counts in class names and ids,
+	// which a listing repeats for every card.
+	markupCap = 5
+
+	// bodyWords is the page length up to which body keywords count fully;
+	// on longer pages they are scaled down by length.
+	bodyWords = 500
+
+	// minContentScore is the evidence needed to classify a page at all.
+	minContentScore = 3.0
+)
+
+// contentTypeOrder fixes the order in which candidates are compared, so ties
+// are broken the same way every time.
+var contentTypeOrder = []ContentType{
+	ContentTypeEcommerce, ContentTypeNews, ContentTypeBlog, ContentTypeSocialMedia, ContentTypeVideo,
+	ContentTypeJob, ContentTypeRealEstate, ContentTypeRecipe, ContentTypeEvent,
+}
+
+// secondaryContentRatio is how close, relative to the best candidate, the
+// runner-up of DetectContentTypes must score for ExtractSmart to run its
+// extractor too, as on a news article that is also a product review.
+const secondaryContentRatio = 0.8
+
+// ContentTypeScore is one candidate classification of a page with its
+// confidence from 0 to 1.
+type ContentTypeScore struct {
+	Type  ContentType `json:"type"`
+	Score float64     `json:"score"`
+}
+
 func (cd *ContentDetector) DetectContentType(url, html string) ContentType {
-	domain := extractDomainFromURL(url)
-	
+	contentType, _ := cd.DetectContentTypeWithConfidence(url, html)
+	return contentType
+}
+
+// DetectContentTypeWithConfidence returns the best candidate of
+// DetectContentTypes.
+func (cd *ContentDetector) DetectContentTypeWithConfidence(url, html string) (ContentType, float64) {
+	candidates, err := cd.DetectContentTypes(url, html)
+	if err != nil {
+		return ContentTypeGeneral, 0
+	}
+	return candidates[0].Type, candidates[0].Score
+}
+
+// DetectContentTypes ranks the content types a page could be, best first.
+// The list is never empty. A schema.org type declared in JSON-LD or
+// microdata scores 0.95 and og:type 0.85; other candidates score by their
+// keywords, weighed by where on the page they appear, with the site's
+// domain counting most. ContentTypeGeneral leads when no candidate has
+// enough evidence. Hybrid pages, like a news article that is also a
+// product review, have more than one high-scoring candidate.
+func (cd *ContentDetector) DetectContentTypes(url, html string) ([]ContentTypeScore, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	return cd.rankContentTypes(url, NewParser(doc)), nil
+}
+
+func (cd *ContentDetector) rankContentTypes(url string, p *Parser) []ContentTypeScore {
+	// Product pages of shops with registered selectors are known to be
+	// e-commerce, whatever else they mention.
+	if registeredProductPage(url, p) {
+		return []ContentTypeScore{{Type: ContentTypeEcommerce, Score: 0.95}}
+	}
+
+	keywords := cd.keywordScores(url, p.doc)
+
+	// strength grows with the evidence for a type; its share of all
+	// evidence says how clearly it wins.
+	strength := func(score float64) float64 {
+		return score / (score + 5)
+	}
+	var top, total float64
+	for _, score := range keywords {
+		total += score
+		top = math.Max(top, score)
+	}
+	scores := make(map[ContentType]float64)
+	for contentType, score := range keywords {
+		if score > 0 {
+			scores[contentType] = strength(score) * score / total
+		}
+	}
+
+	declared := structuredContentTypes(p)
+	for _, contentType := range declared {
+		scores[contentType] = 0.95
+	}
+	if contentType := openGraphContentType(p, keywords); contentType != "" {
+		declared = append(declared, contentType)
+		scores[contentType] = math.Max(scores[contentType], 0.85)
+	}
+	if len(declared) == 0 && top < minContentScore {
+		scores[ContentTypeGeneral] = 1 - strength(top)
+	}
+	// A page that says what it is leaves keywords only a hint at what else
+	// it might be.
+	if len(declared) > 0 {
+		for contentType := range scores {
+			if !slices.Contains(declared, contentType) {
+				scores[contentType] /= 2
+			}
+		}
+	}
+
+	candidates := make([]ContentTypeScore, 0, len(scores))
+	for _, contentType := range append([]ContentType{ContentTypeGeneral}, contentTypeOrder...) {
+		if score, ok := scores[contentType]; ok {
+			candidates = append(candidates, ContentTypeScore{Type: contentType, Score: score})
+		}
+	}
+	// Ties, as between two declared types, go to the type with more keyword
+	// evidence.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return keywords[candidates[i].Type] > keywords[candidates[j].Type]
+	})
+	return candidates
+}
+
+// registeredProductPage reports whether the selectors registered for the
+// page's domain find a product with a name and a price on it.
+func registeredProductPage(pageURL string, p *Parser) bool {
+	selectors, ok := registeredProductSelectors(strings.ToLower(extractDomainFromURL(pageURL)))
+	if !ok || selectors.Name == "" || selectors.Price == "" {
+		return false
+	}
+	return p.doc.Find(selectors.Name).Length() > 0 && p.doc.Find(selectors.Price).Length() > 0
+}
+
+// structuredContentTypes returns the content types of the page-level
+// schema.org types declared in JSON-LD or microdata.
+func structuredContentTypes(p *Parser) []ContentType {
+	objects := p.ExtractJSONLD()
+	itemTypes := p.ExtractAttrs("[itemtype]", "itemtype")
+
+	var types []ContentType
+	seen := make(map[ContentType]bool)
+	for _, candidate := range jsonLDContentTypes {
+		declared := false
+		for _, obj := range objects {
+			declared = declared || jsonLDHasType(obj, candidate.schemaType)
+		}
+		for _, itemType := range itemTypes {
+			declared = declared || strings.HasSuffix(strings.ToLower(itemType), "/"+strings.ToLower(candidate.schemaType))
+		}
+		if declared && !seen[candidate.contentType] {
+			seen[candidate.contentType] = true
+			types = append(types, candidate.contentType)
+		}
+	}
+	return types
+}
+
+// openGraphContentType maps og:type to a content type. Open Graph has no
+// separate type for blog posts, so an article is a blog post only when the
+// keywords say so.
+func openGraphContentType(p *Parser, scores map[ContentType]float64) ContentType {
+	ogType := strings.ToLower(strings.TrimSpace(p.ExtractAttr(`meta[property="og:type"], meta[name="og:type"]`, "content")))
+	switch {
+	case ogType == "product" || strings.HasPrefix(ogType, "product."):
+		return ContentTypeEcommerce
+	case strings.HasPrefix(ogType, "video"):
+		return ContentTypeVideo
+	case ogType == "profile":
+		return ContentTypeSocialMedia
+	case ogType == "article":
+		if scores[ContentTypeBlog] > scores[ContentTypeNews] {
+			return ContentTypeBlog
+		}
+		return ContentTypeNews
+	}
+	return ""
+}
+
+// keywordScores weighs the keywords of every content type found in the
+// domain, title and meta tags, URL path, class names and visible text.
+func (cd *ContentDetector) keywordScores(pageURL string, doc *goquery.Document) map[ContentType]float64 {
+	scores := make(map[ContentType]float64)
+
+	domain := strings.ToLower(extractDomainFromURL(pageURL))
 	for contentType, domains := range cd.domains {
 		for _, d := range domains {
-			if strings.Contains(strings.ToLower(domain), d) {
-				return contentType
+			if strings.Contains(domain, strings.ToLower(d)) {
+				scores[contentType] += domainWeight
+				break
 			}
 		}
 	}
-	
-	htmlLower := strings.ToLower(html)
-	scores := make(map[ContentType]int)
-	
+
+	meta := []string{doc.Find("title").First().Text()}
+	doc.Find(`meta[name="description"], meta[name="keywords"], meta[property="og:title"], meta[property="og:description"], meta[property="og:site_name"]`).Each(func(i int, s *goquery.Selection) {
+		meta = append(meta, s.AttrOr("content", ""))
+	})
+	metaText := strings.ToLower(strings.Join(meta, " "))
+
+	var path string
+	if u, err := url.Parse(pageURL); err == nil {
+		path = strings.ToLower(u.Path)
+	}
+
+	var markup []string
+	doc.Find("[class], [id]").Each(func(i int, s *goquery.Selection) {
+		markup = append(markup, s.AttrOr("class", ""), s.AttrOr("id", ""))
+	})
+	markupText := strings.ToLower(strings.Join(markup, " "))
+
+	var body strings.Builder
+	for _, n := range doc.Find("body").Nodes {
+		writeVisibleText(&body, n)
+	}
+	bodyText := strings.ToLower(body.String())
+	bodyScale := 1.0
+	if words := len(strings.Fields(bodyText)); words > bodyWords {
+		bodyScale = bodyWords / float64(words)
+	}
+
 	for contentType, patterns := range cd.patterns {
 		for _, pattern := range patterns {
-			count := strings.Count(htmlLower, pattern)
-			scores[contentType] += count
+			scores[contentType] += metaWeight*float64(countWord(metaText, pattern)) +
+				urlWeight*float64(countWord(path, pattern)) +
+				markupWeight*float64(min(countWord(markupText, pattern), markupCap)) +
+				bodyScale*float64(countWord(bodyText, pattern))
 		}
 	}
-	
-	maxScore := 0
-	detectedType := ContentTypeGeneral
-	
-	for contentType, score := range scores {
-		if score > maxScore {
-			maxScore = score
-			detectedType = contentType
-		}
+
+	return scores
+}
+
+// writeVisibleText writes the text of n and its descendants, leaving out
+// scripts, styles and other content that is never displayed.
+func writeVisibleText(b *strings.Builder, n *html.Node) {
+	switch {
+	case n.Type == html.TextNode:
+		b.WriteString(n.Data)
+		b.WriteByte(' ')
+		return
+	case n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style" || n.Data == "noscript" || n.Data == "template"):
+		return
 	}
-	
-	if maxScore < 3 {
-		return ContentTypeGeneral
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeVisibleText(b, c)
+	}
+}
+
+// countWord counts the occurrences of word in text that are not part of a
+// longer word, so that "post" matches "post-meta" but not "postal".
+func countWord(text, word string) int {
+	count := 0
+	for i := 0; ; {
+		j := strings.Index(text[i:], word)
+		if j < 0 {
+			return count
+		}
+		start, end := i+j, i+j+len(word)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			count++
+		}
+		i = end
 	}
-	
-	return detectedType
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
 func extractDomainFromURL(url string) string {
@@ -152,6 +406,7 @@ func extractDomainFromURL(url string) string {
 
 type SmartExtractor struct {
 	detector *ContentDetector
+	hook     ExtractionHook
 }
 
 func NewSmartExtractor() *SmartExtractor {
@@ -161,39 +416,82 @@ func NewSmartExtractor() *SmartExtractor {
 }
 
 func (se *SmartExtractor) ExtractSmart(resp *Response) *SmartData {
-	contentType := se.detector.DetectContentType(resp.URL, resp.Body)
-	parser := NewParser(resp.Document)
+	parser := responseParser(resp)
+	candidates := se.detector.rankContentTypes(resp.URL, parser)
+	// Structured data says what the page is; the heuristics only guess.
+	contentType := jsonLDContentType(parser)
+	if contentType == "" {
+		contentType = candidates[0].Type
+	}
 	
 	baseData := &SmartData{
-		URL:         resp.URL,
-		ContentType: contentType,
-		Title:       parser.ExtractTitle(),
-		Description: getMetaDescription(parser),
-		Images:      parser.ExtractImages(),
-		Links:       parser.ExtractLinks(),
-		MetaTags:    parser.ExtractMetaTags(),
+		URL:          resp.URL,
+		ContentType:  contentType,
+		Title:        parser.ExtractTitle(),
+		Description:  getMetaDescription(parser),
+		Images:       smartImages(parser),
+		Links:        parser.ExtractLinks(),
+		MetaTags:     parser.ExtractMetaTags(),
+		ContentTypes: candidates,
+	}
+	
+	baseData.Paywalled, _ = parser.DetectPaywall()
+	
+	// JSON-LD is preferred field by field; selector results fill the gaps.
+	sources := make(map[string]string)
+	se.extractContent(contentType, parser, resp, baseData, sources)
+	
+	// Hybrid pages also get the extractor of the runner-up when it scores
+	// close to the best candidate.
+	for _, candidate := range candidates[:min(2, len(candidates))] {
+		if candidate.Type != contentType && candidate.Score >= candidates[0].Score*secondaryContentRatio {
+			se.extractContent(candidate.Type, parser, resp, baseData, sources)
+			break
+		}
+	}
+	
+	if len(sources) > 0 {
+		baseData.FieldSources = sources
 	}
 	
+	se.reportExtraction(baseData)
+	
+	return baseData
+}
+
+// smartImages lists the page's images and og:image previews, falling back
+// to the Twitter card image when there are neither.
+func smartImages(parser *Parser) []Image {
+	images := mergeImages(parser.ExtractImages(), parser.extractMetaImages())
+	if len(images) == 0 {
+		if image := parser.ExtractTwitterCard().Image; image != "" {
+			images = append(images, Image{URL: image})
+		}
+	}
+	return images
+}
+
+// extractContent runs the extractor for contentType, filling its field of
+// data.
+func (se *SmartExtractor) extractContent(contentType ContentType, parser *Parser, resp *Response, data *SmartData, sources map[string]string) {
 	switch contentType {
 	case ContentTypeEcommerce:
-		baseData.Products = se.extractProducts(parser, resp.URL)
+		data.Products = mergeProducts(productsFromJSONLD(parser, resp.URL), se.extractProducts(parser, resp.URL), sources)
 	case ContentTypeNews:
-		baseData.Article = se.extractArticle(parser)
+		data.Article = mergeSources(articleFromJSONLD(parser), se.extractArticle(parser), "article", sources)
 	case ContentTypeBlog:
-		baseData.BlogPost = se.extractBlogPost(parser)
+		data.BlogPost = mergeSources(blogPostFromJSONLD(parser), se.extractBlogPost(parser), "blog_post", sources)
 	case ContentTypeJob:
-		baseData.JobListing = se.extractJobListing(parser)
+		data.JobListing = mergeSources(jobListingFromJSONLD(parser), se.extractJobListing(parser), "job_listing", sources)
 	case ContentTypeRealEstate:
-		baseData.Property = se.extractProperty(parser)
+		data.Property = mergeSources(nil, se.extractProperty(parser), "property", sources)
 	case ContentTypeRecipe:
-		baseData.Recipe = se.extractRecipe(parser)
+		data.Recipe = mergeSources(recipeFromJSONLD(parser), se.extractRecipe(parser), "recipe", sources)
 	case ContentTypeEvent:
-		baseData.Event = se.extractEvent(parser)
+		data.Event = mergeSources(eventFromJSONLD(parser), se.extractEvent(parser), "event", sources)
 	case ContentTypeVideo:
-		baseData.Video = se.extractVideo(parser)
+		data.Video = mergeSources(videoFromJSONLD(parser), se.extractVideo(parser), "video", sources)
 	}
-	
-	return baseData
 }
 
 type SmartData struct {
@@ -204,6 +502,11 @@ type SmartData struct {
 	Images      []Image     `json:"images"`
 	Links       []Link      `json:"links"`
 	MetaTags    map[string]string `json:"meta_tags"`
+	Paywalled   bool              `json:"paywalled"`
+	FieldSources map[string]string `json:"field_sources,omitempty"`
+	// ContentTypes ranks the content types the page could be, best first;
+	// see ContentDetector.DetectContentTypes.
+	ContentTypes []ContentTypeScore `json:"content_types,omitempty"`
 	
 	Products    []SmartProduct    `json:"products,omitempty"`
 	Article     *Article          `json:"article,omitempty"`
@@ -220,6 +523,7 @@ type SmartProduct struct {
 	Price       string   `json:"price"`
 	OriginalPrice string `json:"original_price,omitempty"`
 	Currency    string   `json:"currency,omitempty"`
+	Prices      []PriceValue `json:"prices,omitempty"`
 	Brand       string   `json:"brand,omitempty"`
 	Rating      string   `json:"rating,omitempty"`
 	Reviews     string   `json:"reviews,omitempty"`
@@ -227,6 +531,18 @@ type SmartProduct struct {
 	URL         string   `json:"url,omitempty"`
 	InStock     bool     `json:"in_stock"`
 	Features    []string `json:"features,omitempty"`
+	// GTIN holds a check-digit-validated EAN/UPC/ISBN, normalized by
+	// NormalizeGTIN. SKU is the retailer's code, MPN the manufacturer's.
+	GTIN        string   `json:"gtin,omitempty"`
+	SKU         string   `json:"sku,omitempty"`
+	MPN         string   `json:"mpn,omitempty"`
+}
+
+// PriceValue is one amount/currency pair shown for a product, e.g. when a
+// site lists the same item in several currencies.
+type PriceValue struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
 }
 
 type Article struct {
@@ -307,4 +623,8 @@ type Video struct {
 	PublishDate string `json:"publish_date,omitempty"`
 	Thumbnail   string `json:"thumbnail,omitempty"`
 	URL         string `json:"url,omitempty"`
+	// EmbedURL is the page of an embeddable player for the video.
+	EmbedURL    string   `json:"embed_url,omitempty"`
+	Sources     []string `json:"sources,omitempty"`
+	Subtitles   []string `json:"subtitles,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,342 @@
+package goscraper
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrChecksumMismatch is returned by DownloadFile when the downloaded file
+// does not match DownloadOptions.Checksum. The partial file is removed.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+const defaultChunkSize = 8 << 20
+
+type DownloadOptions struct {
+	// Concurrency fetches the file in this many parallel Range requests when
+	// the server supports them. Values below 2 download sequentially.
+	Concurrency int
+	// ChunkSize is the size of each Range request in concurrent mode
+	// (default 8 MiB).
+	ChunkSize int64
+	// Resume continues from a previous partial download of destPath instead
+	// of starting over.
+	Resume bool
+	// Checksum verifies the finished file, written as "algorithm:hex" with
+	// md5, sha1, sha256 or sha512, e.g. "sha256:9f86d0...".
+	Checksum string
+	// Progress is called as bytes arrive with the bytes written so far and
+	// the total size, which is -1 when the server does not report it.
+	Progress func(written, total int64)
+}
+
+// downloadState is persisted next to a concurrent download so that an
+// interrupted download only refetches unfinished chunks.
+type downloadState struct {
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunk_size"`
+	Done      []bool `json:"done"`
+}
+
+// DownloadFile saves url to destPath using the scraper's proxies, headers,
+// rate limit and retries. The data is written to destPath+".part" and only
+// renamed into place once complete and verified.
+func (s *DefaultScraper) DownloadFile(ctx context.Context, url, destPath string, opts DownloadOptions) error {
+	if err := s.memory.admit(); err != nil {
+		return err
+	}
+
+	partPath := destPath + ".part"
+	statePath := destPath + ".part.json"
+
+	if !opts.Resume {
+		os.Remove(partPath)
+		os.Remove(statePath)
+	}
+
+	size, ranges := s.probeDownload(ctx, url)
+
+	var err error
+	if opts.Concurrency > 1 && ranges && size > 0 {
+		err = s.downloadChunks(ctx, url, partPath, statePath, size, opts)
+	} else {
+		err = s.downloadSequential(ctx, url, partPath, size, ranges, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Checksum != "" {
+		if err := verifyChecksum(partPath, opts.Checksum); err != nil {
+			os.Remove(partPath)
+			os.Remove(statePath)
+			return err
+		}
+	}
+
+	os.Remove(statePath)
+	return os.Rename(partPath, destPath)
+}
+
+// probeDownload asks for the size of the resource and whether the server
+// honours Range requests. Failures are not fatal; the download then simply
+// proceeds sequentially.
+func (s *DefaultScraper) probeDownload(ctx context.Context, url string) (int64, bool) {
+	resp, err := s.client.send(ctx, "HEAD", url, nil, map[string]string{"Accept-Encoding": "identity"})
+	if err != nil {
+		return -1, false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return -1, false
+	}
+	return resp.ContentLength, strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes")
+}
+
+func (s *DefaultScraper) downloadSequential(ctx context.Context, url, partPath string, size int64, ranges bool, opts DownloadOptions) error {
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", partPath, err)
+	}
+	defer file.Close()
+
+	var offset int64
+	if info, err := file.Stat(); err == nil && ranges {
+		offset = info.Size()
+	}
+	if size > 0 && offset == size {
+		return nil
+	}
+
+	headers := map[string]string{"Accept-Encoding": "identity"}
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	}
+
+	resp, err := s.client.send(ctx, "GET", url, nil, headers)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// The server ignored the Range header; start over.
+		offset = 0
+	default:
+		return fmt.Errorf("failed to download %s: status %d", url, resp.StatusCode)
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	written := offset
+	writer := io.Writer(file)
+	if opts.Progress != nil {
+		writer = &progressWriter{w: file, written: &written, total: size, progress: opts.Progress}
+	}
+	if _, err := io.Copy(writer, resp.Body); err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	return nil
+}
+
+func (s *DefaultScraper) downloadChunks(ctx context.Context, url, partPath, statePath string, size int64, opts DownloadOptions) error {
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	chunks := int((size + chunkSize - 1) / chunkSize)
+
+	state := loadDownloadState(statePath)
+	if state == nil || state.Size != size || state.ChunkSize != chunkSize || len(state.Done) != chunks {
+		state = &downloadState{Size: size, ChunkSize: chunkSize, Done: make([]bool, chunks)}
+		os.Remove(partPath)
+	}
+
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", partPath, err)
+	}
+	defer file.Close()
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+
+	var written int64
+	for i, done := range state.Done {
+		if done {
+			written += chunkLength(i, chunkSize, size)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	work := make(chan int)
+
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				err := s.downloadChunk(ctx, url, file, int64(i)*chunkSize, chunkLength(i, chunkSize, size))
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else {
+					state.Done[i] = true
+					saveDownloadState(statePath, state)
+					written += chunkLength(i, chunkSize, size)
+					if opts.Progress != nil {
+						opts.Progress(written, size)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i, done := range state.Done {
+		if done {
+			continue
+		}
+		select {
+		case work <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func (s *DefaultScraper) downloadChunk(ctx context.Context, url string, file *os.File, offset, length int64) error {
+	resp, err := s.client.send(ctx, "GET", url, nil, map[string]string{
+		"Accept-Encoding": "identity",
+		"Range":           fmt.Sprintf("bytes=%d-%d", offset, offset+length-1),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("failed to download bytes %d-%d of %s: status %d", offset, offset+length-1, url, resp.StatusCode)
+	}
+
+	n, err := io.Copy(io.NewOffsetWriter(file, offset), io.LimitReader(resp.Body, length))
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if n != length {
+		return fmt.Errorf("failed to download bytes %d-%d of %s: got %d bytes", offset, offset+length-1, url, n)
+	}
+	return nil
+}
+
+func chunkLength(i int, chunkSize, size int64) int64 {
+	start := int64(i) * chunkSize
+	if start+chunkSize > size {
+		return size - start
+	}
+	return chunkSize
+}
+
+func loadDownloadState(path string) *downloadState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state downloadState
+	if json.Unmarshal(data, &state) != nil {
+		return nil
+	}
+	return &state
+}
+
+func saveDownloadState(path string, state *downloadState) {
+	if data, err := json.Marshal(state); err == nil {
+		os.WriteFile(path, data, 0644)
+	}
+}
+
+func verifyChecksum(path, checksum string) error {
+	algorithm, expected, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return fmt.Errorf("invalid checksum %q: want algorithm:hex", checksum)
+	}
+
+	var h hash.Hash
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w: got %s:%s", ErrChecksumMismatch, algorithm, actual)
+	}
+	return nil
+}
+
+type progressWriter struct {
+	w        io.Writer
+	written  *int64
+	total    int64
+	progress func(written, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	*p.written += int64(n)
+	p.progress(*p.written, p.total)
+	return n, err
+}
@@ -0,0 +1,156 @@
+package goscraper
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ErrUnsupportedEncoding is returned for a response whose Content-Encoding
+// has no registered decoder, instead of handing compressed bytes to the
+// HTML parser.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// ContentDecoder wraps a compressed body in a reader yielding the original
+// bytes.
+type ContentDecoder func(r io.Reader) (io.ReadCloser, error)
+
+var contentDecoders = struct {
+	sync.RWMutex
+	order    []string
+	decoders map[string]ContentDecoder
+}{
+	order: []string{"gzip", "deflate", "br"},
+	decoders: map[string]ContentDecoder{
+		"gzip":    decodeGzip,
+		"x-gzip":  decodeGzip,
+		"deflate": decodeDeflate,
+		"br":      decodeBrotli,
+	},
+}
+
+// RegisterContentDecoder adds support for another Content-Encoding, or
+// replaces the decoder of a supported one. gzip, deflate and br are
+// supported out of the box. New encodings are advertised in the
+// Accept-Encoding header of requests made from then on; stealth scrapers
+// keep advertising the encodings that were registered when they were
+// created.
+func RegisterContentDecoder(encoding string, decoder ContentDecoder) {
+	encoding = strings.ToLower(encoding)
+
+	contentDecoders.Lock()
+	defer contentDecoders.Unlock()
+
+	if _, exists := contentDecoders.decoders[encoding]; !exists {
+		contentDecoders.order = append(contentDecoders.order, encoding)
+	}
+	contentDecoders.decoders[encoding] = decoder
+}
+
+// UnregisterContentDecoder removes a decoder added with
+// RegisterContentDecoder and stops advertising its encoding. The built-in
+// gzip, deflate and br decoders cannot be removed.
+func UnregisterContentDecoder(encoding string) {
+	encoding = strings.ToLower(encoding)
+	switch encoding {
+	case "gzip", "x-gzip", "deflate", "br":
+		return
+	}
+
+	contentDecoders.Lock()
+	defer contentDecoders.Unlock()
+
+	delete(contentDecoders.decoders, encoding)
+	for i, name := range contentDecoders.order {
+		if name == encoding {
+			contentDecoders.order = append(contentDecoders.order[:i:i], contentDecoders.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// acceptEncoding lists every encoding the scraper can decode.
+func acceptEncoding() string {
+	contentDecoders.RLock()
+	defer contentDecoders.RUnlock()
+	return strings.Join(contentDecoders.order, ", ")
+}
+
+// decodeBody undoes the Content-Encoding of resp, applying stacked encodings
+// such as "deflate, gzip" in reverse order. Transparent decompression in
+// net/http is disabled because the client sets Accept-Encoding itself.
+func decodeBody(resp *http.Response) (io.ReadCloser, error) {
+	header := resp.Header.Get("Content-Encoding")
+	encodings := strings.Split(header, ",")
+
+	var body io.ReadCloser = resp.Body
+	var closers []io.Closer
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if encoding == "" || encoding == "identity" {
+			continue
+		}
+
+		contentDecoders.RLock()
+		decoder, ok := contentDecoders.decoders[encoding]
+		contentDecoders.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+		}
+
+		decoded, err := decoder(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s reader: %w", encoding, err)
+		}
+		closers = append(closers, decoded)
+		body = decoded
+	}
+
+	if len(closers) == 0 {
+		return resp.Body, nil
+	}
+	return &decodedBody{Reader: body, closers: closers}, nil
+}
+
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	var err error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if closeErr := d.closers[i].Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func decodeGzip(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// decodeDeflate accepts both zlib-wrapped streams, which is what "deflate"
+// means in HTTP, and the raw DEFLATE streams plenty of servers send instead.
+func decodeDeflate(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	header, _ := buffered.Peek(2)
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+func decodeBrotli(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
@@ -0,0 +1,86 @@
+package goscraper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Classes of scrape failure. A *ScrapeError matches the class it falls in
+// under errors.Is, whatever its underlying cause.
+var (
+	// ErrBlocked means the site refused the request: 403 or 429.
+	ErrBlocked = errors.New("blocked")
+	// ErrTimeout means no response arrived in time.
+	ErrTimeout = errors.New("timeout")
+	// ErrTooManyRedirects means more than MaxRedirects redirects were
+	// followed.
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrNotFound means the page does not exist: 404 or 410.
+	ErrNotFound = errors.New("not found")
+	// ErrServerError means the site failed with a 5xx status.
+	ErrServerError = errors.New("server error")
+)
+
+// ScrapeError is returned by Do and the methods built on it when a page
+// could not be fetched. StatusCode is set when the site answered with an
+// error status, and is 0 otherwise.
+type ScrapeError struct {
+	URL        string
+	StatusCode int
+	Err        error
+	// Response is the error page the site answered with, when it could be
+	// read. Its Document is nil if the page is not HTML.
+	Response *Response
+}
+
+func (e *ScrapeError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("failed to fetch %s: status %d: %v", e.URL, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("failed to fetch %s: %v", e.URL, e.Err)
+}
+
+func (e *ScrapeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the class of failure e falls in.
+func (e *ScrapeError) Is(target error) bool {
+	return target != nil && target == e.class()
+}
+
+func (e *ScrapeError) class() error {
+	if e.StatusCode != 0 {
+		return statusClass(e.StatusCode)
+	}
+	switch {
+	case errors.Is(e.Err, ErrTooManyRedirects):
+		return ErrTooManyRedirects
+	case errorKind(e.Err) == "timeout", errors.Is(e.Err, ErrSlowOrigin):
+		return ErrTimeout
+	}
+	return nil
+}
+
+// statusClass returns the class of an error status, or nil for statuses
+// that have none.
+func statusClass(code int) error {
+	switch {
+	case code == http.StatusForbidden, code == http.StatusTooManyRequests:
+		return ErrBlocked
+	case code == http.StatusNotFound, code == http.StatusGone:
+		return ErrNotFound
+	case code >= 500:
+		return ErrServerError
+	}
+	return nil
+}
+
+// statusError describes an error status as the cause of a ScrapeError.
+func statusError(code int) error {
+	if class := statusClass(code); class != nil {
+		return fmt.Errorf("%w: %s", class, http.StatusText(code))
+	}
+	return fmt.Errorf("unexpected status: %s", http.StatusText(code))
+}
@@ -3,6 +3,9 @@ package goscraper
 import (
 	"regexp"
 	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
 )
 
 func (se *SmartExtractor) extractProducts(parser *Parser, url string) []SmartProduct {
@@ -22,24 +25,33 @@ func (se *SmartExtractor) extractProducts(parser *Parser, url string) []SmartPro
 	}
 	
 	for _, selector := range productSelectors {
-		elements := parser.ExtractTexts(selector)
-		if len(elements) > 0 {
-			for i, element := range elements {
-				if i >= 20 {
-					break
-				}
-				
-				product := SmartProduct{
-					Name:    cleanText(element),
-					InStock: true,
-				}
-				
-				products = append(products, product)
+		parser.doc.Find(selector).EachWithBreak(func(i int, s *goquery.Selection) bool {
+			text := strings.TrimSpace(s.Text())
+			if text == "" {
+				return true
+			}
+			
+			product := SmartProduct{
+				Name:    cleanText(text),
+				InStock: true,
 			}
+			ids := markupIdentifiers(s)
+			ids.apply(&product)
+			
+			products = append(products, product)
+			return len(products) < 20
+		})
+		if len(products) > 0 {
 			break
 		}
 	}
 	
+	// Page-level identifiers only say which product a product page is about.
+	if len(products) == 1 {
+		ids := pageIdentifiers(parser)
+		ids.apply(&products[0])
+	}
+	
 	return products
 }
 
@@ -78,7 +90,9 @@ func (se *SmartExtractor) extractArticle(parser *Parser) *Article {
 		}
 	}
 	
-	return article
+	// h-entry markup is authored for machines, so it beats the selector
+	// guesses wherever it has a value.
+	return mergeSources(articleFromMicroformats(parser), article, "article", make(map[string]string))
 }
 
 func (se *SmartExtractor) extractBlogPost(parser *Parser) *BlogPost {
@@ -110,7 +124,7 @@ func (se *SmartExtractor) extractBlogPost(parser *Parser) *BlogPost {
 	tags := parser.ExtractTexts(".tag, .tags, [class*='tag']")
 	post.Tags = cleanTextArray(tags)
 	
-	return post
+	return mergeSources(blogPostFromMicroformats(parser), post, "blog_post", make(map[string]string))
 }
 
 func (se *SmartExtractor) extractJobListing(parser *Parser) *JobListing {
@@ -287,54 +301,159 @@ func (se *SmartExtractor) extractVideo(parser *Parser) *Video {
 		}
 	}
 	
+	se.extractVideoMedia(parser, video)
+	
 	return video
 }
 
+// extractVideoMedia fills in the media files of video, its subtitles and
+// its thumbnail, resolved against the page's base URL. Embed URLs point at
+// player pages rather than media files, so they are kept out of Sources.
+func (se *SmartExtractor) extractVideoMedia(parser *Parser, video *Video) {
+	base := parser.BaseURL()
+	var sources, subtitles []string
+	add := func(list []string, ref string) []string {
+		if ref = resolveURL(base, ref); ref == "" {
+			return list
+		}
+		for _, existing := range list {
+			if existing == ref {
+				return list
+			}
+		}
+		return append(list, ref)
+	}
+	
+	for _, obj := range parser.jsonLDOfType("VideoObject") {
+		sources = add(sources, jsonLDString(obj, "contentUrl"))
+		if video.EmbedURL == "" {
+			video.EmbedURL = resolveURL(base, jsonLDString(obj, "embedUrl"))
+		}
+	}
+	
+	meta := parser.ExtractMetaTags()
+	for _, key := range []string{"og:video:secure_url", "og:video:url", "og:video", "og:audio:secure_url", "og:audio"} {
+		sources = add(sources, meta[key])
+	}
+	
+	for _, attr := range parser.ExtractAttrs("video[src], video source[src], audio[src], audio source[src]", "src") {
+		sources = add(sources, attr)
+	}
+	
+	for _, track := range parser.ExtractAttrs("track[src]", "src") {
+		subtitles = add(subtitles, track)
+	}
+	
+	if video.Thumbnail == "" {
+		if poster := parser.ExtractAttr("video[poster]", "poster"); poster != "" {
+			video.Thumbnail = resolveURL(base, poster)
+		} else if image := meta["og:image"]; image != "" {
+			video.Thumbnail = resolveURL(base, image)
+		}
+	}
+	
+	if video.URL == "" && len(sources) > 0 {
+		video.URL = sources[0]
+	}
+	
+	video.Sources = sources
+	video.Subtitles = subtitles
+}
+
+var productSelectorRegistry = struct {
+	sync.RWMutex
+	entries map[string]ProductSelectors
+}{entries: make(map[string]ProductSelectors)}
+
+// RegisterProductSelectors makes ExtractSmart use selectors on listing pages
+// of every domain containing domainSubstring, e.g. "mynewshop.com".
+// Registered selectors take precedence over the built-in ones; when several
+// registrations match, the longest domainSubstring wins. Registering the
+// same substring again replaces its selectors. It is safe to call while
+// scraping.
+func RegisterProductSelectors(domainSubstring string, selectors ProductSelectors) {
+	domainSubstring = strings.ToLower(strings.TrimSpace(domainSubstring))
+	if domainSubstring == "" {
+		return
+	}
+
+	productSelectorRegistry.Lock()
+	defer productSelectorRegistry.Unlock()
+	productSelectorRegistry.entries[domainSubstring] = selectors
+}
+
+// UnregisterProductSelectors removes the selectors registered for
+// domainSubstring with RegisterProductSelectors.
+func UnregisterProductSelectors(domainSubstring string) {
+	domainSubstring = strings.ToLower(strings.TrimSpace(domainSubstring))
+
+	productSelectorRegistry.Lock()
+	defer productSelectorRegistry.Unlock()
+	delete(productSelectorRegistry.entries, domainSubstring)
+}
+
+// getProductSelectorsForDomain returns the registered selectors for domain,
+// falling back to the built-in ones.
 func getProductSelectorsForDomain(domain string) *ProductSelectors {
 	domain = strings.ToLower(domain)
-	
-	if strings.Contains(domain, "trendyol") {
-		return &ProductSelectors{
-			Name:  ".prdct-desc-cntnr-name, .product-down .name",
-			Price: ".price-current, .prc-box-dscntd",
-			Image: ".p-card-img img",
-			Link:  ".p-card-wrppr a",
+	if selectors, ok := registeredProductSelectors(domain); ok {
+		return &selectors
+	}
+	return builtinProductSelectors(domain)
+}
+
+func registeredProductSelectors(domain string) (ProductSelectors, bool) {
+	productSelectorRegistry.RLock()
+	defer productSelectorRegistry.RUnlock()
+
+	var match string
+	for substring := range productSelectorRegistry.entries {
+		if len(substring) > len(match) && strings.Contains(domain, substring) {
+			match = substring
 		}
 	}
+	selectors, ok := productSelectorRegistry.entries[match]
+	return selectors, ok
+}
+
+func builtinProductSelectors(domain string) *ProductSelectors {
+	if strings.Contains(domain, "trendyol") {
+		selectors := GetTrendyolSelectors()
+		return &selectors
+	}
 	
 	if strings.Contains(domain, "hepsiburada") {
-		return &ProductSelectors{
-			Name:  ".product-title, [data-test-id='product-card-name']",
-			Price: ".price-current, .currentPrice",
-			Image: ".product-image img",
-			Link:  ".product-item a",
-		}
+		selectors := GetHepsiburadaSelectors()
+		return &selectors
 	}
 	
 	if strings.Contains(domain, "n11") {
-		return &ProductSelectors{
-			Name:  ".productName, .pro .productTitle",
-			Price: ".newPrice, .priceContainer .newPrice",
-			Image: ".productImage img",
-			Link:  ".pro a",
-		}
+		selectors := GetN11Selectors()
+		return &selectors
 	}
 	
 	if strings.Contains(domain, "amazon") {
 		return &ProductSelectors{
-			Name:  "[data-cy='title-recipe-card'], .s-title-instructions-style",
-			Price: ".a-price-whole, .a-offscreen",
-			Image: ".s-image",
-			Link:  ".s-link-style a",
+			Name:          "[data-cy='title-recipe-card'], .s-title-instructions-style",
+			Price:         ".a-price-whole, .a-offscreen",
+			Image:         ".s-image",
+			Link:          ".s-link-style a",
+			Brand:         "[data-cy='title-recipe-card'] h2.a-size-mini",
+			Rating:        ".a-icon-star-small .a-icon-alt, .a-icon-star .a-icon-alt",
+			Reviews:       "[data-cy='reviews-block'] .s-underline-text",
+			OriginalPrice: ".a-price.a-text-price .a-offscreen",
 		}
 	}
 	
 	if strings.Contains(domain, "ebay") {
 		return &ProductSelectors{
-			Name:  ".s-item__title",
-			Price: ".s-item__price",
-			Image: ".s-item__image",
-			Link:  ".s-item__link",
+			Name:          ".s-item__title",
+			Price:         ".s-item__price",
+			Image:         ".s-item__image",
+			Link:          ".s-item__link",
+			Rating:        ".x-star-rating .clipped",
+			Reviews:       ".s-item__reviews-count span",
+			OriginalPrice: ".s-item__trending-price .STRIKETHROUGH",
 		}
 	}
 	
@@ -347,6 +466,8 @@ func (se *SmartExtractor) extractProductsWithSelectors(parser *Parser, selectors
 	images := parser.ExtractAttrs(selectors.Image, "src")
 	links := parser.ExtractAttrs(selectors.Link, "href")
 	
+	cards := productCards(parser, selectors.Name)
+	
 	maxLen := max(max(len(names), len(prices)), max(len(images), len(links)))
 	products := make([]SmartProduct, 0, maxLen)
 	
@@ -356,9 +477,19 @@ func (se *SmartExtractor) extractProductsWithSelectors(parser *Parser, selectors
 		if i < len(names) {
 			product.Name = cleanText(names[i])
 		}
+		if i < len(cards) {
+			card := cards[i]
+			product.Brand = cleanText(cardText(card, selectors.Brand))
+			product.Rating = extractRating(cardText(card, selectors.Rating))
+			product.Reviews = extractCount(cardText(card, selectors.Reviews))
+			if original := cardText(card, selectors.OriginalPrice); original != "" {
+				product.OriginalPrice = extractPrice(original)
+			}
+		}
 		if i < len(prices) {
 			product.Price = extractPrice(prices[i])
 			product.Currency = extractCurrency(prices[i])
+			product.Prices = extractPrices(prices[i])
 		}
 		if i < len(images) {
 			product.ImageURL = images[i]
@@ -372,9 +503,69 @@ func (se *SmartExtractor) extractProductsWithSelectors(parser *Parser, selectors
 		}
 	}
 	
+	if len(products) == 1 {
+		ids := pageIdentifiers(parser)
+		ids.apply(&products[0])
+	}
+	
 	return products
 }
 
+// productCards returns, for each product name nameSelector matches, the
+// largest element around it holding no other name: the product's card.
+// Optional fields are looked up inside the card so that a value only some
+// products have, like a struck-through price, cannot shift onto the next
+// product.
+func productCards(parser *Parser, nameSelector string) []*goquery.Selection {
+	var cards []*goquery.Selection
+	parser.doc.Find(nameSelector).Each(func(i int, s *goquery.Selection) {
+		if strings.TrimSpace(s.Text()) == "" {
+			return
+		}
+		card := s
+		for parent := s.Parent(); parent.Length() > 0 && parent.Find(nameSelector).Length() == 1; parent = parent.Parent() {
+			card = parent
+		}
+		cards = append(cards, card)
+	})
+	return cards
+}
+
+// cardText returns the text of the first element selector matches in card.
+// Star ratings are often icons, so an empty element falls back to its
+// aria-label or title.
+func cardText(card *goquery.Selection, selector string) string {
+	if selector == "" {
+		return ""
+	}
+	s := card.Find(selector).First()
+	if text := strings.TrimSpace(s.Text()); text != "" {
+		return text
+	}
+	if label, ok := s.Attr("aria-label"); ok {
+		return strings.TrimSpace(label)
+	}
+	title, _ := s.Attr("title")
+	return strings.TrimSpace(title)
+}
+
+var ratingRegex = regexp.MustCompile(`\d+(?:[.,]\d+)?`)
+
+// extractRating returns the first number in text, such as 4.5 from
+// "4,5 out of 5 stars", with a dot as decimal separator.
+func extractRating(text string) string {
+	return strings.Replace(ratingRegex.FindString(text), ",", ".", 1)
+}
+
+var countRegex = regexp.MustCompile(`\d[\d.,]*`)
+
+// extractCount returns the first count in text without thousands
+// separators, such as 1234 from "(1.234 reviews)".
+func extractCount(text string) string {
+	count := countRegex.FindString(text)
+	return strings.NewReplacer(".", "", ",", "").Replace(count)
+}
+
 func cleanText(text string) string {
 	text = strings.TrimSpace(text)
 	text = regexp.MustCompile(`\s+`).ReplaceAllString(text, " ")
@@ -393,9 +584,9 @@ func cleanTextArray(texts []string) []string {
 
 func extractPrice(text string) string {
 	patterns := []string{
-		`\d+[.,]\d+\s*(?:TL|₺|USD|\$|EUR|€)`,
-		`(?:TL|₺|USD|\$|EUR|€)\s*\d+[.,]\d+`,
-		`\d+[.,]\d+`,
+		`\d[\d.,]*[.,]\d+\s*(?:TL|₺|USD|\$|EUR|€)`,
+		`(?:TL|₺|USD|\$|EUR|€)\s*\d[\d.,]*[.,]\d+`,
+		`\d[\d.,]*[.,]\d+`,
 		`\d+`,
 	}
 	
@@ -409,6 +600,30 @@ func extractPrice(text string) string {
 	return text
 }
 
+const currencySymbol = `(TL|₺|USD|\$|EUR|€|GBP|£)`
+
+var multiPriceRegex = regexp.MustCompile(currencySymbol + `\s*(\d[\d.,]*\d|\d)|(\d[\d.,]*\d|\d)\s*` + currencySymbol)
+
+// extractPrices returns every amount in text that carries a currency, in
+// order of appearance, e.g. both pairs from "€19.99 / $21.50".
+func extractPrices(text string) []PriceValue {
+	var prices []PriceValue
+	seen := make(map[PriceValue]bool)
+
+	for _, match := range multiPriceRegex.FindAllStringSubmatch(text, -1) {
+		price := PriceValue{Amount: match[2], Currency: extractCurrency(match[1])}
+		if match[3] != "" {
+			price = PriceValue{Amount: match[3], Currency: extractCurrency(match[4])}
+		}
+		if !seen[price] {
+			seen[price] = true
+			prices = append(prices, price)
+		}
+	}
+
+	return prices
+}
+
 func extractCurrency(text string) string {
 	currencies := map[string]string{
 		"TL": "TRY", "₺": "TRY",
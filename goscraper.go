@@ -2,6 +2,7 @@ package goscraper
 
 import (
 	"context"
+	"io"
 	"time"
 )
 
@@ -23,6 +24,10 @@ func (g *GoScraper) GetWithContext(ctx context.Context, url string) (*Response,
 	return g.scraper.GetWithContext(ctx, url)
 }
 
+func (g *GoScraper) Do(ctx context.Context, method, url string, body io.Reader, headers map[string]string) (*Response, error) {
+	return g.scraper.Do(ctx, method, url, body, headers)
+}
+
 func (g *GoScraper) SetConfig(config *Config) {
 	g.scraper.SetConfig(config)
 }
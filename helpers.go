@@ -19,7 +19,7 @@ type ExtractedData struct {
 }
 
 func ExtractAll(resp *Response) *ExtractedData {
-	parser := NewParser(resp.Document)
+	parser := responseParser(resp)
 	
 	return &ExtractedData{
 		Title:       parser.ExtractTitle(),
@@ -34,7 +34,7 @@ func ExtractAll(resp *Response) *ExtractedData {
 }
 
 func ExtractProducts(resp *Response, selectors ProductSelectors) []Product {
-	parser := NewParser(resp.Document)
+	parser := responseParser(resp)
 	
 	names := parser.ExtractTexts(selectors.Name)
 	prices := parser.ExtractTexts(selectors.Price)
@@ -66,11 +66,18 @@ func ExtractProducts(resp *Response, selectors ProductSelectors) []Product {
 	return products
 }
 
+// ProductSelectors locate the parts of product cards on a listing page.
+// Brand, Rating, Reviews and OriginalPrice are optional and looked up
+// inside each product's card, since only some cards carry them.
 type ProductSelectors struct {
-	Name  string `json:"name"`
-	Price string `json:"price"`
-	Image string `json:"image"`
-	Link  string `json:"link"`
+	Name          string `json:"name"`
+	Price         string `json:"price"`
+	Image         string `json:"image"`
+	Link          string `json:"link"`
+	Brand         string `json:"brand,omitempty"`
+	Rating        string `json:"rating,omitempty"`
+	Reviews       string `json:"reviews,omitempty"`
+	OriginalPrice string `json:"original_price,omitempty"`
 }
 
 type Product struct {
@@ -82,37 +89,54 @@ type Product struct {
 
 func GetTrendyolSelectors() ProductSelectors {
 	return ProductSelectors{
-		Name:  ".prdct-desc-cntnr-name, .product-down .name",
-		Price: ".price-current, .prc-box-dscntd",
-		Image: ".p-card-img img",
-		Link:  ".p-card-wrppr a",
+		Name:          ".prdct-desc-cntnr-name, .product-down .name",
+		Price:         ".price-current, .prc-box-dscntd",
+		Image:         ".p-card-img img",
+		Link:          ".p-card-wrppr a",
+		Brand:         ".prdct-desc-cntnr-ttl",
+		Rating:        ".rating-score",
+		Reviews:       ".ratingCount",
+		OriginalPrice: ".prc-box-orgnl",
 	}
 }
 
 func GetHepsiburadaSelectors() ProductSelectors {
 	return ProductSelectors{
-		Name:  ".product-title, [data-test-id='product-card-name']",
-		Price: ".price-current, .currentPrice",
-		Image: ".product-image img",
-		Link:  ".product-item a",
+		Name:          ".product-title, [data-test-id='product-card-name']",
+		Price:         ".price-current, .currentPrice",
+		Image:         ".product-image img",
+		Link:          ".product-item a",
+		Brand:         ".brand-name, [data-test-id='product-card-brand']",
+		Rating:        ".rating-score, [data-test-id='review-rating']",
+		Reviews:       ".number-of-reviews, [data-test-id='review-count']",
+		OriginalPrice: ".price-old, [data-test-id='prev-price']",
 	}
 }
 
 func GetN11Selectors() ProductSelectors {
 	return ProductSelectors{
-		Name:  ".productName, .pro .productTitle",
-		Price: ".newPrice, .priceContainer .newPrice",
-		Image: ".productImage img",
-		Link:  ".pro a",
+		Name:          ".productName, .pro .productTitle",
+		Price:         ".newPrice, .priceContainer .newPrice",
+		Image:         ".productImage img",
+		Link:          ".pro a",
+		Brand:         ".productBrand",
+		Rating:        ".ratingScore",
+		Reviews:       ".ratingText",
+		OriginalPrice: ".oldPrice",
 	}
 }
 
+// getMetaDescription returns the meta description, falling back to the
+// Open Graph and then the Twitter card description.
 func getMetaDescription(parser *Parser) string {
 	meta := parser.ExtractMetaTags()
-	if desc, exists := meta["description"]; exists {
+	if desc := strings.TrimSpace(meta["description"]); desc != "" {
 		return desc
 	}
-	return ""
+	if desc := parser.ExtractOpenGraph().Description; desc != "" {
+		return desc
+	}
+	return parser.ExtractTwitterCard().Description
 }
 
 func extractMeaningfulText(parser *Parser) []string {
@@ -149,22 +173,9 @@ func extractEmails(html string) []string {
 	return emails
 }
 
+// extractPhoneNumbers reads national numbers as DefaultPhoneRegion ones.
 func extractPhoneNumbers(html string) []string {
-	phoneRegex := regexp.MustCompile(`(\+90|0)?\s?[0-9]{3}\s?[0-9]{3}\s?[0-9]{2}\s?[0-9]{2}`)
-	matches := phoneRegex.FindAllString(html, -1)
-	
-	unique := make(map[string]bool)
-	var phones []string
-	
-	for _, phone := range matches {
-		cleaned := strings.ReplaceAll(phone, " ", "")
-		if !unique[cleaned] && len(cleaned) >= 10 {
-			unique[cleaned] = true
-			phones = append(phones, cleaned)
-		}
-	}
-	
-	return phones
+	return ExtractPhoneNumbers(html, DefaultPhoneRegion)
 }
 
 func max(a, b int) int {
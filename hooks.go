@@ -0,0 +1,34 @@
+package goscraper
+
+import "net/http"
+
+// RequestHook inspects or modifies a request just before it is sent, e.g.
+// to add per-request auth headers. An error aborts the request with that
+// error.
+type RequestHook func(req *http.Request) error
+
+// ResponseHook inspects or modifies a Response before it is returned. An
+// error fails the request with that error.
+type ResponseHook func(resp *Response) error
+
+// runRequestHooks applies the WithRequestHook hooks in the order they were
+// added, stopping at the first error.
+func (c *Client) runRequestHooks(req *http.Request) error {
+	for _, hook := range c.config.RequestHooks {
+		if err := hook(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runResponseHooks applies the WithResponseHook hooks in the order they
+// were added, stopping at the first error.
+func (s *DefaultScraper) runResponseHooks(resp *Response) error {
+	for _, hook := range s.config.ResponseHooks {
+		if err := hook(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
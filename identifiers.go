@@ -0,0 +1,214 @@
+package goscraper
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// NormalizeGTIN validates a GTIN (EAN-8, UPC-A, EAN-13, GTIN-14) or ISBN and
+// returns it in a canonical form for matching across retailers: digits only,
+// ISBN-10 converted to its 978 ISBN-13, and leading zeros dropped down to 13
+// digits, so the UPC 036000291452 and the EAN 0036000291452 compare equal.
+// ok is false when the value is malformed or its check digit is wrong.
+func NormalizeGTIN(raw string) (string, bool) {
+	code := strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, raw)
+	code = strings.TrimPrefix(code, "ISBN")
+	code = strings.TrimPrefix(code, ":")
+
+	if len(code) == 10 {
+		if !validISBN10(code) {
+			return "", false
+		}
+		code = "978" + code[:9]
+		return code + string(gtinCheckDigit(code)), true
+	}
+
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return "", false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	if gtinCheckDigit(code[:len(code)-1]) != code[len(code)-1] {
+		return "", false
+	}
+
+	code = strings.Repeat("0", 14-len(code)) + code
+	return strings.TrimPrefix(code, "0"), true
+}
+
+// gtinCheckDigit computes the GS1 mod-10 check digit for the digits in body,
+// weighting them 3, 1, 3, ... from the right.
+func gtinCheckDigit(body string) byte {
+	sum := 0
+	for i := len(body) - 1; i >= 0; i-- {
+		digit := int(body[i] - '0')
+		if (len(body)-1-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func validISBN10(code string) bool {
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var digit int
+		switch c := code[i]; {
+		case c >= '0' && c <= '9':
+			digit = int(c - '0')
+		case c == 'X' && i == 9:
+			digit = 10
+		default:
+			return false
+		}
+		sum += digit * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+// normalizeProductCode accepts a SKU or MPN, which have no check digit, as
+// long as it looks like a code rather than a sentence or placeholder.
+func normalizeProductCode(raw string) (string, bool) {
+	code := strings.TrimSpace(raw)
+	if code == "" || len(code) > 64 || strings.Count(code, " ") > 2 {
+		return "", false
+	}
+
+	hasAlnum := false
+	for _, r := range code {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			hasAlnum = true
+		case strings.ContainsRune(" -_./#+", r):
+		default:
+			return "", false
+		}
+	}
+	return code, hasAlnum
+}
+
+// productIdentifiers holds the validated identifiers found for a product.
+type productIdentifiers struct {
+	gtin, sku, mpn string
+}
+
+func (ids *productIdentifiers) addGTIN(raw string) {
+	if ids.gtin == "" {
+		ids.gtin, _ = NormalizeGTIN(raw)
+	}
+}
+
+func (ids *productIdentifiers) addSKU(raw string) {
+	if ids.sku == "" {
+		ids.sku, _ = normalizeProductCode(raw)
+	}
+}
+
+func (ids *productIdentifiers) addMPN(raw string) {
+	if ids.mpn == "" {
+		ids.mpn, _ = normalizeProductCode(raw)
+	}
+}
+
+func (ids *productIdentifiers) apply(product *SmartProduct) {
+	if product.GTIN == "" {
+		product.GTIN = ids.gtin
+	}
+	if product.SKU == "" {
+		product.SKU = ids.sku
+	}
+	if product.MPN == "" {
+		product.MPN = ids.mpn
+	}
+}
+
+var gtinKeys = []string{"gtin13", "gtin", "gtin12", "gtin14", "gtin8", "isbn"}
+
+// jsonLDIdentifiers reads identifiers from a Product, falling back to its
+// offers, where some shops put the SKU and GTIN instead.
+func jsonLDIdentifiers(product map[string]interface{}) productIdentifiers {
+	var ids productIdentifiers
+
+	var collect func(value interface{})
+	collect = func(value interface{}) {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				collect(item)
+			}
+		case map[string]interface{}:
+			for _, key := range gtinKeys {
+				ids.addGTIN(jsonLDString(v, key))
+			}
+			ids.addSKU(jsonLDString(v, "sku"))
+			ids.addMPN(jsonLDString(v, "mpn"))
+			if nested, ok := v["offers"]; ok {
+				collect(nested)
+			}
+		}
+	}
+	collect(product)
+
+	return ids
+}
+
+// markupIdentifiers reads schema.org microdata/RDFa properties and data
+// attributes inside s.
+func markupIdentifiers(s *goquery.Selection) productIdentifiers {
+	var ids productIdentifiers
+
+	value := func(el *goquery.Selection) string {
+		if content, ok := el.Attr("content"); ok {
+			return content
+		}
+		return el.Text()
+	}
+
+	for _, key := range gtinKeys {
+		s.Find("[itemprop='" + key + "'], [property='" + key + "']").Each(func(i int, el *goquery.Selection) {
+			ids.addGTIN(value(el))
+		})
+	}
+	s.Find("[itemprop='sku'], [property='sku']").Each(func(i int, el *goquery.Selection) {
+		ids.addSKU(value(el))
+	})
+	s.Find("[itemprop='mpn'], [property='mpn']").Each(func(i int, el *goquery.Selection) {
+		ids.addMPN(value(el))
+	})
+
+	for _, attr := range []string{"data-gtin", "data-ean", "data-upc", "data-isbn"} {
+		ids.addGTIN(s.AttrOr(attr, ""))
+	}
+	ids.addSKU(s.AttrOr("data-sku", ""))
+	ids.addMPN(s.AttrOr("data-mpn", ""))
+
+	return ids
+}
+
+// pageIdentifiers reads identifiers that describe the page as a whole: the
+// Open Graph product tags and any microdata on the page.
+func pageIdentifiers(parser *Parser) productIdentifiers {
+	ids := markupIdentifiers(parser.doc.Selection)
+
+	meta := parser.ExtractMetaTags()
+	for _, key := range []string{"product:ean", "product:upc", "product:isbn", "product:gtin"} {
+		ids.addGTIN(meta[key])
+	}
+	ids.addSKU(meta["product:retailer_item_id"])
+	ids.addMPN(meta["product:mfr_part_no"])
+
+	return ids
+}
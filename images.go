@@ -0,0 +1,130 @@
+package goscraper
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// lazyImageAttrs are the attributes lazy-loading scripts keep the real
+// image source in until the image scrolls into view, in order of
+// preference.
+var lazyImageAttrs = []string{"data-src", "data-original", "data-lazy-src", "data-lazy", "data-url"}
+
+// imageSource returns the URL an <img> shows: its largest srcset candidate,
+// else the first lazy-load attribute set, else src.
+func imageSource(s *goquery.Selection) string {
+	for _, attr := range []string{"srcset", "data-srcset"} {
+		if src := largestSrcsetCandidate(s.AttrOr(attr, "")); src != "" && !isDataURI(src) {
+			return src
+		}
+	}
+	for _, attr := range lazyImageAttrs {
+		if src := strings.TrimSpace(s.AttrOr(attr, "")); src != "" && !isDataURI(src) {
+			return src
+		}
+	}
+	return strings.TrimSpace(s.AttrOr("src", ""))
+}
+
+// largestSrcsetCandidate returns the URL of the widest candidate in srcset,
+// or the one with the highest pixel density when no widths are given.
+func largestSrcsetCandidate(srcset string) string {
+	var best string
+	bestWidth, bestDensity := -1.0, -1.0
+	for _, candidate := range parseSrcset(srcset) {
+		width, density := -1.0, 1.0
+		for _, descriptor := range candidate.descriptors {
+			if len(descriptor) < 2 {
+				continue
+			}
+			value, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64)
+			if err != nil {
+				continue
+			}
+			switch descriptor[len(descriptor)-1] {
+			case 'w':
+				width = value
+			case 'x':
+				density = value
+			}
+		}
+
+		switch {
+		case width > bestWidth:
+			best, bestWidth, bestDensity = candidate.url, width, density
+		case width == bestWidth && density > bestDensity:
+			best, bestDensity = candidate.url, density
+		}
+	}
+	return best
+}
+
+type srcsetCandidate struct {
+	url         string
+	descriptors []string
+}
+
+// parseSrcset splits a srcset into its candidates. URLs may contain commas,
+// so as in the HTML spec a URL runs to the next whitespace, and only a comma
+// after its descriptors ends a candidate.
+func parseSrcset(srcset string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	rest := srcset
+	for {
+		rest = strings.TrimLeft(rest, " \t\n\r\f,")
+		if rest == "" {
+			return candidates
+		}
+
+		end := strings.IndexAny(rest, " \t\n\r\f")
+		if end < 0 {
+			end = len(rest)
+		}
+		candidate := srcsetCandidate{url: rest[:end]}
+		rest = rest[end:]
+
+		if trimmed := strings.TrimRight(candidate.url, ","); trimmed != candidate.url {
+			// A comma right after the URL ends the candidate.
+			candidate.url = trimmed
+		} else {
+			descriptors := rest
+			if comma := strings.IndexByte(rest, ','); comma >= 0 {
+				descriptors, rest = rest[:comma], rest[comma+1:]
+			} else {
+				rest = ""
+			}
+			candidate.descriptors = strings.Fields(strings.ToLower(descriptors))
+		}
+
+		if candidate.url != "" {
+			candidates = append(candidates, candidate)
+		}
+	}
+}
+
+// imageDimension reads a width or height attribute given in pixels, such as
+// "300" or "300px", reporting false for anything else, like "50%".
+func imageDimension(s *goquery.Selection, attr string) (int, bool) {
+	value := strings.TrimSuffix(strings.TrimSpace(strings.ToLower(s.AttrOr(attr, ""))), "px")
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// imageSize returns an <img>'s width and height in pixels, 0 when unknown,
+// and whether the image is sized like a tracking pixel: at most 1 pixel in
+// every dimension given.
+func imageSize(s *goquery.Selection) (width, height int, pixel bool) {
+	width, hasWidth := imageDimension(s, "width")
+	height, hasHeight := imageDimension(s, "height")
+	pixel = (hasWidth || hasHeight) && (!hasWidth || width <= 1) && (!hasHeight || height <= 1)
+	return width, height, pixel
+}
+
+func isDataURI(src string) bool {
+	return len(src) >= 5 && strings.EqualFold(src[:5], "data:")
+}
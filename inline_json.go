@@ -0,0 +1,175 @@
+package goscraper
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ExtractInlineJSON decodes every JSON object or array literal found in
+// inline <script> blocks, including ones assigned to variables such as
+// "window.__STATE__ = {...};". Literals that are JavaScript but not valid
+// JSON (unquoted keys, trailing commas) are skipped, though any valid JSON
+// nested inside them is still returned. Empty objects and arrays are ignored.
+func (p *Parser) ExtractInlineJSON() []interface{} {
+	var values []interface{}
+
+	p.doc.Find("script:not([src])").Each(func(i int, s *goquery.Selection) {
+		values = append(values, scanJSONLiterals(s.Text())...)
+	})
+
+	return values
+}
+
+func scanJSONLiterals(script string) []interface{} {
+	var values []interface{}
+
+	// Outer literals come first, so a valid one is returned whole and the
+	// literals nested inside it are skipped.
+	spans := bracketSpans(script)
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+
+	covered := -1
+	for _, span := range spans {
+		if span[0] <= covered {
+			continue
+		}
+
+		var value interface{}
+		if json.Unmarshal([]byte(script[span[0]:span[1]+1]), &value) != nil || isEmptyJSON(value) {
+			continue
+		}
+
+		values = append(values, value)
+		covered = span[1]
+	}
+
+	return values
+}
+
+// bracketSpans returns the start and end of every balanced {...} and [...]
+// in a single pass over script. Brackets inside strings, template literals,
+// comments and regular expression literals don't count; a mismatched
+// closing bracket leaves every bracket still open unbalanced.
+func bracketSpans(script string) [][2]int {
+	var spans [][2]int
+	var open []int
+
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; c {
+		case '"', '\'', '`':
+			i = skipQuoted(script, i, c)
+		case '/':
+			switch {
+			case i+1 < len(script) && script[i+1] == '/':
+				if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+					i += end
+				} else {
+					i = len(script)
+				}
+			case i+1 < len(script) && script[i+1] == '*':
+				if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+					i += end + 3
+				} else {
+					i = len(script)
+				}
+			case regexAllowed(script[:i]):
+				i = skipRegex(script, i)
+			}
+		case '{', '[':
+			open = append(open, i)
+		case '}', ']':
+			if len(open) == 0 {
+				continue
+			}
+			start := open[len(open)-1]
+			if (script[start] == '{') != (c == '}') {
+				open = open[:0]
+				continue
+			}
+			open = open[:len(open)-1]
+			spans = append(spans, [2]int{start, i})
+		}
+	}
+
+	return spans
+}
+
+// skipQuoted returns the index of the quote closing the string that starts
+// at start.
+func skipQuoted(s string, start int, quote byte) int {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		}
+	}
+	return len(s)
+}
+
+// skipRegex returns the index of the slash closing the regular expression
+// literal that starts at start. Slashes inside character classes don't end
+// it, and neither does a line break, which JavaScript doesn't allow in one.
+func skipRegex(s string, start int) int {
+	inClass := false
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				return i
+			}
+		case '\n':
+			return i
+		}
+	}
+	return len(s)
+}
+
+// regexAllowed reports whether a slash following before starts a regular
+// expression literal rather than being a division, judged by the token
+// before it as JavaScript tokenizers do.
+func regexAllowed(before string) bool {
+	before = strings.TrimRight(before, " \t\r\n")
+	if before == "" {
+		return true
+	}
+
+	last := before[len(before)-1]
+	if last == ')' || last == ']' || last == '}' || last == '_' || last == '$' ||
+		unicode.IsLetter(rune(last)) || unicode.IsDigit(rune(last)) {
+		word := before[strings.LastIndexFunc(before, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '$'
+		})+1:]
+		return regexKeywords[word]
+	}
+	return true
+}
+
+// regexKeywords are the keywords after which a slash starts a regular
+// expression.
+var regexKeywords = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true,
+	"new": true, "delete": true, "void": true, "throw": true, "case": true,
+	"do": true, "else": true, "yield": true, "await": true,
+}
+
+func isEmptyJSON(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
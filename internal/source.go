@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxSourceSize bounds how much of a remote source is read.
+const MaxSourceSize = 1 << 20
+
+// RefreshableSource holds a value loaded from a URL or a local file and
+// reloads it in the background once it is older than the refresh interval.
+// A failed load keeps the previous value and is reported by LastError.
+type RefreshableSource[T any] struct {
+	what     string
+	source   string
+	interval time.Duration
+	parse    func(data []byte) (T, error)
+	client   *http.Client
+
+	mu         sync.RWMutex
+	value      T
+	loadedAt   time.Time
+	refreshing bool
+	lastErr    error
+	// firstLoad is closed once the first load has finished, successfully
+	// or not.
+	firstLoad chan struct{}
+	firstOnce sync.Once
+}
+
+// NewRefreshableSource returns a source reading source with parse. what
+// names the value in errors, e.g. "schema".
+func NewRefreshableSource[T any](what, source string, interval time.Duration, parse func(data []byte) (T, error)) *RefreshableSource[T] {
+	return &RefreshableSource[T]{
+		what:      what,
+		source:    source,
+		interval:  interval,
+		parse:     parse,
+		client:    &http.Client{Timeout: 15 * time.Second},
+		firstLoad: make(chan struct{}),
+	}
+}
+
+// Refresh loads the source synchronously. On failure the previously loaded
+// value is kept.
+func (s *RefreshableSource[T]) Refresh(ctx context.Context) error {
+	value, err := s.load(ctx)
+
+	s.mu.Lock()
+	s.refreshing = false
+	s.lastErr = err
+	// Failures also reset the clock so a broken source isn't hit on every call.
+	s.loadedAt = time.Now()
+	if err == nil {
+		s.value = value
+	}
+	s.mu.Unlock()
+
+	s.firstOnce.Do(func() { close(s.firstLoad) })
+	return err
+}
+
+// LoadInBackground starts loading the source unless a load is already
+// running, without waiting for it.
+func (s *RefreshableSource[T]) LoadInBackground() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.refreshing {
+		s.refreshing = true
+		go s.Refresh(context.Background())
+	}
+}
+
+// Get returns the current value, the zero value until a load succeeds, and
+// starts a background refresh when the value is stale.
+func (s *RefreshableSource[T]) Get() T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stale := !s.refreshing && (s.loadedAt.IsZero() || (s.interval > 0 && time.Since(s.loadedAt) > s.interval))
+	if stale {
+		s.refreshing = true
+		go s.Refresh(context.Background())
+	}
+	return s.value
+}
+
+// WaitFirstLoad blocks until the first load has finished or ctx is done.
+// It does not start a load itself.
+func (s *RefreshableSource[T]) WaitFirstLoad(ctx context.Context) error {
+	select {
+	case <-s.firstLoad:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LastError reports why the most recent refresh failed, if it did.
+func (s *RefreshableSource[T]) LastError() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastErr
+}
+
+func (s *RefreshableSource[T]) load(ctx context.Context) (T, error) {
+	var zero T
+	var data []byte
+	var err error
+	if strings.HasPrefix(s.source, "http://") || strings.HasPrefix(s.source, "https://") {
+		data, err = s.fetch(ctx)
+	} else {
+		data, err = os.ReadFile(s.source)
+	}
+	if err != nil {
+		return zero, fmt.Errorf("failed to load %s from %s: %w", s.what, s.source, err)
+	}
+
+	value, err := s.parse(data)
+	if err != nil {
+		return zero, fmt.Errorf("invalid %s from %s: %w", s.what, s.source, err)
+	}
+	return value, nil
+}
+
+func (s *RefreshableSource[T]) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxSourceSize+1))
+	if err == nil && len(data) > MaxSourceSize {
+		return nil, fmt.Errorf("larger than %d bytes", MaxSourceSize)
+	}
+	return data, err
+}
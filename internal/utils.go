@@ -1,8 +1,10 @@
 package internal
 
 import (
+	"context"
 	"net/url"
 	"strings"
+	"time"
 )
 
 func IsValidURL(rawURL string) bool {
@@ -41,4 +43,21 @@ func ExtractDomain(rawURL string) string {
 		return ""
 	}
 	return u.Host
-}
\ No newline at end of file
+}
+
+// SleepContext waits for d, returning early with ctx.Err() if ctx is done.
+func SleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
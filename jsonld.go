@@ -0,0 +1,446 @@
+package goscraper
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ExtractJSONLD returns every JSON-LD object on the page, flattening
+// top-level arrays and @graph containers. Blocks that are not valid JSON are
+// skipped.
+func (p *Parser) ExtractJSONLD() []map[string]interface{} {
+	var objects []map[string]interface{}
+
+	p.doc.Find(`script[type="application/ld+json"]`).Each(func(i int, s *goquery.Selection) {
+		var data interface{}
+		if err := json.Unmarshal([]byte(unwrapScriptText(s.Text())), &data); err != nil {
+			return
+		}
+		objects = append(objects, flattenJSONLD(data)...)
+	})
+
+	return objects
+}
+
+// unwrapScriptText strips the HTML comment and CDATA wrappers some CMSes
+// still put around inline scripts.
+func unwrapScriptText(text string) string {
+	text = strings.TrimSpace(text)
+	for _, wrapper := range [][2]string{{"<!--", "-->"}, {"//<![CDATA[", "//]]>"}, {"<![CDATA[", "]]>"}} {
+		if strings.HasPrefix(text, wrapper[0]) && strings.HasSuffix(text, wrapper[1]) {
+			text = strings.TrimSpace(text[len(wrapper[0]) : len(text)-len(wrapper[1])])
+		}
+	}
+	return text
+}
+
+func flattenJSONLD(data interface{}) []map[string]interface{} {
+	var objects []map[string]interface{}
+
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			objects = append(objects, flattenJSONLD(item)...)
+		}
+	case map[string]interface{}:
+		objects = append(objects, v)
+		if graph, ok := v["@graph"]; ok {
+			objects = append(objects, flattenJSONLD(graph)...)
+		}
+	}
+
+	return objects
+}
+
+// jsonLDOfType returns the JSON-LD objects whose @type matches typeName.
+func (p *Parser) jsonLDOfType(typeName string) []map[string]interface{} {
+	var matches []map[string]interface{}
+	for _, obj := range p.ExtractJSONLD() {
+		if jsonLDHasType(obj, typeName) {
+			matches = append(matches, obj)
+		}
+	}
+	return matches
+}
+
+// jsonLDContentTypes maps the schema.org types that describe a whole page
+// to the content type whose extractor understands them.
+var jsonLDContentTypes = []struct {
+	schemaType  string
+	contentType ContentType
+}{
+	{"Product", ContentTypeEcommerce},
+	{"Recipe", ContentTypeRecipe},
+	{"JobPosting", ContentTypeJob},
+	{"NewsArticle", ContentTypeNews},
+	{"BlogPosting", ContentTypeBlog},
+	{"Article", ContentTypeNews},
+	{"Event", ContentTypeEvent},
+	{"VideoObject", ContentTypeVideo},
+}
+
+// jsonLDContentType returns the content type declared by the page's JSON-LD,
+// or "" when it declares none of the types in jsonLDContentTypes.
+func jsonLDContentType(p *Parser) ContentType {
+	objects := p.ExtractJSONLD()
+	for _, candidate := range jsonLDContentTypes {
+		for _, obj := range objects {
+			if jsonLDHasType(obj, candidate.schemaType) {
+				return candidate.contentType
+			}
+		}
+	}
+	return ""
+}
+
+func jsonLDHasType(obj map[string]interface{}, typeName string) bool {
+	switch t := obj["@type"].(type) {
+	case string:
+		return strings.EqualFold(t, typeName)
+	case []interface{}:
+		for _, item := range t {
+			if s, ok := item.(string); ok && strings.EqualFold(s, typeName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonLDString reads a string-ish property, unwrapping the common shapes
+// schema.org publishers use: plain strings, arrays, and {"name"/"url": ...}
+// objects.
+func jsonLDString(obj map[string]interface{}, key string) string {
+	return jsonLDValueString(obj[key])
+}
+
+func jsonLDValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		if len(v) > 0 {
+			return jsonLDValueString(v[0])
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"name", "url", "@id", "contentUrl"} {
+			if s := jsonLDValueString(v[key]); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// jsonLDStrings reads a property that may be a single value, a list, or a
+// comma-separated string (as schema.org keywords often are).
+func jsonLDStrings(obj map[string]interface{}, key string) []string {
+	var values []string
+	switch v := obj[key].(type) {
+	case string:
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s := jsonLDValueString(item); s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+// jsonLDObject returns a nested object property, taking the first element
+// when publishers wrap it in a list.
+func jsonLDObject(obj map[string]interface{}, key string) map[string]interface{} {
+	switch v := obj[key].(type) {
+	case map[string]interface{}:
+		return v
+	case []interface{}:
+		if len(v) > 0 {
+			if m, ok := v[0].(map[string]interface{}); ok {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+func jsonLDFirstOfType(p *Parser, typeNames ...string) map[string]interface{} {
+	for _, typeName := range typeNames {
+		if objects := p.jsonLDOfType(typeName); len(objects) > 0 {
+			return objects[0]
+		}
+	}
+	return nil
+}
+
+func jsonLDAddress(obj map[string]interface{}) string {
+	if obj == nil {
+		return ""
+	}
+	address := jsonLDObject(obj, "address")
+	if address == nil {
+		return jsonLDString(obj, "address")
+	}
+	return jsonLDPostalAddress(address)
+}
+
+// jsonLDPostalAddress formats a schema.org PostalAddress on one line.
+func jsonLDPostalAddress(address map[string]interface{}) string {
+	var parts []string
+	for _, key := range []string{"streetAddress", "addressLocality", "addressRegion", "postalCode", "addressCountry"} {
+		if part := jsonLDString(address, key); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func articleFromJSONLD(p *Parser) *Article {
+	obj := jsonLDFirstOfType(p, "NewsArticle", "ReportageNewsArticle", "Article", "BlogPosting")
+	if obj == nil {
+		return nil
+	}
+	return &Article{
+		Headline:    jsonLDString(obj, "headline"),
+		Subheadline: jsonLDString(obj, "alternativeHeadline"),
+		Author:      jsonLDString(obj, "author"),
+		PublishDate: jsonLDString(obj, "datePublished"),
+		Content:     jsonLDString(obj, "articleBody"),
+		Category:    jsonLDString(obj, "articleSection"),
+		Tags:        jsonLDStrings(obj, "keywords"),
+	}
+}
+
+func blogPostFromJSONLD(p *Parser) *BlogPost {
+	obj := jsonLDFirstOfType(p, "BlogPosting", "Article")
+	if obj == nil {
+		return nil
+	}
+	return &BlogPost{
+		Title:       jsonLDString(obj, "headline"),
+		Author:      jsonLDString(obj, "author"),
+		PublishDate: jsonLDString(obj, "datePublished"),
+		Content:     jsonLDString(obj, "articleBody"),
+		Categories:  jsonLDStrings(obj, "articleSection"),
+		Tags:        jsonLDStrings(obj, "keywords"),
+	}
+}
+
+func jobListingFromJSONLD(p *Parser) *JobListing {
+	obj := jsonLDFirstOfType(p, "JobPosting")
+	if obj == nil {
+		return nil
+	}
+
+	salary := ""
+	if base := jsonLDObject(obj, "baseSalary"); base != nil {
+		if value := jsonLDObject(base, "value"); value != nil {
+			salary = strings.TrimSpace(jsonLDString(value, "value") + " " + jsonLDString(base, "currency"))
+			if salary == "" {
+				min, max := jsonLDString(value, "minValue"), jsonLDString(value, "maxValue")
+				if min != "" || max != "" {
+					salary = strings.TrimSpace(min + "-" + max + " " + jsonLDString(base, "currency"))
+				}
+			}
+		} else {
+			salary = jsonLDString(base, "value")
+		}
+	}
+
+	return &JobListing{
+		Title:       jsonLDString(obj, "title"),
+		Company:     jsonLDString(obj, "hiringOrganization"),
+		Location:    jsonLDAddress(jsonLDObject(obj, "jobLocation")),
+		Salary:      salary,
+		JobType:     jsonLDString(obj, "employmentType"),
+		Experience:  jsonLDString(obj, "experienceRequirements"),
+		Description: jsonLDString(obj, "description"),
+		PostDate:    jsonLDString(obj, "datePosted"),
+	}
+}
+
+func recipeFromJSONLD(p *Parser) *Recipe {
+	obj := jsonLDFirstOfType(p, "Recipe")
+	if obj == nil {
+		return nil
+	}
+
+	var instructions []string
+	switch v := obj["recipeInstructions"].(type) {
+	case string:
+		instructions = []string{strings.TrimSpace(v)}
+	case []interface{}:
+		for _, step := range v {
+			switch s := step.(type) {
+			case string:
+				instructions = append(instructions, strings.TrimSpace(s))
+			case map[string]interface{}:
+				if text := jsonLDString(s, "text"); text != "" {
+					instructions = append(instructions, text)
+				}
+			}
+		}
+	}
+
+	nutrition := ""
+	if n := jsonLDObject(obj, "nutrition"); n != nil {
+		nutrition = jsonLDString(n, "calories")
+	}
+
+	return &Recipe{
+		Name:         jsonLDString(obj, "name"),
+		Description:  jsonLDString(obj, "description"),
+		PrepTime:     jsonLDString(obj, "prepTime"),
+		CookTime:     jsonLDString(obj, "cookTime"),
+		TotalTime:    jsonLDString(obj, "totalTime"),
+		Servings:     jsonLDString(obj, "recipeYield"),
+		Ingredients:  jsonLDStrings(obj, "recipeIngredient"),
+		Instructions: instructions,
+		Nutrition:    nutrition,
+	}
+}
+
+func eventFromJSONLD(p *Parser) *Event {
+	obj := jsonLDFirstOfType(p, "Event", "MusicEvent", "SportsEvent", "TheaterEvent", "BusinessEvent")
+	if obj == nil {
+		return nil
+	}
+
+	location := jsonLDObject(obj, "location")
+	price := ""
+	if offers := jsonLDObject(obj, "offers"); offers != nil {
+		price = strings.TrimSpace(jsonLDString(offers, "price") + " " + jsonLDString(offers, "priceCurrency"))
+	}
+
+	venue := ""
+	if location != nil {
+		venue = jsonLDString(location, "name")
+	}
+
+	return &Event{
+		Name:        jsonLDString(obj, "name"),
+		Description: jsonLDString(obj, "description"),
+		Date:        jsonLDString(obj, "startDate"),
+		Venue:       venue,
+		Location:    jsonLDAddress(location),
+		Price:       price,
+		Organizer:   jsonLDString(obj, "organizer"),
+	}
+}
+
+func videoFromJSONLD(p *Parser) *Video {
+	obj := jsonLDFirstOfType(p, "VideoObject")
+	if obj == nil {
+		return nil
+	}
+
+	base := p.BaseURL()
+	embedURL := resolveURL(base, jsonLDString(obj, "embedUrl"))
+	url := resolveURL(base, jsonLDString(obj, "contentUrl"))
+	if url == "" {
+		url = embedURL
+	}
+
+	views := ""
+	if stats := jsonLDObject(obj, "interactionStatistic"); stats != nil {
+		views = jsonLDString(stats, "userInteractionCount")
+	}
+
+	return &Video{
+		Title:       jsonLDString(obj, "name"),
+		Description: jsonLDString(obj, "description"),
+		Duration:    jsonLDString(obj, "duration"),
+		Views:       views,
+		Author:      jsonLDString(obj, "author"),
+		PublishDate: jsonLDString(obj, "uploadDate"),
+		Thumbnail:   resolveURL(base, jsonLDString(obj, "thumbnailUrl")),
+		URL:         url,
+		EmbedURL:    embedURL,
+	}
+}
+
+func productsFromJSONLD(p *Parser, pageURL string) []SmartProduct {
+	var products []SmartProduct
+
+	for _, obj := range p.jsonLDOfType("Product") {
+		product := SmartProduct{
+			Name:     jsonLDString(obj, "name"),
+			Brand:    jsonLDString(obj, "brand"),
+			ImageURL: resolveURL(pageURL, jsonLDString(obj, "image")),
+			URL:      resolveURL(pageURL, jsonLDString(obj, "url")),
+			InStock:  true,
+		}
+
+		if offers := jsonLDObject(obj, "offers"); offers != nil {
+			product.Price = jsonLDString(offers, "price")
+			if product.Price == "" {
+				product.Price = jsonLDString(offers, "lowPrice")
+			}
+			product.Currency = jsonLDString(offers, "priceCurrency")
+			product.Prices = jsonLDPrices(obj)
+			if availability := jsonLDString(offers, "availability"); availability != "" {
+				product.InStock = strings.Contains(availability, "InStock") || strings.Contains(availability, "LimitedAvailability")
+			}
+		}
+
+		ids := jsonLDIdentifiers(obj)
+		ids.apply(&product)
+
+		if rating := jsonLDObject(obj, "aggregateRating"); rating != nil {
+			product.Rating = jsonLDString(rating, "ratingValue")
+			product.Reviews = jsonLDString(rating, "reviewCount")
+			if product.Reviews == "" {
+				product.Reviews = jsonLDString(rating, "ratingCount")
+			}
+		}
+
+		if product.Name != "" {
+			products = append(products, product)
+		}
+	}
+
+	return products
+}
+
+// jsonLDPrices collects a price per offer, looking inside AggregateOffer
+// wrappers, so products sold in several currencies keep every price.
+func jsonLDPrices(product map[string]interface{}) []PriceValue {
+	var prices []PriceValue
+	seen := make(map[PriceValue]bool)
+
+	var collect func(value interface{})
+	collect = func(value interface{}) {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				collect(item)
+			}
+		case map[string]interface{}:
+			if nested, ok := v["offers"]; ok {
+				collect(nested)
+			}
+			amount := jsonLDString(v, "price")
+			if amount == "" {
+				amount = jsonLDString(v, "lowPrice")
+			}
+			price := PriceValue{Amount: amount, Currency: jsonLDString(v, "priceCurrency")}
+			if amount != "" && !seen[price] {
+				seen[price] = true
+				prices = append(prices, price)
+			}
+		}
+	}
+	collect(product["offers"])
+
+	return prices
+}
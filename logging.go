@@ -0,0 +1,59 @@
+package goscraper
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func (c *Client) logger() *zap.Logger {
+	if c.config.Logger != nil {
+		return c.config.Logger
+	}
+	return zap.NewNop()
+}
+
+// logAttempt reports an attempt about to be sent at debug level. userAgent
+// is empty for stealth requests, whose client picks its own.
+func (c *Client) logAttempt(rawURL string, attempt int, userAgent string, proxy *url.URL) {
+	logger := c.logger()
+	if !logger.Core().Enabled(zap.DebugLevel) {
+		return
+	}
+
+	fields := []zap.Field{zap.String("url", rawURL), zap.Int("attempt", attempt+1)}
+	if userAgent != "" {
+		fields = append(fields, zap.String("user_agent", userAgent))
+	}
+	if proxy != nil {
+		fields = append(fields, zap.String("proxy", proxy.Redacted()))
+	}
+	logger.Debug("Sending request", fields...)
+}
+
+// logRetry reports at debug level that the attempt numbered attempt, counting
+// from zero, failed with resp or err and is retried after delay.
+func (c *Client) logRetry(rawURL string, attempt int, resp *http.Response, err error, delay time.Duration) {
+	c.logger().Debug("Retrying request",
+		zap.String("url", rawURL),
+		zap.Int("attempt", attempt+1),
+		zap.String("reason", retryReason(resp, err)),
+		zap.Duration("delay", delay),
+	)
+}
+
+// logFinished reports the outcome of a request at debug level.
+func (c *Client) logFinished(method, rawURL string, start time.Time, resp *http.Response, err error) {
+	fields := []zap.Field{
+		zap.String("method", method),
+		zap.String("url", rawURL),
+		zap.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		c.logger().Debug("Request failed", append(fields, zap.Error(err))...)
+		return
+	}
+	c.logger().Debug("Request finished", append(fields, zap.Int("status", resp.StatusCode))...)
+}
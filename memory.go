@@ -0,0 +1,154 @@
+package goscraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ramusaaa/goscraper/pkg/cache"
+)
+
+// ErrMemoryPressure is returned for new work while heap usage is over the
+// WithMemoryBudget limit, and for responses that would push it over.
+var ErrMemoryPressure = errors.New("memory pressure")
+
+const memorySampleInterval = 250 * time.Millisecond
+
+// underPressure reports whether usage is within a quarter of the budget.
+func underPressure(usage, budget uint64) bool {
+	return usage >= budget-budget/4
+}
+
+// memoryGuard applies a scraper's memory budget: work is refused over the
+// budget and serialized when close to it, so in-flight responses cannot pile up.
+// The heap is sampled in the background until close is called. When a
+// sample first finds usage close to the budget, the shrink functions run to
+// release memory held by the scraper's caches and pools; they run again
+// only after usage has dropped back and come close once more.
+type memoryGuard struct {
+	budget   uint64
+	throttle chan struct{}
+	usage    atomic.Uint64
+	shrink   []func()
+	// shrunk is set while the current pressure episode has been shrunk.
+	// Only sample uses it, from one goroutine at a time.
+	shrunk bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newMemoryGuard(budget uint64, shrink ...func()) *memoryGuard {
+	if budget == 0 {
+		return nil
+	}
+	g := &memoryGuard{
+		budget:   budget,
+		throttle: make(chan struct{}, 1),
+		shrink:   shrink,
+		stop:     make(chan struct{}),
+	}
+	g.sample()
+	go g.monitor()
+	return g
+}
+
+func (g *memoryGuard) monitor() {
+	ticker := time.NewTicker(memorySampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.sample()
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+func (g *memoryGuard) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	g.usage.Store(stats.HeapAlloc)
+
+	pressure := underPressure(stats.HeapAlloc, g.budget)
+	if pressure && !g.shrunk {
+		for _, shrink := range g.shrink {
+			shrink()
+		}
+	}
+	g.shrunk = pressure
+}
+
+// close stops the background sampler.
+func (g *memoryGuard) close() {
+	if g == nil {
+		return
+	}
+	g.stopOnce.Do(func() { close(g.stop) })
+}
+
+// admit checks the budget without waiting.
+func (g *memoryGuard) admit() error {
+	if g == nil {
+		return nil
+	}
+	if usage := g.usage.Load(); usage >= g.budget {
+		return fmt.Errorf("%w: heap at %d bytes, budget %d", ErrMemoryPressure, usage, g.budget)
+	}
+	return nil
+}
+
+// acquire admits a unit of work, waiting for other work to finish first when
+// memory is tight. The returned release must be called when the work is done.
+func (g *memoryGuard) acquire(ctx context.Context) (release func(), err error) {
+	if err := g.admit(); err != nil {
+		return nil, err
+	}
+	if g == nil || !underPressure(g.usage.Load(), g.budget) {
+		return func() {}, nil
+	}
+
+	select {
+	case g.throttle <- struct{}{}:
+		return func() { <-g.throttle }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// remaining is how many more bytes a response may take before the budget is
+// exceeded, or -1 when there is no budget.
+func (g *memoryGuard) remaining() int64 {
+	if g == nil {
+		return -1
+	}
+	usage := g.usage.Load()
+	if usage >= g.budget {
+		return 0
+	}
+	return int64(g.budget - usage)
+}
+
+// shrinkCacheFraction is the share of an in-process response cache, most
+// recently used first, that is kept under memory pressure. The cache may be
+// shared with other components, so it is trimmed rather than cleared.
+const shrinkCacheFraction = 0.5
+
+// memoryShrinkers returns what a scraper built from config can release under
+// memory pressure: part of an in-process response cache, and the idle
+// browsers of a JS challenge solver that pools them.
+func memoryShrinkers(config *Config) []func() {
+	var shrink []func()
+	if responses, ok := config.Cache.(*cache.MemoryCache); ok {
+		shrink = append(shrink, func() { responses.Trim(shrinkCacheFraction) })
+	}
+	if pool, ok := config.JSChallengeSolver.(interface{ Shrink() }); ok {
+		shrink = append(shrink, pool.Shrink)
+	}
+	return shrink
+}
@@ -0,0 +1,111 @@
+package goscraper
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	SourceJSONLD   = "json-ld"
+	SourceSelector = "selector"
+)
+
+// mergeSources combines a JSON-LD derived value with a selector derived one
+// field by field: JSON-LD wins whenever it has a value and the selector
+// result fills the gaps. The origin of every populated field is recorded in
+// sources under "<prefix>.<json field name>".
+func mergeSources[T any](structured, selected *T, prefix string, sources map[string]string) *T {
+	if structured == nil && selected == nil {
+		return nil
+	}
+
+	merged := new(T)
+	if selected != nil {
+		*merged = *selected
+	}
+
+	mergedVal := reflect.ValueOf(merged).Elem()
+	var structuredVal reflect.Value
+	if structured != nil {
+		structuredVal = reflect.ValueOf(structured).Elem()
+	}
+
+	t := mergedVal.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		key := prefix + "." + jsonFieldName(field)
+
+		if structured != nil && !structuredVal.Field(i).IsZero() {
+			mergedVal.Field(i).Set(structuredVal.Field(i))
+			sources[key] = SourceJSONLD
+		} else if !mergedVal.Field(i).IsZero() {
+			sources[key] = SourceSelector
+		}
+	}
+
+	return merged
+}
+
+// mergeProducts merges each JSON-LD product with the selector product
+// describing the same item, matched by GTIN, SKU, URL or name. JSON-LD
+// decides which products there are; selector products only fill the gaps
+// of the one they match. Field sources are recorded per product under
+// "products[<index>]".
+func mergeProducts(structured, selected []SmartProduct, sources map[string]string) []SmartProduct {
+	if len(structured) == 0 {
+		if len(selected) > 0 {
+			sources["products"] = SourceSelector
+		}
+		return selected
+	}
+	sources["products"] = SourceJSONLD
+
+	used := make([]bool, len(selected))
+	merged := make([]SmartProduct, len(structured))
+	for i := range structured {
+		var match *SmartProduct
+		if j := matchProduct(structured[i], selected, used); j >= 0 {
+			used[j] = true
+			match = &selected[j]
+		}
+		merged[i] = *mergeSources(&structured[i], match, fmt.Sprintf("products[%d]", i), sources)
+	}
+	return merged
+}
+
+// matchProduct returns the index of the first unused product in candidates
+// that is the same item as product, or -1. Identifiers are tried before
+// URLs and names, which are less specific.
+func matchProduct(product SmartProduct, candidates []SmartProduct, used []bool) int {
+	keys := []func(p SmartProduct) string{
+		func(p SmartProduct) string { return p.GTIN },
+		func(p SmartProduct) string { return strings.ToLower(p.SKU) },
+		func(p SmartProduct) string { return strings.TrimSuffix(p.URL, "/") },
+		func(p SmartProduct) string { return strings.ToLower(strings.Join(strings.Fields(p.Name), " ")) },
+	}
+	for _, key := range keys {
+		want := key(product)
+		if want == "" {
+			continue
+		}
+		for j, candidate := range candidates {
+			if !used[j] && key(candidate) == want {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
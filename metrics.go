@@ -0,0 +1,85 @@
+package goscraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// requestHost is the host rawURL points at, or "" if it does not parse.
+func requestHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// recordRetry counts a retry of a request to host with WithMetrics. resp and
+// err are the outcome of the attempt that failed.
+func (c *Client) recordRetry(host string, resp *http.Response, err error) {
+	if c.config.Metrics == nil {
+		return
+	}
+	c.config.Metrics.RecordHostRetry("http", host, retryReason(resp, err))
+}
+
+func retryReason(resp *http.Response, err error) string {
+	switch {
+	case err == nil && resp != nil:
+		return strconv.Itoa(resp.StatusCode)
+	case errors.Is(err, ErrSlowOrigin):
+		return "slow_origin"
+	case errors.Is(err, ErrUnexpectedContentType):
+		return "content_type"
+	case isProxyError(err):
+		return "proxy"
+	}
+	return errorKind(err)
+}
+
+// recordRequest reports a finished Do call with WithMetrics. Failed requests
+// that got no response are counted with status "error" and in
+// goscraper_errors_total by kind.
+func (s *DefaultScraper) recordRequest(method, rawURL string, resp *Response, err error, duration time.Duration) {
+	metrics := s.config.Metrics
+	if metrics == nil {
+		return
+	}
+
+	status, size := "error", 0
+	var nonHTML *NonHTMLContentError
+	var scrapeErr *ScrapeError
+	switch {
+	case err == nil:
+		status, size = strconv.Itoa(resp.StatusCode), len(resp.Body)
+	case errors.As(err, &nonHTML):
+		status, size = strconv.Itoa(nonHTML.StatusCode), len(nonHTML.Body)
+	case errors.As(err, &scrapeErr) && scrapeErr.StatusCode != 0:
+		status = strconv.Itoa(scrapeErr.StatusCode)
+	default:
+		metrics.RecordError(errorKind(err), "scraper")
+	}
+	metrics.RecordRequest(method, requestHost(rawURL), status, duration, int64(size))
+}
+
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrDisallowedByRobots):
+		return "robots"
+	case errors.Is(err, ErrMemoryPressure):
+		return "memory"
+	}
+	var netErr interface{ Timeout() bool }
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return "request"
+}
@@ -0,0 +1,368 @@
+package goscraper
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ExtractMicroformats parses microformats2 markup (h-card, h-entry, h-feed
+// and friends) into the canonical mf2 JSON structure:
+//
+//	{"items": [...], "rels": {...}, "rel-urls": {...}}
+//
+// Implied name, photo and url properties follow the mf2 parsing rules in
+// simplified form; the value-class pattern is not supported.
+func (p *Parser) ExtractMicroformats() map[string]interface{} {
+	items := []interface{}{}
+	p.doc.Selection.Children().Each(func(i int, s *goquery.Selection) {
+		items = append(items, p.findMicroformatRoots(s)...)
+	})
+
+	rels := map[string]interface{}{}
+	relURLs := map[string]interface{}{}
+	p.doc.Find("a[rel][href], link[rel][href], area[rel][href]").Each(func(i int, s *goquery.Selection) {
+		href := p.mfURL(s.AttrOr("href", ""))
+		relValues := strings.Fields(s.AttrOr("rel", ""))
+		for _, rel := range relValues {
+			urls, _ := rels[rel].([]string)
+			if !containsString(urls, href) {
+				rels[rel] = append(urls, href)
+			}
+		}
+		if _, exists := relURLs[href]; !exists {
+			entry := map[string]interface{}{"rels": relValues}
+			if text := strings.TrimSpace(s.Text()); text != "" {
+				entry["text"] = text
+			}
+			relURLs[href] = entry
+		}
+	})
+
+	return map[string]interface{}{
+		"items":    items,
+		"rels":     rels,
+		"rel-urls": relURLs,
+	}
+}
+
+func (p *Parser) findMicroformatRoots(s *goquery.Selection) []interface{} {
+	if len(mfClasses(s, "h-")) > 0 {
+		return []interface{}{p.parseMicroformat(s)}
+	}
+
+	var items []interface{}
+	s.Children().Each(func(i int, child *goquery.Selection) {
+		items = append(items, p.findMicroformatRoots(child)...)
+	})
+	return items
+}
+
+func (p *Parser) parseMicroformat(s *goquery.Selection) map[string]interface{} {
+	item := map[string]interface{}{
+		"type": mfClasses(s, "h-"),
+	}
+	properties := map[string][]interface{}{}
+	var children []interface{}
+
+	s.Children().Each(func(i int, child *goquery.Selection) {
+		p.walkMicroformatProperties(child, properties, &children)
+	})
+
+	p.addImpliedProperties(s, properties)
+
+	props := make(map[string]interface{}, len(properties))
+	for name, values := range properties {
+		props[name] = values
+	}
+	item["properties"] = props
+	if len(children) > 0 {
+		item["children"] = children
+	}
+	return item
+}
+
+func (p *Parser) walkMicroformatProperties(s *goquery.Selection, properties map[string][]interface{}, children *[]interface{}) {
+	propClasses := mfPropertyClasses(s)
+
+	if len(mfClasses(s, "h-")) > 0 {
+		nested := p.parseMicroformat(s)
+		if len(propClasses) == 0 {
+			*children = append(*children, nested)
+			return
+		}
+		for _, class := range propClasses {
+			value := make(map[string]interface{}, len(nested)+1)
+			for k, v := range nested {
+				value[k] = v
+			}
+			value["value"] = p.nestedMicroformatValue(s, class, nested)
+			name := class[strings.Index(class, "-")+1:]
+			properties[name] = append(properties[name], value)
+		}
+		return
+	}
+
+	for _, class := range propClasses {
+		name := class[strings.Index(class, "-")+1:]
+		properties[name] = append(properties[name], p.microformatValue(s, class))
+	}
+
+	s.Children().Each(func(i int, child *goquery.Selection) {
+		p.walkMicroformatProperties(child, properties, children)
+	})
+}
+
+func (p *Parser) microformatValue(s *goquery.Selection, class string) interface{} {
+	tag := goquery.NodeName(s)
+
+	switch {
+	case strings.HasPrefix(class, "u-"):
+		for _, attr := range []struct{ tags, attr string }{
+			{"a area link", "href"},
+			{"img audio video source iframe", "src"},
+			{"video", "poster"},
+			{"object", "data"},
+		} {
+			if value, exists := s.Attr(attr.attr); exists && containsString(strings.Fields(attr.tags), tag) {
+				return p.mfURL(value)
+			}
+		}
+		if value, exists := s.Attr("value"); exists && (tag == "data" || tag == "input") {
+			return p.mfURL(value)
+		}
+		return p.mfURL(strings.TrimSpace(s.Text()))
+
+	case strings.HasPrefix(class, "dt-"):
+		if value, exists := s.Attr("datetime"); exists && (tag == "time" || tag == "ins" || tag == "del") {
+			return value
+		}
+		if value, exists := s.Attr("title"); exists && tag == "abbr" {
+			return value
+		}
+		if value, exists := s.Attr("value"); exists && (tag == "data" || tag == "input") {
+			return value
+		}
+		return strings.TrimSpace(s.Text())
+
+	case strings.HasPrefix(class, "e-"):
+		html, _ := s.Html()
+		return map[string]interface{}{
+			"html":  strings.TrimSpace(html),
+			"value": strings.TrimSpace(s.Text()),
+		}
+
+	default:
+		if value, exists := s.Attr("title"); exists && tag == "abbr" {
+			return value
+		}
+		if value, exists := s.Attr("alt"); exists && (tag == "img" || tag == "area") {
+			return value
+		}
+		if value, exists := s.Attr("value"); exists && (tag == "data" || tag == "input") {
+			return value
+		}
+		return strings.TrimSpace(s.Text())
+	}
+}
+
+// nestedMicroformatValue is the plain "value" of an embedded microformat,
+// e.g. the author's name for a p-author h-card.
+func (p *Parser) nestedMicroformatValue(s *goquery.Selection, class string, nested map[string]interface{}) interface{} {
+	props, _ := nested["properties"].(map[string]interface{})
+	switch {
+	case strings.HasPrefix(class, "p-"):
+		if name := mfFirst(props, "name"); name != nil {
+			return name
+		}
+	case strings.HasPrefix(class, "u-"):
+		if u := mfFirst(props, "url"); u != nil {
+			return u
+		}
+	}
+	return p.microformatValue(s, class)
+}
+
+func (p *Parser) addImpliedProperties(s *goquery.Selection, properties map[string][]interface{}) {
+	hasPrefix := func(prefix string) bool {
+		found := false
+		s.Find("*").EachWithBreak(func(i int, child *goquery.Selection) bool {
+			if len(mfClasses(child, prefix)) > 0 {
+				found = true
+			}
+			return !found
+		})
+		return found
+	}
+	hasNested := s.Find("[class*='h-']").FilterFunction(func(i int, child *goquery.Selection) bool {
+		return len(mfClasses(child, "h-")) > 0
+	}).Length() > 0
+
+	if _, ok := properties["name"]; !ok && !hasPrefix("p-") && !hasPrefix("e-") && !hasNested {
+		name := strings.TrimSpace(s.Text())
+		if goquery.NodeName(s) == "img" || goquery.NodeName(s) == "area" {
+			name = s.AttrOr("alt", "")
+		} else if abbr := s.AttrOr("title", ""); goquery.NodeName(s) == "abbr" && abbr != "" {
+			name = abbr
+		}
+		properties["name"] = []interface{}{name}
+	}
+
+	if _, ok := properties["photo"]; !ok && !hasPrefix("u-") {
+		if src, exists := s.Attr("src"); exists && goquery.NodeName(s) == "img" {
+			properties["photo"] = []interface{}{p.mfURL(src)}
+		} else if img := s.ChildrenFiltered("img[src]"); img.Length() == 1 {
+			properties["photo"] = []interface{}{p.mfURL(img.AttrOr("src", ""))}
+		}
+	}
+
+	if _, ok := properties["url"]; !ok && !hasPrefix("u-") {
+		if href, exists := s.Attr("href"); exists && goquery.NodeName(s) == "a" {
+			properties["url"] = []interface{}{p.mfURL(href)}
+		} else if a := s.ChildrenFiltered("a[href]"); a.Length() == 1 {
+			properties["url"] = []interface{}{p.mfURL(a.AttrOr("href", ""))}
+		}
+	}
+}
+
+func (p *Parser) mfURL(ref string) string {
+	if p.doc.Url == nil {
+		return ref
+	}
+	return resolveURL(p.doc.Url.String(), ref)
+}
+
+// mfClasses returns the class names that start with prefix and name a
+// microformat vocabulary, e.g. "h-entry" for prefix "h-".
+func mfClasses(s *goquery.Selection, prefix string) []string {
+	var classes []string
+	for _, class := range strings.Fields(s.AttrOr("class", "")) {
+		if strings.HasPrefix(class, prefix) && len(class) > len(prefix) && isMicroformatName(class[len(prefix):]) {
+			classes = append(classes, class)
+		}
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+func mfPropertyClasses(s *goquery.Selection) []string {
+	var classes []string
+	for _, prefix := range []string{"p-", "u-", "dt-", "e-"} {
+		classes = append(classes, mfClasses(s, prefix)...)
+	}
+	return classes
+}
+
+func isMicroformatName(name string) bool {
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z') && r != '-' {
+			return false
+		}
+	}
+	return !strings.HasPrefix(name, "-") && !strings.HasSuffix(name, "-")
+}
+
+// mfFirst returns the first value of an mf2 property, if any.
+func mfFirst(props map[string]interface{}, name string) interface{} {
+	values, _ := props[name].([]interface{})
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+// mfString flattens the first value of an mf2 property to text.
+func mfString(props map[string]interface{}, name string) string {
+	return mfValueString(mfFirst(props, name))
+}
+
+func mfStrings(props map[string]interface{}, name string) []string {
+	values, _ := props[name].([]interface{})
+	var result []string
+	for _, v := range values {
+		if s := mfValueString(v); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// mfValueString returns plain strings as is, and the "value" of embedded
+// microformats and e-* properties.
+func mfValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if s, ok := v["value"].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// microformatOfType finds the first item of the given type, searching
+// nested children so an h-entry inside an h-feed is found too.
+func microformatOfType(items []interface{}, typeName string) map[string]interface{} {
+	for _, raw := range items {
+		item, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if types, _ := item["type"].([]string); containsString(types, typeName) {
+			props, _ := item["properties"].(map[string]interface{})
+			return props
+		}
+		if children, ok := item["children"].([]interface{}); ok {
+			if props := microformatOfType(children, typeName); props != nil {
+				return props
+			}
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+func articleFromMicroformats(p *Parser) *Article {
+	items, _ := p.ExtractMicroformats()["items"].([]interface{})
+	entry := microformatOfType(items, "h-entry")
+	if entry == nil {
+		return nil
+	}
+	categories := mfStrings(entry, "category")
+	article := &Article{
+		Headline:    mfString(entry, "name"),
+		Subheadline: mfString(entry, "summary"),
+		Author:      mfString(entry, "author"),
+		PublishDate: mfString(entry, "published"),
+		Content:     mfString(entry, "content"),
+		Tags:        categories,
+	}
+	if len(categories) > 0 {
+		article.Category = categories[0]
+	}
+	return article
+}
+
+func blogPostFromMicroformats(p *Parser) *BlogPost {
+	article := articleFromMicroformats(p)
+	if article == nil {
+		return nil
+	}
+	return &BlogPost{
+		Title:       article.Headline,
+		Author:      article.Author,
+		PublishDate: article.PublishDate,
+		Content:     article.Content,
+		Tags:        article.Tags,
+	}
+}
@@ -0,0 +1,98 @@
+package goscraper
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// OpenGraph holds a page's Open Graph (og:) properties. Image and URL are
+// resolved against the page URL.
+type OpenGraph struct {
+	Title       string `json:"title,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Image       string `json:"image,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Description string `json:"description,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// TwitterCard holds a page's Twitter card (twitter:) properties. Image is
+// resolved against the page URL.
+type TwitterCard struct {
+	Card        string `json:"card,omitempty"`
+	Site        string `json:"site,omitempty"`
+	Creator     string `json:"creator,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+// ExtractOpenGraph returns the page's Open Graph properties. Tags are read
+// from either their property or their name attribute, whatever the case of
+// the key; when a property is repeated the first value wins, as the
+// protocol specifies.
+func (p *Parser) ExtractOpenGraph() OpenGraph {
+	meta := p.socialMeta("og:")
+	base := p.BaseURL()
+	return OpenGraph{
+		Title:       meta["og:title"],
+		Type:        meta["og:type"],
+		Image:       resolveMetaURL(base, firstNonEmpty(meta["og:image"], meta["og:image:url"], meta["og:image:secure_url"])),
+		URL:         resolveMetaURL(base, meta["og:url"]),
+		Description: meta["og:description"],
+		SiteName:    meta["og:site_name"],
+	}
+}
+
+// ExtractTwitterCard returns the page's Twitter card properties, read like
+// ExtractOpenGraph reads og: tags.
+func (p *Parser) ExtractTwitterCard() TwitterCard {
+	meta := p.socialMeta("twitter:")
+	return TwitterCard{
+		Card:        meta["twitter:card"],
+		Site:        meta["twitter:site"],
+		Creator:     meta["twitter:creator"],
+		Title:       meta["twitter:title"],
+		Description: meta["twitter:description"],
+		Image:       resolveMetaURL(p.BaseURL(), firstNonEmpty(meta["twitter:image"], meta["twitter:image:src"])),
+	}
+}
+
+// socialMeta returns the first non-empty content of every meta tag whose
+// property or name starts with prefix, keyed by the lowercased key.
+func (p *Parser) socialMeta(prefix string) map[string]string {
+	meta := make(map[string]string)
+	p.doc.Find("meta[content]").Each(func(i int, s *goquery.Selection) {
+		content := strings.TrimSpace(s.AttrOr("content", ""))
+		if content == "" {
+			return
+		}
+		for _, attr := range []string{"property", "name"} {
+			key := strings.ToLower(strings.TrimSpace(s.AttrOr(attr, "")))
+			if strings.HasPrefix(key, prefix) {
+				if _, seen := meta[key]; !seen {
+					meta[key] = content
+				}
+				break
+			}
+		}
+	})
+	return meta
+}
+
+func resolveMetaURL(base, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	return resolveURL(base, ref)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
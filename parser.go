@@ -1,18 +1,53 @@
 package goscraper
 
 import (
+	"net/url"
 	"regexp"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/ramusaaa/goscraper/pkg/xpath"
+	"golang.org/x/net/html"
 )
 
 type Parser struct {
-	doc *goquery.Document
+	doc     *goquery.Document
+	baseURL string
 }
 
+// NewParser wraps doc. Relative links and image sources are resolved against
+// the document's URL when goquery knows it; use SetBaseURL otherwise.
 func NewParser(doc *goquery.Document) *Parser {
-	return &Parser{doc: doc}
+	p := &Parser{doc: doc}
+	if doc.Url != nil {
+		p.baseURL = doc.Url.String()
+	}
+	return p
+}
+
+// responseParser returns a parser for resp that falls back to resp.URL as
+// the base URL.
+func responseParser(resp *Response) *Parser {
+	p := NewParser(resp.Document)
+	if p.baseURL == "" {
+		p.baseURL = resp.URL
+	}
+	return p
+}
+
+// SetBaseURL sets the URL of the page, which relative links and image
+// sources are resolved against.
+func (p *Parser) SetBaseURL(baseURL string) {
+	p.baseURL = baseURL
+}
+
+// BaseURL returns the URL relative references resolve against: the page URL,
+// or the document's <base href> resolved against it.
+func (p *Parser) BaseURL() string {
+	if href, ok := p.doc.Find("base[href]").First().Attr("href"); ok {
+		return resolveURL(p.baseURL, href)
+	}
+	return p.baseURL
 }
 
 func (p *Parser) ExtractText(selector string) string {
@@ -45,27 +80,96 @@ func (p *Parser) ExtractAttrs(selector, attr string) []string {
 	return attrs
 }
 
+// ExtractTextXPath is ExtractText for an XPath expression, evaluated
+// against the same document. An expression ending in an attribute step,
+// like //a/@href, yields the attribute's value, and scalar expressions like
+// count(//a) their value. Invalid expressions select nothing.
+func (p *Parser) ExtractTextXPath(expr string) string {
+	compiled, err := xpath.Compile(expr)
+	if err != nil || len(p.doc.Nodes) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(compiled.Text(p.doc.Nodes[0]))
+}
+
+func (p *Parser) ExtractTextsXPath(expr string) []string {
+	var texts []string
+	for _, n := range p.selectXPath(expr) {
+		if text := strings.TrimSpace(xpath.InnerText(n)); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+func (p *Parser) ExtractAttrsXPath(expr, attr string) []string {
+	var attrs []string
+	for _, n := range p.selectXPath(expr) {
+		for _, a := range n.Attr {
+			if a.Key == attr {
+				attrs = append(attrs, a.Val)
+				break
+			}
+		}
+	}
+	return attrs
+}
+
+func (p *Parser) selectXPath(expr string) []*html.Node {
+	compiled, err := xpath.Compile(expr)
+	if err != nil || len(p.doc.Nodes) == 0 {
+		return nil
+	}
+	return compiled.Select(p.doc.Nodes[0])
+}
+
+// ExtractLinks returns every link with its URL resolved against BaseURL.
+// RawURL keeps the href as written.
 func (p *Parser) ExtractLinks() []Link {
 	var links []Link
+	base := p.BaseURL()
 	p.doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
 		href, _ := s.Attr("href")
 		text := strings.TrimSpace(s.Text())
 		links = append(links, Link{
-			URL:  href,
-			Text: text,
+			URL:    resolveURL(base, href),
+			RawURL: href,
+			Text:   text,
 		})
 	})
 	return links
 }
 
+// ExtractImages returns the page's <img> images, each once by resolved
+// URL. The source is the largest srcset candidate, else the first lazy-load
+// attribute set (data-src and the like), else src. Data URIs and images
+// sized as tracking pixels are left out.
 func (p *Parser) ExtractImages() []Image {
 	var images []Image
+	seen := make(map[string]bool)
+	base := p.BaseURL()
 	p.doc.Find("img").Each(func(i int, s *goquery.Selection) {
-		src, _ := s.Attr("src")
+		src := imageSource(s)
+		if src == "" || isDataURI(src) {
+			return
+		}
+		width, height, pixel := imageSize(s)
+		if pixel {
+			return
+		}
+
+		url := resolveURL(base, src)
+		if seen[url] {
+			return
+		}
+		seen[url] = true
 		alt, _ := s.Attr("alt")
 		images = append(images, Image{
-			URL: src,
-			Alt: alt,
+			URL:    url,
+			RawURL: src,
+			Alt:    alt,
+			Width:  width,
+			Height: height,
 		})
 	})
 	return images
@@ -90,6 +194,75 @@ func (p *Parser) ExtractMetaTags() map[string]string {
 	return meta
 }
 
+// ExtractMetaTagsMulti is like ExtractMetaTags but keeps every value of a
+// repeated name or property, in document order, e.g. all og:image tags.
+func (p *Parser) ExtractMetaTagsMulti() map[string][]string {
+	meta := make(map[string][]string)
+	
+	p.doc.Find("meta[content]").Each(func(i int, s *goquery.Selection) {
+		content, _ := s.Attr("content")
+		for _, attr := range []string{"name", "property"} {
+			if key, exists := s.Attr(attr); exists {
+				meta[key] = append(meta[key], content)
+			}
+		}
+	})
+	
+	return meta
+}
+
+// extractMetaImages returns the og:image previews declared in meta tags,
+// each paired with the og:image:alt that follows it.
+func (p *Parser) extractMetaImages() []Image {
+	var images []Image
+	base := p.BaseURL()
+	p.doc.Find("meta[property][content]").Each(func(i int, s *goquery.Selection) {
+		content := strings.TrimSpace(s.AttrOr("content", ""))
+		switch s.AttrOr("property", "") {
+		case "og:image", "og:image:url":
+			if content != "" {
+				images = append(images, Image{URL: resolveURL(base, content), RawURL: content})
+			}
+		case "og:image:alt":
+			if len(images) > 0 && images[len(images)-1].Alt == "" {
+				images[len(images)-1].Alt = content
+			}
+		}
+	})
+	return images
+}
+
+// mergeImages appends the images in extra whose URL is not already listed.
+func mergeImages(images, extra []Image) []Image {
+	seen := make(map[string]bool, len(images))
+	for _, img := range images {
+		seen[img.URL] = true
+	}
+	for _, img := range extra {
+		if !seen[img.URL] {
+			seen[img.URL] = true
+			images = append(images, img)
+		}
+	}
+	return images
+}
+
+// ExtractCanonical returns the href of <link rel="canonical">, or "" when
+// the page does not declare one.
+func (p *Parser) ExtractCanonical() string {
+	canonical := ""
+	p.doc.Find("link[rel][href]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		for _, rel := range strings.Fields(strings.ToLower(s.AttrOr("rel", ""))) {
+			if rel == "canonical" {
+				canonical = strings.TrimSpace(s.AttrOr("href", ""))
+				return false
+			}
+		}
+		return true
+	})
+	return canonical
+}
+
 func (p *Parser) ExtractTitle() string {
 	return p.ExtractText("title")
 }
@@ -105,11 +278,37 @@ func (p *Parser) ExtractByRegex(pattern string) []string {
 }
 
 type Link struct {
-	URL  string `json:"url"`
-	Text string `json:"text"`
+	URL    string `json:"url"`
+	RawURL string `json:"raw_url,omitempty"`
+	Text   string `json:"text"`
 }
 
 type Image struct {
-	URL string `json:"url"`
-	Alt string `json:"alt"`
-}
\ No newline at end of file
+	URL    string `json:"url"`
+	RawURL string `json:"raw_url,omitempty"`
+	Alt    string `json:"alt"`
+	// Width and Height come from the tag's attributes, and are 0 when
+	// not given in pixels.
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// resolveURL resolves ref against base, returning ref unchanged when either
+// cannot be parsed.
+func resolveURL(base, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || base == "" {
+		return ref
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+
+	return baseURL.ResolveReference(refURL).String()
+}
@@ -0,0 +1,149 @@
+package goscraper
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var paywallSelectors = []string{
+	".paywall", "#paywall", "[class*='paywall']", "[data-paywall]",
+	".subscriber-only", ".subscribers-only", "[class*='subscriber-only']",
+	".premium-content", ".meteredContent", ".tp-modal", ".tp-container-inner",
+}
+
+// paywallScripts name paywall vendors and are matched against both the src
+// and the body of a script. The generic words only count in a src path, since
+// inline configs mention them just as often to switch a paywall off.
+var paywallScripts = []string{
+	"piano.io", "tinypass.com", "pelcro.com", "poool.fr", "zephr",
+	"laterpay", "memberful",
+}
+
+var paywallScriptPaths = []string{"/paywall", "/metering", "/metered"}
+
+var paywallPhrases = []string{
+	"subscribe to continue", "subscribe to read", "subscribers only",
+	"this article is for subscribers", "already a subscriber", "to continue reading",
+	"abone olun", "devamını okumak için",
+}
+
+// DetectPaywall reports whether the page looks paywalled. The confidence is
+// the sum of the matched signals: schema.org isAccessibleForFree=false is the
+// strongest, followed by paywall markup, metering scripts and teaser-length
+// content next to a subscribe prompt.
+func (p *Parser) DetectPaywall() (bool, float64) {
+	confidence := 0.0
+
+	if p.jsonLDNotAccessibleForFree() {
+		confidence += 0.6
+	}
+
+	for _, selector := range paywallSelectors {
+		if p.doc.Find(selector).Length() > 0 {
+			confidence += 0.3
+			break
+		}
+	}
+
+	scriptFound := false
+	p.doc.Find("script").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		src, _ := s.Attr("src")
+		src = strings.ToLower(src)
+		body := src + " " + strings.ToLower(s.Text())
+		for _, marker := range paywallScripts {
+			if strings.Contains(body, marker) {
+				scriptFound = true
+				return false
+			}
+		}
+		for _, marker := range paywallScriptPaths {
+			if strings.Contains(src, marker) {
+				scriptFound = true
+				return false
+			}
+		}
+		return true
+	})
+	if scriptFound {
+		confidence += 0.2
+	}
+
+	if p.looksTruncated() {
+		confidence += 0.2
+	}
+
+	if confidence > 1 {
+		confidence = 1
+	}
+
+	return confidence >= 0.5, confidence
+}
+
+func (p *Parser) jsonLDNotAccessibleForFree() bool {
+	found := false
+	p.doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		var data interface{}
+		if err := json.Unmarshal([]byte(s.Text()), &data); err != nil {
+			return true
+		}
+		found = hasNotAccessibleForFree(data)
+		return !found
+	})
+	return found
+}
+
+func hasNotAccessibleForFree(data interface{}) bool {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		if free, ok := v["isAccessibleForFree"]; ok {
+			switch f := free.(type) {
+			case bool:
+				if !f {
+					return true
+				}
+			case string:
+				if strings.EqualFold(f, "false") {
+					return true
+				}
+			}
+		}
+		for _, child := range v {
+			if hasNotAccessibleForFree(child) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if hasNotAccessibleForFree(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Parser) looksTruncated() bool {
+	text := strings.ToLower(p.doc.Find("body").Text())
+
+	prompt := false
+	for _, phrase := range paywallPhrases {
+		if strings.Contains(text, phrase) {
+			prompt = true
+			break
+		}
+	}
+	if !prompt {
+		return false
+	}
+
+	content := ""
+	for _, selector := range []string{"article", ".article-body", ".entry-content", ".post-content", ".content"} {
+		if content = p.ExtractText(selector); content != "" {
+			break
+		}
+	}
+
+	return len(content) < 1500
+}
@@ -0,0 +1,101 @@
+package goscraper
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// DefaultPhoneRegion is the region extractPhoneNumbers reads national
+// numbers for.
+const DefaultPhoneRegion = "TR"
+
+// phoneCandidateRe finds runs of digits joined by the separators numbers
+// are written with. A run may hold several numbers; they are split apart
+// by validation.
+var phoneCandidateRe = regexp.MustCompile(`[+(]?\d[\d\s().\-/\x{00a0}]*\d`)
+
+// phoneGroupRe splits a candidate into its digit groups, keeping a leading
+// + with the group it belongs to.
+var phoneGroupRe = regexp.MustCompile(`\+?\d+`)
+
+// maxPhoneGroups bounds the groups tried as one number, which keeps
+// splitting long runs cheap.
+const maxPhoneGroups = 8
+
+// ExtractPhoneNumbers finds the phone numbers in html that are valid for
+// region, an ISO 3166 code such as "US" or "GB", and returns them in E.164
+// form (+14155550123), each once. Numbers written internationally, with +
+// or 00, are accepted whatever their country, as long as they are valid
+// for it. An unknown or empty region accepts only international numbers.
+// Numbers are parsed and validated with the libphonenumber metadata.
+func ExtractPhoneNumbers(html string, region string) []string {
+	home := strings.ToUpper(region)
+	if phonenumbers.GetCountryCodeForRegion(home) == 0 {
+		home = ""
+	}
+
+	seen := make(map[string]bool)
+	var phones []string
+	for _, loc := range phoneCandidateRe.FindAllStringIndex(html, -1) {
+		// Digits glued to words are identifiers, not phone numbers.
+		if r, _ := utf8.DecodeLastRuneInString(html[:loc[0]]); loc[0] > 0 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			continue
+		}
+		if r, _ := utf8.DecodeRuneInString(html[loc[1]:]); loc[1] < len(html) && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			continue
+		}
+
+		groups := phoneGroupRe.FindAllString(html[loc[0]:loc[1]], -1)
+		for i := 0; i < len(groups); {
+			end := i + maxPhoneGroups
+			if end > len(groups) {
+				end = len(groups)
+			}
+			matched := false
+			// Take the longest run of groups that is a valid number.
+			for j := end; j > i; j-- {
+				if phone, ok := normalizePhone(groups[i:j], home); ok {
+					if !seen[phone] {
+						seen[phone] = true
+						phones = append(phones, phone)
+					}
+					i, matched = j, true
+					break
+				}
+			}
+			if !matched {
+				i++
+			}
+		}
+	}
+	return phones
+}
+
+// normalizePhone returns the E.164 form of the number written as groups,
+// if it is valid. National numbers are read as home ones, and must carry
+// the trunk prefix where home numbers are written with one, so that bare
+// digit runs such as order numbers are not taken for numbers.
+func normalizePhone(groups []string, home string) (string, bool) {
+	raw := strings.Join(groups, "")
+	if strings.LastIndex(raw, "+") > 0 {
+		return "", false
+	}
+	// 00 is the international prefix in most regions, so it is read as
+	// one whatever the home region.
+	if strings.HasPrefix(raw, "00") {
+		raw = "+" + raw[2:]
+	}
+	if !strings.HasPrefix(raw, "+") && home == "" {
+		return "", false
+	}
+
+	number, err := phonenumbers.ParseAndKeepRawInput(raw, home)
+	if err != nil || !phonenumbers.IsValidNumber(number) || !phonenumbers.IsNationalPrefixPresentIfRequired(number) {
+		return "", false
+	}
+	return phonenumbers.Format(number, phonenumbers.E164), true
+}
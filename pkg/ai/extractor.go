@@ -4,14 +4,17 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/tidwall/gjson"
 )
 
 type AIExtractor struct {
-	models map[string]Model
-	config *AIConfig
+	models  map[string]Model
+	config  *AIConfig
+	limiter *callLimiter
 }
 
 type Model interface {
@@ -28,6 +31,13 @@ type AIConfig struct {
 	MaxTokens       int               `json:"max_tokens"`
 	Temperature     float64           `json:"temperature"`
 	Confidence      float64           `json:"confidence_threshold"`
+
+	// MaxConcurrentCalls and TokensPerMinute keep model calls under provider
+	// quotas; zero means unlimited. When a limit is reached calls fail with
+	// ErrAIRateLimited, or block until capacity frees up if WaitWhenLimited.
+	MaxConcurrentCalls int  `json:"max_concurrent_calls,omitempty"`
+	TokensPerMinute    int  `json:"tokens_per_minute,omitempty"`
+	WaitWhenLimited    bool `json:"wait_when_limited,omitempty"`
 }
 
 type ModelConfig struct {
@@ -104,8 +114,9 @@ type TrainingExample struct {
 
 func NewAIExtractor(config *AIConfig) *AIExtractor {
 	extractor := &AIExtractor{
-		models: make(map[string]Model),
-		config: config,
+		models:  make(map[string]Model),
+		config:  config,
+		limiter: newCallLimiter(config),
 	}
 
 	for name, modelConfig := range config.Models {
@@ -121,17 +132,22 @@ func NewAIExtractor(config *AIConfig) *AIExtractor {
 func (a *AIExtractor) Extract(ctx context.Context, input *ExtractionInput) (*ExtractionResult, error) {
 	cssResult := a.extractWithCSS(input)
 	
+	var aiErr error
 	if input.Options != nil && input.Options.UseAI {
 		aiResult, err := a.extractWithAI(ctx, input)
 		if err == nil && aiResult.Confidence >= input.Options.ConfidenceMin {
 			return aiResult, nil
 		}
+		aiErr = err
 	}
 
 	if input.Options != nil && input.Options.FallbackToCSS {
 		return cssResult, nil
 	}
 
+	if aiErr != nil {
+		return nil, fmt.Errorf("extraction failed: %w", aiErr)
+	}
 	return nil, fmt.Errorf("extraction failed")
 }
 
@@ -143,56 +159,61 @@ func (a *AIExtractor) extractWithCSS(input *ExtractionInput) *ExtractionResult {
 		}
 	}
 
-	data := make(map[string]interface{})
-	errors := []string{}
-
-	for _, field := range input.Schema.Fields {
-		if field.Selector == "" {
-			continue
-		}
-
-		selection := doc.Find(field.Selector)
-		if selection.Length() == 0 && field.Required {
-			errors = append(errors, fmt.Sprintf("Required field '%s' not found", field.Name))
-			continue
-		}
-
-		var value interface{}
-		if field.Multiple {
-			var values []string
-			selection.Each(func(i int, s *goquery.Selection) {
-				val := a.extractValue(s, field)
-				if val != "" {
-					values = append(values, val)
-				}
-			})
-			value = values
-		} else {
-			value = a.extractValue(selection.First(), field)
-		}
+	result, _ := ExtractWithCSS(doc, input.Schema)
+	return result
+}
 
-		if value != nil {
-			data[field.Name] = value
-		}
+// ExtractWithCSS reads the fields of schema from doc with their CSS
+// selectors and post-processes and validates them the way Extract does.
+// The failures are listed in the result's Errors and also returned.
+func ExtractWithCSS(doc *goquery.Document, schema *ExtractionSchema) (*ExtractionResult, []error) {
+	data, errs := ExtractFields(doc, schema)
+	errors := []string{}
+	for _, err := range errs {
+		errors = append(errors, err.Error())
 	}
 
-	return &ExtractionResult{
+	result := &ExtractionResult{
 		Data:       data,
 		Confidence: 0.8, 
 		Method:     "css",
 		Errors:     errors,
 	}
+	return result, append(errs, applySchemaRules(result, schema)...)
 }
 
-func (a *AIExtractor) extractValue(selection *goquery.Selection, field FieldSchema) string {
-	if field.Attribute != "" {
-		val, exists := selection.Attr(field.Attribute)
-		if exists {
-			return strings.TrimSpace(val)
-		}
-		return ""
+// applySchemaRules runs the schema's post-processing and then its
+// validation on result. Fields that fail validation are dropped; fields
+// that could not be post-processed keep their raw value. Every failure is
+// added to result.Errors, and returned, and Confidence is scaled down by
+// the share of schema fields affected.
+func applySchemaRules(result *ExtractionResult, schema *ExtractionSchema) []error {
+	if schema == nil || result.Data == nil {
+		return nil
+	}
+
+	failed, errs := applyPostProcess(result.Data, schema.PostProcess)
+	invalid, validationErrs := schema.Validation.check(result.Data)
+	for name := range invalid {
+		delete(result.Data, name)
+		failed[name] = true
 	}
-	return strings.TrimSpace(selection.Text())
+
+	errs = append(errs, validationErrs...)
+	for _, err := range errs {
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	total := len(schema.Fields)
+	if total == 0 || len(failed) == 0 {
+		return errs
+	}
+	affected := len(failed)
+	if affected > total {
+		affected = total
+	}
+	result.Confidence *= 1 - float64(affected)/float64(total)
+	return errs
 }
 
 func (a *AIExtractor) extractWithAI(ctx context.Context, input *ExtractionInput) (*ExtractionResult, error) {
@@ -202,13 +223,28 @@ func (a *AIExtractor) extractWithAI(ctx context.Context, input *ExtractionInput)
 		return nil, fmt.Errorf("model not found: %s", modelName)
 	}
 
-	return model.Extract(ctx, input)
+	if a.limiter != nil {
+		release, err := a.limiter.acquire(ctx, estimateTokens(input, a.config.MaxTokens))
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	result, err := model.Extract(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	applySchemaRules(result, input.Schema)
+	return result, nil
 }
 
 func (a *AIExtractor) createModel(config ModelConfig) Model {
 	switch config.Type {
 	case "openai":
-		return &MockModel{modelType: "openai"}
+		return NewOpenAIModel(config, a.config.MaxTokens, a.config.Temperature)
+	case "mock":
+		return &MockModel{modelType: "mock"}
 	case "huggingface":
 		return &MockModel{modelType: "huggingface"}
 	case "local":
@@ -241,8 +277,12 @@ func (m *MockModel) Predict(ctx context.Context, features []float64) ([]float64,
 	return []float64{0.9}, nil
 }
 
+// AISmartExtractor remembers, per domain, where the fields the model found
+// were on the page, so later pages of a known domain can be read with CSS
+// selectors instead of another model call. It is safe for concurrent use.
 type AISmartExtractor struct {
 	aiExtractor *AIExtractor
+	mu          sync.RWMutex
 	patterns    map[string]*ExtractionPattern
 	cache       map[string]*ExtractionResult
 }
@@ -263,21 +303,34 @@ func NewAISmartExtractor(aiExtractor *AIExtractor) *AISmartExtractor {
 	}
 }
 
+// LearnPattern records the fields of result for the domain of url. Without
+// the page's HTML no selectors can be learned, so the pattern is only used
+// by Extract once it has seen a page of the domain.
 func (s *AISmartExtractor) LearnPattern(url string, result *ExtractionResult) {
+	s.learn(url, s.generateSchema(result.Data), result.Confidence)
+}
+
+func (s *AISmartExtractor) learn(url string, schema *ExtractionSchema, confidence float64) {
 	domain := extractDomain(url)
-	
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	pattern, exists := s.patterns[domain]
 	if !exists {
 		pattern = &ExtractionPattern{
 			Name:       domain,
 			URLPattern: fmt.Sprintf("*%s*", domain),
-			Schema:     s.generateSchema(result.Data),
-			Confidence: result.Confidence,
+			Schema:     schema,
+			Confidence: confidence,
 		}
 		s.patterns[domain] = pattern
 	} else {
-		pattern.Confidence = (pattern.Confidence + result.Confidence) / 2
+		pattern.Schema = mergeLearnedFields(pattern.Schema, schema)
+		pattern.Confidence = (pattern.Confidence + confidence) / 2
 	}
+	pattern.LastUpdated = now
 }
 
 func (s *AISmartExtractor) generateSchema(data map[string]interface{}) *ExtractionSchema {
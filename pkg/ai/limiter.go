@@ -0,0 +1,123 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrAIRateLimited is returned when an AI call would exceed MaxConcurrentCalls
+// or TokensPerMinute and AIConfig.WaitWhenLimited is not set.
+var ErrAIRateLimited = errors.New("ai rate limit exceeded")
+
+// callLimiter bounds concurrent model calls and the tokens they consume per
+// minute. It is shared by every call made through one AIExtractor.
+type callLimiter struct {
+	slots chan struct{}
+	wait  bool
+
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	perSec   float64
+	last     time.Time
+}
+
+func newCallLimiter(config *AIConfig) *callLimiter {
+	if config.MaxConcurrentCalls <= 0 && config.TokensPerMinute <= 0 {
+		return nil
+	}
+
+	l := &callLimiter{wait: config.WaitWhenLimited}
+	if config.MaxConcurrentCalls > 0 {
+		l.slots = make(chan struct{}, config.MaxConcurrentCalls)
+	}
+	if config.TokensPerMinute > 0 {
+		l.capacity = float64(config.TokensPerMinute)
+		l.tokens = l.capacity
+		l.perSec = l.capacity / 60
+		l.last = time.Now()
+	}
+	return l
+}
+
+// acquire reserves a call slot and the estimated tokens for one call. The
+// returned release func must be called when the call finishes.
+func (l *callLimiter) acquire(ctx context.Context, tokens int) (func(), error) {
+	if l.slots != nil {
+		if l.wait {
+			select {
+			case l.slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		} else {
+			select {
+			case l.slots <- struct{}{}:
+			default:
+				return nil, ErrAIRateLimited
+			}
+		}
+	}
+
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+
+	if err := l.takeTokens(ctx, tokens); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+func (l *callLimiter) takeTokens(ctx context.Context, tokens int) error {
+	if l.capacity == 0 {
+		return nil
+	}
+
+	// A single oversized call could otherwise never be admitted.
+	need := float64(tokens)
+	if need > l.capacity {
+		need = l.capacity
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.perSec
+		if l.tokens > l.capacity {
+			l.tokens = l.capacity
+		}
+		l.last = now
+
+		if l.tokens >= need {
+			l.tokens -= need
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((need - l.tokens) / l.perSec * float64(time.Second))
+		l.mu.Unlock()
+
+		if !l.wait {
+			return ErrAIRateLimited
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// estimateTokens approximates the prompt size at four characters per token
+// plus the configured completion budget.
+func estimateTokens(input *ExtractionInput, maxTokens int) int {
+	return len(input.HTML)/4 + maxTokens
+}
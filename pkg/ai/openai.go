@@ -0,0 +1,380 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ErrMissingAPIKey is returned by models that call a hosted API when their
+// ModelConfig has no APIKey. No request is made.
+var ErrMissingAPIKey = errors.New("ai model has no API key")
+
+const (
+	defaultOpenAIEndpoint = "https://api.openai.com/v1"
+	defaultOpenAIModel    = "gpt-4o-mini"
+
+	// defaultCompletionTokens caps the JSON answer, which only has to hold
+	// the schema fields.
+	defaultCompletionTokens = 1024
+)
+
+// OpenAIModel extracts schema fields with an OpenAI-compatible chat
+// completions API. The model is asked for a JSON object holding one key per
+// schema field; its answer is coerced to the field types and scored.
+//
+// ModelConfig.Parameters may set "model" (default gpt-4o-mini) and
+// "max_tokens" for the answer (default 1024).
+type OpenAIModel struct {
+	config      ModelConfig
+	maxTokens   int
+	temperature float64
+	client      *http.Client
+}
+
+// NewOpenAIModel creates a model calling config.Endpoint (the OpenAI API by
+// default). maxTokens bounds the prompt: the page is cut down to fit it.
+func NewOpenAIModel(config ModelConfig, maxTokens int, temperature float64) *OpenAIModel {
+	return &OpenAIModel{
+		config:      config,
+		maxTokens:   maxTokens,
+		temperature: temperature,
+		client:      &http.Client{},
+	}
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model          string            `json:"model"`
+	Messages       []chatMessage     `json:"messages"`
+	Temperature    float64           `json:"temperature"`
+	MaxTokens      int               `json:"max_tokens,omitempty"`
+	ResponseFormat map[string]string `json:"response_format,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error,omitempty"`
+}
+
+const openAISystemPrompt = `You extract structured data from web pages.
+Answer with a single JSON object and nothing else. Use exactly the field names you are given.
+Use null for fields the page does not contain; never invent values.
+Also include "_confidence": a number from 0 to 1 for how sure you are that the values are correct.`
+
+func (m *OpenAIModel) Extract(ctx context.Context, input *ExtractionInput) (*ExtractionResult, error) {
+	if m.config.APIKey == "" {
+		return nil, ErrMissingAPIKey
+	}
+	if input.Schema == nil || len(input.Schema.Fields) == 0 {
+		return nil, fmt.Errorf("openai extraction needs a schema with fields")
+	}
+	if input.Options != nil && input.Options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(input.Options.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	prompt := buildExtractionPrompt(input, m.maxTokens)
+	request := chatRequest{
+		Model: m.modelName(),
+		Messages: []chatMessage{
+			{Role: "system", Content: openAISystemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		Temperature:    m.temperature,
+		MaxTokens:      m.completionTokens(),
+		ResponseFormat: map[string]string{"type": "json_object"},
+	}
+
+	response, err := m.complete(ctx, &request)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("openai returned no choices")
+	}
+	choice := response.Choices[0]
+
+	var answer map[string]interface{}
+	if err := json.Unmarshal([]byte(stripCodeFence(choice.Message.Content)), &answer); err != nil {
+		return nil, fmt.Errorf("openai answer is not a JSON object: %w", err)
+	}
+
+	data, errs := coerceFields(answer, input.Schema)
+	result := &ExtractionResult{
+		Data:       data,
+		Confidence: answerConfidence(answer, data, input.Schema, choice.FinishReason),
+		Method:     "openai",
+		Errors:     errs,
+		Metadata: map[string]interface{}{
+			"model":             request.Model,
+			"finish_reason":     choice.FinishReason,
+			"prompt_tokens":     response.Usage.PromptTokens,
+			"completion_tokens": response.Usage.CompletionTokens,
+		},
+	}
+	return result, nil
+}
+
+func (m *OpenAIModel) complete(ctx context.Context, request *chatRequest) (*chatResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := strings.TrimSuffix(m.config.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = defaultOpenAIEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.config.APIKey)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("openai request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read openai response: %w", err)
+	}
+
+	var response chatResponse
+	if err := json.Unmarshal(raw, &response); err != nil {
+		return nil, fmt.Errorf("openai returned status %d with an unreadable body: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if response.Error != nil {
+			return nil, fmt.Errorf("openai returned status %d: %s", resp.StatusCode, response.Error.Message)
+		}
+		return nil, fmt.Errorf("openai returned status %d", resp.StatusCode)
+	}
+	return &response, nil
+}
+
+func (m *OpenAIModel) modelName() string {
+	if name, ok := m.config.Parameters["model"].(string); ok && name != "" {
+		return name
+	}
+	return defaultOpenAIModel
+}
+
+func (m *OpenAIModel) completionTokens() int {
+	switch v := m.config.Parameters["max_tokens"].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return defaultCompletionTokens
+}
+
+// Train is a no-op: hosted models are steered through the schema instead.
+func (m *OpenAIModel) Train(ctx context.Context, data *TrainingData) error {
+	return nil
+}
+
+func (m *OpenAIModel) Predict(ctx context.Context, features []float64) ([]float64, error) {
+	return nil, fmt.Errorf("openai model does not support Predict")
+}
+
+// buildExtractionPrompt describes the fields to extract followed by the
+// page. Scripts, styles and other markup that carries no content are
+// dropped, and the page is cut to what fits in maxTokens at roughly four
+// characters per token.
+func buildExtractionPrompt(input *ExtractionInput, maxTokens int) string {
+	var prompt strings.Builder
+	prompt.WriteString("Extract these fields:\n")
+	for _, field := range input.Schema.Fields {
+		fieldType := field.Type
+		if fieldType == "" {
+			fieldType = "string"
+		}
+		if field.Multiple {
+			fieldType = "array of " + fieldType
+		}
+		fmt.Fprintf(&prompt, "- %s (%s", field.Name, fieldType)
+		if field.Required {
+			prompt.WriteString(", required")
+		}
+		prompt.WriteString(")")
+		if field.Description != "" {
+			prompt.WriteString(": " + field.Description)
+		}
+		if len(field.Examples) > 0 {
+			prompt.WriteString(" e.g. " + strings.Join(field.Examples, ", "))
+		}
+		prompt.WriteString("\n")
+	}
+	if input.URL != "" {
+		prompt.WriteString("\nPage URL: " + input.URL + "\n")
+	}
+	prompt.WriteString("\nPage HTML:\n")
+
+	page := condenseHTML(input.HTML)
+	if maxTokens > 0 {
+		if budget := maxTokens*4 - prompt.Len(); budget < len(page) {
+			if budget < 0 {
+				budget = 0
+			}
+			page = strings.ToValidUTF8(page[:budget], "")
+		}
+	}
+	prompt.WriteString(page)
+	return prompt.String()
+}
+
+// condenseHTML removes elements that never hold extractable content.
+func condenseHTML(html string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return html
+	}
+	doc.Find("script:not([type='application/ld+json']), style, noscript, svg, iframe, link").Remove()
+	condensed, err := doc.Html()
+	if err != nil {
+		return html
+	}
+	return condensed
+}
+
+func stripCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	return strings.TrimSpace(strings.TrimSuffix(content, "```"))
+}
+
+// coerceFields keeps the schema fields of answer, converted to their
+// declared types. Values that cannot be converted are reported and left out.
+func coerceFields(answer map[string]interface{}, schema *ExtractionSchema) (map[string]interface{}, []string) {
+	data := make(map[string]interface{})
+	var errs []string
+
+	for _, field := range schema.Fields {
+		value, ok := answer[field.Name]
+		if !ok || value == nil || value == "" {
+			if field.Required {
+				errs = append(errs, fmt.Sprintf("required field '%s' not found", field.Name))
+			}
+			continue
+		}
+
+		if field.Multiple {
+			items, ok := value.([]interface{})
+			if !ok {
+				items = []interface{}{value}
+			}
+			values := make([]interface{}, 0, len(items))
+			for _, item := range items {
+				if v, err := coerceValue(item, field.Type); err == nil {
+					values = append(values, v)
+				} else {
+					errs = append(errs, fmt.Sprintf("field '%s': %v", field.Name, err))
+				}
+			}
+			data[field.Name] = values
+			continue
+		}
+
+		v, err := coerceValue(value, field.Type)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("field '%s': %v", field.Name, err))
+			continue
+		}
+		data[field.Name] = v
+	}
+
+	return data, errs
+}
+
+func coerceValue(value interface{}, fieldType string) (interface{}, error) {
+	switch fieldType {
+	case "number", "float", "integer", "int", "price":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			return parseNumber(v)
+		}
+		return nil, fmt.Errorf("expected a number, got %v", value)
+	case "boolean", "bool":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(strings.ToLower(strings.TrimSpace(v)))
+		}
+		return nil, fmt.Errorf("expected a boolean, got %v", value)
+	case "object":
+		return value, nil
+	default:
+		switch v := value.(type) {
+		case string:
+			return strings.TrimSpace(v), nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+		return nil, fmt.Errorf("expected a string, got %v", value)
+	}
+}
+
+// answerConfidence scores an answer by the share of schema fields it filled
+// with valid values, with required fields counting double, scaled by the
+// model's own confidence. Answers cut off by the token limit are halved.
+func answerConfidence(answer, data map[string]interface{}, schema *ExtractionSchema, finishReason string) float64 {
+	var total, filled float64
+	for _, field := range schema.Fields {
+		weight := 1.0
+		if field.Required {
+			weight = 2
+		}
+		total += weight
+		if _, ok := data[field.Name]; ok {
+			filled += weight
+		}
+	}
+	confidence := filled / total
+
+	if self, ok := answer["_confidence"].(float64); ok && self >= 0 && self <= 1 {
+		confidence *= self
+	}
+	if finishReason == "length" {
+		confidence /= 2
+	}
+	return confidence
+}
@@ -0,0 +1,381 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ramusaaa/goscraper/pkg/xpath"
+	"golang.org/x/net/html"
+)
+
+// cssIdentRe matches the ids and class names that can be written in a
+// selector without escaping.
+var cssIdentRe = regexp.MustCompile(`^-?[_a-zA-Z][_a-zA-Z0-9-]*$`)
+
+// Extract reads input with the learned pattern for its URL when there is
+// one that finds every required field, and otherwise with the underlying
+// AIExtractor. The selectors of the fields a model returns are learned from
+// input.HTML, so the next page of the same domain does not need the model.
+//
+// Results read with a pattern have Method "pattern" and the pattern's name
+// in Metadata["pattern"].
+func (s *AISmartExtractor) Extract(ctx context.Context, input *ExtractionInput) (*ExtractionResult, error) {
+	if pattern := s.matchPattern(input.URL); pattern != nil {
+		if result, ok := applyPattern(input, pattern); ok {
+			return result, nil
+		}
+	}
+
+	result, err := s.aiExtractor.Extract(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	// CSS results come from selectors the caller already has.
+	if result.Method != "css" && len(result.Data) > 0 {
+		s.learn(input.URL, s.learnSelectors(input, result.Data), result.Confidence)
+	}
+	return result, nil
+}
+
+// SavePatterns writes the learned patterns to path as JSON.
+func (s *AISmartExtractor) SavePatterns(path string) error {
+	s.mu.RLock()
+	patterns := make([]*ExtractionPattern, 0, len(s.patterns))
+	for _, pattern := range s.patterns {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i].Name < patterns[j].Name })
+	data, err := json.MarshalIndent(patterns, "", "  ")
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode patterns: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save patterns: %w", err)
+	}
+	return nil
+}
+
+// LoadPatterns adds the patterns saved to path by SavePatterns, replacing
+// learned patterns of the same name. Nothing is loaded if any pattern is
+// invalid.
+func (s *AISmartExtractor) LoadPatterns(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to load patterns: %w", err)
+	}
+
+	var patterns []*ExtractionPattern
+	if err := json.Unmarshal(data, &patterns); err != nil {
+		return fmt.Errorf("failed to decode patterns: %w", err)
+	}
+	for i, pattern := range patterns {
+		if pattern == nil || pattern.Name == "" {
+			return fmt.Errorf("pattern %d has no name", i)
+		}
+		if pattern.Schema == nil {
+			return fmt.Errorf("pattern '%s' has no schema", pattern.Name)
+		}
+		if err := pattern.Schema.Validate(); err != nil {
+			return fmt.Errorf("pattern '%s': %w", pattern.Name, err)
+		}
+		if pattern.URLPattern == "" {
+			pattern.URLPattern = fmt.Sprintf("*%s*", pattern.Name)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pattern := range patterns {
+		s.patterns[pattern.Name] = pattern
+	}
+	return nil
+}
+
+// matchPattern returns the pattern whose URLPattern matches url, the most
+// specific one if several do.
+func (s *AISmartExtractor) matchPattern(url string) *ExtractionPattern {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var best *ExtractionPattern
+	for _, pattern := range s.patterns {
+		if pattern.Schema == nil || !matchURLPattern(pattern.URLPattern, url) {
+			continue
+		}
+		if best == nil || len(pattern.URLPattern) > len(best.URLPattern) ||
+			(len(pattern.URLPattern) == len(best.URLPattern) && pattern.Name < best.Name) {
+			best = pattern
+		}
+	}
+	return best
+}
+
+// matchURLPattern reports whether url matches pattern, a glob in which *
+// matches any run of characters and ? any single one.
+func matchURLPattern(pattern, url string) bool {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	matcher, err := regexp.Compile("^" + quoted + "$")
+	return err == nil && matcher.MatchString(url)
+}
+
+// applyPattern reads input with the selectors of pattern. It fails unless
+// every required field is found and passes the schema's rules.
+func applyPattern(input *ExtractionInput, pattern *ExtractionPattern) (*ExtractionResult, bool) {
+	schema := patternSchema(input.Schema, pattern.Schema)
+	if schema == nil {
+		return nil, false
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(input.HTML))
+	if err != nil {
+		return nil, false
+	}
+	found, errs := ExtractFields(doc, schema)
+	if len(errs) > 0 {
+		return nil, false
+	}
+
+	// Bring the values to the types the model would have returned.
+	for name, value := range found {
+		if values, ok := value.([]string); ok {
+			items := make([]interface{}, len(values))
+			for i, v := range values {
+				items[i] = v
+			}
+			found[name] = items
+		}
+	}
+	data, coerceErrs := coerceFields(found, schema)
+	if len(coerceErrs) > 0 {
+		return nil, false
+	}
+
+	result := &ExtractionResult{
+		Data:       data,
+		Confidence: pattern.Confidence,
+		Method:     "pattern",
+		Metadata:   map[string]interface{}{"pattern": pattern.Name},
+	}
+	applySchemaRules(result, schema)
+	if len(result.Errors) > 0 || (input.Options != nil && result.Confidence < input.Options.ConfidenceMin) {
+		return nil, false
+	}
+	return result, true
+}
+
+// patternSchema fills the fields of requested that have no selector with
+// the ones learned. It returns nil if a required field is left without one.
+// With no requested fields, the learned schema is used as it is.
+func patternSchema(requested, learned *ExtractionSchema) *ExtractionSchema {
+	if requested == nil || len(requested.Fields) == 0 {
+		return learned
+	}
+
+	selectors := make(map[string]FieldSchema, len(learned.Fields))
+	for _, field := range learned.Fields {
+		if field.Selector != "" {
+			selectors[field.Name] = field
+		}
+	}
+
+	schema := *requested
+	schema.Fields = make([]FieldSchema, len(requested.Fields))
+	withSelector := 0
+	for i, field := range requested.Fields {
+		if field.Selector == "" {
+			if known, ok := selectors[field.Name]; ok {
+				field.Selector, field.Attribute = known.Selector, known.Attribute
+			}
+		}
+		if field.Selector == "" && field.Required {
+			return nil
+		}
+		if field.Selector != "" {
+			withSelector++
+		}
+		schema.Fields[i] = field
+	}
+	if withSelector == 0 {
+		return nil
+	}
+	return &schema
+}
+
+// learnSelectors builds a schema for data, locating each single value in
+// input.HTML to learn its selector. Fields the caller gave a selector keep
+// it.
+func (s *AISmartExtractor) learnSelectors(input *ExtractionInput, data map[string]interface{}) *ExtractionSchema {
+	schema := s.generateSchema(data)
+	sort.Slice(schema.Fields, func(i, j int) bool { return schema.Fields[i].Name < schema.Fields[j].Name })
+
+	requested := make(map[string]FieldSchema)
+	if input.Schema != nil {
+		for _, field := range input.Schema.Fields {
+			requested[field.Name] = field
+		}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(input.HTML))
+	if err != nil {
+		return schema
+	}
+	for i, field := range schema.Fields {
+		if known, ok := requested[field.Name]; ok {
+			field = known
+		}
+		if field.Selector == "" && !field.Multiple {
+			field.Selector = inferSelector(doc, data[field.Name])
+		}
+		schema.Fields[i] = field
+	}
+	return schema
+}
+
+// mergeLearnedFields returns schema with the fields of learned added, and
+// their selectors replacing older ones: a page that needed the model again
+// may mean the site changed its markup.
+func mergeLearnedFields(schema, learned *ExtractionSchema) *ExtractionSchema {
+	if schema == nil {
+		return learned
+	}
+
+	merged := *schema
+	merged.Fields = append([]FieldSchema(nil), schema.Fields...)
+	for _, field := range learned.Fields {
+		i := 0
+		for i < len(merged.Fields) && merged.Fields[i].Name != field.Name {
+			i++
+		}
+		if i == len(merged.Fields) {
+			merged.Fields = append(merged.Fields, field)
+		} else if field.Selector != "" {
+			merged.Fields[i].Selector, merged.Fields[i].Attribute = field.Selector, field.Attribute
+		}
+	}
+	return &merged
+}
+
+// inferSelector returns a selector for the innermost element whose text is
+// value, or "" if there is none or it cannot be told apart from the
+// elements before it. Numbers match text holding the same number, whatever
+// its format.
+func inferSelector(doc *goquery.Document, value interface{}) string {
+	var match func(text string) bool
+	switch v := value.(type) {
+	case string:
+		target := strings.Join(strings.Fields(v), " ")
+		if target == "" {
+			return ""
+		}
+		match = func(text string) bool { return text == target }
+	case float64:
+		match = func(text string) bool {
+			n, err := parseNumber(text)
+			return err == nil && n == v
+		}
+	default:
+		return ""
+	}
+
+	var found *html.Node
+	doc.Find("body *").EachWithBreak(func(_ int, sel *goquery.Selection) bool {
+		n := sel.Nodes[0]
+		if found != nil && !isAncestor(found, n) {
+			return false
+		}
+		if n.Data == "script" || n.Data == "style" {
+			return true
+		}
+		if match(strings.Join(strings.Fields(xpath.InnerText(n)), " ")) {
+			found = n
+		}
+		return true
+	})
+	if found == nil {
+		return ""
+	}
+
+	selector := nodeSelector(found)
+	if nodes := doc.Find(selector).Nodes; len(nodes) == 0 || nodes[0] != found {
+		return ""
+	}
+	return selector
+}
+
+// nodeSelector describes the path to n by tag and class, starting from the
+// nearest ancestor with an id, or from body.
+func nodeSelector(n *html.Node) string {
+	var parts []string
+	for ; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		if n.Data == "body" || n.Data == "html" {
+			parts = append(parts, n.Data)
+			break
+		}
+		if id := nodeAttr(n, "id"); cssIdentRe.MatchString(id) {
+			parts = append(parts, "#"+id)
+			break
+		}
+
+		part := n.Data + classSelector(n)
+		// Tell the element apart from siblings that look the same.
+		index, twins := 0, 0
+		for sibling := n.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+			if sibling.Type != html.ElementNode || sibling.Data != n.Data {
+				continue
+			}
+			index++
+			if sibling == n {
+				part = fmt.Sprintf("%s:nth-of-type(%d)", part, index)
+			} else if sibling.Data+classSelector(sibling) == n.Data+classSelector(n) {
+				twins++
+			}
+		}
+		if twins == 0 {
+			part = n.Data + classSelector(n)
+		}
+		parts = append(parts, part)
+	}
+
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, " > ")
+}
+
+func classSelector(n *html.Node) string {
+	var b strings.Builder
+	for _, class := range strings.Fields(nodeAttr(n, "class")) {
+		if cssIdentRe.MatchString(class) {
+			b.WriteString("." + class)
+		}
+	}
+	return b.String()
+}
+
+func nodeAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func isAncestor(ancestor, n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,358 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/ramusaaa/goscraper/pkg/xpath"
+	"golang.org/x/net/html"
+)
+
+// Validate reports the first problem that would make the schema unusable:
+// no fields, a field without a name or with a duplicate one, a selector that
+// does not compile, an invalid validation pattern or an unknown post-process
+// operation. Schemas loaded from outside the program should be validated
+// before use.
+func (s *ExtractionSchema) Validate() error {
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("schema has no fields")
+	}
+
+	names := make(map[string]bool, len(s.Fields))
+	for i, field := range s.Fields {
+		if field.Name == "" {
+			return fmt.Errorf("field %d has no name", i)
+		}
+		if names[field.Name] {
+			return fmt.Errorf("duplicate field '%s'", field.Name)
+		}
+		names[field.Name] = true
+
+		if expr, ok := strings.CutPrefix(field.Selector, xpathPrefix); ok {
+			if _, err := xpath.Compile(expr); err != nil {
+				return fmt.Errorf("invalid selector for '%s': %w", field.Name, err)
+			}
+		} else if field.Selector != "" {
+			if _, err := cascadia.ParseGroup(field.Selector); err != nil {
+				return fmt.Errorf("invalid selector for '%s': %w", field.Name, err)
+			}
+		}
+	}
+
+	if s.Validation != nil && s.Validation.Pattern != "" {
+		if _, err := regexp.Compile(s.Validation.Pattern); err != nil {
+			return fmt.Errorf("invalid validation pattern: %w", err)
+		}
+	}
+
+	for _, rule := range s.PostProcess {
+		if _, err := postProcessOperation(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xpathPrefix marks a FieldSchema.Selector holding an XPath expression
+// rather than a CSS selector, as in "xpath://h1[@itemprop='name']".
+const xpathPrefix = "xpath:"
+
+// ExtractFields runs the selectors of schema against doc: CSS selectors, or
+// XPath expressions when prefixed with "xpath:". Fields without a selector
+// are skipped; missing required fields are reported as errors.
+func ExtractFields(doc *goquery.Document, schema *ExtractionSchema) (map[string]interface{}, []error) {
+	data := make(map[string]interface{})
+	var errs []error
+
+	for _, field := range schema.Fields {
+		if field.Selector == "" {
+			continue
+		}
+
+		nodes, err := selectField(doc, field)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("field '%s': %w", field.Name, err))
+			continue
+		}
+		if len(nodes) == 0 {
+			if field.Required {
+				errs = append(errs, fmt.Errorf("required field '%s' not found", field.Name))
+			}
+			continue
+		}
+
+		if field.Multiple {
+			var values []string
+			for _, n := range nodes {
+				if val := extractFieldValue(n, field); val != "" {
+					values = append(values, val)
+				}
+			}
+			data[field.Name] = values
+		} else {
+			data[field.Name] = extractFieldValue(nodes[0], field)
+		}
+	}
+
+	return data, errs
+}
+
+func selectField(doc *goquery.Document, field FieldSchema) ([]*html.Node, error) {
+	expr, ok := strings.CutPrefix(field.Selector, xpathPrefix)
+	if !ok {
+		return doc.Find(field.Selector).Nodes, nil
+	}
+	compiled, err := xpath.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Nodes) == 0 {
+		return nil, nil
+	}
+	return compiled.Select(doc.Nodes[0]), nil
+}
+
+func extractFieldValue(n *html.Node, field FieldSchema) string {
+	if field.Attribute != "" {
+		for _, attr := range n.Attr {
+			if attr.Key == field.Attribute {
+				return strings.TrimSpace(attr.Val)
+			}
+		}
+		return ""
+	}
+	return strings.TrimSpace(xpath.InnerText(n))
+}
+
+// Validate checks every string value in data against the rules. Slices are
+// validated element by element.
+func (v *ValidationRules) Validate(data map[string]interface{}) []error {
+	_, errs := v.check(data)
+	return errs
+}
+
+// check is Validate that also names the fields that failed.
+func (v *ValidationRules) check(data map[string]interface{}) (map[string]bool, []error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	var pattern *regexp.Regexp
+	if v.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(v.Pattern); err != nil {
+			return nil, []error{fmt.Errorf("invalid validation pattern: %w", err)}
+		}
+	}
+
+	failed := make(map[string]bool)
+	var errs []error
+	for name, value := range data {
+		switch val := value.(type) {
+		case string:
+			if err := v.validateValue(val, pattern); err != nil {
+				failed[name] = true
+				errs = append(errs, fmt.Errorf("field '%s': %w", name, err))
+			}
+		case []string:
+			for i, item := range val {
+				if err := v.validateValue(item, pattern); err != nil {
+					failed[name] = true
+					errs = append(errs, fmt.Errorf("field '%s'[%d]: %w", name, i, err))
+				}
+			}
+		case []interface{}:
+			for i, item := range val {
+				str, ok := item.(string)
+				if !ok {
+					continue
+				}
+				if err := v.validateValue(str, pattern); err != nil {
+					failed[name] = true
+					errs = append(errs, fmt.Errorf("field '%s'[%d]: %w", name, i, err))
+				}
+			}
+		}
+	}
+
+	return failed, errs
+}
+
+func (v *ValidationRules) validateValue(value string, pattern *regexp.Regexp) error {
+	if v.MinLength > 0 && len(value) < v.MinLength {
+		return fmt.Errorf("length %d is below minimum %d", len(value), v.MinLength)
+	}
+	if v.MaxLength > 0 && len(value) > v.MaxLength {
+		return fmt.Errorf("length %d exceeds maximum %d", len(value), v.MaxLength)
+	}
+	if pattern != nil && !pattern.MatchString(value) {
+		return fmt.Errorf("value %q does not match pattern %s", value, v.Pattern)
+	}
+	if len(v.AllowedValues) > 0 {
+		for _, allowed := range v.AllowedValues {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("value %q is not allowed", value)
+	}
+	return nil
+}
+
+// ApplyPostProcess applies rules to data in order, modifying it in place.
+// Supported operations are trim, lowercase, uppercase, remove, replace
+// (Value "old=>new"), regex_extract, regex_replace (Value
+// "pattern=>replacement"), prepend, append, split and to_number.
+func ApplyPostProcess(data map[string]interface{}, rules []PostProcessRule) []error {
+	_, errs := applyPostProcess(data, rules)
+	return errs
+}
+
+// applyPostProcess is ApplyPostProcess that also names the fields whose
+// values could not be processed. Those keep their previous value.
+func applyPostProcess(data map[string]interface{}, rules []PostProcessRule) (map[string]bool, []error) {
+	failed := make(map[string]bool)
+	var errs []error
+
+	for _, rule := range rules {
+		value, exists := data[rule.Field]
+		if !exists {
+			continue
+		}
+
+		op, err := postProcessOperation(rule)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		switch val := value.(type) {
+		case string:
+			result, err := op(val)
+			if err != nil {
+				failed[rule.Field] = true
+				errs = append(errs, fmt.Errorf("field '%s': %w", rule.Field, err))
+				continue
+			}
+			data[rule.Field] = result
+		case []string:
+			results := make([]interface{}, 0, len(val))
+			allStrings := true
+			for _, item := range val {
+				result, err := op(item)
+				if err != nil {
+					failed[rule.Field] = true
+					errs = append(errs, fmt.Errorf("field '%s': %w", rule.Field, err))
+					result = item
+				}
+				if _, ok := result.(string); !ok {
+					allStrings = false
+				}
+				results = append(results, result)
+			}
+			if allStrings {
+				strs := make([]string, len(results))
+				for i, r := range results {
+					strs[i] = r.(string)
+				}
+				data[rule.Field] = strs
+			} else {
+				data[rule.Field] = results
+			}
+		}
+	}
+
+	return failed, errs
+}
+
+func postProcessOperation(rule PostProcessRule) (func(string) (interface{}, error), error) {
+	switch rule.Operation {
+	case "trim":
+		return func(s string) (interface{}, error) { return strings.TrimSpace(s), nil }, nil
+	case "lowercase":
+		return func(s string) (interface{}, error) { return strings.ToLower(s), nil }, nil
+	case "uppercase":
+		return func(s string) (interface{}, error) { return strings.ToUpper(s), nil }, nil
+	case "remove":
+		return func(s string) (interface{}, error) { return strings.ReplaceAll(s, rule.Value, ""), nil }, nil
+	case "replace":
+		parts := strings.SplitN(rule.Value, "=>", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("replace rule for '%s' needs a value of the form old=>new", rule.Field)
+		}
+		return func(s string) (interface{}, error) { return strings.ReplaceAll(s, parts[0], parts[1]), nil }, nil
+	case "regex_extract":
+		re, err := regexp.Compile(rule.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex for '%s': %w", rule.Field, err)
+		}
+		return func(s string) (interface{}, error) {
+			match := re.FindStringSubmatch(s)
+			if match == nil {
+				return "", nil
+			}
+			if len(match) > 1 {
+				return match[1], nil
+			}
+			return match[0], nil
+		}, nil
+	case "regex_replace":
+		parts := strings.SplitN(rule.Value, "=>", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("regex_replace rule for '%s' needs a value of the form pattern=>replacement", rule.Field)
+		}
+		re, err := regexp.Compile(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex for '%s': %w", rule.Field, err)
+		}
+		return func(s string) (interface{}, error) { return re.ReplaceAllString(s, parts[1]), nil }, nil
+	case "prepend":
+		return func(s string) (interface{}, error) { return rule.Value + s, nil }, nil
+	case "append":
+		return func(s string) (interface{}, error) { return s + rule.Value, nil }, nil
+	case "split":
+		sep := rule.Value
+		if sep == "" {
+			sep = ","
+		}
+		return func(s string) (interface{}, error) {
+			var parts []string
+			for _, part := range strings.Split(s, sep) {
+				if part = strings.TrimSpace(part); part != "" {
+					parts = append(parts, part)
+				}
+			}
+			return parts, nil
+		}, nil
+	case "to_number":
+		return func(s string) (interface{}, error) { return parseNumber(s) }, nil
+	default:
+		return nil, fmt.Errorf("unknown post-process operation '%s' for field '%s'", rule.Operation, rule.Field)
+	}
+}
+
+var numberRe = regexp.MustCompile(`-?\d[\d.,]*`)
+
+// parseNumber pulls the first number out of s, treating whichever of '.'
+// or ',' appears last as the decimal separator.
+func parseNumber(s string) (float64, error) {
+	match := numberRe.FindString(s)
+	if match == "" {
+		return 0, fmt.Errorf("no number in %q", s)
+	}
+
+	lastDot := strings.LastIndex(match, ".")
+	lastComma := strings.LastIndex(match, ",")
+	if lastComma > lastDot {
+		match = strings.ReplaceAll(match, ".", "")
+		match = strings.Replace(match, ",", ".", 1)
+	} else {
+		match = strings.ReplaceAll(match, ",", "")
+	}
+
+	return strconv.ParseFloat(match, 64)
+}
@@ -0,0 +1,117 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ramusaaa/goscraper/pkg/stealth"
+)
+
+// ChallengeSolver solves Cloudflare JS challenges by loading the page in a
+// browser from the Manager's pool and waiting for the clearance cookie. It
+// implements stealth.ChallengeSolver, e.g. for goscraper.WithJSChallengeBypass.
+type ChallengeSolver struct {
+	manager *Manager
+
+	// ClearanceCookie is the cookie that marks a solved challenge.
+	// The default is "cf_clearance".
+	ClearanceCookie string
+	// Timeout bounds how long to wait for the challenge to clear. The
+	// default is 30 seconds.
+	Timeout time.Duration
+	// PollInterval is how often the browser's cookies are checked. The
+	// default is 500 milliseconds.
+	PollInterval time.Duration
+}
+
+func NewChallengeSolver(manager *Manager) *ChallengeSolver {
+	return &ChallengeSolver{
+		manager:         manager,
+		ClearanceCookie: "cf_clearance",
+		Timeout:         30 * time.Second,
+		PollInterval:    500 * time.Millisecond,
+	}
+}
+
+// Shrink closes the idle browsers of the solver's Manager, e.g. when
+// goscraper.WithMemoryBudget finds memory tight.
+func (s *ChallengeSolver) Shrink() {
+	s.manager.Shrink()
+}
+
+func (s *ChallengeSolver) SolveChallenge(ctx context.Context, url string) (*stealth.ChallengeClearance, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	engine, err := s.manager.GetEngine(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.manager.ReturnEngine(engine)
+
+	cookieEngine, ok := engine.(CookieEngine)
+	if !ok {
+		return nil, fmt.Errorf("browser engine %T cannot read cookies to solve challenges", engine)
+	}
+
+	if err := engine.Navigate(ctx, url); err != nil {
+		return nil, fmt.Errorf("failed to load challenge page: %w", err)
+	}
+
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		cookies, err := cookieEngine.Cookies(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read browser cookies: %w", err)
+		}
+		if hasCookie(cookies, s.ClearanceCookie) {
+			userAgent, err := engine.ExecuteScript(ctx, "navigator.userAgent")
+			if err != nil {
+				return nil, fmt.Errorf("failed to read browser user agent: %w", err)
+			}
+			ua, _ := userAgent.(string)
+			// The page is only a fallback, so failing to read it is not fatal.
+			html, _ := engine.GetHTML(ctx)
+			return &stealth.ChallengeClearance{Cookies: cookies, UserAgent: ua, HTML: html}, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no %s cookie before the challenge timed out: %w", s.ClearanceCookie, ctx.Err())
+		}
+	}
+}
+
+func hasCookie(cookies []*http.Cookie, name string) bool {
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// browserCookie converts a cookie reported by the DevTools protocol, whose
+// expiry is in seconds since the epoch (negative for session cookies).
+func browserCookie(name, value, domain, path string, expires float64, httpOnly, secure bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   domain,
+		Path:     path,
+		HttpOnly: httpOnly,
+		Secure:   secure,
+	}
+	if expires > 0 {
+		cookie.Expires = time.Unix(int64(expires), 0)
+	}
+	return cookie
+}
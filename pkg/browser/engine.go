@@ -3,16 +3,29 @@ package browser
 import (
 	"context"
 	"fmt"
+	"math"
+	"net/http"
+	"sync"
 	"time"
 
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/proto"
+	"github.com/ramusaaa/goscraper/pkg/monitoring"
+	"go.uber.org/zap"
 )
 
+// healthCheckTimeout bounds the script ReturnEngine runs to tell whether an
+// engine's browser is still alive.
+const healthCheckTimeout = 5 * time.Second
+
 type Engine interface {
 	Navigate(ctx context.Context, url string) error
 	ExecuteScript(ctx context.Context, script string) (interface{}, error)
+	// Screenshot captures the viewport as a PNG.
 	Screenshot(ctx context.Context) ([]byte, error)
 	GetHTML(ctx context.Context) (string, error)
 	WaitForSelector(ctx context.Context, selector string, timeout time.Duration) error
@@ -21,6 +34,20 @@ type Engine interface {
 	Close() error
 }
 
+// CookieEngine is implemented by engines that can read the cookies the
+// browser holds for the current page, including HttpOnly ones that page
+// scripts cannot see. ChallengeSolver needs it to spot the clearance cookie.
+type CookieEngine interface {
+	Cookies(ctx context.Context) ([]*http.Cookie, error)
+}
+
+// FullScreenshotEngine is implemented by engines that can capture the whole
+// page, below the fold included, as a PNG. Manager.Screenshot needs it for
+// full-page captures.
+type FullScreenshotEngine interface {
+	FullScreenshot(ctx context.Context) ([]byte, error)
+}
+
 type EngineType string
 
 const (
@@ -41,22 +68,45 @@ type Config struct {
 	DisableJS       bool
 	CustomFlags     []string
 	Extensions      []string
+	Timeouts        Timeouts
+	// Logger receives the exceptions thrown by WithBrowserInitScripts
+	// scripts, among other warnings.
+	Logger          *zap.Logger
+	// Metrics, if set, tracks the engines the Manager holds open in
+	// goscraper_browser_sessions.
+	Metrics         *monitoring.Metrics
+	// NewEngine, if set, creates engines instead of the built-in ChromeDP
+	// and Rod ones, e.g. to drive another browser.
+	NewEngine       func(ctx context.Context, config *Config) (Engine, error)
 }
 
+// Manager pools browser engines. Engines are created on demand, or ahead of
+// time with WarmUp, and health-checked when they are handed back.
 type Manager struct {
-	config  *Config
-	engines map[string]Engine
-	pool    chan Engine
+	config *Config
+	pool   chan Engine
+
+	initScripts      []string
+	navigatorStealth bool
+
+	mu     sync.Mutex
+	warm   int
+	closed bool
 }
 
-func NewManager(config *Config, poolSize int) *Manager {
-	return &Manager{
-		config:  config,
-		engines: make(map[string]Engine),
-		pool:    make(chan Engine, poolSize),
+func NewManager(config *Config, poolSize int, opts ...ManagerOption) *Manager {
+	m := &Manager{
+		config: config,
+		pool:   make(chan Engine, poolSize),
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
+	return m
 }
 
+// GetEngine takes an engine from the pool, creating one if the pool is
+// empty. Hand it back with ReturnEngine when done.
 func (m *Manager) GetEngine(ctx context.Context) (Engine, error) {
 	select {
 	case engine := <-m.pool:
@@ -66,15 +116,154 @@ func (m *Manager) GetEngine(ctx context.Context) (Engine, error) {
 	}
 }
 
+// ReturnEngine puts engine back in the pool if its browser still answers a
+// script. Dead engines are closed and, if the pool was warmed up, replaced
+// in the background; engines that don't fit in the pool are closed.
 func (m *Manager) ReturnEngine(engine Engine) {
+	if !alive(engine) {
+		m.config.logger().Warn("Discarding dead browser engine")
+		m.closeEngine(engine)
+		m.replenish()
+		return
+	}
+
+	m.mu.Lock()
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		m.closeEngine(engine)
+		return
+	}
+
 	select {
 	case m.pool <- engine:
 	default:
-		engine.Close()
+		m.closeEngine(engine)
+	}
+}
+
+// WarmUp creates engines until the pool holds n of them (at most its
+// size), so the first requests don't pay for starting a browser. Dead
+// engines are replaced to keep it at that level.
+func (m *Manager) WarmUp(ctx context.Context, n int) error {
+	if n > cap(m.pool) {
+		n = cap(m.pool)
+	}
+	m.mu.Lock()
+	m.warm = n
+	m.mu.Unlock()
+
+	for len(m.pool) < n {
+		engine, err := m.createEngine(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to warm up browser pool: %w", err)
+		}
+		select {
+		case m.pool <- engine:
+		default:
+			m.closeEngine(engine)
+			return nil
+		}
+	}
+	return nil
+}
+
+// Close closes the pooled engines. Engines handed out are closed when they
+// are returned.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+
+	for {
+		select {
+		case engine := <-m.pool:
+			m.closeEngine(engine)
+		default:
+			return nil
+		}
 	}
 }
 
+// Shrink closes the idle engines in the pool to release their memory. The
+// pool fills up again as engines are created and returned.
+func (m *Manager) Shrink() {
+	for {
+		select {
+		case engine := <-m.pool:
+			m.closeEngine(engine)
+		default:
+			return
+		}
+	}
+}
+
+// replenish starts an engine in the background if the pool has fallen
+// below what WarmUp asked for.
+func (m *Manager) replenish() {
+	m.mu.Lock()
+	short := !m.closed && len(m.pool) < m.warm
+	m.mu.Unlock()
+	if !short {
+		return
+	}
+
+	go func() {
+		engine, err := m.createEngine(context.Background())
+		if err != nil {
+			m.config.logger().Warn("Failed to replace dead browser engine", zap.Error(err))
+			return
+		}
+		m.ReturnEngine(engine)
+	}()
+}
+
+func alive(engine Engine) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	_, err := engine.ExecuteScript(ctx, "1")
+	return err == nil
+}
+
 func (m *Manager) createEngine(ctx context.Context) (Engine, error) {
+	engine, err := m.newEngine(ctx)
+	if err != nil {
+		if m.config.Metrics != nil {
+			m.config.Metrics.BrowserErrors.WithLabelValues(m.engineLabel(), "start").Inc()
+		}
+		return nil, err
+	}
+	if err := m.installInitScripts(ctx, engine); err != nil {
+		engine.Close()
+		if m.config.Metrics != nil {
+			m.config.Metrics.BrowserErrors.WithLabelValues(m.engineLabel(), "start").Inc()
+		}
+		return nil, err
+	}
+	if m.config.Metrics != nil {
+		m.config.Metrics.RecordBrowserSession(m.engineLabel(), 1)
+	}
+	return engine, nil
+}
+
+func (m *Manager) closeEngine(engine Engine) {
+	engine.Close()
+	if m.config.Metrics != nil {
+		m.config.Metrics.RecordBrowserSession(m.engineLabel(), -1)
+	}
+}
+
+func (m *Manager) engineLabel() string {
+	if m.config.NewEngine != nil && m.config.Engine == "" {
+		return "custom"
+	}
+	return string(m.config.Engine)
+}
+
+func (m *Manager) newEngine(ctx context.Context) (Engine, error) {
+	if m.config.NewEngine != nil {
+		return m.config.NewEngine(ctx, m.config)
+	}
 	switch m.config.Engine {
 	case ChromeDP:
 		return m.createChromeDPEngine(ctx)
@@ -88,6 +277,7 @@ func (m *Manager) createEngine(ctx context.Context) (Engine, error) {
 type ChromeDPEngine struct {
 	ctx    context.Context
 	cancel context.CancelFunc
+	logger *zap.Logger
 }
 
 func (m *Manager) createChromeDPEngine(ctx context.Context) (*ChromeDPEngine, error) {
@@ -111,46 +301,127 @@ func (m *Manager) createChromeDPEngine(ctx context.Context) (*ChromeDPEngine, er
 	allocCtx, cancel := chromedp.NewExecAllocator(ctx, opts...)
 	engineCtx, _ := chromedp.NewContext(allocCtx)
 
+	// Allocate the browser up front: if the first Run used a per-call
+	// deadline, hitting it would tear down the whole browser.
+	if err := chromedp.Run(engineCtx); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start browser: %w", err)
+	}
+
 	return &ChromeDPEngine{
 		ctx:    engineCtx,
 		cancel: cancel,
+		logger: m.config.logger(),
 	}, nil
 }
 
+// run executes actions on the engine's browser tab while honouring the
+// caller's cancellation and deadline. chromedp needs its own context, so the
+// caller's ctx can't be passed to chromedp.Run directly.
+func (e *ChromeDPEngine) run(ctx context.Context, actions ...chromedp.Action) error {
+	runCtx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancelDeadline context.CancelFunc
+		runCtx, cancelDeadline = context.WithDeadline(runCtx, deadline)
+		defer cancelDeadline()
+	}
+
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	return chromedp.Run(runCtx, actions...)
+}
+
+func (e *ChromeDPEngine) AddInitScript(ctx context.Context, script string) error {
+	return e.run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		_, err := page.AddScriptToEvaluateOnNewDocument(script).Do(ctx)
+		return err
+	}))
+}
+
 func (e *ChromeDPEngine) Navigate(ctx context.Context, url string) error {
-	return chromedp.Run(e.ctx, chromedp.Navigate(url))
+	if err := e.run(ctx, chromedp.Navigate(url)); err != nil {
+		return err
+	}
+	var errs string
+	if err := e.run(ctx, chromedp.Evaluate(readInitErrorsScript, &errs)); err == nil {
+		reportInitScriptErrors(e.logger, url, errs)
+	}
+	return nil
 }
 
 func (e *ChromeDPEngine) ExecuteScript(ctx context.Context, script string) (interface{}, error) {
 	var result interface{}
-	err := chromedp.Run(e.ctx, chromedp.Evaluate(script, &result))
+	err := e.run(ctx, chromedp.Evaluate(script, &result))
 	return result, err
 }
 
 func (e *ChromeDPEngine) Screenshot(ctx context.Context) ([]byte, error) {
 	var buf []byte
-	err := chromedp.Run(e.ctx, chromedp.CaptureScreenshot(&buf))
+	err := e.run(ctx, chromedp.CaptureScreenshot(&buf))
+	return buf, err
+}
+
+// FullScreenshot resizes the viewport to the page's content size for the
+// capture and restores it afterwards.
+func (e *ChromeDPEngine) FullScreenshot(ctx context.Context) ([]byte, error) {
+	var buf []byte
+	err := e.run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		_, _, _, _, _, content, err := page.GetLayoutMetrics().Do(ctx)
+		if err != nil {
+			return err
+		}
+		width, height := int64(math.Ceil(content.Width)), int64(math.Ceil(content.Height))
+		if err := emulation.SetDeviceMetricsOverride(width, height, 1, false).Do(ctx); err != nil {
+			return err
+		}
+		defer emulation.ClearDeviceMetricsOverride().Do(ctx)
+
+		buf, err = page.CaptureScreenshot().
+			WithFormat(page.CaptureScreenshotFormatPng).
+			WithClip(&page.Viewport{Width: content.Width, Height: content.Height, Scale: 1}).
+			WithCaptureBeyondViewport(true).
+			Do(ctx)
+		return err
+	}))
 	return buf, err
 }
 
 func (e *ChromeDPEngine) GetHTML(ctx context.Context) (string, error) {
 	var html string
-	err := chromedp.Run(e.ctx, chromedp.OuterHTML("html", &html))
+	err := e.run(ctx, chromedp.OuterHTML("html", &html))
 	return html, err
 }
 
 func (e *ChromeDPEngine) WaitForSelector(ctx context.Context, selector string, timeout time.Duration) error {
 	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	return chromedp.Run(timeoutCtx, chromedp.WaitVisible(selector))
+	return e.run(timeoutCtx, chromedp.WaitVisible(selector))
 }
 
 func (e *ChromeDPEngine) Click(ctx context.Context, selector string) error {
-	return chromedp.Run(e.ctx, chromedp.Click(selector))
+	return e.run(ctx, chromedp.Click(selector))
 }
 
 func (e *ChromeDPEngine) Type(ctx context.Context, selector, text string) error {
-	return chromedp.Run(e.ctx, chromedp.SendKeys(selector, text))
+	return e.run(ctx, chromedp.SendKeys(selector, text))
+}
+
+func (e *ChromeDPEngine) Cookies(ctx context.Context) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	err := e.run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		found, err := network.GetCookies().Do(ctx)
+		if err != nil {
+			return err
+		}
+		for _, c := range found {
+			cookies = append(cookies, browserCookie(c.Name, c.Value, c.Domain, c.Path, c.Expires, c.HTTPOnly, c.Secure))
+		}
+		return nil
+	}))
+	return cookies, err
 }
 
 func (e *ChromeDPEngine) Close() error {
@@ -161,6 +432,7 @@ func (e *ChromeDPEngine) Close() error {
 type RodEngine struct {
 	browser *rod.Browser
 	page    *rod.Page
+	logger  *zap.Logger
 }
 
 func (m *Manager) createRodEngine(ctx context.Context) (*RodEngine, error) {
@@ -174,15 +446,28 @@ func (m *Manager) createRodEngine(ctx context.Context) (*RodEngine, error) {
 	return &RodEngine{
 		browser: browser,
 		page:    page,
+		logger:  m.config.logger(),
 	}, nil
 }
 
+func (e *RodEngine) AddInitScript(ctx context.Context, script string) error {
+	_, err := e.page.Context(ctx).EvalOnNewDocument(script)
+	return err
+}
+
 func (e *RodEngine) Navigate(ctx context.Context, url string) error {
-	return e.page.Navigate(url)
+	page := e.page.Context(ctx)
+	if err := page.Navigate(url); err != nil {
+		return err
+	}
+	if result, err := page.Eval(readInitErrorsScript); err == nil {
+		reportInitScriptErrors(e.logger, url, result.Value.Str())
+	}
+	return nil
 }
 
 func (e *RodEngine) ExecuteScript(ctx context.Context, script string) (interface{}, error) {
-	result, err := e.page.Eval(script)
+	result, err := e.page.Context(ctx).Eval(script)
 	if err != nil {
 		return nil, err
 	}
@@ -190,15 +475,19 @@ func (e *RodEngine) ExecuteScript(ctx context.Context, script string) (interface
 }
 
 func (e *RodEngine) Screenshot(ctx context.Context) ([]byte, error) {
-	return e.page.Screenshot(true, nil)
+	return e.page.Context(ctx).Screenshot(false, nil)
+}
+
+func (e *RodEngine) FullScreenshot(ctx context.Context) ([]byte, error) {
+	return e.page.Context(ctx).Screenshot(true, nil)
 }
 
 func (e *RodEngine) GetHTML(ctx context.Context) (string, error) {
-	return e.page.HTML()
+	return e.page.Context(ctx).HTML()
 }
 
 func (e *RodEngine) WaitForSelector(ctx context.Context, selector string, timeout time.Duration) error {
-	element, err := e.page.Timeout(timeout).Element(selector)
+	element, err := e.page.Context(ctx).Timeout(timeout).Element(selector)
 	if err != nil {
 		return err
 	}
@@ -206,7 +495,7 @@ func (e *RodEngine) WaitForSelector(ctx context.Context, selector string, timeou
 }
 
 func (e *RodEngine) Click(ctx context.Context, selector string) error {
-	element, err := e.page.Element(selector)
+	element, err := e.page.Context(ctx).Element(selector)
 	if err != nil {
 		return err
 	}
@@ -214,13 +503,25 @@ func (e *RodEngine) Click(ctx context.Context, selector string) error {
 }
 
 func (e *RodEngine) Type(ctx context.Context, selector, text string) error {
-	element, err := e.page.Element(selector)
+	element, err := e.page.Context(ctx).Element(selector)
 	if err != nil {
 		return err
 	}
 	return element.Input(text)
 }
 
+func (e *RodEngine) Cookies(ctx context.Context) ([]*http.Cookie, error) {
+	found, err := e.page.Context(ctx).Cookies(nil)
+	if err != nil {
+		return nil, err
+	}
+	cookies := make([]*http.Cookie, 0, len(found))
+	for _, c := range found {
+		cookies = append(cookies, browserCookie(c.Name, c.Value, c.Domain, c.Path, float64(c.Expires), c.HTTPOnly, c.Secure))
+	}
+	return cookies, nil
+}
+
 func (e *RodEngine) Close() error {
 	if e.page != nil {
 		e.page.Close()
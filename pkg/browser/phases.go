@@ -0,0 +1,192 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Timeouts bounds each phase of a browser fetch separately. A zero phase
+// timeout leaves that phase limited only by Total; a zero Total falls back
+// to Config.Timeout.
+type Timeouts struct {
+	Navigate     time.Duration
+	WaitSelector time.Duration
+	Script       time.Duration
+	Total        time.Duration
+}
+
+type Phase string
+
+const (
+	PhaseNavigate     Phase = "navigate"
+	PhaseWaitSelector Phase = "wait_selector"
+	PhaseScript       Phase = "script"
+	PhaseExtract      Phase = "extract"
+	PhaseTotal        Phase = "total"
+)
+
+type PhaseTimeoutError struct {
+	Phase   Phase
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *PhaseTimeoutError) Error() string {
+	return fmt.Sprintf("browser %s phase timed out after %s: %v", e.Phase, e.Timeout, e.Err)
+}
+
+func (e *PhaseTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+type FetchOptions struct {
+	WaitSelector string
+	Scripts      []string
+}
+
+// FetchHTML renders url in a pooled engine and returns the resulting HTML.
+// Every phase runs under its own deadline from Config.Timeouts, and a
+// deadline hit is reported as a *PhaseTimeoutError naming the phase.
+func (m *Manager) FetchHTML(ctx context.Context, url string, opts FetchOptions) (string, error) {
+	totalCtx, timeouts, cancel := m.withTotalTimeout(ctx)
+	defer cancel()
+
+	// Engines outlive this call once returned to the pool, so they must not
+	// be tied to the request context.
+	engine, err := m.GetEngine(context.Background())
+	if err != nil {
+		return "", err
+	}
+	defer m.ReturnEngine(engine)
+
+	err = runPhase(totalCtx, PhaseNavigate, timeouts, func(ctx context.Context) error {
+		return engine.Navigate(ctx, url)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if opts.WaitSelector != "" {
+		waitTimeout := timeouts.WaitSelector
+		if waitTimeout == 0 {
+			waitTimeout = timeouts.Total
+		}
+		err = runPhase(totalCtx, PhaseWaitSelector, timeouts, func(ctx context.Context) error {
+			return engine.WaitForSelector(ctx, opts.WaitSelector, waitTimeout)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for _, script := range opts.Scripts {
+		err = runPhase(totalCtx, PhaseScript, timeouts, func(ctx context.Context) error {
+			_, err := engine.ExecuteScript(ctx, script)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var html string
+	err = runPhase(totalCtx, PhaseExtract, timeouts, func(ctx context.Context) error {
+		var err error
+		html, err = engine.GetHTML(ctx)
+		return err
+	})
+	return html, err
+}
+
+// Screenshot renders url in a pooled engine and captures it as a PNG: the
+// whole page with fullPage, which needs a FullScreenshotEngine, otherwise
+// the viewport. Phases time out as in
+// FetchHTML, the capture counting as the extract phase.
+func (m *Manager) Screenshot(ctx context.Context, url string, fullPage bool) ([]byte, error) {
+	totalCtx, timeouts, cancel := m.withTotalTimeout(ctx)
+	defer cancel()
+
+	engine, err := m.GetEngine(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer m.ReturnEngine(engine)
+
+	capture := engine.Screenshot
+	if fullPage {
+		full, ok := engine.(FullScreenshotEngine)
+		if !ok {
+			return nil, fmt.Errorf("browser engine %T does not support full-page screenshots", engine)
+		}
+		capture = full.FullScreenshot
+	}
+
+	err = runPhase(totalCtx, PhaseNavigate, timeouts, func(ctx context.Context) error {
+		return engine.Navigate(ctx, url)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var png []byte
+	err = runPhase(totalCtx, PhaseExtract, timeouts, func(ctx context.Context) error {
+		var err error
+		png, err = capture(ctx)
+		return err
+	})
+	return png, err
+}
+
+// withTotalTimeout bounds ctx by Timeouts.Total, or Config.Timeout when
+// that is zero, and returns the timeouts with Total filled in.
+func (m *Manager) withTotalTimeout(ctx context.Context) (context.Context, Timeouts, context.CancelFunc) {
+	timeouts := m.config.Timeouts
+	if timeouts.Total == 0 {
+		timeouts.Total = m.config.Timeout
+	}
+	if timeouts.Total <= 0 {
+		return ctx, timeouts, func() {}
+	}
+	totalCtx, cancel := context.WithTimeout(ctx, timeouts.Total)
+	return totalCtx, timeouts, cancel
+}
+
+func runPhase(ctx context.Context, phase Phase, timeouts Timeouts, fn func(context.Context) error) error {
+	limit := phaseTimeout(phase, timeouts)
+
+	phaseCtx := ctx
+	if limit > 0 {
+		var cancel context.CancelFunc
+		phaseCtx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+	}
+
+	err := fn(phaseCtx)
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case ctx.Err() != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return &PhaseTimeoutError{Phase: PhaseTotal, Timeout: timeouts.Total, Err: err}
+	case limit > 0 && errors.Is(phaseCtx.Err(), context.DeadlineExceeded):
+		return &PhaseTimeoutError{Phase: phase, Timeout: limit, Err: err}
+	}
+
+	return fmt.Errorf("browser %s phase failed: %w", phase, err)
+}
+
+func phaseTimeout(phase Phase, timeouts Timeouts) time.Duration {
+	switch phase {
+	case PhaseNavigate:
+		return timeouts.Navigate
+	case PhaseWaitSelector:
+		return timeouts.WaitSelector
+	case PhaseScript:
+		return timeouts.Script
+	default:
+		return 0
+	}
+}
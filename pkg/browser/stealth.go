@@ -0,0 +1,156 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// InitScriptEngine is implemented by engines that can run a script in every
+// new document before the page's own scripts. The Manager installs the
+// scripts of WithBrowserInitScripts and WithNavigatorStealth through it.
+type InitScriptEngine interface {
+	AddInitScript(ctx context.Context, script string) error
+}
+
+// ManagerOption configures a Manager.
+type ManagerOption func(*Manager)
+
+// WithBrowserInitScripts runs scripts in every new document of the
+// Manager's engines, before the page's own scripts, e.g. to patch a
+// particular anti-bot SDK. Scripts run in order and exactly as given, so
+// globals they declare stay visible to the page; one that throws does not
+// stop the ones after it, and its exception is logged to Config.Logger.
+func WithBrowserInitScripts(scripts []string) ManagerOption {
+	return func(m *Manager) {
+		m.initScripts = append(m.initScripts, scripts...)
+	}
+}
+
+// WithNavigatorStealth runs the built-in navigator spoofing before any
+// WithBrowserInitScripts scripts: it hides navigator.webdriver and fills in
+// navigator.languages, navigator.plugins and window.chrome when missing.
+func WithNavigatorStealth() ManagerOption {
+	return func(m *Manager) {
+		m.navigatorStealth = true
+	}
+}
+
+// navigatorStealthScript hides the most common automation giveaways before
+// any page script can look at them.
+const navigatorStealthScript = `
+Object.defineProperty(navigator, 'webdriver', {get: () => undefined});
+if (!navigator.languages || navigator.languages.length === 0) {
+	Object.defineProperty(navigator, 'languages', {get: () => ['en-US', 'en']});
+}
+if (navigator.plugins.length === 0) {
+	Object.defineProperty(navigator, 'plugins', {get: () => [1, 2, 3, 4, 5]});
+}
+window.chrome = window.chrome || {runtime: {}};
+`
+
+// initErrorsVar collects exceptions thrown by init scripts in the page, since
+// Page.addScriptToEvaluateOnNewDocument gives no way to report them.
+// initScriptVar names the init script running, so its uncaught exceptions
+// can be told apart from the page's.
+const (
+	initErrorsVar = "__goscraperInitErrors"
+	initScriptVar = "__goscraperInitScript"
+)
+
+// initErrorsScript starts recording the uncaught exceptions of the init
+// scripts that follow it, until initDoneScript.
+const initErrorsScript = `(function() {
+	window.` + initErrorsVar + ` = [];
+	function record(e) {
+		if (window.` + initScriptVar + ` === undefined) {
+			return;
+		}
+		window.` + initErrorsVar + `.push({script: String(window.` + initScriptVar + `), error: String(e.error && e.error.stack || e.message)});
+	}
+	window.addEventListener('error', record);
+	window.` + initScriptVar + `Done = function() {
+		window.removeEventListener('error', record);
+		delete window.` + initScriptVar + `;
+		delete window.` + initScriptVar + `Done;
+	};
+})();`
+
+const initDoneScript = `window.` + initScriptVar + `Done();`
+
+func initScriptMarker(name string) string {
+	return fmt.Sprintf("window.%s = %q;", initScriptVar, name)
+}
+
+// scripts returns what to install on every new document: the error
+// recording, then each of the built-in navigator spoofing (if enabled) and
+// the WithBrowserInitScripts scripts preceded by a marker naming it.
+func (m *Manager) scripts() []string {
+	if !m.navigatorStealth && len(m.initScripts) == 0 {
+		return nil
+	}
+	scripts := []string{initErrorsScript}
+	if m.navigatorStealth {
+		scripts = append(scripts, initScriptMarker("builtin"), navigatorStealthScript)
+	}
+	for i, script := range m.initScripts {
+		scripts = append(scripts, initScriptMarker(strconv.Itoa(i)), script)
+	}
+	return append(scripts, initDoneScript)
+}
+
+// installInitScripts adds the Manager's init scripts to a new engine.
+func (m *Manager) installInitScripts(ctx context.Context, engine Engine) error {
+	scripts := m.scripts()
+	if len(scripts) == 0 {
+		return nil
+	}
+	installer, ok := engine.(InitScriptEngine)
+	if !ok {
+		return fmt.Errorf("browser engine %T does not support init scripts", engine)
+	}
+	for i, script := range scripts {
+		if err := installer.AddInitScript(ctx, script); err != nil {
+			return fmt.Errorf("failed to install init script %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// readInitErrorsScript drains the errors recorded since the last navigation.
+const readInitErrorsScript = `(function() {
+	var errors = window.` + initErrorsVar + ` || [];
+	window.` + initErrorsVar + ` = [];
+	return JSON.stringify(errors);
+})()`
+
+type initScriptError struct {
+	Script string `json:"script"`
+	Error  string `json:"error"`
+}
+
+func (c *Config) logger() *zap.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return zap.NewNop()
+}
+
+// reportInitScriptErrors logs the init script failures read back from the
+// page as JSON by readInitErrorsScript.
+func reportInitScriptErrors(logger *zap.Logger, url, raw string) {
+	var errs []initScriptError
+	if err := json.Unmarshal([]byte(raw), &errs); err != nil {
+		return
+	}
+	for _, e := range errs {
+		logger.Warn("Browser init script failed",
+			zap.String("url", url),
+			zap.String("script", e.Script),
+			zap.String("error", e.Error),
+		)
+	}
+}
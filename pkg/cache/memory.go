@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryCacheSweepInterval is how often Set removes every expired item from
+// a MemoryCache. In between, expired items are removed as they are looked up.
+const memoryCacheSweepInterval = time.Minute
+
+// MemoryCache is a Cache held in process memory, safe for concurrent use.
+// Values are stored as given rather than serialized, so callers must not
+// modify a value after storing it or one they got back.
+//
+// With a maximum size, storing a new key beyond it evicts the least
+// recently used one.
+type MemoryCache struct {
+	ttl      time.Duration
+	maxItems int
+
+	mu        sync.Mutex
+	items     map[string]*list.Element
+	lru       *list.List
+	lastSweep time.Time
+	hits      int64
+	misses    int64
+}
+
+// NewMemoryCache creates a cache whose items expire after ttl when Set is
+// given no TTL of its own, holding at most maxItems items. A maxItems of 0
+// or less means no limit.
+func NewMemoryCache(ttl time.Duration, maxItems int) *MemoryCache {
+	return &MemoryCache{
+		ttl:       ttl,
+		maxItems:  maxItems,
+		items:     make(map[string]*list.Element),
+		lru:       list.New(),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryCache) Get(ctx context.Context, key string) (*CacheItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.items[key]
+	if !ok {
+		m.misses++
+		return nil, ErrCacheMiss
+	}
+
+	item := element.Value.(*CacheItem)
+	if m.expired(item, time.Now()) {
+		m.remove(element)
+		m.misses++
+		return nil, ErrCacheExpired
+	}
+
+	m.hits++
+	m.lru.MoveToFront(element)
+	copy := *item
+	return &copy, nil
+}
+
+func (m *MemoryCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = m.ttl
+	}
+
+	now := time.Now()
+	item := &CacheItem{
+		Key:       key,
+		Value:     value,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		item.ExpiresAt = now.Add(ttl)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) >= memoryCacheSweepInterval {
+		m.sweep(now)
+	}
+
+	if element, ok := m.items[key]; ok {
+		element.Value = item
+		m.lru.MoveToFront(element)
+		return nil
+	}
+
+	m.items[key] = m.lru.PushFront(item)
+	if m.maxItems > 0 && m.lru.Len() > m.maxItems {
+		// Expired items go first; only then is a live item evicted.
+		m.sweep(now)
+		for m.lru.Len() > m.maxItems {
+			m.remove(m.lru.Back())
+		}
+	}
+	return nil
+}
+
+func (m *MemoryCache) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, ok := m.items[key]; ok {
+		m.remove(element)
+	}
+	return nil
+}
+
+func (m *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.items[key]
+	return ok && !m.expired(element.Value.(*CacheItem), time.Now()), nil
+}
+
+func (m *MemoryCache) Clear(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items = make(map[string]*list.Element)
+	m.lru.Init()
+	return nil
+}
+
+// Keys returns the live keys matching pattern, a glob in which * matches
+// any run of characters and ? any single one, as in Redis.
+func (m *MemoryCache) Keys(ctx context.Context, pattern string) ([]string, error) {
+	matcher, err := globRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var keys []string
+	for key, element := range m.items {
+		if !m.expired(element.Value.(*CacheItem), now) && matcher.MatchString(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Stats reports the live keys and the hits and misses of Get so far. An
+// expired item counts as a miss. Memory usage is not tracked.
+func (m *MemoryCache) Stats(ctx context.Context) (*CacheStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(time.Now())
+
+	stats := &CacheStats{
+		TotalKeys: int64(len(m.items)),
+		HitCount:  m.hits,
+		MissCount: m.misses,
+	}
+	if lookups := stats.HitCount + stats.MissCount; lookups > 0 {
+		stats.HitRatio = float64(stats.HitCount) / float64(lookups)
+	}
+	return stats, nil
+}
+
+// Trim releases memory by removing every expired item and then the least
+// recently used ones until at most fraction of the items are left. A
+// fraction of 0 or less empties the cache.
+func (m *MemoryCache) Trim(fraction float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(time.Now())
+	keep := 0
+	if fraction > 0 {
+		keep = int(float64(m.lru.Len()) * fraction)
+	}
+	for m.lru.Len() > keep {
+		m.remove(m.lru.Back())
+	}
+}
+
+func (m *MemoryCache) expired(item *CacheItem, now time.Time) bool {
+	return !item.ExpiresAt.IsZero() && !now.Before(item.ExpiresAt)
+}
+
+// sweep removes every expired item. m.mu must be held.
+func (m *MemoryCache) sweep(now time.Time) {
+	m.lastSweep = now
+	for _, element := range m.items {
+		if m.expired(element.Value.(*CacheItem), now) {
+			m.remove(element)
+		}
+	}
+}
+
+func (m *MemoryCache) remove(element *list.Element) {
+	delete(m.items, element.Value.(*CacheItem).Key)
+	m.lru.Remove(element)
+}
+
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.Compile("^" + quoted + "$")
+}
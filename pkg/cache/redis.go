@@ -4,6 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -140,25 +144,62 @@ func (r *RedisCache) Keys(ctx context.Context, pattern string) ([]string, error)
 	return result, nil
 }
 
+// Ping checks that Redis is reachable.
+func (r *RedisCache) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
 func (r *RedisCache) Stats(ctx context.Context) (*CacheStats, error) {
-	_, err := r.client.Info(ctx, "memory", "stats").Result()
+	info, err := r.client.Info(ctx, "memory", "stats", "clients", "keyspace").Result()
 	if err != nil {
 		return nil, err
 	}
 
+	return ParseRedisInfo(info, r.client.Options().DB), nil
+}
+
+// ParseRedisInfo builds CacheStats from the output of the Redis INFO command,
+// counting the keys of database db. Missing sections or fields leave the
+// corresponding stats at zero.
+func ParseRedisInfo(info string, db int) *CacheStats {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = value
+		}
+	}
+
 	stats := &CacheStats{
-		TotalKeys:   0,
-		HitCount:    0, 
-		MissCount:   0, 
-		HitRatio:    0, 
-		MemoryUsage: 0, 
-		Connections: 0, 
+		HitCount:    infoInt(fields["keyspace_hits"]),
+		MissCount:   infoInt(fields["keyspace_misses"]),
+		MemoryUsage: infoInt(fields["used_memory"]),
+		Connections: int(infoInt(fields["connected_clients"])),
 	}
 
-	// Info string'ini parse et ve stats'ı doldur
-	// Bu kısım Redis info formatına göre implement edilecek
+	// Keyspace lines look like "db0:keys=12,expires=3,avg_ttl=0".
+	for _, pair := range strings.Split(fields[fmt.Sprintf("db%d", db)], ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok && key == "keys" {
+			stats.TotalKeys = infoInt(value)
+		}
+	}
 
-	return stats, nil
+	if lookups := stats.HitCount + stats.MissCount; lookups > 0 {
+		stats.HitRatio = float64(stats.HitCount) / float64(lookups)
+	}
+
+	return stats
+}
+
+func infoInt(value string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
 }
 
 func (r *RedisCache) getFullKey(key string) string {
@@ -171,12 +212,25 @@ func (r *RedisCache) getFullKey(key string) string {
 var (
 	ErrCacheMiss    = fmt.Errorf("cache miss")
 	ErrCacheExpired = fmt.Errorf("cache expired")
+	// ErrCacheClosed is returned for WriteBack updates made after Close.
+	ErrCacheClosed = fmt.Errorf("cache closed")
 )
 
+// writeBackQueueSize is how many WriteBack updates of the secondary tier
+// can wait to be applied.
+const writeBackQueueSize = 1024
+
 type DistributedCache struct {
 	primary   Cache
 	secondary Cache
 	strategy  CacheStrategy
+
+	// mu guards closing writeBack against updates still being queued.
+	mu            sync.RWMutex
+	closed        bool
+	writeBack     chan func(ctx context.Context)
+	writeBackDone chan struct{}
+	dropped       atomic.Int64
 }
 
 type CacheStrategy string
@@ -187,12 +241,25 @@ const (
 	WriteAround  CacheStrategy = "write_around"
 )
 
+// NewDistributedCache layers primary over secondary. With WriteBack a
+// background worker updates the secondary; Close stops it.
 func NewDistributedCache(primary, secondary Cache, strategy CacheStrategy) *DistributedCache {
-	return &DistributedCache{
+	d := &DistributedCache{
 		primary:   primary,
 		secondary: secondary,
 		strategy:  strategy,
 	}
+	if strategy == WriteBack {
+		d.writeBack = make(chan func(ctx context.Context), writeBackQueueSize)
+		d.writeBackDone = make(chan struct{})
+		go func() {
+			defer close(d.writeBackDone)
+			for op := range d.writeBack {
+				op(context.Background())
+			}
+		}()
+	}
+	return d
 }
 
 func (d *DistributedCache) Get(ctx context.Context, key string) (*CacheItem, error) {
@@ -221,11 +288,166 @@ func (d *DistributedCache) Set(ctx context.Context, key string, value interface{
 		return err2
 	case WriteBack:
 		err := d.primary.Set(ctx, key, value, ttl)
-		go d.secondary.Set(context.Background(), key, value, ttl)
+		if queueErr := d.writeBehind(ctx, false, func(ctx context.Context) { d.secondary.Set(ctx, key, value, ttl) }); err == nil {
+			err = queueErr
+		}
 		return err
 	case WriteAround:
 		return d.primary.Set(ctx, key, value, ttl)
 	default:
 		return d.primary.Set(ctx, key, value, ttl)
 	}
-}
\ No newline at end of file
+}
+
+// writeBehind queues a WriteBack update of the secondary tier. Updates run
+// in the background one at a time, in order, so a Delete cannot be
+// overtaken by the Set before it. When the queue is full a droppable
+// update (a Set, which at worst turns into a miss) is dropped and counted;
+// any other waits for room until ctx is done.
+func (d *DistributedCache) writeBehind(ctx context.Context, mustQueue bool, op func(ctx context.Context)) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrCacheClosed
+	}
+
+	select {
+	case d.writeBack <- op:
+		return nil
+	default:
+	}
+	if !mustQueue {
+		d.dropped.Add(1)
+		return nil
+	}
+	select {
+	case d.writeBack <- op:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DroppedWrites reports how many WriteBack Sets never reached the secondary
+// tier because the update queue was full.
+func (d *DistributedCache) DroppedWrites() int64 {
+	return d.dropped.Load()
+}
+
+// Close waits for the queued WriteBack updates to be applied and stops the
+// worker applying them; later Set, Delete and Clear calls fail with
+// ErrCacheClosed. The tiers themselves are left open. Close does nothing
+// for the other strategies.
+func (d *DistributedCache) Close() error {
+	if d.strategy != WriteBack {
+		return nil
+	}
+
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.writeBack)
+	}
+	d.mu.Unlock()
+
+	<-d.writeBackDone
+	return nil
+}
+
+// Delete removes key from both tiers. With WriteBack the secondary is
+// updated in the background, as with Set.
+func (d *DistributedCache) Delete(ctx context.Context, key string) error {
+	if d.strategy == WriteBack {
+		err := d.primary.Delete(ctx, key)
+		if queueErr := d.writeBehind(ctx, true, func(ctx context.Context) { d.secondary.Delete(ctx, key) }); err == nil {
+			err = queueErr
+		}
+		return err
+	}
+
+	err1 := d.primary.Delete(ctx, key)
+	err2 := d.secondary.Delete(ctx, key)
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+// Exists reports whether either tier holds key, asking the primary first.
+func (d *DistributedCache) Exists(ctx context.Context, key string) (bool, error) {
+	exists, err := d.primary.Exists(ctx, key)
+	if err == nil && exists {
+		return true, nil
+	}
+	return d.secondary.Exists(ctx, key)
+}
+
+// Clear empties both tiers. With WriteBack the secondary is cleared in the
+// background.
+func (d *DistributedCache) Clear(ctx context.Context) error {
+	if d.strategy == WriteBack {
+		err := d.primary.Clear(ctx)
+		if queueErr := d.writeBehind(ctx, true, func(ctx context.Context) { d.secondary.Clear(ctx) }); err == nil {
+			err = queueErr
+		}
+		return err
+	}
+
+	err1 := d.primary.Clear(ctx)
+	err2 := d.secondary.Clear(ctx)
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+// Keys returns the keys matching pattern in either tier, each once.
+func (d *DistributedCache) Keys(ctx context.Context, pattern string) ([]string, error) {
+	primary, err := d.primary.Keys(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := d.secondary.Keys(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(primary)+len(secondary))
+	keys := make([]string, 0, len(primary)+len(secondary))
+	for _, key := range append(primary, secondary...) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Stats merges the stats of both tiers: hits, misses, memory and
+// connections add up. The tiers mostly hold the same keys, so TotalKeys is
+// the larger of the two counts rather than their sum.
+func (d *DistributedCache) Stats(ctx context.Context) (*CacheStats, error) {
+	primary, err := d.primary.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := d.secondary.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &CacheStats{
+		TotalKeys:   primary.TotalKeys,
+		HitCount:    primary.HitCount + secondary.HitCount,
+		MissCount:   primary.MissCount + secondary.MissCount,
+		MemoryUsage: primary.MemoryUsage + secondary.MemoryUsage,
+		Connections: primary.Connections + secondary.Connections,
+	}
+	if secondary.TotalKeys > stats.TotalKeys {
+		stats.TotalKeys = secondary.TotalKeys
+	}
+	if lookups := stats.HitCount + stats.MissCount; lookups > 0 {
+		stats.HitRatio = float64(stats.HitCount) / float64(lookups)
+	}
+	return stats, nil
+}
@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/consul/api"
+	"github.com/ramusaaa/goscraper/internal"
 	"go.uber.org/zap"
 )
 
@@ -47,6 +49,7 @@ type Coordinator interface {
 	DistributeJob(ctx context.Context, job *Job) (*Node, error)
 	ElectLeader(ctx context.Context) (string, error)
 	IsLeader(ctx context.Context) (bool, error)
+	WatchLeader(ctx context.Context) (<-chan string, error)
 	WatchNodes(ctx context.Context) (<-chan NodeEvent, error)
 }
 
@@ -74,6 +77,21 @@ const (
 	EventNodeFailed  EventType = "node_failed"
 )
 
+// maxAssignAttempts bounds how often DistributeJob picks a node again after
+// losing a race to claim one.
+const maxAssignAttempts = 10
+
+// leaderLockDelay is the lock delay of leader sessions: how long Consul
+// keeps the leader lock from being taken after its holder's session is
+// invalidated.
+const leaderLockDelay = time.Second
+
+// DefaultNodeTTL is the ConsulConfig.NodeTTL used when none is set.
+const DefaultNodeTTL = 90 * time.Second
+
+// DefaultSessionTTL is the ConsulConfig.SessionTTL used when none is set.
+const DefaultSessionTTL = 30 * time.Second
+
 type ConsulCoordinator struct {
 	client    *api.Client
 	config    *ConsulConfig
@@ -81,7 +99,16 @@ type ConsulCoordinator struct {
 	nodeID    string
 	leaderKey string
 	mu        sync.RWMutex
+
+	// ctx lives until Close; the sessions are renewed under it rather than
+	// under the ctx of whichever call created them.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	sessionMu     sync.Mutex
+	leaderSession string
 	nodes     map[string]*Node
+	failed    map[string]bool
 }
 
 type ConsulConfig struct {
@@ -89,6 +116,14 @@ type ConsulConfig struct {
 	Datacenter string `json:"datacenter"`
 	Token      string `json:"token"`
 	Prefix     string `json:"prefix"`
+
+	// NodeTTL is how old a node's LastSeen may get before WatchNodes
+	// reports the node failed, so nodes must call UpdateNodeLoad more often
+	// than that even while idle. Zero means DefaultNodeTTL.
+	NodeTTL time.Duration `json:"node_ttl"`
+	// SessionTTL is the TTL of the node and leader sessions, which are
+	// renewed every third of it. Zero means DefaultSessionTTL.
+	SessionTTL time.Duration `json:"session_ttl"`
 }
 
 func NewConsulCoordinator(config *ConsulConfig, nodeID string, logger *zap.Logger) (*ConsulCoordinator, error) {
@@ -102,16 +137,47 @@ func NewConsulCoordinator(config *ConsulConfig, nodeID string, logger *zap.Logge
 		return nil, fmt.Errorf("failed to create consul client: %w", err)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &ConsulCoordinator{
 		client:    client,
 		config:    config,
 		logger:    logger,
 		nodeID:    nodeID,
 		leaderKey: fmt.Sprintf("%s/leader", config.Prefix),
+		ctx:       ctx,
+		cancel:    cancel,
 		nodes:     make(map[string]*Node),
+		failed:    make(map[string]bool),
 	}, nil
 }
 
+// Close stops renewing the coordinator's sessions and destroys its leader
+// session, so another node can take the leader lock without waiting for the
+// session to expire.
+func (c *ConsulCoordinator) Close() error {
+	c.cancel()
+
+	c.sessionMu.Lock()
+	sessionID := c.leaderSession
+	c.leaderSession = ""
+	c.sessionMu.Unlock()
+
+	if sessionID == "" {
+		return nil
+	}
+	if _, err := c.client.Session().Destroy(sessionID, nil); err != nil {
+		return fmt.Errorf("failed to destroy leader session: %w", err)
+	}
+	return nil
+}
+
+func (c *ConsulCoordinator) sessionTTL() time.Duration {
+	if c.config.SessionTTL > 0 {
+		return c.config.SessionTTL
+	}
+	return DefaultSessionTTL
+}
+
 func (c *ConsulCoordinator) RegisterNode(ctx context.Context, node *Node) error {
 	key := fmt.Sprintf("%s/nodes/%s", c.config.Prefix, node.ID)
 	
@@ -122,7 +188,7 @@ func (c *ConsulCoordinator) RegisterNode(ctx context.Context, node *Node) error
 
 	session := &api.SessionEntry{
 		Name:      fmt.Sprintf("node-%s", node.ID),
-		TTL:       "30s",
+		TTL:       c.sessionTTL().String(),
 		Behavior:  api.SessionBehaviorDelete,
 		LockDelay: time.Second,
 	}
@@ -143,7 +209,7 @@ func (c *ConsulCoordinator) RegisterNode(ctx context.Context, node *Node) error
 		return fmt.Errorf("failed to register node: %w", err)
 	}
 
-	go c.renewSession(ctx, sessionID)
+	go c.renewSession(sessionID)
 
 	c.mu.Lock()
 	c.nodes[node.ID] = node
@@ -170,26 +236,40 @@ func (c *ConsulCoordinator) UnregisterNode(ctx context.Context, nodeID string) e
 }
 
 func (c *ConsulCoordinator) GetNodes(ctx context.Context) ([]*Node, error) {
-	prefix := fmt.Sprintf("%s/nodes/", c.config.Prefix)
-	
-	pairs, _, err := c.client.KV().List(prefix, nil)
+	pairs, err := c.listNodePairs(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list nodes: %w", err)
+		return nil, err
 	}
 
 	var nodes []*Node
 	for _, pair := range pairs {
-		var node Node
-		if err := json.Unmarshal(pair.Value, &node); err != nil {
-			c.logger.Warn("Failed to unmarshal node", zap.Error(err))
-			continue
+		if node := c.decodeNode(pair); node != nil {
+			nodes = append(nodes, node)
 		}
-		nodes = append(nodes, &node)
 	}
 
 	return nodes, nil
 }
 
+func (c *ConsulCoordinator) listNodePairs(ctx context.Context) (api.KVPairs, error) {
+	prefix := fmt.Sprintf("%s/nodes/", c.config.Prefix)
+
+	pairs, _, err := c.client.KV().List(prefix, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return pairs, nil
+}
+
+func (c *ConsulCoordinator) decodeNode(pair *api.KVPair) *Node {
+	var node Node
+	if err := json.Unmarshal(pair.Value, &node); err != nil {
+		c.logger.Warn("Failed to unmarshal node", zap.String("key", pair.Key), zap.Error(err))
+		return nil
+	}
+	return &node
+}
+
 func (c *ConsulCoordinator) GetNode(ctx context.Context, nodeID string) (*Node, error) {
 	key := fmt.Sprintf("%s/nodes/%s", c.config.Prefix, nodeID)
 	
@@ -210,61 +290,291 @@ func (c *ConsulCoordinator) GetNode(ctx context.Context, nodeID string) (*Node,
 	return &node, nil
 }
 
+// UpdateNodeLoad records the load a node reports and refreshes its
+// LastSeen. QueueSize is kept as DistributeJob and ReleaseJob left it, since
+// it counts the jobs assigned to the node that are not done yet. The write
+// is a check-and-set, made again if the node changes in the meantime, so it
+// does not undo a concurrent claim.
 func (c *ConsulCoordinator) UpdateNodeLoad(ctx context.Context, nodeID string, load *NodeLoad) error {
-	node, err := c.GetNode(ctx, nodeID)
-	if err != nil {
-		return err
-	}
+	key := fmt.Sprintf("%s/nodes/%s", c.config.Prefix, nodeID)
+
+	for attempt := 0; attempt < maxAssignAttempts; attempt++ {
+		pair, _, err := c.client.KV().Get(key, (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to get node: %w", err)
+		}
+		if pair == nil {
+			return fmt.Errorf("node not found: %s", nodeID)
+		}
+
+		var node Node
+		if err := json.Unmarshal(pair.Value, &node); err != nil {
+			return fmt.Errorf("failed to unmarshal node: %w", err)
+		}
 
-	node.Load = load
-	node.LastSeen = time.Now()
+		updated := *load
+		updated.QueueSize = 0
+		if node.Load != nil {
+			updated.QueueSize = node.Load.QueueSize
+		}
+		node.Load = &updated
+		node.LastSeen = time.Now()
+
+		data, err := json.Marshal(&node)
+		if err != nil {
+			return fmt.Errorf("failed to marshal node: %w", err)
+		}
 
-	return c.RegisterNode(ctx, node)
+		stored, _, err := c.client.KV().CAS(&api.KVPair{
+			Key:         key,
+			Value:       data,
+			ModifyIndex: pair.ModifyIndex,
+		}, (&api.WriteOptions{}).WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to update node load: %w", err)
+		}
+		if stored {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to update load of node %s: node kept changing", nodeID)
 }
 
+// DistributeJob assigns job to the active node with the best score among
+// those with the capabilities it requires, and claims capacity on that node
+// by bumping its queue size with a check-and-set, so concurrent callers see
+// the node as busier and spread their jobs out. If another caller changes
+// the node first, the choice is made again. job.AssignedTo is set to the
+// chosen node, and the job is stored under the prefix's jobs/ keys in the
+// same transaction as the claim. Call ReleaseJob once the job is done to
+// give the capacity back.
 func (c *ConsulCoordinator) DistributeJob(ctx context.Context, job *Job) (*Node, error) {
-	nodes, err := c.GetNodes(ctx)
+	for attempt := 0; attempt < maxAssignAttempts; attempt++ {
+		pairs, err := c.listNodePairs(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var bestNode *Node
+		var bestPair *api.KVPair
+		var bestScore float64
+
+		for _, pair := range pairs {
+			node := c.decodeNode(pair)
+			if node == nil || node.Status != NodeStatusActive {
+				continue
+			}
+
+			if !c.nodeSupportsJob(node, job) {
+				continue
+			}
+
+			score := c.calculateNodeScore(node, job)
+			if bestNode == nil || score > bestScore {
+				bestNode = node
+				bestPair = pair
+				bestScore = score
+			}
+		}
+
+		if bestNode == nil {
+			return nil, fmt.Errorf("no suitable node found for job")
+		}
+
+		claimed, err := c.claimNode(ctx, bestPair, bestNode, job)
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			job.AssignedTo = bestNode.ID
+			return bestNode, nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to assign job %s: nodes kept changing", job.ID)
+}
+
+// claimNode adds job to node's queue and stores it as assigned to node, in
+// one transaction, provided the node's key is still at the revision in
+// pair. It reports false if the node changed in the meantime.
+func (c *ConsulCoordinator) claimNode(ctx context.Context, pair *api.KVPair, node *Node, job *Job) (bool, error) {
+	load := NodeLoad{}
+	if node.Load != nil {
+		load = *node.Load
+	}
+	load.QueueSize++
+	node.Load = &load
+
+	nodeData, err := json.Marshal(node)
 	if err != nil {
-		return nil, err
+		return false, fmt.Errorf("failed to marshal node: %w", err)
 	}
 
-	var bestNode *Node
-	var bestScore float64
+	assigned := *job
+	assigned.AssignedTo = node.ID
+	jobData, err := json.Marshal(&assigned)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal job: %w", err)
+	}
 
-	for _, node := range nodes {
-		if node.Status != NodeStatusActive {
-			continue
+	claimed, _, _, err := c.client.Txn().Txn(api.TxnOps{
+		{KV: &api.KVTxnOp{Verb: api.KVCAS, Key: pair.Key, Value: nodeData, Index: pair.ModifyIndex}},
+		{KV: &api.KVTxnOp{Verb: api.KVSet, Key: c.jobKey(job.ID), Value: jobData}},
+	}, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return false, fmt.Errorf("failed to claim node %s: %w", node.ID, err)
+	}
+	return claimed, nil
+}
+
+// ReleaseJob gives back the capacity DistributeJob claimed on a node for a
+// job, and forgets the job's assignment, once the job is done. Jobs that
+// were not distributed, or were already released, are ignored.
+func (c *ConsulCoordinator) ReleaseJob(ctx context.Context, jobID string) error {
+	for attempt := 0; attempt < maxAssignAttempts; attempt++ {
+		jobPair, _, err := c.client.KV().Get(c.jobKey(jobID), (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to get job: %w", err)
+		}
+		if jobPair == nil {
+			return nil
 		}
 
-		if !c.nodeSupportsJob(node, job) {
-			continue
+		ops := api.TxnOps{
+			{KV: &api.KVTxnOp{Verb: api.KVDeleteCAS, Key: jobPair.Key, Index: jobPair.ModifyIndex}},
+		}
+
+		var job Job
+		if err := json.Unmarshal(jobPair.Value, &job); err != nil {
+			c.logger.Warn("Failed to unmarshal job", zap.String("key", jobPair.Key), zap.Error(err))
+		} else if job.AssignedTo != "" {
+			key := fmt.Sprintf("%s/nodes/%s", c.config.Prefix, job.AssignedTo)
+			nodePair, _, err := c.client.KV().Get(key, (&api.QueryOptions{}).WithContext(ctx))
+			if err != nil {
+				return fmt.Errorf("failed to get node: %w", err)
+			}
+			// A node that left has no capacity to give back.
+			if nodePair != nil {
+				if node := c.decodeNode(nodePair); node != nil && node.Load != nil && node.Load.QueueSize > 0 {
+					node.Load.QueueSize--
+					data, err := json.Marshal(node)
+					if err != nil {
+						return fmt.Errorf("failed to marshal node: %w", err)
+					}
+					ops = append(ops, &api.TxnOp{KV: &api.KVTxnOp{Verb: api.KVCAS, Key: key, Value: data, Index: nodePair.ModifyIndex}})
+				}
+			}
 		}
 
-		score := c.calculateNodeScore(node, job)
-		if bestNode == nil || score > bestScore {
-			bestNode = node
-			bestScore = score
+		released, _, _, err := c.client.Txn().Txn(ops, (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to release job %s: %w", jobID, err)
+		}
+		if released {
+			return nil
 		}
 	}
 
-	if bestNode == nil {
-		return nil, fmt.Errorf("no suitable node found for job")
-	}
+	return fmt.Errorf("failed to release job %s: nodes kept changing", jobID)
+}
 
-	return bestNode, nil
+func (c *ConsulCoordinator) jobKey(jobID string) string {
+	return fmt.Sprintf("%s/jobs/%s", c.config.Prefix, jobID)
 }
 
+// ElectLeader tries to take the leader lock and returns the node that
+// holds it, this one or another.
 func (c *ConsulCoordinator) ElectLeader(ctx context.Context) (string, error) {
-	session := &api.SessionEntry{
-		Name:      fmt.Sprintf("leader-%s", c.nodeID),
-		TTL:       "30s",
-		Behavior:  api.SessionBehaviorRelease,
-		LockDelay: time.Second,
+	leader, err := c.campaign(ctx)
+	if err != nil {
+		return "", err
+	}
+	if leader == "" {
+		return "", fmt.Errorf("no leader found")
 	}
+	return leader, nil
+}
 
-	sessionID, _, err := c.client.Session().Create(session, nil)
+// WatchLeader reports the cluster leader: the current one first, then each
+// new one. It also campaigns for this node in the background, taking the
+// leader lock whenever it is free, as when the leader's session expires, so
+// the cluster does not stay leaderless after the leader fails. The channel
+// is closed once ctx is done.
+func (c *ConsulCoordinator) WatchLeader(ctx context.Context) (<-chan string, error) {
+	leader, err := c.campaign(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to create session: %w", err)
+		return nil, err
+	}
+
+	leaderCh := make(chan string, 1)
+	go c.watchLeader(ctx, leader, leaderCh)
+	return leaderCh, nil
+}
+
+func (c *ConsulCoordinator) watchLeader(ctx context.Context, leader string, leaderCh chan<- string) {
+	defer close(leaderCh)
+
+	var reported string
+	var lastIndex uint64
+	for {
+		if leader != "" && leader != reported {
+			select {
+			case leaderCh <- leader:
+				reported = leader
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		pair, meta, err := c.client.KV().Get(c.leaderKey, (&api.QueryOptions{
+			WaitIndex: lastIndex,
+			WaitTime:  30 * time.Second,
+		}).WithContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.logger.Error("Failed to watch leader", zap.Error(err))
+			if internal.SleepContext(ctx, 5*time.Second) != nil {
+				return
+			}
+			lastIndex = 0
+			continue
+		}
+		lastIndex = meta.LastIndex
+
+		leader = leaderOf(pair)
+		if leader != "" {
+			continue
+		}
+
+		// The lock is free: campaign for it. Consul refuses it for the
+		// lock delay after the old holder's session is invalidated, so a
+		// failed attempt is retried after that rather than on the next
+		// change to the key.
+		leader, err = c.campaign(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.logger.Error("Failed to campaign for leader", zap.Error(err))
+		}
+		if leader == "" {
+			if internal.SleepContext(ctx, leaderLockDelay) != nil {
+				return
+			}
+			lastIndex = 0
+		}
+	}
+}
+
+// campaign tries to take the leader lock with this node's leader session
+// and returns the node holding the lock afterwards, or "" if none does.
+func (c *ConsulCoordinator) campaign(ctx context.Context) (string, error) {
+	sessionID, err := c.leaderSessionID(ctx)
+	if err != nil {
+		return "", err
 	}
 
 	kv := &api.KVPair{
@@ -273,39 +583,101 @@ func (c *ConsulCoordinator) ElectLeader(ctx context.Context) (string, error) {
 		Session: sessionID,
 	}
 
-	acquired, _, err := c.client.KV().Acquire(kv, nil)
+	acquired, _, err := c.client.KV().Acquire(kv, (&api.WriteOptions{}).WithContext(ctx))
 	if err != nil {
+		// Consul rejects a session that has expired or been destroyed;
+		// forget it so the next campaign starts a new one.
+		if entry, _, infoErr := c.client.Session().Info(sessionID, (&api.QueryOptions{}).WithContext(ctx)); infoErr == nil && entry == nil {
+			c.dropLeaderSession(sessionID)
+		}
 		return "", fmt.Errorf("failed to acquire leader lock: %w", err)
 	}
 
 	if acquired {
-		go c.renewSession(ctx, sessionID)
 		return c.nodeID, nil
 	}
 
-	pair, _, err := c.client.KV().Get(c.leaderKey, nil)
+	pair, _, err := c.client.KV().Get(c.leaderKey, (&api.QueryOptions{}).WithContext(ctx))
 	if err != nil {
 		return "", fmt.Errorf("failed to get current leader: %w", err)
 	}
 
-	if pair != nil {
-		return string(pair.Value), nil
+	return leaderOf(pair), nil
+}
+
+// leaderSessionID returns the session this node campaigns with, creating
+// it if there is none. The session is renewed until the coordinator is
+// closed or a renewal fails, when it is forgotten.
+func (c *ConsulCoordinator) leaderSessionID(ctx context.Context) (string, error) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+
+	if c.leaderSession != "" {
+		return c.leaderSession, nil
+	}
+
+	session := &api.SessionEntry{
+		Name:      fmt.Sprintf("leader-%s", c.nodeID),
+		TTL:       c.sessionTTL().String(),
+		Behavior:  api.SessionBehaviorRelease,
+		LockDelay: leaderLockDelay,
+	}
+
+	sessionID, _, err := c.client.Session().Create(session, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %w", err)
 	}
 
-	return "", fmt.Errorf("no leader found")
+	c.leaderSession = sessionID
+	go c.renewSession(sessionID)
+	return sessionID, nil
 }
 
+func (c *ConsulCoordinator) dropLeaderSession(sessionID string) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+
+	if c.leaderSession == sessionID {
+		c.leaderSession = ""
+	}
+}
+
+// leaderOf returns the node holding the leader lock in pair. A key left
+// behind by a released lock still names its last holder, so only a key
+// held by a session counts.
+func leaderOf(pair *api.KVPair) string {
+	if pair == nil || pair.Session == "" {
+		return ""
+	}
+	return string(pair.Value)
+}
+
+// Ping checks that the Consul agent is reachable and its cluster has a
+// leader, without which no coordination works.
+func (c *ConsulCoordinator) Ping(ctx context.Context) error {
+	leader, err := c.client.Status().LeaderWithQueryOptions((&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if leader == "" {
+		return fmt.Errorf("consul cluster has no leader")
+	}
+	return nil
+}
+
+// IsLeader reports whether this node holds the leader lock right now,
+// through its live leader session.
 func (c *ConsulCoordinator) IsLeader(ctx context.Context) (bool, error) {
-	pair, _, err := c.client.KV().Get(c.leaderKey, nil)
+	pair, _, err := c.client.KV().Get(c.leaderKey, (&api.QueryOptions{}).WithContext(ctx))
 	if err != nil {
 		return false, err
 	}
 
-	if pair != nil && string(pair.Value) == c.nodeID {
-		return true, nil
-	}
+	c.sessionMu.Lock()
+	sessionID := c.leaderSession
+	c.sessionMu.Unlock()
 
-	return false, nil
+	return pair != nil && sessionID != "" && pair.Session == sessionID, nil
 }
 
 func (c *ConsulCoordinator) WatchNodes(ctx context.Context) (<-chan NodeEvent, error) {
@@ -322,12 +694,15 @@ func (c *ConsulCoordinator) WatchNodes(ctx context.Context) (<-chan NodeEvent, e
 			case <-ctx.Done():
 				return
 			default:
-				pairs, meta, err := c.client.KV().List(prefix, &api.QueryOptions{
+				pairs, meta, err := c.client.KV().List(prefix, (&api.QueryOptions{
 					WaitIndex: lastIndex,
 					WaitTime:  30 * time.Second,
-				})
+				}).WithContext(ctx))
 				
 				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
 					c.logger.Error("Failed to watch nodes", zap.Error(err))
 					time.Sleep(5 * time.Second)
 					continue
@@ -343,18 +718,29 @@ func (c *ConsulCoordinator) WatchNodes(ctx context.Context) (<-chan NodeEvent, e
 	return eventCh, nil
 }
 
-func (c *ConsulCoordinator) renewSession(ctx context.Context, sessionID string) {
-	ticker := time.NewTicker(10 * time.Second)
+// renewSession keeps a session alive until the coordinator is closed. If
+// the session cannot be renewed it is about to expire, so when it is the
+// leader session it is forgotten and the next campaign starts a new one.
+func (c *ConsulCoordinator) renewSession(sessionID string) {
+	defer c.dropLeaderSession(sessionID)
+
+	ticker := time.NewTicker(c.sessionTTL() / 3)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ctx.Done():
+		case <-c.ctx.Done():
 			return
 		case <-ticker.C:
-			_, _, err := c.client.Session().Renew(sessionID, nil)
+			entry, _, err := c.client.Session().Renew(sessionID, (&api.WriteOptions{}).WithContext(c.ctx))
 			if err != nil {
-				c.logger.Error("Failed to renew session", zap.Error(err))
+				if c.ctx.Err() == nil {
+					c.logger.Error("Failed to renew session", zap.String("session_id", sessionID), zap.Error(err))
+				}
+				return
+			}
+			if entry == nil {
+				c.logger.Warn("Session expired", zap.String("session_id", sessionID))
 				return
 			}
 		}
@@ -377,45 +763,75 @@ func (c *ConsulCoordinator) nodeSupportsJob(node *Node, job *Job) bool {
 	return true
 }
 
+// calculateNodeScore rates how well node can take job; higher is better.
+// A node that has not reported its load yet counts as idle.
 func (c *ConsulCoordinator) calculateNodeScore(node *Node, job *Job) float64 {
-	if node.Load == nil {
-		return 0
+	load := NodeLoad{}
+	if node.Load != nil {
+		load = *node.Load
 	}
 
-	cpuScore := 1.0 - node.Load.CPU
-	memoryScore := 1.0 - node.Load.Memory
-	jobScore := 1.0 / (float64(node.Load.ActiveJobs) + 1)
+	cpuScore := 1.0 - load.CPU
+	memoryScore := 1.0 - load.Memory
+	// Queued jobs count as much as running ones: they are work the node
+	// has already been given.
+	jobScore := 1.0 / (float64(load.ActiveJobs+load.QueueSize) + 1)
 
 	priorityWeight := float64(job.Priority) / 10.0
 
 	return (cpuScore + memoryScore + jobScore) * (1.0 + priorityWeight)
 }
 
+// processNodeChanges compares a snapshot of the node keys with the nodes
+// seen last time and emits an event for each difference. A node that
+// reports itself failed, or whose LastSeen is older than the node TTL, is
+// reported failed once; any other change to its state is an update.
 func (c *ConsulCoordinator) processNodeChanges(pairs api.KVPairs, eventCh chan<- NodeEvent) {
+	now := time.Now()
 	currentNodes := make(map[string]*Node)
 	
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
 	for _, pair := range pairs {
 		var node Node
 		if err := json.Unmarshal(pair.Value, &node); err != nil {
 			continue
 		}
 		currentNodes[node.ID] = &node
-	}
-	
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	
-	for id, node := range currentNodes {
-		if _, exists := c.nodes[id]; !exists {
+
+		previous, exists := c.nodes[node.ID]
+		if !exists {
 			eventCh <- NodeEvent{
 				Type: EventNodeJoined,
-				Node: node,
+				Node: &node,
+			}
+		}
+
+		if c.nodeFailed(&node, now) {
+			if !c.failed[node.ID] {
+				c.failed[node.ID] = true
+				eventCh <- NodeEvent{
+					Type: EventNodeFailed,
+					Node: &node,
+				}
+				continue
+			}
+		} else {
+			delete(c.failed, node.ID)
+		}
+
+		if exists && nodeStateChanged(previous, &node) {
+			eventCh <- NodeEvent{
+				Type: EventNodeUpdated,
+				Node: &node,
 			}
 		}
 	}
 	
 	for id, node := range c.nodes {
 		if _, exists := currentNodes[id]; !exists {
+			delete(c.failed, id)
 			eventCh <- NodeEvent{
 				Type: EventNodeLeft,
 				Node: node,
@@ -424,4 +840,34 @@ func (c *ConsulCoordinator) processNodeChanges(pairs api.KVPairs, eventCh chan<-
 	}
 	
 	c.nodes = currentNodes
-}
\ No newline at end of file
+}
+
+func (c *ConsulCoordinator) nodeFailed(node *Node, now time.Time) bool {
+	if node.Status == NodeStatusFailed {
+		return true
+	}
+
+	ttl := c.config.NodeTTL
+	if ttl <= 0 {
+		ttl = DefaultNodeTTL
+	}
+	return !node.LastSeen.IsZero() && now.Sub(node.LastSeen) > ttl
+}
+
+// nodeStateChanged reports whether a node's serialized state differs,
+// ignoring LastSeen so that load reports which only refresh it do not count
+// as updates.
+func nodeStateChanged(previous, current *Node) bool {
+	a, b := *previous, *current
+	a.LastSeen, b.LastSeen = time.Time{}, time.Time{}
+
+	before, err := json.Marshal(a)
+	if err != nil {
+		return true
+	}
+	after, err := json.Marshal(b)
+	if err != nil {
+		return true
+	}
+	return !bytes.Equal(before, after)
+}
@@ -0,0 +1,209 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// AlertNotifier is called when an alert starts firing, with the value that
+// breached its threshold.
+type AlertNotifier func(ctx context.Context, alert *Alert, value float64)
+
+type AlertManagerOption func(*AlertManager)
+
+// WithAlertNotifier delivers firing alerts to notify in addition to the log.
+func WithAlertNotifier(notify AlertNotifier) AlertManagerOption {
+	return func(a *AlertManager) {
+		a.notifier = notify
+	}
+}
+
+// WithAlertInterval sets how often CheckAlerts evaluates the alerts.
+// The default is 30 seconds.
+func WithAlertInterval(interval time.Duration) AlertManagerOption {
+	return func(a *AlertManager) {
+		a.interval = interval
+	}
+}
+
+// alertQuery is the small subset of PromQL that Alert.Query supports:
+// a metric name with optional equality matchers, optionally wrapped in
+// sum(...) and/or rate(...), e.g. rate(goscraper_errors_total{component="http"}[5m]).
+// Matching series are always summed. The rate is taken between consecutive
+// evaluations, so any range selector is accepted but ignored.
+type alertQuery struct {
+	metric string
+	labels map[string]string
+	rate   bool
+}
+
+func parseAlertQuery(query string) (*alertQuery, error) {
+	q := &alertQuery{labels: make(map[string]string)}
+	expr := strings.TrimSpace(query)
+
+	for {
+		if inner, ok := unwrapCall(expr, "sum"); ok {
+			expr = inner
+			continue
+		}
+		if inner, ok := unwrapCall(expr, "rate"); ok {
+			expr = inner
+			q.rate = true
+			continue
+		}
+		break
+	}
+
+	if strings.HasSuffix(expr, "]") {
+		if i := strings.LastIndex(expr, "["); i >= 0 {
+			expr = strings.TrimSpace(expr[:i])
+		}
+	}
+
+	if i := strings.Index(expr, "{"); i >= 0 {
+		if !strings.HasSuffix(expr, "}") {
+			return nil, fmt.Errorf("invalid alert query %q: unterminated label matchers", query)
+		}
+		for _, matcher := range strings.Split(expr[i+1:len(expr)-1], ",") {
+			matcher = strings.TrimSpace(matcher)
+			if matcher == "" {
+				continue
+			}
+			name, value, ok := strings.Cut(matcher, "=")
+			if !ok || strings.HasSuffix(name, "!") {
+				return nil, fmt.Errorf("invalid alert query %q: only label=\"value\" matchers are supported", query)
+			}
+			unquoted, err := strconv.Unquote(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid alert query %q: %w", query, err)
+			}
+			q.labels[strings.TrimSpace(name)] = unquoted
+		}
+		expr = strings.TrimSpace(expr[:i])
+	}
+
+	if expr == "" || strings.ContainsAny(expr, "(){}[] ") {
+		return nil, fmt.Errorf("invalid alert query %q", query)
+	}
+	q.metric = expr
+	return q, nil
+}
+
+func unwrapCall(expr, name string) (string, bool) {
+	if !strings.HasPrefix(expr, name+"(") || !strings.HasSuffix(expr, ")") {
+		return "", false
+	}
+	return strings.TrimSpace(expr[len(name)+1 : len(expr)-1]), true
+}
+
+// value sums the series matching q. Histograms and summaries are addressed
+// through their _count and _sum series, as in Prometheus. found is false when
+// no series matches, which is treated as "no data" rather than zero.
+func (q *alertQuery) value(families []*dto.MetricFamily) (total float64, found bool) {
+	for _, family := range families {
+		suffix, ok := seriesSuffix(family.GetName(), q.metric)
+		if !ok {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if !q.matches(metric) {
+				continue
+			}
+			if v, ok := sampleValue(family.GetType(), metric, suffix); ok {
+				total += v
+				found = true
+			}
+		}
+	}
+	return total, found
+}
+
+func seriesSuffix(family, metric string) (string, bool) {
+	if family == metric {
+		return "", true
+	}
+	for _, suffix := range []string{"_count", "_sum"} {
+		if metric == family+suffix {
+			return suffix, true
+		}
+	}
+	return "", false
+}
+
+func (q *alertQuery) matches(metric *dto.Metric) bool {
+	for name, want := range q.labels {
+		var got string
+		for _, pair := range metric.GetLabel() {
+			if pair.GetName() == name {
+				got = pair.GetValue()
+				break
+			}
+		}
+		if got != want {
+			return false
+		}
+	}
+	return true
+}
+
+func sampleValue(kind dto.MetricType, metric *dto.Metric, suffix string) (float64, bool) {
+	switch kind {
+	case dto.MetricType_COUNTER:
+		return metric.GetCounter().GetValue(), suffix == ""
+	case dto.MetricType_GAUGE:
+		return metric.GetGauge().GetValue(), suffix == ""
+	case dto.MetricType_UNTYPED:
+		return metric.GetUntyped().GetValue(), suffix == ""
+	case dto.MetricType_HISTOGRAM:
+		switch suffix {
+		case "_count":
+			return float64(metric.GetHistogram().GetSampleCount()), true
+		case "_sum":
+			return metric.GetHistogram().GetSampleSum(), true
+		}
+	case dto.MetricType_SUMMARY:
+		switch suffix {
+		case "_count":
+			return float64(metric.GetSummary().GetSampleCount()), true
+		case "_sum":
+			return metric.GetSummary().GetSampleSum(), true
+		}
+	}
+	return 0, false
+}
+
+// alertState is what the manager remembers about an alert between evaluations.
+type alertState struct {
+	pendingSince time.Time
+	firing       bool
+
+	lastValue float64
+	lastTime  time.Time
+	hasLast   bool
+}
+
+// observe turns the raw value into the query's value at now, returning false
+// until a rate has two samples to work with.
+func (s *alertState) observe(q *alertQuery, raw float64, now time.Time) (float64, bool) {
+	if !q.rate {
+		return raw, true
+	}
+
+	prev, prevTime, ok := s.lastValue, s.lastTime, s.hasLast
+	s.lastValue, s.lastTime, s.hasLast = raw, now, true
+	if !ok || !now.After(prevTime) {
+		return 0, false
+	}
+
+	delta := raw - prev
+	if delta < 0 {
+		// Counter reset: everything counted since is new.
+		delta = raw
+	}
+	return delta / now.Sub(prevTime).Seconds(), true
+}
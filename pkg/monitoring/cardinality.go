@@ -0,0 +1,111 @@
+package monitoring
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// HostLabelStrategy decides what the host label of a request metric is set
+// to, so that scraping many sites cannot grow the registry without bound.
+type HostLabelStrategy string
+
+const (
+	// HostLabelFirstN, the default, keeps the first hosts seen, up to the
+	// WithMetricsCardinalityLimit limit, and reports later ones as
+	// HostLabelOther. Hosts are admitted in arrival order, not by traffic.
+	HostLabelFirstN HostLabelStrategy = "first_n"
+	// HostLabelStrip reports every host as HostLabelAll.
+	HostLabelStrip HostLabelStrategy = "strip"
+	// HostLabelHash spreads hosts over as many "bucket-N" labels as the
+	// limit allows, by a hash of the host name.
+	HostLabelHash HostLabelStrategy = "hash"
+)
+
+const (
+	// HostLabelOther is the label of hosts beyond the limit of
+	// HostLabelFirstN.
+	HostLabelOther = "other"
+	// HostLabelAll is the label of every host with HostLabelStrip.
+	HostLabelAll = "all"
+)
+
+// MetricsOption configures NewMetrics.
+type MetricsOption func(*Metrics)
+
+// WithMetricsCardinalityLimit bounds the number of distinct values the host
+// label can take. Hosts beyond the limit are folded into HostLabelOther (or
+// into hash buckets when HostLabelHash is used). A limit of 0 disables the guard.
+func WithMetricsCardinalityLimit(n int) MetricsOption {
+	return func(m *Metrics) {
+		m.hostLabels.limit = n
+	}
+}
+
+// WithHostLabelStrategy sets how host labels are bounded. The default is
+// HostLabelFirstN.
+func WithHostLabelStrategy(strategy HostLabelStrategy) MetricsOption {
+	return func(m *Metrics) {
+		m.hostLabels.strategy = strategy
+	}
+}
+
+type hostLabeler struct {
+	strategy HostLabelStrategy
+	limit    int
+	mu       sync.RWMutex
+	seen     map[string]struct{}
+}
+
+func newHostLabeler() *hostLabeler {
+	return &hostLabeler{
+		strategy: HostLabelFirstN,
+		seen:     make(map[string]struct{}),
+	}
+}
+
+func (h *hostLabeler) label(host string) string {
+	switch h.strategy {
+	case HostLabelStrip:
+		return HostLabelAll
+	case HostLabelHash:
+		if h.limit <= 0 {
+			return host
+		}
+		hasher := fnv.New32a()
+		hasher.Write([]byte(host))
+		return fmt.Sprintf("bucket-%d", hasher.Sum32()%uint32(h.limit))
+	default:
+		if h.limit <= 0 {
+			return host
+		}
+		return h.admit(host)
+	}
+}
+
+// admit keeps the first limit hosts it sees as-is; everything after that is
+// reported as HostLabelOther so the registry cannot grow without bound.
+func (h *hostLabeler) admit(host string) string {
+	h.mu.RLock()
+	_, ok := h.seen[host]
+	full := len(h.seen) >= h.limit
+	h.mu.RUnlock()
+
+	if ok {
+		return host
+	}
+	if full {
+		return HostLabelOther
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.seen[host]; ok {
+		return host
+	}
+	if len(h.seen) >= h.limit {
+		return HostLabelOther
+	}
+	h.seen[host] = struct{}{}
+	return host
+}
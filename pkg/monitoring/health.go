@@ -0,0 +1,105 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthCheck reports whether a dependency is usable. It must return once
+// ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// DependencyStatus is the outcome of one HealthCheck.
+type DependencyStatus struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+// ReadinessReport is the body served by ReadinessHandler.
+type ReadinessReport struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// CheckReadiness runs every check concurrently, each bounded by timeout,
+// and reports the node ready only if all of them pass.
+func CheckReadiness(ctx context.Context, checks map[string]HealthCheck, timeout time.Duration) *ReadinessReport {
+	report := &ReadinessReport{
+		Status:       "ready",
+		Dependencies: make(map[string]DependencyStatus, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := runCheck(checkCtx, check)
+			status := DependencyStatus{Status: "up", Latency: time.Since(start).Round(time.Millisecond).String()}
+			if err != nil {
+				status.Status = "down"
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Dependencies[name] = status
+			if err != nil {
+				report.Status = "unavailable"
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// runCheck stops waiting for check once ctx is done, so a check that
+// ignores its context cannot hold up the probe.
+func runCheck(ctx context.Context, check HealthCheck) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ReadinessHandler serves a readiness probe: 200 with a per-dependency
+// report when every check passes, 503 with the same report otherwise.
+func ReadinessHandler(checks map[string]HealthCheck, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := CheckReadiness(r.Context(), checks, timeout)
+
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != "ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// LivenessHandler serves a liveness probe. It only shows the process can
+// answer requests and never touches dependencies, so an outage elsewhere
+// does not get healthy nodes restarted.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+}
@@ -3,10 +3,12 @@ package monitoring
 import (
 	"context"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"go.uber.org/zap"
 )
 
@@ -35,14 +37,20 @@ type Metrics struct {
 	GoroutineCount    prometheus.Gauge
 	
 	DataExtracted     *prometheus.CounterVec
+	ExtractionsTotal  *prometheus.CounterVec
+	ExtractionConfidence *prometheus.HistogramVec
+	ExtractionErrors  *prometheus.CounterVec
 	ErrorsTotal       *prometheus.CounterVec
 	RetryAttempts     *prometheus.CounterVec
+	HostRetries       *prometheus.CounterVec
+	BlocksTotal       *prometheus.CounterVec
 	
-	registry *prometheus.Registry
-	logger   *zap.Logger
+	registry   *prometheus.Registry
+	logger     *zap.Logger
+	hostLabels *hostLabeler
 }
 
-func NewMetrics(logger *zap.Logger) *Metrics {
+func NewMetrics(logger *zap.Logger, opts ...MetricsOption) *Metrics {
 	registry := prometheus.NewRegistry()
 	
 	m := &Metrics{
@@ -192,6 +200,31 @@ func NewMetrics(logger *zap.Logger) *Metrics {
 			[]string{"type", "source"},
 		),
 		
+		ExtractionsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "goscraper_extractions_total",
+				Help: "Total number of smart extractions by content type and outcome",
+			},
+			[]string{"content_type", "status"},
+		),
+		
+		ExtractionConfidence: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "goscraper_extraction_confidence",
+				Help:    "Extraction confidence by content type",
+				Buckets: []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+			},
+			[]string{"content_type"},
+		),
+		
+		ExtractionErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "goscraper_extraction_errors_total",
+				Help: "Total number of fields that could not be extracted or failed validation",
+			},
+			[]string{"content_type", "field"},
+		),
+		
 		ErrorsTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "goscraper_errors_total",
@@ -208,8 +241,29 @@ func NewMetrics(logger *zap.Logger) *Metrics {
 			[]string{"component", "reason"},
 		),
 		
-		registry: registry,
-		logger:   logger,
+		HostRetries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "goscraper_host_retries_total",
+				Help: "Total number of retry attempts by host",
+			},
+			[]string{"component", "host", "reason"},
+		),
+		
+		BlocksTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "goscraper_blocks_total",
+				Help: "Total number of requests blocked by the target site, by block type",
+			},
+			[]string{"host", "type"},
+		),
+		
+		registry:   registry,
+		logger:     logger,
+		hostLabels: newHostLabeler(),
+	}
+	
+	for _, opt := range opts {
+		opt(m)
 	}
 	
 	m.registerMetrics()
@@ -237,12 +291,18 @@ func (m *Metrics) registerMetrics() {
 		m.CPUUsage,
 		m.GoroutineCount,
 		m.DataExtracted,
+		m.ExtractionsTotal,
+		m.ExtractionConfidence,
+		m.ExtractionErrors,
 		m.ErrorsTotal,
 		m.RetryAttempts,
+		m.HostRetries,
+		m.BlocksTotal,
 	)
 }
 
 func (m *Metrics) RecordRequest(method, host, status string, duration time.Duration, size int64) {
+	host = m.HostLabel(host)
 	m.RequestsTotal.WithLabelValues(method, status, host).Inc()
 	m.RequestDuration.WithLabelValues(method, host).Observe(duration.Seconds())
 	m.ResponseSize.WithLabelValues(host).Observe(float64(size))
@@ -266,9 +326,38 @@ func (m *Metrics) RecordBrowserSession(engine string, delta float64) {
 }
 
 func (m *Metrics) RecordPageLoad(engine, host string, duration time.Duration) {
+	host = m.HostLabel(host)
 	m.PageLoadTime.WithLabelValues(engine, host).Observe(duration.Seconds())
 }
 
+// TrackInFlight counts a request to host in goscraper_requests_in_flight
+// until the returned function is called.
+func (m *Metrics) TrackInFlight(host string) (done func()) {
+	gauge := m.RequestsInFlight.WithLabelValues(m.HostLabel(host))
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// HostLabel maps a raw host to the value used for the "host" label, applying
+// the configured cardinality guard. Callers updating host-labelled vectors
+// directly should go through it.
+func (m *Metrics) HostLabel(host string) string {
+	return m.hostLabels.label(host)
+}
+
+func (m *Metrics) RecordExtraction(contentType string, success bool, confidence float64) {
+	status := "success"
+	if !success {
+		status = "failure"
+	}
+	m.ExtractionsTotal.WithLabelValues(contentType, status).Inc()
+	m.ExtractionConfidence.WithLabelValues(contentType).Observe(confidence)
+}
+
+func (m *Metrics) RecordExtractionError(contentType, field string) {
+	m.ExtractionErrors.WithLabelValues(contentType, field).Inc()
+}
+
 func (m *Metrics) RecordError(errorType, component string) {
 	m.ErrorsTotal.WithLabelValues(errorType, component).Inc()
 }
@@ -277,6 +366,26 @@ func (m *Metrics) RecordRetry(component, reason string) {
 	m.RetryAttempts.WithLabelValues(component, reason).Inc()
 }
 
+// RecordHostRetry counts a request to host being retried, both in
+// goscraper_retry_attempts_total and by host in goscraper_host_retries_total.
+// reason names what failed, e.g. a status code such as "503" or "timeout".
+func (m *Metrics) RecordHostRetry(component, host, reason string) {
+	m.RecordRetry(component, reason)
+	m.HostRetries.WithLabelValues(component, m.HostLabel(host), reason).Inc()
+}
+
+// RecordBlock counts a request blocked by host. blockType names how, e.g.
+// "429" or "cloudflare-js".
+func (m *Metrics) RecordBlock(host, blockType string) {
+	m.BlocksTotal.WithLabelValues(m.HostLabel(host), blockType).Inc()
+}
+
+// Registry is the registry the metrics are registered with. Collectors added
+// to it are served by Handler and can be used in alert queries.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
 func (m *Metrics) Handler() http.Handler {
 	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
 }
@@ -313,26 +422,41 @@ type Alert struct {
 	Annotations map[string]string `json:"annotations"`
 }
 
+// AlertManager evaluates alerts against the metrics registry. An alert
+// fires once its query value has stayed above Threshold for Duration.
 type AlertManager struct {
-	alerts  map[string]*Alert
-	metrics *Metrics
-	logger  *zap.Logger
+	mu       sync.Mutex
+	alerts   map[string]*Alert
+	state    map[string]*alertState
+	metrics  *Metrics
+	logger   *zap.Logger
+	notifier AlertNotifier
+	interval time.Duration
 }
 
-func NewAlertManager(metrics *Metrics, logger *zap.Logger) *AlertManager {
-	return &AlertManager{
-		alerts:  make(map[string]*Alert),
-		metrics: metrics,
-		logger:  logger,
+func NewAlertManager(metrics *Metrics, logger *zap.Logger, opts ...AlertManagerOption) *AlertManager {
+	a := &AlertManager{
+		alerts:   make(map[string]*Alert),
+		state:    make(map[string]*alertState),
+		metrics:  metrics,
+		logger:   logger,
+		interval: 30 * time.Second,
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 func (a *AlertManager) AddAlert(alert *Alert) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	a.alerts[alert.Name] = alert
+	delete(a.state, alert.Name)
 }
 
 func (a *AlertManager) CheckAlerts(ctx context.Context) {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(a.interval)
 	defer ticker.Stop()
 	
 	for {
@@ -340,20 +464,88 @@ func (a *AlertManager) CheckAlerts(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			for name, alert := range a.alerts {
-				if a.evaluateAlert(alert) {
-					a.logger.Warn("Alert triggered",
-						zap.String("alert", name),
-						zap.String("description", alert.Description),
-					)
-					//TODO: NOTIFICATION SYSTEM ENTEGRATION
-				}
-			}
+			a.Evaluate(ctx)
 		}
 	}
 }
 
-func (a *AlertManager) evaluateAlert(alert *Alert) bool {
-	
-	return false
-}
\ No newline at end of file
+// Evaluate checks every alert once and returns the ones currently firing.
+// Alerts that have just started firing are logged and passed to the notifier;
+// an alert has to recover before it is notified again.
+func (a *AlertManager) Evaluate(ctx context.Context) []*Alert {
+	type notification struct {
+		alert *Alert
+		value float64
+	}
+
+	a.mu.Lock()
+	families, err := a.metrics.registry.Gather()
+	if err != nil {
+		a.logger.Warn("Failed to gather metrics for alerts", zap.Error(err))
+	}
+
+	now := time.Now()
+	var firing []*Alert
+	var fired []notification
+	for name, alert := range a.alerts {
+		state := a.state[name]
+		if state == nil {
+			state = &alertState{}
+			a.state[name] = state
+		}
+
+		value, breached := a.evaluateAlert(alert, state, families, now)
+		if !breached {
+			state.firing = false
+			continue
+		}
+		firing = append(firing, alert)
+		if !state.firing {
+			state.firing = true
+			fired = append(fired, notification{alert, value})
+		}
+	}
+	notify := a.notifier
+	a.mu.Unlock()
+
+	for _, n := range fired {
+		a.logger.Warn("Alert triggered",
+			zap.String("alert", n.alert.Name),
+			zap.String("description", n.alert.Description),
+			zap.Float64("value", n.value),
+			zap.Float64("threshold", n.alert.Threshold),
+		)
+		if notify != nil {
+			notify(ctx, n.alert, n.value)
+		}
+	}
+	return firing
+}
+
+// evaluateAlert reports whether alert's query has been above its threshold
+// for at least alert.Duration, tracking when the breach began in state.
+func (a *AlertManager) evaluateAlert(alert *Alert, state *alertState, families []*dto.MetricFamily, now time.Time) (float64, bool) {
+	query, err := parseAlertQuery(alert.Query)
+	if err != nil {
+		a.logger.Warn("Skipping alert", zap.String("alert", alert.Name), zap.Error(err))
+		return 0, false
+	}
+
+	raw, found := query.value(families)
+	if !found {
+		state.hasLast = false
+		state.pendingSince = time.Time{}
+		return 0, false
+	}
+
+	value, ok := state.observe(query, raw, now)
+	if !ok || value <= alert.Threshold {
+		state.pendingSince = time.Time{}
+		return value, false
+	}
+
+	if state.pendingSince.IsZero() {
+		state.pendingSince = now
+	}
+	return value, now.Sub(state.pendingSince) >= alert.Duration
+}
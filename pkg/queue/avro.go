@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/registry"
+)
+
+// avroAPI matches struct fields to schema fields by their json tags, so
+// the same structs serialize as JSON and Avro.
+var avroAPI = avro.Config{TagKey: "json"}.Freeze()
+
+// AvroSerializer encodes message values as Avro using the Confluent wire
+// format: a zero magic byte, the 4-byte big-endian schema ID, then the Avro
+// binary payload. The writer schema is registered under "<topic>-value" on
+// first use; readers resolve whatever schema ID the payload carries.
+type AvroSerializer struct {
+	client  *registry.Client
+	decoder *registry.Decoder
+	raw     string
+	schema  avro.Schema
+
+	mu  sync.RWMutex
+	ids map[string]int
+}
+
+// NewAvroSerializer returns a serializer writing with schema and looking up
+// schemas in client, e.g. one from registry.NewClient.
+func NewAvroSerializer(client *registry.Client, schema string) (*AvroSerializer, error) {
+	parsed, err := avro.Parse(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %w", err)
+	}
+
+	return &AvroSerializer{
+		client:  client,
+		decoder: registry.NewDecoder(client, registry.WithAPI(avroAPI)),
+		raw:     schema,
+		schema:  parsed,
+		ids:     make(map[string]int),
+	}, nil
+}
+
+func (a *AvroSerializer) Serialize(ctx context.Context, topic string, value interface{}) ([]byte, error) {
+	id, err := a.schemaID(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := avroAPI.Marshal(a.schema, value)
+	if err != nil {
+		return nil, fmt.Errorf("avro encode error: %w", err)
+	}
+
+	data := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(data[1:], uint32(id))
+	return append(data, payload...), nil
+}
+
+// Deserialize decodes data into generic values: records become
+// map[string]interface{}.
+func (a *AvroSerializer) Deserialize(ctx context.Context, topic string, data []byte) (interface{}, error) {
+	var value interface{}
+	if err := a.decoder.Decode(ctx, data, &value); err != nil {
+		return nil, fmt.Errorf("avro decode error: %w", err)
+	}
+	return value, nil
+}
+
+func (a *AvroSerializer) schemaID(ctx context.Context, topic string) (int, error) {
+	a.mu.RLock()
+	id, exists := a.ids[topic]
+	a.mu.RUnlock()
+	if exists {
+		return id, nil
+	}
+
+	id, _, err := a.client.CreateSchema(ctx, topic+"-value", a.raw)
+	if err != nil {
+		return 0, fmt.Errorf("register schema for %s: %w", topic, err)
+	}
+
+	a.mu.Lock()
+	a.ids[topic] = id
+	a.mu.Unlock()
+
+	return id, nil
+}
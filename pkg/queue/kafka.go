@@ -30,8 +30,15 @@ type MessageHandler func(ctx context.Context, message *Message) error
 type KafkaQueue struct {
 	brokers []string
 	writer  *kafka.Writer
-	readers map[string]*kafka.Reader
-	config  *KafkaConfig
+	// readers holds every subscription's reader; a topic may be subscribed
+	// more than once to consume it concurrently.
+	readers []*kafka.Reader
+	dialer     *kafka.Dialer
+	serializer Serializer
+	config     *KafkaConfig
+	// securityErr is why config.Security could not be applied. Publish,
+	// Subscribe and Ping fail with it.
+	securityErr error
 }
 
 type KafkaConfig struct {
@@ -44,47 +51,92 @@ type KafkaConfig struct {
 	RetryDelay    time.Duration
 	Compression   kafka.Compression
 	Security      *SecurityConfig
+	// Balancer selects the partition for each message. Nil defaults to
+	// kafka.Hash, which keeps messages with the same key on one partition
+	// and round-robins keyless messages.
+	Balancer      kafka.Balancer
+	// Serializer encodes Message.Value on publish and decodes it on
+	// subscribe. Nil defaults to JSONSerializer.
+	Serializer    Serializer
+	// DeadLetterSuffix names the topic that Subscribe parks messages on once
+	// RetryAttempts retries have failed. Empty defaults to DefaultDeadLetterSuffix.
+	DeadLetterSuffix string
 }
 
 type SecurityConfig struct {
-	Protocol string
-	Username string
-	Password string
+	Protocol  string
+	Mechanism string
+	Username  string
+	Password  string
 	CertFile string
 	KeyFile  string
 	CAFile   string
 }
 
+// NewKafkaQueue connects to config.Brokers with the TLS and SASL settings of
+// config.Security. If those cannot be loaded, e.g. because a certificate
+// file is missing, every Publish, Subscribe and Ping fails with the reason.
 func NewKafkaQueue(config *KafkaConfig) *KafkaQueue {
+	balancer := config.Balancer
+	if balancer == nil {
+		balancer = &kafka.Hash{}
+	}
+
 	writer := &kafka.Writer{
 		Addr:         kafka.TCP(config.Brokers...),
-		Balancer:     &kafka.LeastBytes{},
+		Balancer:     balancer,
 		BatchSize:    config.BatchSize,
 		BatchTimeout: config.BatchTimeout,
 		Compression:  config.Compression,
 	}
 
+	var dialer *kafka.Dialer
+	var securityErr error
+	if config.Security != nil {
+		transport, err := config.Security.transport()
+		if err == nil {
+			writer.Transport = transport
+			dialer, err = config.Security.dialer()
+		}
+		if err != nil {
+			securityErr = fmt.Errorf("kafka security config error: %w", err)
+		}
+	}
+
+	serializer := config.Serializer
+	if serializer == nil {
+		serializer = JSONSerializer{}
+	}
+
 	return &KafkaQueue{
-		brokers: config.Brokers,
-		writer:  writer,
-		readers: make(map[string]*kafka.Reader),
-		config:  config,
+		brokers:     config.Brokers,
+		writer:      writer,
+		dialer:      dialer,
+		serializer:  serializer,
+		config:      config,
+		securityErr: securityErr,
 	}
 }
 
 func (k *KafkaQueue) Publish(ctx context.Context, topic string, message *Message) error {
-	value, err := json.Marshal(message.Value)
+	if k.securityErr != nil {
+		return k.securityErr
+	}
+	value, err := k.serializer.Serialize(ctx, topic, message.Value)
 	if err != nil {
-		return fmt.Errorf("marshal message error: %w", err)
+		return fmt.Errorf("serialize message error: %w", err)
 	}
 
 	kafkaMessage := kafka.Message{
 		Topic:     topic,
-		Key:       []byte(message.Key),
 		Value:     value,
 		Time:      message.Timestamp,
 	}
 
+	if message.Key != "" {
+		kafkaMessage.Key = []byte(message.Key)
+	}
+
 	for k, v := range message.Headers {
 		kafkaMessage.Headers = append(kafkaMessage.Headers, kafka.Header{
 			Key:   k,
@@ -96,58 +148,106 @@ func (k *KafkaQueue) Publish(ctx context.Context, topic string, message *Message
 }
 
 func (k *KafkaQueue) Subscribe(ctx context.Context, topic string, handler MessageHandler) error {
+	if k.securityErr != nil {
+		return k.securityErr
+	}
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  k.brokers,
 		Topic:    topic,
 		GroupID:  k.config.GroupID,
+		Dialer:   k.dialer,
 		MinBytes: 10e3, 
 		MaxBytes: 10e6, 
 	})
 
-	k.readers[topic] = reader
+	k.readers = append(k.readers, reader)
+
+	handler = RetryHandler(handler, k.config.RetryAttempts, k.config.RetryDelay)
 
 	go func() {
 		defer reader.Close()
 		
 		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				kafkaMessage, err := reader.ReadMessage(ctx)
-				if err != nil {
-					continue
-				}
-
-				var value interface{}
-				if err := json.Unmarshal(kafkaMessage.Value, &value); err != nil {
-					continue
-				}
-
-				headers := make(map[string]string)
-				for _, h := range kafkaMessage.Headers {
-					headers[h.Key] = string(h.Value)
+			// Offsets are committed by hand, only once a message has been
+			// handled or moved to the dead-letter topic.
+			kafkaMessage, err := reader.FetchMessage(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
 				}
+				continue
+			}
 
-				message := &Message{
-					Topic:     kafkaMessage.Topic,
-					Key:       string(kafkaMessage.Key),
-					Value:     value,
-					Headers:   headers,
-					Timestamp: kafkaMessage.Time,
+			if err := k.process(ctx, kafkaMessage, handler); err != nil {
+				if ctx.Err() == nil {
+					err = k.deadLetter(ctx, kafkaMessage, err)
 				}
-
-				if err := handler(ctx, message); err != nil {
-					//TODO: RETRY LOGIC IMPLEMANTATION
+				if err != nil {
+					// Leave the offset uncommitted so the message is
+					// delivered again after a restart or rebalance.
 					continue
 				}
 			}
+
+			reader.CommitMessages(ctx, kafkaMessage)
 		}
 	}()
 
 	return nil
 }
 
+func (k *KafkaQueue) process(ctx context.Context, kafkaMessage kafka.Message, handler MessageHandler) error {
+	value, err := k.serializer.Deserialize(ctx, kafkaMessage.Topic, kafkaMessage.Value)
+	if err != nil {
+		return fmt.Errorf("deserialize message error: %w", err)
+	}
+
+	headers := make(map[string]string)
+	for _, h := range kafkaMessage.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+
+	message := &Message{
+		Topic:     kafkaMessage.Topic,
+		Key:       string(kafkaMessage.Key),
+		Value:     value,
+		Headers:   headers,
+		Timestamp: kafkaMessage.Time,
+	}
+
+	return handler(ctx, message)
+}
+
+// Ping checks that at least one broker accepts connections and answers a
+// metadata request.
+func (k *KafkaQueue) Ping(ctx context.Context) error {
+	if k.securityErr != nil {
+		return k.securityErr
+	}
+	dialer := k.dialer
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+
+	err := fmt.Errorf("no kafka brokers configured")
+	for _, broker := range k.brokers {
+		var conn *kafka.Conn
+		conn, err = dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			continue
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		_, err = conn.Brokers()
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("kafka unreachable: %w", err)
+}
+
 func (k *KafkaQueue) Close() error {
 	if k.writer != nil {
 		k.writer.Close()
@@ -218,44 +318,3 @@ func (j *JobQueue) Subscribe(ctx context.Context, handler func(ctx context.Conte
 		return handler(ctx, &job)
 	})
 }
-
-type PriorityQueue struct {
-	queues map[int]*JobQueue 
-	topics map[int]string    
-}
-
-func NewPriorityQueue(queue Queue, priorities []int) *PriorityQueue {
-	pq := &PriorityQueue{
-		queues: make(map[int]*JobQueue),
-		topics: make(map[int]string),
-	}
-
-	for _, priority := range priorities {
-		topic := fmt.Sprintf("scraping-jobs-p%d", priority)
-		pq.queues[priority] = NewJobQueue(queue, topic)
-		pq.topics[priority] = topic
-	}
-
-	return pq
-}
-
-func (p *PriorityQueue) Enqueue(ctx context.Context, job *ScrapingJob) error {
-	queue, exists := p.queues[job.Priority]
-	if !exists {
-		queue = p.queues[0]
-	}
-
-	return queue.Enqueue(ctx, job)
-}
-
-func (p *PriorityQueue) Subscribe(ctx context.Context, handler func(ctx context.Context, job *ScrapingJob) error) error {
-	for priority := 10; priority >= 0; priority-- {
-		if queue, exists := p.queues[priority]; exists {
-			if err := queue.Subscribe(ctx, handler); err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
\ No newline at end of file
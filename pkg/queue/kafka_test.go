@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// lastPartition always picks the highest partition.
+type lastPartition struct{}
+
+func (lastPartition) Balance(msg kafka.Message, partitions ...int) int {
+	return partitions[len(partitions)-1]
+}
+
+func TestKafkaQueueBalancer(t *testing.T) {
+	partitions := []int{0, 1, 2, 3, 4, 5}
+
+	q := NewKafkaQueue(&KafkaConfig{Brokers: []string{"localhost:9092"}})
+	if _, ok := q.writer.Balancer.(*kafka.Hash); !ok {
+		t.Fatalf("expected kafka.Hash by default, got %T", q.writer.Balancer)
+	}
+
+	// Messages for one job must land on one partition, whichever node
+	// publishes them.
+	other := NewKafkaQueue(&KafkaConfig{Brokers: []string{"localhost:9092"}})
+	for _, key := range []string{"job-1", "job-2", "job-3"} {
+		msg := kafka.Message{Key: []byte(key)}
+		want := q.writer.Balancer.Balance(msg, partitions...)
+		for i := 0; i < 5; i++ {
+			if got := q.writer.Balancer.Balance(msg, partitions...); got != want {
+				t.Errorf("%s: moved from partition %d to %d", key, want, got)
+			}
+		}
+		if got := other.writer.Balancer.Balance(msg, partitions...); got != want {
+			t.Errorf("%s: expected partition %d on another queue, got %d", key, want, got)
+		}
+	}
+
+	seen := make(map[int]bool)
+	for range partitions {
+		seen[q.writer.Balancer.Balance(kafka.Message{}, partitions...)] = true
+	}
+	if len(seen) != len(partitions) {
+		t.Errorf("expected keyless messages to visit every partition, got %v", seen)
+	}
+
+	custom := NewKafkaQueue(&KafkaConfig{Brokers: []string{"localhost:9092"}, Balancer: lastPartition{}})
+	if got := custom.writer.Balancer.Balance(kafka.Message{Key: []byte("job-1")}, partitions...); got != 5 {
+		t.Errorf("expected the configured balancer to pick partition 5, got %d", got)
+	}
+}
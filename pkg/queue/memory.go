@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueClosed is returned by MemoryQueue once Close has been called.
+var ErrQueueClosed = errors.New("queue closed")
+
+// DefaultMemoryQueueBuffer is how many messages a MemoryQueue topic holds
+// when NewMemoryQueue is given no buffer size.
+const DefaultMemoryQueueBuffer = 1024
+
+// MemoryQueue is a Queue held in memory, for tests and single-node use.
+// Each topic is a buffered channel: messages are delivered in the order
+// they were published, and subscribers of the same topic share its
+// messages the way consumers in one Kafka group do. Handler errors are not
+// retried, and queued messages are lost when the process exits.
+//
+// Messages are handed to subscribers as published, without serializing
+// Value, so publishers must not modify a message after publishing it.
+type MemoryQueue struct {
+	buffer int
+
+	mu     sync.Mutex
+	topics map[string]chan *Message
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewMemoryQueue creates a queue whose topics hold up to buffer messages;
+// Publish blocks while a topic is full. A buffer of 0 or less uses
+// DefaultMemoryQueueBuffer.
+func NewMemoryQueue(buffer int) *MemoryQueue {
+	if buffer <= 0 {
+		buffer = DefaultMemoryQueueBuffer
+	}
+	return &MemoryQueue{
+		buffer: buffer,
+		topics: make(map[string]chan *Message),
+		closed: make(chan struct{}),
+	}
+}
+
+func (q *MemoryQueue) topic(name string) chan *Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ch, ok := q.topics[name]
+	if !ok {
+		ch = make(chan *Message, q.buffer)
+		q.topics[name] = ch
+	}
+	return ch
+}
+
+func (q *MemoryQueue) isClosed() bool {
+	select {
+	case <-q.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Publish queues message on topic, waiting for room if the topic is full.
+func (q *MemoryQueue) Publish(ctx context.Context, topic string, message *Message) error {
+	if q.isClosed() {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.topic(topic) <- message:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-q.closed:
+		return ErrQueueClosed
+	}
+}
+
+// Subscribe hands topic's messages to handler, one at a time, until ctx is
+// done or the queue is closed. Like KafkaQueue it returns at once; several
+// subscriptions to one topic process its messages concurrently.
+func (q *MemoryQueue) Subscribe(ctx context.Context, topic string, handler MessageHandler) error {
+	if q.isClosed() {
+		return ErrQueueClosed
+	}
+
+	messages := q.topic(topic)
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for {
+			// Stop promptly rather than draining a backlog after Close.
+			if ctx.Err() != nil || q.isClosed() {
+				return
+			}
+			select {
+			case message := <-messages:
+				handler(ctx, message)
+			case <-ctx.Done():
+				return
+			case <-q.closed:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close stops the subscribers, waiting for handlers that are running to
+// return, and fails any Publish blocked on a full topic. It must not be
+// called from a handler.
+func (q *MemoryQueue) Close() error {
+	q.closeOnce.Do(func() {
+		close(q.closed)
+	})
+	q.wg.Wait()
+	return nil
+}
+
+// Len reports how many messages are waiting on topic.
+func (q *MemoryQueue) Len(topic string) int {
+	return len(q.topic(topic))
+}
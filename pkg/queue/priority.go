@@ -0,0 +1,188 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// DefaultPriorityGrace is the default PriorityQueue.Grace.
+const DefaultPriorityGrace = 20 * time.Millisecond
+
+// PriorityQueue spreads jobs over one topic per priority and hands them to
+// a single handler highest priority first.
+type PriorityQueue struct {
+	queues     map[int]*JobQueue
+	topics     map[int]string
+	priorities []int
+
+	// Concurrency is how many jobs Subscribe runs the handler on at once.
+	// NewPriorityQueue sets it to the number of priorities, as many as ran
+	// at once when every priority topic was consumed on its own.
+	Concurrency int
+
+	// Grace is how long Subscribe waits for the next job of a priority that
+	// has just delivered one before it serves lower priorities. Queues hand
+	// over messages one at a time, so without it a lower-priority job could
+	// slip in while a backlogged higher-priority topic fetches its next
+	// message.
+	Grace time.Duration
+}
+
+func NewPriorityQueue(queue Queue, priorities []int) *PriorityQueue {
+	pq := &PriorityQueue{
+		queues: make(map[int]*JobQueue),
+		topics: make(map[int]string),
+		Grace:  DefaultPriorityGrace,
+	}
+
+	for _, priority := range priorities {
+		if _, exists := pq.queues[priority]; exists {
+			continue
+		}
+		topic := fmt.Sprintf("scraping-jobs-p%d", priority)
+		pq.queues[priority] = NewJobQueue(queue, topic)
+		pq.topics[priority] = topic
+		pq.priorities = append(pq.priorities, priority)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(pq.priorities)))
+	pq.Concurrency = len(pq.priorities)
+
+	return pq
+}
+
+// Enqueue publishes job to the topic of its priority. Jobs with a priority
+// that is not configured go to the lowest configured one.
+func (p *PriorityQueue) Enqueue(ctx context.Context, job *ScrapingJob) error {
+	queue, exists := p.queues[job.Priority]
+	if !exists {
+		if len(p.priorities) == 0 {
+			return errors.New("priority queue has no priorities")
+		}
+		queue = p.queues[p.priorities[len(p.priorities)-1]]
+	}
+
+	return queue.Enqueue(ctx, job)
+}
+
+// delivery is a job handed from a priority's subscription to the
+// dispatcher. The subscription waits on done, so the underlying queue only
+// acknowledges the message once the handler has run.
+type delivery struct {
+	ctx  context.Context
+	job  *ScrapingJob
+	done chan error
+}
+
+// Subscribe runs handler on up to Concurrency jobs at once. Whenever a
+// worker is free it takes the highest priority with a job waiting: lower
+// priorities are only served while every higher one is empty. It returns
+// once every priority is subscribed; jobs are dispatched until ctx is done.
+func (p *PriorityQueue) Subscribe(ctx context.Context, handler func(ctx context.Context, job *ScrapingJob) error) error {
+	concurrency := p.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ready := make([]chan delivery, len(p.priorities))
+	for i, priority := range p.priorities {
+		ch := make(chan delivery)
+		ready[i] = ch
+		consume := func(msgCtx context.Context, job *ScrapingJob) error {
+			d := delivery{ctx: msgCtx, job: job, done: make(chan error, 1)}
+			select {
+			case ch <- d:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			select {
+			case err := <-d.done:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		// A subscription holds its job until the handler is done with it,
+		// so each priority needs one per worker to keep them all busy.
+		for n := 0; n < concurrency; n++ {
+			if err := p.queues[priority].Subscribe(ctx, consume); err != nil {
+				return err
+			}
+		}
+	}
+
+	go p.dispatch(ctx, ready, concurrency, handler)
+	return nil
+}
+
+func (p *PriorityQueue) dispatch(ctx context.Context, ready []chan delivery, concurrency int, handler func(ctx context.Context, job *ScrapingJob) error) {
+	// Every subscription starts out fetching, so each gets the grace period.
+	start := time.Now()
+	lastDelivered := make([]time.Time, len(ready))
+	for i := range lastDelivered {
+		lastDelivered[i] = start
+	}
+
+	workers := make(chan struct{}, concurrency)
+	for {
+		// Only pick a job once a worker is free to run it, so that it is
+		// chosen among everything waiting by then.
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		i, d, ok := p.next(ctx, ready, lastDelivered)
+		if !ok {
+			return
+		}
+		lastDelivered[i] = time.Now()
+		go func() {
+			defer func() { <-workers }()
+			d.done <- handler(d.ctx, d.job)
+		}()
+	}
+}
+
+// next picks the job to run: the highest priority one waiting, waiting out
+// the grace period of priorities that may be about to deliver, or else the
+// first one to arrive.
+func (p *PriorityQueue) next(ctx context.Context, ready []chan delivery, lastDelivered []time.Time) (int, delivery, bool) {
+	for i, ch := range ready {
+		select {
+		case d := <-ch:
+			return i, d, true
+		default:
+		}
+
+		wait := p.Grace - time.Since(lastDelivered[i])
+		if wait <= 0 {
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case d := <-ch:
+			timer.Stop()
+			return i, d, true
+		case <-timer.C:
+			lastDelivered[i] = time.Time{}
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, delivery{}, false
+		}
+	}
+
+	cases := make([]reflect.SelectCase, 0, len(ready)+1)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+	for _, ch := range ready {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+	chosen, value, _ := reflect.Select(cases)
+	if chosen == 0 {
+		return 0, delivery{}, false
+	}
+	return chosen - 1, value.Interface().(delivery), true
+}
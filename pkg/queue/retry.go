@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers added to messages published to a dead-letter topic, alongside the
+// original headers.
+const (
+	DeadLetterErrorHeader     = "x-dlq-error"
+	DeadLetterTopicHeader     = "x-dlq-original-topic"
+	DeadLetterPartitionHeader = "x-dlq-original-partition"
+	DeadLetterOffsetHeader    = "x-dlq-original-offset"
+)
+
+// DefaultDeadLetterSuffix is appended to a topic to name its dead-letter topic.
+const DefaultDeadLetterSuffix = ".dlq"
+
+// RetryHandler wraps handler so a failing message is retried up to attempts
+// more times, waiting delay before the first retry and doubling it after each
+// one. It returns the last error once the retries are exhausted, or the
+// context error if ctx is cancelled while waiting.
+func RetryHandler(handler MessageHandler, attempts int, delay time.Duration) MessageHandler {
+	return func(ctx context.Context, message *Message) error {
+		err := handler(ctx, message)
+		for retry := 0; err != nil && retry < attempts; retry++ {
+			if delay > 0 {
+				timer := time.NewTimer(delay << retry)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+			err = handler(ctx, message)
+		}
+		return err
+	}
+}
+
+func (k *KafkaQueue) deadLetterTopic(topic string) string {
+	suffix := k.config.DeadLetterSuffix
+	if suffix == "" {
+		suffix = DefaultDeadLetterSuffix
+	}
+	return topic + suffix
+}
+
+// deadLetter republishes the original bytes of a message that could not be
+// processed to the topic's dead-letter topic. Publishing is retried like the
+// handler, but keeps going until it succeeds or ctx is done, since the offset
+// must not be committed before the message is safely parked.
+func (k *KafkaQueue) deadLetter(ctx context.Context, original kafka.Message, cause error) error {
+	message := kafka.Message{
+		Topic: k.deadLetterTopic(original.Topic),
+		Key:   original.Key,
+		Value: original.Value,
+		Time:  original.Time,
+	}
+	message.Headers = append(message.Headers, original.Headers...)
+	message.Headers = append(message.Headers,
+		kafka.Header{Key: DeadLetterErrorHeader, Value: []byte(cause.Error())},
+		kafka.Header{Key: DeadLetterTopicHeader, Value: []byte(original.Topic)},
+		kafka.Header{Key: DeadLetterPartitionHeader, Value: []byte(strconv.Itoa(original.Partition))},
+		kafka.Header{Key: DeadLetterOffsetHeader, Value: []byte(strconv.FormatInt(original.Offset, 10))},
+	)
+
+	delay := k.config.RetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	for {
+		err := k.writer.WriteMessages(ctx, message)
+		if err == nil {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("dead-letter publish to %s failed: %w", message.Topic, err)
+		}
+		if delay < time.Minute {
+			delay *= 2
+		}
+	}
+}
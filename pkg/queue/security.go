@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const (
+	ProtocolPlaintext     = "PLAINTEXT"
+	ProtocolSSL           = "SSL"
+	ProtocolSASLPlaintext = "SASL_PLAINTEXT"
+	ProtocolSASLSSL       = "SASL_SSL"
+)
+
+const (
+	MechanismPlain       = "PLAIN"
+	MechanismSCRAMSHA256 = "SCRAM-SHA-256"
+	MechanismSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+func (s *SecurityConfig) transport() (*kafka.Transport, error) {
+	tlsConfig, mechanism, err := s.build()
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Transport{
+		TLS:  tlsConfig,
+		SASL: mechanism,
+	}, nil
+}
+
+func (s *SecurityConfig) dialer() (*kafka.Dialer, error) {
+	tlsConfig, mechanism, err := s.build()
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+func (s *SecurityConfig) build() (*tls.Config, sasl.Mechanism, error) {
+	var useTLS, useSASL bool
+
+	switch strings.ToUpper(s.Protocol) {
+	case "", ProtocolPlaintext:
+	case ProtocolSSL:
+		useTLS = true
+	case ProtocolSASLPlaintext:
+		useSASL = true
+	case ProtocolSASLSSL:
+		useTLS = true
+		useSASL = true
+	default:
+		return nil, nil, fmt.Errorf("unsupported kafka security protocol: %s", s.Protocol)
+	}
+
+	var tlsConfig *tls.Config
+	if useTLS {
+		var err error
+		if tlsConfig, err = s.tlsConfig(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var mechanism sasl.Mechanism
+	if useSASL {
+		var err error
+		if mechanism, err = s.saslMechanism(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return tlsConfig, mechanism, nil
+}
+
+func (s *SecurityConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if s.CAFile != "" {
+		caCert, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file error: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", s.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if s.CertFile != "" || s.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate error: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func (s *SecurityConfig) saslMechanism() (sasl.Mechanism, error) {
+	if s.Username == "" {
+		return nil, fmt.Errorf("SASL requires a username")
+	}
+
+	switch strings.ToUpper(s.Mechanism) {
+	case "", MechanismPlain:
+		return plain.Mechanism{Username: s.Username, Password: s.Password}, nil
+	case MechanismSCRAMSHA256:
+		return scram.Mechanism(scram.SHA256, s.Username, s.Password)
+	case MechanismSCRAMSHA512:
+		return scram.Mechanism(scram.SHA512, s.Username, s.Password)
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism: %s", s.Mechanism)
+	}
+}
@@ -0,0 +1,26 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Serializer converts Message.Value to and from the bytes stored in Kafka.
+type Serializer interface {
+	Serialize(ctx context.Context, topic string, value interface{}) ([]byte, error)
+	Deserialize(ctx context.Context, topic string, data []byte) (interface{}, error)
+}
+
+type JSONSerializer struct{}
+
+func (JSONSerializer) Serialize(ctx context.Context, topic string, value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONSerializer) Deserialize(ctx context.Context, topic string, data []byte) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
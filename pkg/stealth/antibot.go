@@ -1,12 +1,20 @@
 package stealth
 
 import (
+	"context"
 	"crypto/tls"
+	"fmt"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/ramusaaa/goscraper/internal"
+	"golang.org/x/net/publicsuffix"
 )
 
 type StealthConfig struct {
@@ -17,10 +25,52 @@ type StealthConfig struct {
 	BypassCloudflare    bool
 	DelayRange          [2]int
 	MaxRetries          int
+	// TLSFingerprinting only takes effect together with TLSProfile; on its
+	// own it leaves Go's ClientHello in place.
 	TLSFingerprinting   bool
+	// TLSProfile names the RegisterTLSProfile profile connections are made
+	// with when TLSFingerprinting is set. Empty keeps Go's own handshake.
+	// TLSProfileChrome and TLSProfileFirefox mimic those browsers.
+	TLSProfile          string
+	// TLSConfig is the base TLS configuration connections are made with,
+	// e.g. to trust extra roots or skip verification for some hosts. It is
+	// cloned, never modified.
+	TLSConfig           *tls.Config
+	// DialTLSContext, when set, makes the TLS connections of requests not
+	// sent through a proxy in place of TLSProfile, e.g. to pick the TLS
+	// configuration by host. Proxied requests still use TLSConfig.
+	DialTLSContext      func(ctx context.Context, network, addr string) (net.Conn, error)
 	JSChallengeBypass   bool
+	DisableKeepAlives   bool
+	// ForceHTTP2 and DisableHTTP2 make connections offer HTTP/2 over ALPN,
+	// as the browsers whose user agents are sent do, or only HTTP/1.1.
+	// DisableHTTP2 wins if both are set.
+	ForceHTTP2          bool
+	DisableHTTP2        bool
+	// UserAgents replaces the built-in User-Agent rotation list, and any
+	// UserAgentProvider, when set.
+	UserAgents          []string
+	// DeviceProfile restricts rotation to desktop or mobile User-Agents.
+	// When none of the list matches, the matching built-in ones are used.
+	DeviceProfile       DeviceProfile
+	UserAgentProvider   *UserAgentProvider
+	// ChallengeSolver is used for Cloudflare JS challenges when
+	// JSChallengeBypass is set; without one they fall back to
+	// CloudflareBypass, which cannot run JavaScript.
+	ChallengeSolver     ChallengeSolver
+	// ChallengeDetector decides which responses go to ChallengeSolver.
+	// The default is DetectCloudflareChallenge.
+	ChallengeDetector   ChallengeDetector
+	// OnBlocked is called with every blocked or challenged response and the
+	// start of its body before the client tries to get past it.
+	OnBlocked           func(resp *http.Response, body []byte)
+	// AcceptEncoding, when set, replaces the randomized Accept-Encoding
+	// header with the encodings the caller can actually decode.
+	AcceptEncoding      string
 }
 
+type StealthOption func(*StealthConfig)
+
 type StealthClient struct {
 	config     *StealthConfig
 	userAgents []string
@@ -31,7 +81,7 @@ type StealthClient struct {
 func NewStealthClient(config *StealthConfig) *StealthClient {
 	return &StealthClient{
 		config:     config,
-		userAgents: getRealisticUserAgents(),
+		userAgents: config.userAgentPool(config.UserAgents),
 		client:     createStealthHTTPClient(config),
 	}
 }
@@ -52,7 +102,9 @@ func createStealthHTTPClient(config *StealthConfig) *http.Client {
 		MaxIdleConns:        100,
 		MaxIdleConnsPerHost: 10,
 		IdleConnTimeout:     90 * time.Second,
+		DisableKeepAlives:   config.DisableKeepAlives,
 	}
+	config.configureTransport(transport)
 
 	return &http.Client{
 		Transport: transport,
@@ -69,85 +121,169 @@ func (s *StealthClient) CreateStealthRequest(method, url string) (*http.Request,
 	if s.config.RotateUserAgents {
 		req.Header.Set("User-Agent", s.getRandomUserAgent())
 	}
+	s.setBrowserHeaders(req)
+
+	return req, nil
+}
 
+// setBrowserHeaders sets the headers that depend on the request's
+// User-Agent, so they have to be set again whenever it changes.
+func (s *StealthClient) setBrowserHeaders(req *http.Request) {
 	if s.config.RandomizeHeaders {
 		s.addRealisticHeaders(req)
 	}
+	// Client hints must describe the same browser as the User-Agent.
+	setClientHints(req)
 
-	return req, nil
+	if s.config.AcceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", s.config.AcceptEncoding)
+	}
 }
 
 func (s *StealthClient) getRandomUserAgent() string {
-	return s.userAgents[rand.Intn(len(s.userAgents))]
+	userAgents := s.userAgents
+	if len(s.config.UserAgents) == 0 && s.config.UserAgentProvider != nil {
+		userAgents = s.config.userAgentPool(s.config.UserAgentProvider.UserAgents())
+	}
+	return userAgents[rand.Intn(len(userAgents))]
 }
 
+func RandomUserAgent() string {
+	userAgents := getRealisticUserAgents()
+	return userAgents[rand.Intn(len(userAgents))]
+}
+
+// addRealisticHeaders sets the headers the browser named by the request's
+// User-Agent sends when navigating to a page typed into its address bar.
+// Only the language preference is picked at random, since the other headers
+// have to agree with each other and with the User-Agent to look genuine.
 func (s *StealthClient) addRealisticHeaders(req *http.Request) {
-	headers := map[string][]string{
-		"Accept": {
-			"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
-			"text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8",
-			"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
-		},
-		"Accept-Language": {
+	profile := browserProfileFor(req.Header.Get("User-Agent"))
+
+	req.Header.Set("Accept", profile.accept)
+	req.Header.Set("Accept-Language", profile.languages[rand.Intn(len(profile.languages))])
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	req.Header.Set("Sec-Fetch-Dest", "document")
+	req.Header.Set("Sec-Fetch-Mode", "navigate")
+	req.Header.Set("Sec-Fetch-Site", "none")
+	req.Header.Set("Sec-Fetch-User", "?1")
+	req.Header.Set("Upgrade-Insecure-Requests", "1")
+	req.Header.Set("Connection", "keep-alive")
+}
+
+// browserProfile holds the navigation headers of a browser family.
+type browserProfile struct {
+	accept    string
+	languages []string
+}
+
+var (
+	chromiumProfile = browserProfile{
+		accept: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+		languages: []string{
 			"tr-TR,tr;q=0.9,en-US;q=0.8,en;q=0.7",
 			"tr,en-US;q=0.9,en;q=0.8",
-			"tr-TR,tr;q=0.8,en-US;q=0.5,en;q=0.3",
-		},
-		"Accept-Encoding": {
-			"gzip, deflate, br",
-			"gzip, deflate",
 		},
-		"Cache-Control": {
-			"max-age=0",
-			"no-cache",
-			"",
-		},
-		"Sec-Fetch-Dest": {
-			"document",
-			"empty",
-		},
-		"Sec-Fetch-Mode": {
-			"navigate",
-			"cors",
-		},
-		"Sec-Fetch-Site": {
-			"none",
-			"same-origin",
-			"cross-site",
+	}
+	firefoxProfile = browserProfile{
+		accept: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+		languages: []string{
+			"tr-TR,tr;q=0.8,en-US;q=0.5,en;q=0.3",
+			"tr,en-US;q=0.7,en;q=0.3",
 		},
-		"Sec-Fetch-User": {
-			"?1",
-			"",
+	}
+	safariProfile = browserProfile{
+		accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		languages: []string{
+			"tr-TR,tr;q=0.9",
+			"tr-TR,tr;q=0.9,en-US;q=0.8,en;q=0.7",
 		},
 	}
+)
 
-	for header, options := range headers {
-		if len(options) > 0 {
-			value := options[rand.Intn(len(options))]
-			if value != "" {
-				req.Header.Set(header, value)
-			}
-		}
+// browserProfileFor returns the profile of the browser userAgent names,
+// Chromium's when it is not recognized.
+func browserProfileFor(userAgent string) browserProfile {
+	switch {
+	case strings.Contains(userAgent, "Firefox/"):
+		return firefoxProfile
+	case strings.Contains(userAgent, "Chrome/"):
+		return chromiumProfile
+	case strings.Contains(userAgent, "Safari/"):
+		return safariProfile
 	}
+	return chromiumProfile
+}
 
-	req.Header.Set("DNT", "1")
-	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
+var chromeVersionRe = regexp.MustCompile(`Chrome/(\d+)`)
+
+// setClientHints derives the Sec-CH-UA headers from the request's
+// User-Agent. Only Chromium-based browsers send client hints, so they are
+// removed entirely for Firefox and Safari user agents.
+func setClientHints(req *http.Request) {
+	brands, mobile, platform, ok := clientHintsFor(req.Header.Get("User-Agent"))
+	if !ok {
+		req.Header.Del("Sec-CH-UA")
+		req.Header.Del("Sec-CH-UA-Mobile")
+		req.Header.Del("Sec-CH-UA-Platform")
+		return
+	}
+
+	req.Header.Set("Sec-CH-UA", brands)
+	req.Header.Set("Sec-CH-UA-Mobile", mobile)
+	req.Header.Set("Sec-CH-UA-Platform", platform)
+}
+
+func clientHintsFor(userAgent string) (brands, mobile, platform string, ok bool) {
+	match := chromeVersionRe.FindStringSubmatch(userAgent)
+	if match == nil || strings.Contains(userAgent, "Firefox/") {
+		return "", "", "", false
+	}
+	version := match[1]
 
-	if rand.Float32() < 0.3 {
-		req.Header.Set("Sec-CH-UA", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`)
-		req.Header.Set("Sec-CH-UA-Mobile", "?0")
-		req.Header.Set("Sec-CH-UA-Platform", `"macOS"`)
+	brand := "Google Chrome"
+	if strings.Contains(userAgent, "Edg/") {
+		brand = "Microsoft Edge"
 	}
+	brands = fmt.Sprintf(`"Not_A Brand";v="8", "Chromium";v="%s", "%s";v="%s"`, version, brand, version)
+
+	mobile = "?0"
+	if strings.Contains(userAgent, "Mobile") {
+		mobile = "?1"
+	}
+
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		platform = `"Android"`
+	case strings.Contains(userAgent, "Windows"):
+		platform = `"Windows"`
+	case strings.Contains(userAgent, "Macintosh"):
+		platform = `"macOS"`
+	case strings.Contains(userAgent, "CrOS"):
+		platform = `"Chrome OS"`
+	case strings.Contains(userAgent, "Linux"):
+		platform = `"Linux"`
+	default:
+		platform = `"Unknown"`
+	}
+
+	return brands, mobile, platform, true
 }
 
 func (s *StealthClient) SimulateHumanDelay() {
-	if s.config.SimulateHuman {
-		min := s.config.DelayRange[0]
-		max := s.config.DelayRange[1]
-		delay := time.Duration(min+rand.Intn(max-min)) * time.Millisecond
-		time.Sleep(delay)
+	s.simulateHumanDelay(context.Background())
+}
+
+// simulateHumanDelay is SimulateHumanDelay cut short when ctx is done.
+func (s *StealthClient) simulateHumanDelay(ctx context.Context) error {
+	if !s.config.SimulateHuman {
+		return nil
 	}
+
+	min := s.config.DelayRange[0]
+	max := s.config.DelayRange[1]
+	delay := time.Duration(min+rand.Intn(max-min)) * time.Millisecond
+	return internal.SleepContext(ctx, delay)
 }
 
 func getRealisticUserAgents() []string {
@@ -170,7 +306,8 @@ func getRealisticUserAgents() []string {
 }
 
 type CloudflareBypass struct {
-	client *http.Client
+	client         *http.Client
+	acceptEncoding string
 }
 
 func NewCloudflareBypass() *CloudflareBypass {
@@ -182,7 +319,11 @@ func NewCloudflareBypass() *CloudflareBypass {
 }
 
 func (c *CloudflareBypass) BypassChallenge(url string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+	return c.BypassChallengeContext(context.Background(), url)
+}
+
+func (c *CloudflareBypass) BypassChallengeContext(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -190,7 +331,11 @@ func (c *CloudflareBypass) BypassChallenge(url string) (*http.Response, error) {
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
 	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
-	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	acceptEncoding := c.acceptEncoding
+	if acceptEncoding == "" {
+		acceptEncoding = "gzip, deflate"
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
 	req.Header.Set("DNT", "1")
 	req.Header.Set("Connection", "keep-alive")
 	req.Header.Set("Upgrade-Insecure-Requests", "1")
@@ -201,7 +346,10 @@ func (c *CloudflareBypass) BypassChallenge(url string) (*http.Response, error) {
 	}
 
 	if resp.StatusCode == 503 || resp.StatusCode == 403 {
-		time.Sleep(5 * time.Second)
+		resp.Body.Close()
+		if err := internal.SleepContext(ctx, 5*time.Second); err != nil {
+			return nil, err
+		}
 		return c.client.Do(req)
 	}
 
@@ -209,51 +357,50 @@ func (c *CloudflareBypass) BypassChallenge(url string) (*http.Response, error) {
 }
 
 type SessionManager struct {
-	sessions map[string]*http.Client
-	cookies  map[string][]*http.Cookie
+	mu        sync.Mutex
+	sessions  map[string]*http.Client
+	transport http.RoundTripper
 }
 
 func NewSessionManager() *SessionManager {
 	return &SessionManager{
 		sessions: make(map[string]*http.Client),
-		cookies:  make(map[string][]*http.Cookie),
 	}
 }
 
 func (s *SessionManager) GetSession(domain string) *http.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if client, exists := s.sessions[domain]; exists {
 		return client
 	}
 
-	jar := &cookieJar{cookies: make(map[string][]*http.Cookie)}
 	client := &http.Client{
-		Jar:     jar,
-		Timeout: 30 * time.Second,
+		Jar:       newSessionJar(),
+		Timeout:   30 * time.Second,
+		Transport: s.transport,
 	}
 
 	s.sessions[domain] = client
 	return client
 }
 
-type cookieJar struct {
-	cookies map[string][]*http.Cookie
-}
-
-func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
-	j.cookies[u.Host] = cookies
-}
-
-func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
-	return j.cookies[u.Host]
-}
-
 type BotDetectionEvasion struct {
+	config        *StealthConfig
 	stealthClient *StealthClient
-	cfBypass      *CloudflareBypass
 	sessionMgr    *SessionManager
+
+	// transport carries the configured TLS and HTTP/2 settings; proxied
+	// requests use clones of it.
+	transport     *http.Transport
+
+	mu            sync.Mutex
+	transports    map[string]*http.Transport
+	clearedAgents map[string]string
 }
 
-func NewBotDetectionEvasion() *BotDetectionEvasion {
+func NewBotDetectionEvasion(options ...StealthOption) *BotDetectionEvasion {
 	config := &StealthConfig{
 		RotateUserAgents:  true,
 		RandomizeHeaders:  true,
@@ -264,36 +411,229 @@ func NewBotDetectionEvasion() *BotDetectionEvasion {
 		TLSFingerprinting: true,
 	}
 
+	for _, option := range options {
+		option(config)
+	}
+
+	sessionMgr := NewSessionManager()
+	base := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		DisableKeepAlives:   config.DisableKeepAlives,
+	}
+	if config.TLSConfig != nil {
+		base.TLSClientConfig = config.TLSConfig.Clone()
+	}
+	config.configureTransport(base)
+	if config.customTransport() {
+		sessionMgr.transport = base
+	}
+
 	return &BotDetectionEvasion{
+		config:        config,
 		stealthClient: NewStealthClient(config),
-		cfBypass:      NewCloudflareBypass(),
-		sessionMgr:    NewSessionManager(),
+		sessionMgr:    sessionMgr,
+		transport:     base,
+		transports:    make(map[string]*http.Transport),
+		clearedAgents: make(map[string]string),
 	}
 }
 
+// Sessions returns the per-domain sessions requests are made in, e.g. to
+// save or load their cookies. Domains are keyed by host, including any port.
+func (b *BotDetectionEvasion) Sessions() *SessionManager {
+	return b.sessionMgr
+}
+
 func (b *BotDetectionEvasion) MakeRequest(url string) (*http.Response, error) {
+	return b.MakeRequestContext(context.Background(), url)
+}
+
+// MakeRequestContext is MakeRequest bounded by ctx: cancellation and
+// deadlines abort the human delay, the request and any challenge retry.
+func (b *BotDetectionEvasion) MakeRequestContext(ctx context.Context, url string) (*http.Response, error) {
+	return b.MakeRequestWithProxy(ctx, url, nil)
+}
+
+// MakeRequestWithProxy behaves like MakeRequestContext but routes the
+// request through proxy. The domain session (and its cookies) is shared
+// regardless of which proxy is used.
+func (b *BotDetectionEvasion) MakeRequestWithProxy(ctx context.Context, url string, proxy *url.URL) (*http.Response, error) {
+	return b.MakeRequestWithOptions(ctx, url, RequestOptions{Proxy: proxy})
+}
+
+// RequestOptions adjusts a single request of MakeRequestWithOptions.
+type RequestOptions struct {
+	// Proxy routes the request through a proxy; nil sends it directly.
+	Proxy *url.URL
+	// Referer is the page the request navigates from. It is sent as the
+	// Referer header, and Sec-Fetch-Site tells how the two pages are
+	// related instead of claiming a typed-in address.
+	Referer string
+	// Header is set on the request after the stealth headers, replacing any
+	// of the same name.
+	Header http.Header
+	// Cookies are sent along with those of the domain session.
+	Cookies []*http.Cookie
+	// Jar, when set, keeps and sends the request's cookies in place of the
+	// domain session.
+	Jar http.CookieJar
+	// Prepare is called with the request just before it is sent; an error
+	// aborts the request.
+	Prepare func(req *http.Request) error
+}
+
+// MakeRequestWithOptions behaves like MakeRequestContext, adjusted by opts.
+func (b *BotDetectionEvasion) MakeRequestWithOptions(ctx context.Context, url string, opts RequestOptions) (*http.Response, error) {
 	domain := extractDomain(url)
 	client := b.sessionMgr.GetSession(domain)
 
-	req, err := b.stealthClient.CreateStealthRequest("GET", url)
+	if opts.Proxy != nil || opts.Jar != nil {
+		adjusted := *client
+		if opts.Proxy != nil {
+			adjusted.Transport = b.proxyTransport(opts.Proxy)
+		}
+		if opts.Jar != nil {
+			adjusted.Jar = opts.Jar
+		}
+		client = &adjusted
+	}
+
+	req, err := b.newRequest(ctx, url, domain, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	b.stealthClient.SimulateHumanDelay()
+	if err := b.stealthClient.simulateHumanDelay(ctx); err != nil {
+		return nil, err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
-	if isBlocked(resp) {
-		return b.cfBypass.BypassChallenge(url)
+	challenge := b.config.JSChallengeBypass && b.config.ChallengeSolver != nil && b.detectChallenge(resp)
+	blocked := isBlocked(resp)
+	if (challenge || blocked) && b.config.OnBlocked != nil {
+		b.config.OnBlocked(resp, SniffBody(resp))
+	}
+	if challenge {
+		resp.Body.Close()
+		return b.solveChallenge(ctx, client, req, domain)
+	}
+	if blocked {
+		resp.Body.Close()
+		return b.retryBlocked(ctx, client, url, domain, opts)
 	}
 
 	return resp, nil
 }
 
+// newRequest builds a stealth request for url with opts applied on top of
+// the stealth headers.
+func (b *BotDetectionEvasion) newRequest(ctx context.Context, url, domain string, opts RequestOptions) (*http.Request, error) {
+	req, err := b.stealthClient.CreateStealthRequest("GET", url)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if opts.Referer != "" {
+		req.Header.Set("Referer", opts.Referer)
+		// Without randomized headers no Sec-Fetch headers are sent at all.
+		if req.Header.Get("Sec-Fetch-Site") != "" {
+			req.Header.Set("Sec-Fetch-Site", secFetchSite(opts.Referer, req.URL))
+		}
+	}
+	b.applyClearance(req, domain)
+	for name, values := range opts.Header {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	for _, cookie := range opts.Cookies {
+		req.AddCookie(cookie)
+	}
+	if opts.Prepare != nil {
+		if err := opts.Prepare(req); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// retryBlocked repeats a blocked request through the same client, proxy and
+// options. A request that is still challenged with 403 or 503 gets one more
+// try after the few seconds such interstitials usually take.
+func (b *BotDetectionEvasion) retryBlocked(ctx context.Context, client *http.Client, url, domain string, opts RequestOptions) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := b.newRequest(ctx, url, domain, opts)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if attempt > 0 || (resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusServiceUnavailable) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if err := internal.SleepContext(ctx, blockedRetryDelay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// blockedRetryDelay is how long retryBlocked waits before its last try.
+const blockedRetryDelay = 5 * time.Second
+
+func (b *BotDetectionEvasion) proxyTransport(proxy *url.URL) *http.Transport {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := proxy.String()
+	if transport, exists := b.transports[key]; exists {
+		return transport
+	}
+
+	transport := b.transport.Clone()
+	transport.Proxy = http.ProxyURL(proxy)
+	// TLS profiles are not used through proxies, but the TLS configuration
+	// and HTTP/2 settings are.
+	transport.DialTLSContext = nil
+	b.transports[key] = transport
+	return transport
+}
+
+// secFetchSite is the Sec-Fetch-Site a browser sends when following a link
+// from the page at referer to target.
+func secFetchSite(referer string, target *url.URL) string {
+	from, err := url.Parse(referer)
+	if err != nil || from.Host == "" {
+		return "none"
+	}
+	if from.Scheme != target.Scheme {
+		return "cross-site"
+	}
+	if from.Host == target.Host {
+		return "same-origin"
+	}
+	// A site is the registrable domain, or the whole host for IPs and
+	// names without a public suffix; ports do not count.
+	if from.Hostname() == target.Hostname() {
+		return "same-site"
+	}
+	if net.ParseIP(from.Hostname()) != nil || net.ParseIP(target.Hostname()) != nil {
+		return "cross-site"
+	}
+	fromSite, fromErr := publicsuffix.EffectiveTLDPlusOne(from.Hostname())
+	toSite, toErr := publicsuffix.EffectiveTLDPlusOne(target.Hostname())
+	if fromErr == nil && toErr == nil && fromSite == toSite {
+		return "same-site"
+	}
+	return "cross-site"
+}
+
 func isBlocked(resp *http.Response) bool {
 	return resp.StatusCode == 403 || resp.StatusCode == 503 || 
 		   resp.StatusCode == 429 || resp.StatusCode == 520
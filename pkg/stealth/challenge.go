@@ -0,0 +1,174 @@
+package stealth
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ChallengeSolver clears a JavaScript challenge that plain HTTP requests
+// can't pass, typically by loading the page in a real browser until the
+// challenge sets its clearance cookie. browser.ChallengeSolver is the
+// implementation shipped with goscraper.
+type ChallengeSolver interface {
+	SolveChallenge(ctx context.Context, url string) (*ChallengeClearance, error)
+}
+
+// ChallengeClearance is what a solved challenge leaves behind. The cookies
+// are only honoured together with the User-Agent that earned them. HTML is
+// the page the browser ended up on, used when the site keeps challenging
+// plain HTTP requests despite the clearance.
+type ChallengeClearance struct {
+	Cookies   []*http.Cookie
+	UserAgent string
+	HTML      string
+}
+
+// ChallengeDetector reports whether resp is a JS challenge page. body holds
+// the start of the decoded response body and may be empty when it could not
+// be read, e.g. for an unsupported Content-Encoding.
+type ChallengeDetector func(resp *http.Response, body []byte) bool
+
+// challengeMarkers only appear in Cloudflare's challenge interstitials.
+// /cdn-cgi/challenge-platform/ is not one of them: Cloudflare injects its
+// scripts/jsd/main.js into ordinary pages too.
+var challengeMarkers = []string{"cf-browser-verification", "__cf_chl", "cf_chl_opt"}
+
+// challengeSniffLen bounds how much of a body is read to look for markers.
+const challengeSniffLen = 32 << 10
+
+// DetectCloudflareChallenge is the default ChallengeDetector. It recognises
+// challenges by Cloudflare's response headers, or by the markers and the
+// "Just a moment..." title its interstitial pages carry. Challenges are
+// served as 403 or 503, so the body is only looked at for those statuses.
+func DetectCloudflareChallenge(resp *http.Response, body []byte) bool {
+	if isJSChallenge(resp) {
+		return true
+	}
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusServiceUnavailable {
+		return false
+	}
+	for _, marker := range challengeMarkers {
+		if bytes.Contains(body, []byte(marker)) {
+			return true
+		}
+	}
+	return bytes.Contains(body, []byte("<title>Just a moment"))
+}
+
+// isJSChallenge reports whether a blocked response is an interactive
+// Cloudflare challenge rather than a plain denial.
+func isJSChallenge(resp *http.Response) bool {
+	if strings.EqualFold(resp.Header.Get("Cf-Mitigated"), "challenge") {
+		return true
+	}
+	return strings.EqualFold(resp.Header.Get("Server"), "cloudflare") &&
+		(resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusServiceUnavailable) &&
+		strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html")
+}
+
+// detectChallenge runs the configured ChallengeDetector on resp. HTML bodies
+// are sniffed without being consumed: resp.Body still returns every byte.
+func (b *BotDetectionEvasion) detectChallenge(resp *http.Response) bool {
+	detect := b.config.ChallengeDetector
+	if detect == nil {
+		detect = DetectCloudflareChallenge
+	}
+
+	var body []byte
+	if contentType := resp.Header.Get("Content-Type"); contentType == "" || strings.Contains(contentType, "html") {
+		body = SniffBody(resp)
+	}
+	return detect(resp, body)
+}
+
+// SniffBody returns up to 32KB from the start of the decoded body and
+// rewinds resp.Body so the caller still sees all of it. Bodies in encodings
+// other than identity and gzip are rewound but reported as empty.
+func SniffBody(resp *http.Response) []byte {
+	prefix, _ := io.ReadAll(io.LimitReader(resp.Body, challengeSniffLen))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), resp.Body), resp.Body}
+
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return prefix
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(prefix))
+		if err != nil {
+			return nil
+		}
+		// The prefix is usually a truncated stream; keep what decodes.
+		decoded, _ := io.ReadAll(io.LimitReader(zr, challengeSniffLen))
+		return decoded
+	default:
+		return nil
+	}
+}
+
+// solveChallenge escalates to the ChallengeSolver, stores the clearance in
+// the domain session and repeats req with the browser's User-Agent. Later
+// requests to the domain reuse the clearance on the HTTP path.
+func (b *BotDetectionEvasion) solveChallenge(ctx context.Context, client *http.Client, req *http.Request, domain string) (*http.Response, error) {
+	clearance, err := b.config.ChallengeSolver.SolveChallenge(ctx, req.URL.String())
+	if err != nil {
+		return nil, fmt.Errorf("js challenge for %s not solved: %w", domain, err)
+	}
+
+	if client.Jar != nil {
+		client.Jar.SetCookies(req.URL, clearance.Cookies)
+	}
+	if clearance.UserAgent != "" {
+		b.mu.Lock()
+		b.clearedAgents[domain] = clearance.UserAgent
+		b.mu.Unlock()
+	}
+
+	retry := req.Clone(ctx)
+	retry.Header.Del("Cookie")
+	b.applyClearance(retry, domain)
+	resp, err := client.Do(retry)
+	if err != nil || clearance.HTML == "" || !b.detectChallenge(resp) {
+		return resp, err
+	}
+
+	// The clearance didn't carry over to plain HTTP, e.g. because the TLS
+	// fingerprint differs from the browser's. Serve the page the browser got.
+	resp.Body.Close()
+	return browserResponse(retry, clearance.HTML), nil
+}
+
+func browserResponse(req *http.Request, html string) *http.Response {
+	header := make(http.Header)
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(html)),
+		ContentLength: int64(len(html)),
+		Request:       req,
+	}
+}
+
+// applyClearance pins req to the User-Agent a solved challenge was bound to.
+func (b *BotDetectionEvasion) applyClearance(req *http.Request, domain string) {
+	b.mu.Lock()
+	userAgent := b.clearedAgents[domain]
+	b.mu.Unlock()
+
+	if userAgent == "" {
+		return
+	}
+	req.Header.Set("User-Agent", userAgent)
+	b.stealthClient.setBrowserHeaders(req)
+}
@@ -0,0 +1,150 @@
+package stealth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// sessionJar is a standard cookie jar, so paths, expiry and domain matching
+// follow RFC 6265, that also remembers every cookie it was given. The
+// standard jar cannot list its contents, which saving a session needs.
+type sessionJar struct {
+	jar *cookiejar.Jar
+
+	mu      sync.Mutex
+	entries map[string]savedCookie
+}
+
+// savedCookie is a cookie together with the URL it was set for, which the
+// jar needs to scope host-only cookies and default paths when it is loaded.
+type savedCookie struct {
+	URL      string        `json:"url"`
+	Name     string        `json:"name"`
+	Value    string        `json:"value"`
+	Domain   string        `json:"domain,omitempty"`
+	Path     string        `json:"path,omitempty"`
+	Expires  time.Time     `json:"expires"`
+	Secure   bool          `json:"secure,omitempty"`
+	HttpOnly bool          `json:"http_only,omitempty"`
+	SameSite http.SameSite `json:"same_site,omitempty"`
+}
+
+func newSessionJar() *sessionJar {
+	// cookiejar.New only fails on invalid options.
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &sessionJar{
+		jar:     jar,
+		entries: make(map[string]savedCookie),
+	}
+}
+
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	for _, cookie := range cookies {
+		saved := savedCookie{
+			URL:      (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String(),
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  cookie.Expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+			SameSite: cookie.SameSite,
+		}
+		if cookie.MaxAge > 0 {
+			saved.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+
+		key := u.Host + ";" + cookie.Domain + ";" + cookie.Path + ";" + cookie.Name
+		if cookie.MaxAge < 0 || (!saved.Expires.IsZero() && !saved.Expires.After(now)) {
+			delete(j.entries, key)
+			continue
+		}
+		j.entries[key] = saved
+	}
+}
+
+func (j *sessionJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// saved lists the cookies that have not expired yet.
+func (j *sessionJar) saved() []savedCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	cookies := make([]savedCookie, 0, len(j.entries))
+	for key, cookie := range j.entries {
+		if !cookie.Expires.IsZero() && !cookie.Expires.After(now) {
+			delete(j.entries, key)
+			continue
+		}
+		cookies = append(cookies, cookie)
+	}
+	return cookies
+}
+
+func (j *sessionJar) load(cookies []savedCookie) {
+	for _, saved := range cookies {
+		u, err := url.Parse(saved.URL)
+		if err != nil {
+			continue
+		}
+		j.SetCookies(u, []*http.Cookie{{
+			Name:     saved.Name,
+			Value:    saved.Value,
+			Domain:   saved.Domain,
+			Path:     saved.Path,
+			Expires:  saved.Expires,
+			Secure:   saved.Secure,
+			HttpOnly: saved.HttpOnly,
+			SameSite: saved.SameSite,
+		}})
+	}
+}
+
+// SaveCookies writes the cookies of the session for domain to a JSON file at
+// path, e.g. to keep a logged-in session across runs. Session cookies are
+// saved too; expired ones are dropped.
+func (s *SessionManager) SaveCookies(domain, path string) error {
+	jar := s.GetSession(domain).Jar.(*sessionJar)
+
+	data, err := json.MarshalIndent(jar.saved(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cookies for %s: %w", domain, err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save cookies for %s: %w", domain, err)
+	}
+	return nil
+}
+
+// LoadCookies adds the cookies saved by SaveCookies at path to the session
+// for domain. Cookies that expired in the meantime are skipped.
+func (s *SessionManager) LoadCookies(domain, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to load cookies for %s: %w", domain, err)
+	}
+
+	var cookies []savedCookie
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return fmt.Errorf("failed to parse cookies in %s: %w", path, err)
+	}
+
+	s.GetSession(domain).Jar.(*sessionJar).load(cookies)
+	return nil
+}
@@ -0,0 +1,169 @@
+package stealth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// ErrUnknownTLSProfile is returned when connecting with a TLS profile that
+// has not been registered.
+var ErrUnknownTLSProfile = errors.New("unknown TLS profile")
+
+// TLSProfileGo is a standard crypto/tls handshake, which WAFs can
+// recognize as Go. It is built in along with the uTLS browser profiles
+// TLSProfileChrome and TLSProfileFirefox.
+const TLSProfileGo = "go"
+
+// TLSDialFunc opens a connection to addr and completes a TLS handshake with
+// config, whose ServerName is always set. It is how a ClientHello mimicking
+// a browser is plugged in, e.g. with a uTLS UClient and HelloChrome_Auto.
+//
+// config.NextProtos lists the protocols the transport can speak, and a
+// dialer must not offer others over ALPN. HTTP/2 is only spoken when the
+// returned connection has a ConnectionState method returning a
+// crypto/tls ConnectionState, as *tls.Conn does; otherwise it is spoken to
+// as HTTP/1.1.
+type TLSDialFunc func(ctx context.Context, network, addr string, config *tls.Config) (net.Conn, error)
+
+var tlsProfiles = struct {
+	sync.RWMutex
+	dialers map[string]TLSDialFunc
+}{dialers: builtinTLSProfiles()}
+
+func builtinTLSProfiles() map[string]TLSDialFunc {
+	return map[string]TLSDialFunc{
+		TLSProfileGo:      dialStandardTLS,
+		TLSProfileChrome:  utlsDialer(utls.HelloChrome_Auto),
+		TLSProfileFirefox: utlsDialer(utls.HelloFirefox_Auto),
+	}
+}
+
+// RegisterTLSProfile makes dial available as the TLS profile name,
+// replacing any profile of that name, built-in ones included. Profiles are
+// looked up on every new connection, so they may be registered after
+// clients using them are made.
+func RegisterTLSProfile(name string, dial TLSDialFunc) {
+	tlsProfiles.Lock()
+	defer tlsProfiles.Unlock()
+	tlsProfiles.dialers[name] = dial
+}
+
+// UnregisterTLSProfile removes the TLS profile name, so that connections
+// made with it fail with ErrUnknownTLSProfile. Built-in profiles cannot be
+// removed; a replaced one goes back to the built-in dialer.
+func UnregisterTLSProfile(name string) {
+	tlsProfiles.Lock()
+	defer tlsProfiles.Unlock()
+	if builtin, ok := builtinTLSProfiles()[name]; ok {
+		tlsProfiles.dialers[name] = builtin
+		return
+	}
+	delete(tlsProfiles.dialers, name)
+}
+
+// ResetTLSProfiles drops every registered profile and restores the
+// built-in ones, e.g. in a test's cleanup.
+func ResetTLSProfiles() {
+	tlsProfiles.Lock()
+	defer tlsProfiles.Unlock()
+	tlsProfiles.dialers = builtinTLSProfiles()
+}
+
+// TLSProfileDialer returns a DialTLSContext function for an http.Transport
+// that connects with the named profile, using a copy of config (which may
+// be nil). Connecting fails with ErrUnknownTLSProfile while no profile of
+// that name is registered.
+//
+// The transport only uses it for HTTPS requests that do not go through a
+// proxy.
+func TLSProfileDialer(profile string, config *tls.Config) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		tlsProfiles.RLock()
+		dial, ok := tlsProfiles.dialers[profile]
+		tlsProfiles.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownTLSProfile, profile)
+		}
+
+		cfg := config.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			cfg.ServerName = host
+		}
+		return dial(ctx, network, addr, cfg)
+	}
+}
+
+func dialStandardTLS(ctx context.Context, network, addr string, config *tls.Config) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	raw, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := tls.Client(raw, config)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ConfigureHTTP2 makes transport negotiate HTTP/2 over ALPN when enabled,
+// including over connections made by a TLS profile, and only HTTP/1.1 when
+// not. Servers without HTTP/2 are still spoken to as HTTP/1.1.
+func ConfigureHTTP2(transport *http.Transport, enabled bool) {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(enabled)
+	transport.Protocols = protocols
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	if enabled {
+		transport.TLSClientConfig.NextProtos = []string{"h2", "http/1.1"}
+	} else {
+		transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+}
+
+// configureTransport applies the HTTP/2 and TLS profile settings to
+// transport.
+func (c *StealthConfig) configureTransport(transport *http.Transport) {
+	if c.ForceHTTP2 || c.DisableHTTP2 {
+		ConfigureHTTP2(transport, !c.DisableHTTP2)
+	}
+	c.useTLSProfile(transport)
+}
+
+// customTransport reports whether the settings need a transport of their
+// own rather than Go's default one.
+func (c *StealthConfig) customTransport() bool {
+	return c.DisableKeepAlives || c.ForceHTTP2 || c.DisableHTTP2 || c.TLSConfig != nil || c.DialTLSContext != nil || (c.TLSFingerprinting && c.TLSProfile != "")
+}
+
+// useTLSProfile installs DialTLSContext, or else the profile configured for
+// TLS fingerprinting, on transport, if there is one.
+func (c *StealthConfig) useTLSProfile(transport *http.Transport) {
+	switch {
+	case c.DialTLSContext != nil:
+		transport.DialTLSContext = c.DialTLSContext
+	case c.TLSFingerprinting && c.TLSProfile != "":
+		transport.DialTLSContext = TLSProfileDialer(c.TLSProfile, transport.TLSClientConfig)
+	}
+}
@@ -0,0 +1,141 @@
+package stealth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/ramusaaa/goscraper/internal"
+)
+
+// UserAgentProvider serves User-Agent strings loaded from a URL or a local
+// file, so the stealth fingerprints can track current browser releases
+// without a library update. The list is first loaded in the background when
+// the provider is created and refreshed the same way once it is older than
+// the refresh interval; until the first successful load, and whenever
+// loading fails, the built-in list is used. Remote sources over 1 MiB fail
+// to load.
+//
+// The source is either a JSON array of strings or plain text with one
+// User-Agent per line (blank lines and lines starting with # are ignored).
+type UserAgentProvider struct {
+	source *internal.RefreshableSource[[]string]
+}
+
+func NewUserAgentProvider(source string, interval time.Duration) *UserAgentProvider {
+	p := &UserAgentProvider{source: internal.NewRefreshableSource("user agents", source, interval, parseUserAgents)}
+	// Loading now keeps the fetch off the first request.
+	p.source.LoadInBackground()
+	return p
+}
+
+// WaitFirstLoad blocks until the load started by NewUserAgentProvider has
+// finished, successfully or not, or ctx is done.
+func (p *UserAgentProvider) WaitFirstLoad(ctx context.Context) error {
+	return p.source.WaitFirstLoad(ctx)
+}
+
+// Refresh loads the source synchronously, e.g. on startup. On failure the
+// previously loaded list is kept.
+func (p *UserAgentProvider) Refresh(ctx context.Context) error {
+	return p.source.Refresh(ctx)
+}
+
+// UserAgents returns the current list, falling back to the built-in one.
+func (p *UserAgentProvider) UserAgents() []string {
+	agents := p.source.Get()
+	if len(agents) == 0 {
+		return getRealisticUserAgents()
+	}
+	return agents
+}
+
+func (p *UserAgentProvider) Random() string {
+	agents := p.UserAgents()
+	return agents[rand.Intn(len(agents))]
+}
+
+// LastError reports why the most recent refresh failed, if it did.
+func (p *UserAgentProvider) LastError() error {
+	return p.source.LastError()
+}
+
+func parseUserAgents(data []byte) ([]string, error) {
+	agents := parseUserAgentList(data)
+	if len(agents) == 0 {
+		return nil, errors.New("no user agents found")
+	}
+	return agents, nil
+}
+
+func parseUserAgentList(data []byte) []string {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		lines = strings.Split(string(data), "\n")
+	}
+
+	var agents []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || !strings.HasPrefix(line, "Mozilla/") {
+			continue
+		}
+		agents = append(agents, line)
+	}
+	return agents
+}
+
+// DeviceProfile restricts User-Agent rotation to one class of device.
+type DeviceProfile string
+
+const (
+	// DeviceAny rotates through every User-Agent.
+	DeviceAny DeviceProfile = ""
+	// DeviceDesktop only picks desktop browsers.
+	DeviceDesktop DeviceProfile = "desktop"
+	// DeviceMobile only picks phone and tablet browsers.
+	DeviceMobile DeviceProfile = "mobile"
+)
+
+// matches reports whether userAgent belongs to the profile. Mobile browsers
+// are told apart by the "Mobi" token they all send.
+func (d DeviceProfile) matches(userAgent string) bool {
+	switch d {
+	case DeviceDesktop:
+		return !isMobileUserAgent(userAgent)
+	case DeviceMobile:
+		return isMobileUserAgent(userAgent)
+	}
+	return true
+}
+
+func isMobileUserAgent(userAgent string) bool {
+	return strings.Contains(userAgent, "Mobi")
+}
+
+// userAgentPool returns the User-Agents of agents matching the configured
+// DeviceProfile, or the matching built-in ones if there are none.
+func (c *StealthConfig) userAgentPool(agents []string) []string {
+	if c.DeviceProfile == DeviceAny && len(agents) > 0 {
+		return agents
+	}
+
+	var matching []string
+	for _, agent := range agents {
+		if c.DeviceProfile.matches(agent) {
+			matching = append(matching, agent)
+		}
+	}
+	if len(matching) > 0 {
+		return matching
+	}
+	for _, agent := range getRealisticUserAgents() {
+		if c.DeviceProfile.matches(agent) {
+			matching = append(matching, agent)
+		}
+	}
+	return matching
+}
@@ -0,0 +1,98 @@
+package stealth
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// Browser TLS profiles built on uTLS. They send the ClientHello of a
+// current browser release, cipher suite and extension order, GREASE values
+// and key shares included.
+const (
+	TLSProfileChrome  = "chrome"
+	TLSProfileFirefox = "firefox"
+)
+
+// utlsDialer returns a TLSDialFunc that handshakes with the ClientHello of
+// the uTLS browser id.
+//
+// net/http only speaks HTTP/2 over a *tls.Conn, so the ALPN extension of
+// the browser's hello is rewritten to offer just HTTP/1.1 (when the
+// transport allows it); everything else is sent as the browser would.
+func utlsDialer(id utls.ClientHelloID) TLSDialFunc {
+	return func(ctx context.Context, network, addr string, config *tls.Config) (net.Conn, error) {
+		spec, err := utls.UTLSIdToSpec(id)
+		if err != nil {
+			return nil, err
+		}
+		protocols := http1Protocols(config.NextProtos)
+		for _, ext := range spec.Extensions {
+			if alpn, ok := ext.(*utls.ALPNExtension); ok {
+				alpn.AlpnProtocols = protocols
+			}
+		}
+
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		raw, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		conn := utls.UClient(raw, utlsConfig(config, protocols), utls.HelloCustom)
+		if err := conn.ApplyPreset(&spec); err != nil {
+			raw.Close()
+			return nil, err
+		}
+		if err := conn.HandshakeContext(ctx); err != nil {
+			raw.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// http1Protocols is protocols without HTTP/2, or just HTTP/1.1 when that
+// leaves nothing.
+func http1Protocols(protocols []string) []string {
+	var out []string
+	for _, protocol := range protocols {
+		if protocol != "h2" {
+			out = append(out, protocol)
+		}
+	}
+	if len(out) == 0 {
+		return []string{"http/1.1"}
+	}
+	return out
+}
+
+// utlsConfig carries the verification settings of config over to uTLS.
+func utlsConfig(config *tls.Config, protocols []string) *utls.Config {
+	cfg := &utls.Config{
+		ServerName:            config.ServerName,
+		RootCAs:               config.RootCAs,
+		InsecureSkipVerify:    config.InsecureSkipVerify,
+		VerifyPeerCertificate: config.VerifyPeerCertificate,
+		NextProtos:            protocols,
+	}
+	if verify := config.VerifyConnection; verify != nil {
+		cfg.VerifyConnection = func(cs utls.ConnectionState) error {
+			return verify(tls.ConnectionState{
+				Version:                    cs.Version,
+				HandshakeComplete:          cs.HandshakeComplete,
+				DidResume:                  cs.DidResume,
+				CipherSuite:                cs.CipherSuite,
+				NegotiatedProtocol:         cs.NegotiatedProtocol,
+				NegotiatedProtocolIsMutual: cs.NegotiatedProtocolIsMutual,
+				ServerName:                 cs.ServerName,
+				PeerCertificates:           cs.PeerCertificates,
+				VerifiedChains:             cs.VerifiedChains,
+			})
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,127 @@
+// Package xpath evaluates XPath 1.0 expressions against documents parsed by
+// golang.org/x/net/html, the tree goquery documents wrap, so CSS and XPath
+// selectors can run against the same parsed page. Expressions are compiled
+// and evaluated by github.com/antchfx/xpath through htmlquery's navigator.
+package xpath
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+)
+
+// Expr is a compiled XPath expression. Evaluating it keeps state in the
+// expression, so concurrent callers should compile their own.
+type Expr struct {
+	expr *xpath.Expr
+}
+
+// Compile parses expr.
+func Compile(expr string) (*Expr, error) {
+	compiled, err := xpath.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("xpath %q: %w", expr, err)
+	}
+	return &Expr{expr: compiled}, nil
+}
+
+// MustCompile is like Compile but panics if expr cannot be parsed.
+func MustCompile(expr string) *Expr {
+	e, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+func (e *Expr) String() string {
+	return e.expr.String()
+}
+
+// Select evaluates e with root as the context node and returns the nodes
+// it selects. Forward axes yield them in document order; reverse axes and
+// unions in the order they are found. Attribute nodes, which html.Node cannot
+// represent, are returned as detached elements named after the attribute
+// with its value as their text. Expressions that do not evaluate to a node
+// set select nothing.
+func (e *Expr) Select(root *html.Node) []*html.Node {
+	iter, ok := e.expr.Evaluate(htmlquery.CreateXPathNavigator(root)).(*xpath.NodeIterator)
+	if !ok {
+		return nil
+	}
+	var nodes []*html.Node
+	for iter.MoveNext() {
+		nodes = append(nodes, currentNode(iter.Current().(*htmlquery.NodeNavigator)))
+	}
+	return nodes
+}
+
+// Evaluate evaluates e with root as the context node. The result is a
+// string, float64, bool or, for node sets, the []*html.Node Select returns.
+func (e *Expr) Evaluate(root *html.Node) interface{} {
+	v := e.expr.Evaluate(htmlquery.CreateXPathNavigator(root))
+	iter, ok := v.(*xpath.NodeIterator)
+	if !ok {
+		return v
+	}
+	nodes := []*html.Node{}
+	for iter.MoveNext() {
+		nodes = append(nodes, currentNode(iter.Current().(*htmlquery.NodeNavigator)))
+	}
+	return nodes
+}
+
+// Text evaluates e with root as the context node and returns its XPath
+// string value: the text of the first node selected, or the scalar result
+// of expressions such as count(//a) or string(//title).
+func (e *Expr) Text(root *html.Node) string {
+	switch v := e.expr.Evaluate(htmlquery.CreateXPathNavigator(root)).(type) {
+	case *xpath.NodeIterator:
+		if v.MoveNext() {
+			return v.Current().Value()
+		}
+		return ""
+	case string:
+		return v
+	case float64:
+		return formatNumber(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// InnerText returns the XPath string value of n: the concatenated text of
+// every text node below it, or the data of a text or comment node.
+func InnerText(n *html.Node) string {
+	if n.Type == html.CommentNode {
+		return n.Data
+	}
+	return htmlquery.InnerText(n)
+}
+
+// currentNode is the node nav is on, with attributes detached as described
+// for Select.
+func currentNode(nav *htmlquery.NodeNavigator) *html.Node {
+	if nav.NodeType() != xpath.AttributeNode {
+		return nav.Current()
+	}
+	text := &html.Node{Type: html.TextNode, Data: nav.Value()}
+	return &html.Node{
+		Type:       html.ElementNode,
+		Data:       nav.LocalName(),
+		FirstChild: text,
+		LastChild:  text,
+	}
+}
+
+func formatNumber(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,163 @@
+package xpath_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+
+	"github.com/ramusaaa/goscraper/pkg/xpath"
+)
+
+const fixture = `<html><head><title>Catalog</title></head><body>
+<ul id="list">
+	<li class="item first" data-sku="A1"><a href="/a">Alpha</a><span>10</span></li>
+	<li class="item" data-sku="B2"><a href="/b">Beta</a><span>25</span></li>
+	<!-- sold out -->
+	<li class="item last" data-sku="C3"><a href="/c">Gamma</a><span>40</span></li>
+</ul>
+<p id="note">  Prices   in <b>EUR</b>  </p>
+</body></html>`
+
+func parseFixture(t *testing.T) *html.Node {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// texts joins the trimmed string values of nodes.
+func texts(nodes []*html.Node) string {
+	var out []string
+	for _, n := range nodes {
+		out = append(out, strings.TrimSpace(xpath.InnerText(n)))
+	}
+	return strings.Join(out, "|")
+}
+
+func TestSelect(t *testing.T) {
+	doc := parseFixture(t)
+
+	for _, tc := range []struct {
+		name, expr, want string
+	}{
+		{"child path", "/html/body/ul/li/a", "Alpha|Beta|Gamma"},
+		{"descendant", "//a", "Alpha|Beta|Gamma"},
+		{"wildcard", "//li/*[1]", "Alpha|Beta|Gamma"},
+		{"attribute", "//li/@data-sku", "A1|B2|C3"},
+		{"attribute wildcard", "//a[1]/@*", "/a|/b|/c"},
+		{"self", "//span/self::span", "10|25|40"},
+		{"parent", "//a[.='Beta']/..", "Beta25"},
+		{"parent axis", "//span[.='40']/parent::li/@data-sku", "C3"},
+		{"ancestor", "//b/ancestor::*[@id]/@id", "note"},
+		{"ancestor-or-self", "//li[1]/ancestor-or-self::ul/@id", "list"},
+		{"descendant-or-self", "//ul/descendant-or-self::span", "10|25|40"},
+		{"following-sibling", "//li[1]/following-sibling::li/a", "Beta|Gamma"},
+		{"preceding-sibling", "//li[3]/preceding-sibling::li/a", "Beta|Alpha"},
+		{"text", "//li/a/text()", "Alpha|Beta|Gamma"},
+		{"comment", "//ul/comment()", "sold out"},
+		{"position predicate", "//li[2]/a", "Beta"},
+		{"last", "//li[last()]/a", "Gamma"},
+		{"position function", "//li[position() > 1]/a", "Beta|Gamma"},
+		{"nested predicates", "//li[a[starts-with(., 'G')]]/span", "40"},
+		{"number comparison", "//li[span >= 25]/a", "Beta|Gamma"},
+		{"string comparison", "//li[@data-sku != 'B2']/a", "Alpha|Gamma"},
+		{"and", "//li[span > 5 and span < 30]/a", "Alpha|Beta"},
+		{"or", "//li[@data-sku = 'A1' or @data-sku = 'C3']/a", "Alpha|Gamma"},
+		{"not", "//li[not(contains(@class, 'first'))]/a", "Beta|Gamma"},
+		{"union", "//li[3]/a | //li[1]/a", "Gamma|Alpha"},
+		{"union without duplicates", "//li/a | //a", "Alpha|Beta|Gamma"},
+		{"filter expression", "(//a)[2]", "Beta"},
+		{"class token", "//li[contains(concat(' ', @class, ' '), ' last ')]/a", "Gamma"},
+		{"no match", "//table", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expr, err := xpath.Compile(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := texts(expr.Select(doc)); got != tc.want {
+				t.Errorf("%s: expected %q, got %q", tc.expr, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateScalars(t *testing.T) {
+	doc := parseFixture(t)
+
+	for _, tc := range []struct {
+		expr string
+		want interface{}
+	}{
+		{"count(//li)", 3.0},
+		{"count(//li[span > 20])", 2.0},
+		{"string(//title)", "Catalog"},
+		{"string(//li/@data-sku)", "A1"},
+		{"name(//ul/*[1])", "li"},
+		{"concat(//li[1]/a, '-', //li[1]/@data-sku)", "Alpha-A1"},
+		{"substring-before('12.50 EUR', ' ')", "12.50"},
+		{"substring-after('12.50 EUR', ' ')", "EUR"},
+		{"string-length(//li[2]/a)", 4.0},
+		{"normalize-space(//p)", "Prices in EUR"},
+		{"translate('a-b-c', '-', '')", "abc"},
+		{"number(//li[3]/span)", 40.0},
+		{"ends-with(//li[1]/a/@href, '/a')", true},
+		{"boolean(//table)", false},
+		{"//li[1]/span < //li[2]/span", true},
+		{"true() and not(false())", true},
+	} {
+		expr, err := xpath.Compile(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		if got := expr.Evaluate(doc); got != tc.want {
+			t.Errorf("%s: expected %#v, got %#v", tc.expr, tc.want, got)
+		}
+	}
+
+	if got := xpath.MustCompile("number('n/a')").Evaluate(doc); !math.IsNaN(got.(float64)) {
+		t.Errorf("expected NaN for a non-numeric string, got %v", got)
+	}
+	if got := xpath.MustCompile("count(//a)").Select(doc); len(got) != 0 {
+		t.Errorf("expected a scalar expression to select no nodes, got %d", len(got))
+	}
+}
+
+func TestText(t *testing.T) {
+	doc := parseFixture(t)
+
+	for expr, want := range map[string]string{
+		"//li/a":            "Alpha",
+		"//li[2]/@data-sku": "B2",
+		"count(//a)":        "3",
+		"1 = 1":             "true",
+		"//li[1]/span > 5":  "true",
+		"string(//title)":   "Catalog",
+		"//table":           "",
+	} {
+		if got := xpath.MustCompile(expr).Text(doc); got != want {
+			t.Errorf("%s: expected %q, got %q", expr, want, got)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		"//div[",
+		"//div[@class='x'",
+		"count(",
+		"unknown-function(//a)",
+		"'unterminated",
+		"//li[1] //",
+		"$variable",
+	} {
+		if _, err := xpath.Compile(expr); err == nil {
+			t.Errorf("expected %q not to compile", expr)
+		}
+	}
+}
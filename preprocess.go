@@ -0,0 +1,33 @@
+package goscraper
+
+import (
+	"regexp"
+	"strings"
+)
+
+// HTMLPreprocessor rewrites a page's HTML before it is parsed, e.g. to fix
+// markup the parser would otherwise misread, strip problematic sections or
+// inject a <base> tag. Response.Body is left as fetched.
+type HTMLPreprocessor func(html string) string
+
+var nbspEntityRe = regexp.MustCompile(`(?i)&(?:amp;)?nbsp;?`)
+
+// FixCommonHTML is the preprocessor every scraper runs first. It removes
+// byte order marks, which some CMSes leave in the middle of pages, and NUL
+// bytes, and repairs non-breaking space entities that are double-escaped,
+// upper-cased or missing their semicolon.
+func FixCommonHTML(html string) string {
+	html = strings.ReplaceAll(html, "\ufeff", "")
+	html = strings.ReplaceAll(html, "\x00", "")
+	if strings.Contains(html, "&") {
+		html = nbspEntityRe.ReplaceAllString(html, "&nbsp;")
+	}
+	return html
+}
+
+func (c *Config) preprocessHTML(html string) string {
+	for _, preprocess := range c.HTMLPreprocessors {
+		html = preprocess(html)
+	}
+	return html
+}
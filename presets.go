@@ -14,7 +14,6 @@ func EcommercePreset() []Option {
 		WithHeaders(map[string]string{
 			"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8",
 			"Accept-Language": "tr-TR,tr;q=0.9,en-US;q=0.8,en;q=0.7",
-			"Accept-Encoding": "gzip, deflate, br",
 			"DNT":             "1",
 			"Connection":      "keep-alive",
 			"Sec-Fetch-Dest":  "document",
@@ -0,0 +1,94 @@
+package goscraper
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyBan is a proxy that was blocked by a host and is not used for that
+// host again until Until.
+type ProxyBan struct {
+	Proxy string    `json:"proxy"`
+	Host  string    `json:"host"`
+	Until time.Time `json:"until"`
+}
+
+type proxyBanKey struct {
+	proxy string
+	host  string
+}
+
+// proxyBans tracks (proxy, host) pairs that got blocked. A proxy banned on
+// one site stays in rotation for every other site.
+type proxyBans struct {
+	cooldown time.Duration
+
+	mu   sync.Mutex
+	bans map[proxyBanKey]time.Time
+}
+
+func newProxyBans(cooldown time.Duration) *proxyBans {
+	return &proxyBans{
+		cooldown: cooldown,
+		bans:     make(map[proxyBanKey]time.Time),
+	}
+}
+
+func (b *proxyBans) ban(proxy *url.URL, host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bans[proxyBanKey{proxy.String(), strings.ToLower(host)}] = time.Now().Add(b.cooldown)
+}
+
+func (b *proxyBans) banned(proxy *url.URL, host string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := proxyBanKey{proxy.String(), strings.ToLower(host)}
+	until, ok := b.bans[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(b.bans, key)
+		return false
+	}
+	return true
+}
+
+func (b *proxyBans) active() []ProxyBan {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	var bans []ProxyBan
+	for key, until := range b.bans {
+		if now.After(until) {
+			delete(b.bans, key)
+			continue
+		}
+		proxy := key.proxy
+		if u, err := url.Parse(proxy); err == nil {
+			proxy = u.Redacted()
+		}
+		bans = append(bans, ProxyBan{Proxy: proxy, Host: key.host, Until: until})
+	}
+
+	sort.Slice(bans, func(i, j int) bool {
+		if bans[i].Host != bans[j].Host {
+			return bans[i].Host < bans[j].Host
+		}
+		return bans[i].Proxy < bans[j].Proxy
+	})
+	return bans
+}
+
+// isBanResponse reports whether resp looks like the site refusing this
+// client rather than failing on its own.
+func isBanResponse(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests
+}
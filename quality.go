@@ -0,0 +1,124 @@
+package goscraper
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ExtractionHook receives the outcome of every ExtractSmart call.
+// *monitoring.Metrics satisfies it.
+type ExtractionHook interface {
+	RecordExtraction(contentType string, success bool, confidence float64)
+	RecordExtractionError(contentType, field string)
+}
+
+// SetExtractionHook reports extraction success, confidence and the fields
+// that are missing or fail validation to hook, e.g. to alert when a site
+// layout change breaks selectors.
+func (se *SmartExtractor) SetExtractionHook(hook ExtractionHook) {
+	se.hook = hook
+}
+
+func (se *SmartExtractor) reportExtraction(data *SmartData) {
+	if se.hook == nil {
+		return
+	}
+
+	confidence, failed := extractionQuality(data)
+	contentType := string(data.ContentType)
+
+	se.hook.RecordExtraction(contentType, confidence >= 0.5, confidence)
+	for _, field := range failed {
+		se.hook.RecordExtractionError(contentType, field)
+	}
+}
+
+// extractionQuality scores an extraction by the share of key fields for its
+// content type that were populated with a valid value, and returns the
+// names of those missing or invalid. Values fail validation when they can't
+// be what the field holds, as when a selector lands on the wrong element.
+func extractionQuality(data *SmartData) (float64, []string) {
+	fields := map[string]bool{}
+
+	switch data.ContentType {
+	case ContentTypeEcommerce:
+		fields["products"] = len(data.Products) > 0
+		if len(data.Products) > 0 {
+			fields["product_name"] = data.Products[0].Name != ""
+			fields["product_price"] = validPrice(data.Products[0].Price)
+		}
+	case ContentTypeNews:
+		if a := data.Article; a != nil {
+			fields["headline"] = a.Headline != ""
+			fields["content"] = a.Content != ""
+			fields["author"] = a.Author != ""
+			fields["publish_date"] = a.PublishDate != ""
+		}
+	case ContentTypeBlog:
+		if b := data.BlogPost; b != nil {
+			fields["title"] = b.Title != ""
+			fields["content"] = b.Content != ""
+			fields["author"] = b.Author != ""
+		}
+	case ContentTypeJob:
+		if j := data.JobListing; j != nil {
+			fields["title"] = j.Title != ""
+			fields["company"] = j.Company != ""
+			fields["location"] = j.Location != ""
+			fields["description"] = j.Description != ""
+		}
+	case ContentTypeRealEstate:
+		if p := data.Property; p != nil {
+			fields["title"] = p.Title != ""
+			fields["price"] = validPrice(p.Price)
+			fields["location"] = p.Location != ""
+		}
+	case ContentTypeRecipe:
+		if r := data.Recipe; r != nil {
+			fields["name"] = r.Name != ""
+			fields["ingredients"] = len(r.Ingredients) > 0
+			fields["instructions"] = len(r.Instructions) > 0
+		}
+	case ContentTypeEvent:
+		if e := data.Event; e != nil {
+			fields["name"] = e.Name != ""
+			fields["date"] = e.Date != ""
+			fields["venue"] = e.Venue != ""
+		}
+	case ContentTypeVideo:
+		if v := data.Video; v != nil {
+			fields["title"] = v.Title != ""
+			fields["url"] = validAbsoluteURL(v.URL)
+			fields["thumbnail"] = v.Thumbnail != ""
+		}
+	default:
+		fields["title"] = data.Title != ""
+		fields["description"] = data.Description != ""
+	}
+
+	if len(fields) == 0 {
+		return 0, nil
+	}
+
+	found := 0
+	var failed []string
+	for name, ok := range fields {
+		if ok {
+			found++
+		} else {
+			failed = append(failed, name)
+		}
+	}
+
+	return float64(found) / float64(len(fields)), failed
+}
+
+// validPrice reports whether price holds an amount.
+func validPrice(price string) bool {
+	return strings.ContainsAny(price, "0123456789")
+}
+
+func validAbsoluteURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,53 @@
+package goscraper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimiter is a token bucket shared by every request of a Client: it
+// holds up to burst tokens and gains one every interval. Waiters are served
+// in arrival order, so concurrent callers are spaced evenly.
+type rateLimiter struct {
+	limiter *rate.Limiter
+}
+
+// newRateLimiter returns nil, meaning unlimited, when interval is not positive.
+func newRateLimiter(interval time.Duration, burst int) *rateLimiter {
+	if interval <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{limiter: rate.NewLimiter(rate.Every(interval), burst)}
+}
+
+// wait blocks until a token is available and returns how long that took.
+// If ctx is done first, or its deadline comes before the token would, the
+// token is handed back and an error wrapping ctx's is returned.
+func (l *rateLimiter) wait(ctx context.Context) (time.Duration, error) {
+	if l == nil {
+		return 0, ctx.Err()
+	}
+
+	start := time.Now()
+	if err := l.limiter.Wait(ctx); err != nil {
+		// Wait gives up without waiting when the deadline is too close.
+		if ctx.Err() == nil {
+			if _, ok := ctx.Deadline(); ok {
+				return 0, fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+			}
+		}
+		return 0, err
+	}
+	// An available token still takes a moment to hand out; that is not
+	// reported as waiting.
+	if waited := time.Since(start); waited >= time.Millisecond {
+		return waited, nil
+	}
+	return 0, nil
+}
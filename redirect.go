@@ -0,0 +1,106 @@
+package goscraper
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RedirectPolicy decides which redirects the client follows, on top of the
+// overall MaxRedirects limit. The zero value follows redirects to any host.
+type RedirectPolicy struct {
+	sameHostOnly bool
+	maxPerHost   int
+}
+
+var (
+	// SameHostOnly stops at the first redirect that leaves the original host.
+	SameHostOnly = RedirectPolicy{sameHostOnly: true}
+	// AllowCrossHost follows redirects to any host.
+	AllowCrossHost = RedirectPolicy{}
+)
+
+// MaxPerHost allows cross-host redirects but stops once the chain visits the
+// same host more than n times, which catches redirect loops through trackers.
+func MaxPerHost(n int) RedirectPolicy {
+	return RedirectPolicy{maxPerHost: n}
+}
+
+func (p RedirectPolicy) String() string {
+	switch {
+	case p.sameHostOnly:
+		return "same-host-only"
+	case p.maxPerHost > 0:
+		return fmt.Sprintf("max-%d-per-host", p.maxPerHost)
+	default:
+		return "allow-cross-host"
+	}
+}
+
+// RedirectPolicyError is returned when a redirect violates the configured
+// RedirectPolicy. Chain holds every URL requested, ending with the rejected
+// redirect target.
+type RedirectPolicyError struct {
+	Policy RedirectPolicy
+	Chain  []string
+}
+
+func (e *RedirectPolicyError) Error() string {
+	return fmt.Sprintf("redirect to %s violates %s policy (chain: %s)",
+		e.Chain[len(e.Chain)-1], e.Policy, strings.Join(e.Chain, " -> "))
+}
+
+func (p RedirectPolicy) check(req *http.Request, via []*http.Request) error {
+	host := strings.ToLower(req.URL.Hostname())
+
+	violated := false
+	switch {
+	case p.sameHostOnly:
+		violated = host != strings.ToLower(via[0].URL.Hostname())
+	case p.maxPerHost > 0:
+		visits := 1
+		for _, prev := range via {
+			if strings.ToLower(prev.URL.Hostname()) == host {
+				visits++
+			}
+		}
+		violated = visits > p.maxPerHost
+	}
+	if !violated {
+		return nil
+	}
+
+	chain := make([]string, 0, len(via)+1)
+	for _, prev := range via {
+		chain = append(chain, prev.URL.String())
+	}
+	chain = append(chain, req.URL.String())
+	return &RedirectPolicyError{Policy: p, Chain: chain}
+}
+
+// redirectChain lists the URLs that led to resp, oldest first, or nil when
+// the request was not redirected.
+func redirectChain(resp *http.Response) []string {
+	if resp.Request == nil || resp.Request.Response == nil {
+		return nil
+	}
+
+	var chain []string
+	for req := resp.Request; req != nil; {
+		chain = append([]string{req.URL.String()}, chain...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	return chain
+}
+
+// finalURL is the URL resp was served from: the last one of its redirect
+// chain, or the requested URL when there was no redirect.
+func finalURL(resp *Response) string {
+	if n := len(resp.RedirectChain); n > 0 {
+		return resp.RedirectChain[n-1]
+	}
+	return resp.URL
+}
@@ -0,0 +1,87 @@
+package goscraper
+
+import (
+	"context"
+	"net/url"
+)
+
+// RefererPolicy decides how much of the referring page's URL is sent in the
+// Referer header, like a page's Referrer-Policy does in a browser. The zero
+// value is RefererStrictOriginWhenCrossOrigin, the browsers' default.
+type RefererPolicy string
+
+const (
+	// RefererStrictOriginWhenCrossOrigin sends the full URL to the same
+	// origin, only the origin to others, and nothing from HTTPS to HTTP.
+	RefererStrictOriginWhenCrossOrigin RefererPolicy = ""
+	// RefererNoReferrer never sends a Referer.
+	RefererNoReferrer RefererPolicy = "no-referrer"
+	// RefererSameOrigin sends the full URL to the same origin and nothing
+	// to others.
+	RefererSameOrigin RefererPolicy = "same-origin"
+	// RefererStrictOrigin sends only the origin, and nothing from HTTPS to
+	// HTTP.
+	RefererStrictOrigin RefererPolicy = "strict-origin"
+)
+
+type refererContextKey struct{}
+
+// ContextWithReferer returns a context whose requests are sent as if
+// following a link on the page at referer, which overrides WithReferer.
+// Crawler does this for every page it finds a link on.
+func ContextWithReferer(ctx context.Context, referer string) context.Context {
+	return context.WithValue(ctx, refererContextKey{}, referer)
+}
+
+// refererFor returns the Referer header a request to target made from ctx
+// carries, or "" if it has none.
+func (c *Client) refererFor(ctx context.Context, target *url.URL) string {
+	referer := c.config.Referer
+	if fromCtx, ok := ctx.Value(refererContextKey{}).(string); ok {
+		referer = fromCtx
+	}
+	if referer == "" {
+		return ""
+	}
+
+	from, err := url.Parse(referer)
+	if err != nil || (from.Scheme != "http" && from.Scheme != "https") || from.Host == "" {
+		return ""
+	}
+	return c.config.RefererPolicy.referer(from, target)
+}
+
+// referer applies the policy to a request from the page at from to target.
+func (p RefererPolicy) referer(from, target *url.URL) string {
+	sameOrigin := from.Scheme == target.Scheme && from.Host == target.Host
+	downgrade := from.Scheme == "https" && target.Scheme != "https"
+
+	full := *from
+	full.User = nil
+	full.Fragment = ""
+	full.RawFragment = ""
+	origin := url.URL{Scheme: from.Scheme, Host: from.Host, Path: "/"}
+
+	switch p {
+	case RefererNoReferrer:
+		return ""
+	case RefererSameOrigin:
+		if sameOrigin {
+			return full.String()
+		}
+		return ""
+	case RefererStrictOrigin:
+		if downgrade {
+			return ""
+		}
+		return origin.String()
+	}
+
+	switch {
+	case sameOrigin:
+		return full.String()
+	case downgrade:
+		return ""
+	}
+	return origin.String()
+}
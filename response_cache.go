@@ -0,0 +1,150 @@
+package goscraper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.uber.org/zap"
+)
+
+// responseCacheHeaders are the request headers that can change what a site
+// sends back, and so are part of a response's cache key.
+var responseCacheHeaders = []string{"Accept", "Accept-Language", "Authorization", "Cookie"}
+
+// cachedResponse is what WithCache stores for a Response. The document is
+// parsed again from Body on a hit.
+type cachedResponse struct {
+	URL           string      `json:"url"`
+	FinalURL      string      `json:"final_url"`
+	StatusCode    int         `json:"status_code"`
+	Headers       http.Header `json:"headers"`
+	Body          string      `json:"body"`
+	RedirectChain []string    `json:"redirect_chain,omitempty"`
+}
+
+// responseCacheKey returns the key a request is cached under, and false if
+// the request must not be cached: only GETs without a body are, unless the
+// request asks for no-store.
+func (s *DefaultScraper) responseCacheKey(method, rawURL string, body io.Reader, headers map[string]string) (string, bool) {
+	if s.config.Cache == nil || method != http.MethodGet || body != nil {
+		return "", false
+	}
+
+	merged := make(http.Header)
+	for key, value := range s.config.Headers {
+		merged.Set(key, value)
+	}
+	for key, value := range headers {
+		merged.Set(key, value)
+	}
+	if hasNoStore(merged) {
+		return "", false
+	}
+
+	// Header values are hashed so credentials never end up in key names.
+	hash := sha256.New()
+	for _, name := range responseCacheHeaders {
+		hash.Write([]byte(name + ": " + merged.Get(name) + "\n"))
+	}
+	return "goscraper:response:" + method + ":" + rawURL + ":" + hex.EncodeToString(hash.Sum(nil))[:16], true
+}
+
+// cachedResponse returns the Response stored under key, or nil on a miss.
+// Cache failures count as misses.
+func (s *DefaultScraper) cachedResponse(ctx context.Context, key string) *Response {
+	item, err := s.config.Cache.Get(ctx, key)
+	if err == nil {
+		var cached cachedResponse
+		if err = decodeCachedResponse(item.Value, &cached); err == nil {
+			if resp, err := cached.response(); err == nil {
+				if s.config.Metrics != nil {
+					s.config.Metrics.RecordCacheHit("response")
+				}
+				return resp
+			}
+		}
+	}
+
+	if s.config.Metrics != nil {
+		s.config.Metrics.RecordCacheMiss("response")
+	}
+	return nil
+}
+
+// cacheResponse stores a successful response for the WithCache TTL, unless
+// the site marked it no-store.
+func (s *DefaultScraper) cacheResponse(ctx context.Context, key string, resp *Response) {
+	if resp.StatusCode >= 300 || hasNoStore(resp.Headers) {
+		return
+	}
+
+	cached := &cachedResponse{
+		URL:           resp.URL,
+		StatusCode:    resp.StatusCode,
+		Headers:       resp.Headers.Clone(),
+		Body:          resp.Body,
+		RedirectChain: resp.RedirectChain,
+	}
+	if resp.Document != nil && resp.Document.Url != nil {
+		cached.FinalURL = resp.Document.Url.String()
+	}
+
+	if err := s.config.Cache.Set(ctx, key, cached, s.config.CacheTTL); err != nil {
+		s.client.logger().Warn("Failed to cache response", zap.String("url", resp.URL), zap.Error(err))
+	}
+}
+
+func (c *cachedResponse) response() (*Response, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(c.Body))
+	if err != nil {
+		return nil, err
+	}
+	finalURL := c.FinalURL
+	if finalURL == "" {
+		finalURL = c.URL
+	}
+	if doc.Url, err = url.Parse(finalURL); err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		URL:           c.URL,
+		StatusCode:    c.StatusCode,
+		Headers:       c.Headers.Clone(),
+		Body:          c.Body,
+		Document:      doc,
+		RedirectChain: c.RedirectChain,
+	}, nil
+}
+
+// decodeCachedResponse converts a cached value into out. Caches that
+// serialize values, like RedisCache, hand them back as decoded JSON.
+func decodeCachedResponse(value interface{}, out *cachedResponse) error {
+	if cached, ok := value.(*cachedResponse); ok {
+		*out = *cached
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func hasNoStore(header http.Header) bool {
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+				return true
+			}
+		}
+	}
+	return false
+}
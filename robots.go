@@ -0,0 +1,344 @@
+package goscraper
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ramusaaa/goscraper/internal"
+)
+
+// ErrDisallowedByRobots is returned, wrapped in a *RobotsDisallowedError,
+// when WithRespectRobots is set and robots.txt disallows a URL.
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// RobotsDisallowedError names the URL and the rule that excluded it.
+type RobotsDisallowedError struct {
+	URL       string
+	UserAgent string
+	Rule      string
+}
+
+func (e *RobotsDisallowedError) Error() string {
+	return fmt.Sprintf("%s is disallowed by robots.txt for %q (Disallow: %s)", e.URL, e.UserAgent, e.Rule)
+}
+
+func (e *RobotsDisallowedError) Unwrap() error {
+	return ErrDisallowedByRobots
+}
+
+const (
+	robotsTTL      = 24 * time.Hour
+	robotsRetryTTL = time.Minute
+	robotsMaxSize  = 500 << 10
+)
+
+// robotsRule is one Allow or Disallow line.
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// robotsGroup holds the rules for the user agents named above them.
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsTxt struct {
+	groups []*robotsGroup
+}
+
+// parseRobots reads robots.txt as described in RFC 9309. Consecutive
+// User-agent lines share one group, and Crawl-delay, which the RFC leaves
+// out, is read in seconds as most crawlers do.
+func parseRobots(r io.Reader) *robotsTxt {
+	robots := &robotsTxt{}
+	var group *robotsGroup
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				group = &robotsGroup{}
+				robots.groups = append(robots.groups, group)
+				inAgents = true
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			if group == nil || value == "" {
+				// An empty Disallow allows everything, which is the default.
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value, re: robotsPattern(value)})
+		case "crawl-delay":
+			inAgents = false
+			if group == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				group.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	return robots
+}
+
+// group picks the group for userAgent: the one naming the longest agent
+// token contained in it, falling back to "*".
+func (r *robotsTxt) group(userAgent string) *robotsGroup {
+	userAgent = strings.ToLower(userAgent)
+
+	var best, wildcard *robotsGroup
+	bestLen := 0
+	for _, group := range r.groups {
+		for _, agent := range group.agents {
+			switch {
+			case agent == "*":
+				if wildcard == nil {
+					wildcard = group
+				}
+			case len(agent) > bestLen && strings.Contains(userAgent, agent):
+				best, bestLen = group, len(agent)
+			}
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return wildcard
+}
+
+// disallowedBy returns the Disallow rule that excludes path for userAgent,
+// or "" when it is allowed. The longest matching rule wins and Allow wins
+// ties, as in RFC 9309.
+func (r *robotsTxt) disallowedBy(userAgent, path string) string {
+	group := r.group(userAgent)
+	if group == nil {
+		return ""
+	}
+
+	var match *robotsRule
+	for i, rule := range group.rules {
+		if !rule.matches(path) {
+			continue
+		}
+		if match == nil || len(rule.pattern) > len(match.pattern) ||
+			(len(rule.pattern) == len(match.pattern) && rule.allow) {
+			match = &group.rules[i]
+		}
+	}
+	if match == nil || match.allow {
+		return ""
+	}
+	return match.pattern
+}
+
+func (r *robotsTxt) crawlDelay(userAgent string) time.Duration {
+	if group := r.group(userAgent); group != nil {
+		return group.crawlDelay
+	}
+	return 0
+}
+
+// robotsPattern compiles a robots.txt path pattern, where * matches any run
+// of characters and a trailing $ anchors the end of the path. Plain
+// prefixes, by far the most common, are left uncompiled.
+func robotsPattern(pattern string) *regexp.Regexp {
+	if !strings.ContainsAny(pattern, "*$") {
+		return nil
+	}
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+func (r robotsRule) matches(path string) bool {
+	if r.re != nil {
+		return r.re.MatchString(path)
+	}
+	return strings.HasPrefix(path, r.pattern)
+}
+
+type robotsEntry struct {
+	robots    *robotsTxt
+	expires   time.Time
+	nextVisit time.Time
+}
+
+// robotsCache keeps the parsed robots.txt of every origin visited.
+type robotsCache struct {
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{entries: make(map[string]*robotsEntry)}
+}
+
+// get returns the robots.txt for u's origin, fetching it with client when it
+// is missing or stale. Following RFC 9309, a missing robots.txt (4xx)
+// allows everything while an unreachable one (5xx or a network error)
+// disallows everything; the latter is retried sooner. Only ctx ending makes
+// it fail.
+func (c *robotsCache) get(ctx context.Context, client *http.Client, u *url.URL, userAgent string) (*robotsTxt, error) {
+	origin := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	entry, ok := c.entries[origin]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.robots, nil
+	}
+
+	robots, ttl := fetchRobots(ctx, client, origin, userAgent)
+	if ctx.Err() != nil {
+		// Not the site's fault, so don't remember it as unreachable.
+		return nil, ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok = c.entries[origin]; ok {
+		entry.robots, entry.expires = robots, time.Now().Add(ttl)
+	} else {
+		c.entries[origin] = &robotsEntry{robots: robots, expires: time.Now().Add(ttl)}
+	}
+	return robots, nil
+}
+
+func fetchRobots(ctx context.Context, client *http.Client, origin, userAgent string) (*robotsTxt, time.Duration) {
+	disallowAll := &robotsTxt{groups: []*robotsGroup{{
+		agents: []string{"*"},
+		rules:  []robotsRule{{pattern: "/"}},
+	}}}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", origin+"/robots.txt", nil)
+	if err != nil {
+		return disallowAll, robotsRetryTTL
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return disallowAll, robotsRetryTTL
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseRobots(io.LimitReader(resp.Body, robotsMaxSize)), robotsTTL
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return &robotsTxt{}, robotsTTL
+	default:
+		return disallowAll, robotsRetryTTL
+	}
+}
+
+// waitCrawlDelay spaces requests to u's origin by delay.
+func (c *robotsCache) waitCrawlDelay(ctx context.Context, u *url.URL, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	entry := c.entries[u.Scheme+"://"+u.Host]
+	if entry == nil {
+		c.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	visit := entry.nextVisit
+	if visit.Before(now) {
+		visit = now
+	}
+	entry.nextVisit = visit.Add(delay)
+	c.mu.Unlock()
+
+	return internal.SleepContext(ctx, visit.Sub(now))
+}
+
+// checkRobots enforces WithRespectRobots for rawURL: it fails with a
+// *RobotsDisallowedError for excluded URLs and otherwise waits out the
+// site's Crawl-delay.
+func (c *Client) checkRobots(ctx context.Context, rawURL, userAgent string) error {
+	if c.robots == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+
+	robots, err := c.robots.get(ctx, c.httpClient, u, userAgent)
+	if err != nil {
+		return err
+	}
+	if rule := robots.disallowedBy(userAgent, u.EscapedPath()+queryString(u)); rule != "" {
+		return &RobotsDisallowedError{URL: rawURL, UserAgent: userAgent, Rule: rule}
+	}
+	return c.robots.waitCrawlDelay(ctx, u, robots.crawlDelay(userAgent))
+}
+
+func queryString(u *url.URL) string {
+	if u.RawQuery == "" {
+		return ""
+	}
+	return "?" + u.RawQuery
+}
+
+// CrawlDelay returns the Crawl-delay robots.txt sets for the configured
+// User-Agent on rawURL's site, fetching robots.txt if needed. Requests made
+// with WithRespectRobots already wait it out.
+func (c *Client) CrawlDelay(ctx context.Context, rawURL string) (time.Duration, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid URL %s: %w", rawURL, err)
+	}
+	cache := c.robots
+	if cache == nil {
+		cache = newRobotsCache()
+	}
+	robots, err := cache.get(ctx, c.httpClient, u, c.config.UserAgent)
+	if err != nil {
+		return 0, err
+	}
+	return robots.crawlDelay(c.config.UserAgent), nil
+}
+
+// CrawlDelay returns the Crawl-delay robots.txt sets for the scraper on
+// rawURL's site.
+func (s *DefaultScraper) CrawlDelay(ctx context.Context, rawURL string) (time.Duration, error) {
+	return s.client.CrawlDelay(ctx, rawURL)
+}
@@ -0,0 +1,50 @@
+package goscraper
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/ramusaaa/goscraper/pkg/ai"
+)
+
+// ErrNoModel is returned by ExtractWithSchema for options that ask for AI
+// extraction without allowing FallbackToCSS, as it has no model to use.
+var ErrNoModel = errors.New("schema extraction has no AI model")
+
+// ExtractWithSchema runs a declarative ai.ExtractionSchema against the
+// parsed document of resp using its CSS selectors. Post-processing rules run
+// before validation so rules are checked against the cleaned values; fields
+// failing validation are dropped, and every failure is listed in the
+// result's Errors. No AI model or API key is involved: opts asking for a
+// model fail with ErrNoModel unless they allow FallbackToCSS, and other
+// options are ignored. For model extraction, call Extract on an
+// ai.AIExtractor configured with one.
+func ExtractWithSchema(resp *Response, schema *ai.ExtractionSchema, opts *ai.ExtractionOptions) (*ai.ExtractionResult, error) {
+	if resp == nil {
+		return nil, errors.New("no response to extract from")
+	}
+	if schema == nil {
+		return nil, ErrNoSchema
+	}
+	if opts != nil && opts.UseAI && !opts.FallbackToCSS {
+		return nil, ErrNoModel
+	}
+
+	doc, err := schemaDocument(resp)
+	if err != nil {
+		return nil, err
+	}
+	result, _ := ai.ExtractWithCSS(doc, schema)
+	return result, nil
+}
+
+// schemaDocument returns the parsed document of resp, parsing the body of
+// responses that were not parsed as HTML.
+func schemaDocument(resp *Response) (*goquery.Document, error) {
+	if resp.Document != nil {
+		return resp.Document, nil
+	}
+	return goquery.NewDocumentFromReader(strings.NewReader(resp.Body))
+}
@@ -0,0 +1,91 @@
+package goscraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ramusaaa/goscraper/internal"
+	"github.com/ramusaaa/goscraper/pkg/ai"
+)
+
+// ErrNoSchema is returned when schema extraction is requested before any
+// schema has been loaded.
+var ErrNoSchema = errors.New("no extraction schema loaded")
+
+// SchemaSource serves an ai.ExtractionSchema loaded as JSON from a URL or a
+// local file, so selectors can be maintained in one place and picked up by
+// running scrapers without a redeploy. The schema is refreshed in the
+// background once it is older than the refresh interval. A fetched schema
+// only replaces the current one if it parses and passes Validate; otherwise
+// the previous schema stays in use and the failure is kept in LastError.
+type SchemaSource struct {
+	source *internal.RefreshableSource[*ai.ExtractionSchema]
+}
+
+func NewSchemaSource(source string, interval time.Duration) *SchemaSource {
+	return &SchemaSource{source: internal.NewRefreshableSource("schema", source, interval, parseSchema)}
+}
+
+func parseSchema(data []byte) (*ai.ExtractionSchema, error) {
+	var schema ai.ExtractionSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// Refresh loads the source synchronously, e.g. on startup. On failure the
+// previously loaded schema is kept.
+func (s *SchemaSource) Refresh(ctx context.Context) error {
+	return s.source.Refresh(ctx)
+}
+
+// Schema returns the current schema, or nil if none has loaded yet. The
+// returned schema is shared and must not be modified.
+func (s *SchemaSource) Schema() *ai.ExtractionSchema {
+	return s.source.Get()
+}
+
+// LastError reports why the most recent refresh failed, if it did.
+func (s *SchemaSource) LastError() error {
+	return s.source.LastError()
+}
+
+// SchemaSource returns the source configured with WithSchemaSource, or nil.
+func (s *DefaultScraper) SchemaSource() *SchemaSource {
+	return s.schemas
+}
+
+// ExtractWithSchema runs the schema configured with WithSchemaSource against
+// resp with CSS selectors, as the package-level ExtractWithSchema does, and
+// returns the fields kept along with every failure. It fails with
+// ErrNoSchema until a valid schema has been loaded.
+func (s *DefaultScraper) ExtractWithSchema(resp *Response) (map[string]interface{}, []error) {
+	if s.schemas == nil {
+		return nil, []error{ErrNoSchema}
+	}
+	schema := s.schemas.Schema()
+	if schema == nil {
+		// The first load runs in the background from New.
+		s.schemas.source.WaitFirstLoad(context.Background())
+		schema = s.schemas.Schema()
+	}
+	if schema == nil {
+		if err := s.schemas.LastError(); err != nil {
+			return nil, []error{fmt.Errorf("%w: %v", ErrNoSchema, err)}
+		}
+		return nil, []error{ErrNoSchema}
+	}
+	doc, err := schemaDocument(resp)
+	if err != nil {
+		return nil, []error{err}
+	}
+	result, errs := ai.ExtractWithCSS(doc, schema)
+	return result.Data, errs
+}
@@ -1,18 +1,30 @@
 package goscraper
 
 import (
-	"compress/gzip"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
 )
 
+var ErrDocumentTooComplex = fmt.Errorf("document too complex")
+
+// ErrResponseTooLarge is returned for response bodies over the
+// WithMaxResponseSize limit.
+var ErrResponseTooLarge = fmt.Errorf("response too large")
+
+// DefaultMaxResponseSize is the largest response body read by default.
+const DefaultMaxResponseSize = 50 << 20
+
 type Scraper interface {
 	Get(url string) (*Response, error)
 	GetWithContext(ctx context.Context, url string) (*Response, error)
+	Do(ctx context.Context, method, url string, body io.Reader, headers map[string]string) (*Response, error)
 	SetConfig(config *Config)
 }
 
@@ -23,11 +35,16 @@ type Response struct {
 	Body       string
 	Document   *goquery.Document
 	LoadTime   time.Duration
+	// RedirectChain lists every URL requested on the way to this response,
+	// starting with the original URL. It is empty when there was no redirect.
+	RedirectChain []string
 }
 
 type DefaultScraper struct {
-	client *Client
-	config *Config
+	client  *Client
+	config  *Config
+	memory  *memoryGuard
+	schemas *SchemaSource
 }
 
 func New(options ...Option) *DefaultScraper {
@@ -37,9 +54,20 @@ func New(options ...Option) *DefaultScraper {
 		option(config)
 	}
 
+	var schemas *SchemaSource
+	if config.SchemaSource != "" {
+		schemas = NewSchemaSource(config.SchemaSource, config.SchemaRefresh)
+		// Load in the background so New doesn't wait on the network; the
+		// first extraction waits for it, and a failure is reported through
+		// SchemaSource().LastError().
+		schemas.source.LoadInBackground()
+	}
+
 	return &DefaultScraper{
-		client: NewClient(config),
-		config: config,
+		client:  NewClient(config),
+		config:  config,
+		memory:  newMemoryGuard(config.MemoryBudget, memoryShrinkers(config)...),
+		schemas: schemas,
 	}
 }
 
@@ -48,44 +76,247 @@ func (s *DefaultScraper) Get(url string) (*Response, error) {
 }
 
 func (s *DefaultScraper) GetWithContext(ctx context.Context, url string) (*Response, error) {
+	return s.Do(ctx, "GET", url, nil, nil)
+}
+
+// Do sends a request with any method, body and extra headers through the
+// same rate limiting, retries and decompression as Get. The body is read
+// up front so it can be replayed on retries. Failures to fetch the page,
+// including responses with a 4xx or 5xx status, are *ScrapeErrors. The
+// Response of an error status is returned along with the error, and is
+// also in its ScrapeError. With WithCache, GETs are answered from the
+// cache when possible.
+func (s *DefaultScraper) Do(ctx context.Context, method, url string, body io.Reader, headers map[string]string) (*Response, error) {
 	start := time.Now()
-	
-	resp, err := s.client.GetWithContext(ctx, url)
+	cacheKey, cacheable := s.responseCacheKey(method, url, body, headers)
+	if cacheable {
+		if resp := s.cachedResponse(ctx, cacheKey); resp != nil {
+			resp.LoadTime = time.Since(start)
+			return s.finishResponse(resp)
+		}
+	}
+
+	resp, err := s.fetch(ctx, start, method, url, body, headers)
+	s.recordRequest(method, url, resp, err, time.Since(start))
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+		return resp, err
+	}
+	// The cache holds responses as fetched; hooks run on every copy served.
+	if cacheable {
+		s.cacheResponse(ctx, cacheKey, resp)
+	}
+	return s.finishResponse(resp)
+}
+
+func (s *DefaultScraper) finishResponse(resp *Response) (*Response, error) {
+	if err := s.runResponseHooks(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// fetch wraps every failure of fetchResponse in a *ScrapeError.
+func (s *DefaultScraper) fetch(ctx context.Context, start time.Time, method, url string, body io.Reader, headers map[string]string) (*Response, error) {
+	resp, err := s.fetchResponse(ctx, start, method, url, body, headers)
+	if err != nil {
+		if _, ok := err.(*ScrapeError); !ok {
+			err = &ScrapeError{URL: url, Err: err}
+		}
+	}
+	return resp, err
+}
+
+func (s *DefaultScraper) fetchResponse(ctx context.Context, start time.Time, method, url string, body io.Reader, headers map[string]string) (*Response, error) {
+	release, err := s.memory.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var payload []byte
+	if body != nil {
+		if payload, err = io.ReadAll(body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
+	resp, err := s.client.send(ctx, method, url, payload, headers)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	reader := resp.Body
-	
-	encoding := resp.Header.Get("Content-Encoding")
-	if encoding == "gzip" {
-		gzipReader, err := gzip.NewReader(resp.Body)
+	// Error pages are still read, so callers can look at what the site
+	// said. If that fails, the status is the failure reported.
+	var statusErr *ScrapeError
+	if resp.StatusCode >= 400 {
+		statusErr = &ScrapeError{URL: url, StatusCode: resp.StatusCode, Err: statusError(resp.StatusCode)}
+	}
+	fail := func(err error) (*Response, error) {
+		if statusErr != nil {
+			return nil, statusErr
+		}
+		return nil, err
+	}
+
+	// A body that is already too large on the wire is not read at all.
+	if maxSize := s.config.MaxResponseSize; maxSize > 0 && resp.ContentLength > maxSize {
+		return fail(fmt.Errorf("%w: %s sent %d bytes, over the %d byte limit", ErrResponseTooLarge, url, resp.ContentLength, maxSize))
+	}
+
+	reader, err := decodeBody(resp)
+	if err != nil {
+		return fail(err)
+	}
+	defer reader.Close()
+
+	// The document is parsed from the same buffer that ends up in Body
+	// rather than being re-serialized into it.
+	raw, err := readBody(reader, s.memory.remaining(), s.config.MaxResponseSize)
+	if err != nil {
+		return fail(err)
+	}
+
+	response := &Response{
+		URL:           url,
+		StatusCode:    resp.StatusCode,
+		Headers:       resp.Header,
+		Body:          string(raw),
+		LoadTime:      time.Since(start),
+		RedirectChain: redirectChain(resp),
+	}
+
+	if contentType, ok := sniffContentType(raw); !ok {
+		if statusErr != nil {
+			statusErr.Response = response
+			return response, statusErr
+		}
+		return nil, &NonHTMLContentError{
+			URL:         url,
+			StatusCode:  resp.StatusCode,
+			ContentType: contentType,
+			Body:        raw,
+		}
+	}
+
+	// Preprocessors only change what is parsed; Body stays as fetched.
+	if len(s.config.HTMLPreprocessors) > 0 {
+		raw = []byte(s.config.preprocessHTML(response.Body))
+	}
+
+	// Tokens are counted before parsing so an oversized page never gets a
+	// tree built for it; the tree is checked as well for the nodes the
+	// parser adds itself, such as reopened formatting elements.
+	if s.config.MaxHTMLNodes > 0 && exceedsTokenLimit(raw, s.config.MaxHTMLNodes) {
+		return fail(fmt.Errorf("%w: more than %d nodes", ErrDocumentTooComplex, s.config.MaxHTMLNodes))
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(raw))
+	if err != nil {
+		return fail(fmt.Errorf("failed to parse HTML: %w", err))
+	}
+	// Resolve relative links against where the page ended up after redirects.
+	doc.Url = resp.Request.URL
+
+	if s.config.MaxHTMLNodes > 0 && exceedsNodeLimit(doc, s.config.MaxHTMLNodes) {
+		return fail(fmt.Errorf("%w: more than %d nodes", ErrDocumentTooComplex, s.config.MaxHTMLNodes))
+	}
+
+	response.Document = doc
+	if statusErr != nil {
+		statusErr.Response = response
+		return response, statusErr
+	}
+	return response, nil
+}
+
+// readBody reads the whole body, failing with ErrMemoryPressure once it
+// grows past the budget bytes left, or with ErrResponseTooLarge past
+// maxSize. A negative budget and a maxSize of zero mean no limit.
+func readBody(r io.Reader, budget, maxSize int64) ([]byte, error) {
+	limit := budget
+	if maxSize > 0 && (limit < 0 || maxSize <= limit) {
+		limit = maxSize
+	}
+	if limit < 0 {
+		raw, err := io.ReadAll(r)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+			return nil, fmt.Errorf("failed to read response body: %w", err)
 		}
-		defer gzipReader.Close()
-		reader = gzipReader
+		return raw, nil
 	}
 
-	doc, err := goquery.NewDocumentFromReader(reader)
+	raw, err := io.ReadAll(io.LimitReader(r, limit+1))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if int64(len(raw)) > limit {
+		if limit == maxSize {
+			return nil, fmt.Errorf("%w: response body exceeds %d bytes", ErrResponseTooLarge, maxSize)
+		}
+		return nil, fmt.Errorf("%w: response body exceeds the %d bytes left in the budget", ErrMemoryPressure, limit)
 	}
+	return raw, nil
+}
 
-	body, _ := doc.Html()
-	
-	return &Response{
-		URL:        url,
-		StatusCode: resp.StatusCode,
-		Headers:    resp.Header,
-		Body:       body,
-		Document:   doc,
-		LoadTime:   time.Since(start),
-	}, nil
+// ProxyBans lists the (proxy, host) pairs avoided because of
+// WithProxyBanDetection.
+func (s *DefaultScraper) ProxyBans() []ProxyBan {
+	return s.client.ProxyBans()
 }
 
 func (s *DefaultScraper) SetConfig(config *Config) {
 	s.config = config
 	s.client = NewClient(config)
+	s.memory.close()
+	s.memory = newMemoryGuard(config.MemoryBudget, memoryShrinkers(config)...)
+}
+
+// Close stops the background work started for the scraper, such as the heap
+// sampling of WithMemoryBudget. The scraper must not be used afterwards.
+func (s *DefaultScraper) Close() error {
+	s.memory.close()
+	return nil
+}
+
+// exceedsTokenLimit reports whether raw holds more than limit tokens that
+// become nodes: elements, text, comments and doctypes. It stops as soon as
+// the limit is crossed.
+func exceedsTokenLimit(raw []byte, limit int) bool {
+	count := 0
+	tokenizer := html.NewTokenizer(bytes.NewReader(raw))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return false
+		case html.EndTagToken:
+			continue
+		}
+
+		count++
+		if count > limit {
+			return true
+		}
+	}
+}
+
+// exceedsNodeLimit walks the parsed tree iteratively and stops as soon as
+// the limit is crossed, so deeply nested pages can't blow the stack either.
+func exceedsNodeLimit(doc *goquery.Document, limit int) bool {
+	count := 0
+	stack := append([]*html.Node(nil), doc.Nodes...)
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		count++
+		if count > limit {
+			return true
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			stack = append(stack, child)
+		}
+	}
+	return false
 }
\ No newline at end of file
@@ -0,0 +1,183 @@
+package goscraper
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// NDJSONSink appends items as newline-delimited JSON. It is safe for
+// concurrent use by many workers: writes are serialized, buffered, flushed
+// periodically and on Close, and the file is optionally rotated by size.
+type NDJSONSink struct {
+	path          string
+	flushInterval time.Duration
+	maxSize       int64
+
+	mu       sync.Mutex
+	file     *os.File
+	writer   *bufio.Writer
+	size     int64
+	rotation int
+	closed   bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type NDJSONSinkOption func(*NDJSONSink)
+
+// WithSinkFlushInterval sets how often buffered items are flushed to disk
+// (default one second).
+func WithSinkFlushInterval(interval time.Duration) NDJSONSinkOption {
+	return func(s *NDJSONSink) {
+		s.flushInterval = interval
+	}
+}
+
+// WithSinkMaxSize rotates the file once it grows past maxBytes. Rotated
+// files are renamed to path.1, path.2 and so on; path always holds the
+// newest items.
+func WithSinkMaxSize(maxBytes int64) NDJSONSinkOption {
+	return func(s *NDJSONSink) {
+		s.maxSize = maxBytes
+	}
+}
+
+func NewNDJSONSink(path string, options ...NDJSONSinkOption) (*NDJSONSink, error) {
+	s := &NDJSONSink{
+		path:          path,
+		flushInterval: time.Second,
+		done:          make(chan struct{}),
+	}
+	for _, option := range options {
+		option(s)
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	if s.flushInterval > 0 {
+		s.wg.Add(1)
+		go s.flushLoop()
+	}
+
+	return s, nil
+}
+
+// Write encodes item as one JSON line.
+func (s *NDJSONSink) Write(item interface{}) error {
+	line, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal item: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("ndjson sink is closed")
+	}
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.writer.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *NDJSONSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	return s.writer.Flush()
+}
+
+// Close flushes any buffered items and closes the file.
+func (s *NDJSONSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+
+	err := s.writer.Flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *NDJSONSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat %s: %w", s.path, err)
+	}
+
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	s.size = info.Size()
+	return nil
+}
+
+// rotate must be called with s.mu held.
+func (s *NDJSONSink) rotate() error {
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	for {
+		s.rotation++
+		rotated := fmt.Sprintf("%s.%d", s.path, s.rotation)
+		if _, err := os.Stat(rotated); os.IsNotExist(err) {
+			if err := os.Rename(s.path, rotated); err != nil {
+				return fmt.Errorf("failed to rotate %s: %w", s.path, err)
+			}
+			break
+		}
+	}
+
+	return s.open()
+}
+
+func (s *NDJSONSink) flushLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.done:
+			return
+		}
+	}
+}
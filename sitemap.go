@@ -0,0 +1,161 @@
+package goscraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultSitemapMaxURLs is the number of URLs ParseSitemap stops at, the
+// most a single sitemap may list under the sitemap protocol.
+const DefaultSitemapMaxURLs = 50000
+
+const (
+	// sitemapMaxDepth bounds how deeply sitemap indexes may nest.
+	sitemapMaxDepth = 5
+	// sitemapMaxSize is the protocol's limit on an uncompressed sitemap, and
+	// guards against gzip bombs.
+	sitemapMaxSize = 50 << 20
+)
+
+// sitemapDocument decodes both a <urlset> and a <sitemapindex>.
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+// ParseSitemap fetches the sitemap at sitemapURL with scraper and returns
+// the page URLs it lists, each once and in order. Sitemap indexes are
+// followed into their child sitemaps, and gzipped sitemaps (.xml.gz) are
+// decompressed. It stops after DefaultSitemapMaxURLs URLs.
+func ParseSitemap(ctx context.Context, scraper Scraper, sitemapURL string) ([]string, error) {
+	return ParseSitemapLimit(ctx, scraper, sitemapURL, DefaultSitemapMaxURLs)
+}
+
+// ParseSitemapLimit is ParseSitemap stopping after maxURLs URLs; no more
+// sitemaps are fetched once the cap is reached. A child sitemap that fails
+// does not stop the others: the URLs found are returned along with an error
+// naming each failure.
+func ParseSitemapLimit(ctx context.Context, scraper Scraper, sitemapURL string, maxURLs int) ([]string, error) {
+	p := &sitemapParser{
+		scraper: scraper,
+		maxURLs: maxURLs,
+		seen:    make(map[string]bool),
+		fetched: make(map[string]bool),
+	}
+
+	if err := p.parse(ctx, sitemapURL, 0); err != nil {
+		return nil, err
+	}
+	return p.urls, errors.Join(p.errs...)
+}
+
+type sitemapParser struct {
+	scraper Scraper
+	maxURLs int
+	urls    []string
+	seen    map[string]bool
+	fetched map[string]bool
+	errs    []error
+}
+
+func (p *sitemapParser) full() bool {
+	return p.maxURLs > 0 && len(p.urls) >= p.maxURLs
+}
+
+func (p *sitemapParser) parse(ctx context.Context, sitemapURL string, depth int) error {
+	p.fetched[sitemapURL] = true
+
+	raw, err := fetchSitemap(ctx, p.scraper, sitemapURL)
+	if err != nil {
+		return err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	// Sitemaps in the wild carry HTML entities and other sloppiness.
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	var doc sitemapDocument
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("failed to parse sitemap %s: %w", sitemapURL, err)
+	}
+
+	switch doc.XMLName.Local {
+	case "urlset":
+		for _, entry := range doc.URLs {
+			if p.full() {
+				return nil
+			}
+			loc := strings.TrimSpace(entry.Loc)
+			if loc != "" && !p.seen[loc] {
+				p.seen[loc] = true
+				p.urls = append(p.urls, loc)
+			}
+		}
+	case "sitemapindex":
+		if depth >= sitemapMaxDepth {
+			return fmt.Errorf("sitemap index %s is nested more than %d deep", sitemapURL, sitemapMaxDepth)
+		}
+		for _, entry := range doc.Sitemaps {
+			loc := strings.TrimSpace(entry.Loc)
+			if p.full() || ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if loc == "" || p.fetched[loc] {
+				continue
+			}
+			if err := p.parse(ctx, loc, depth+1); err != nil {
+				p.errs = append(p.errs, err)
+			}
+		}
+	default:
+		return fmt.Errorf("%s is not a sitemap: root element <%s>", sitemapURL, doc.XMLName.Local)
+	}
+	return nil
+}
+
+// fetchSitemap returns a sitemap's XML. A gzipped sitemap served without
+// Content-Encoding comes back from the scraper as binary content, and is
+// decompressed here.
+func fetchSitemap(ctx context.Context, scraper Scraper, sitemapURL string) ([]byte, error) {
+	var raw []byte
+	resp, err := scraper.GetWithContext(ctx, sitemapURL)
+	var nonHTML *NonHTMLContentError
+	switch {
+	case err == nil:
+		raw = []byte(resp.Body)
+	case errors.As(err, &nonHTML):
+		raw = nonHTML.Body
+	default:
+		return nil, fmt.Errorf("failed to fetch sitemap %s: %w", sitemapURL, err)
+	}
+
+	if !bytes.HasPrefix(raw, []byte{0x1f, 0x8b}) {
+		return raw, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress sitemap %s: %w", sitemapURL, err)
+	}
+	defer reader.Close()
+
+	raw, err = io.ReadAll(io.LimitReader(reader, sitemapMaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress sitemap %s: %w", sitemapURL, err)
+	}
+	if len(raw) > sitemapMaxSize {
+		return nil, fmt.Errorf("sitemap %s is larger than %d bytes uncompressed", sitemapURL, sitemapMaxSize)
+	}
+	return raw, nil
+}
@@ -0,0 +1,73 @@
+package goscraper
+
+import (
+	"sync"
+	"time"
+)
+
+type smartCacheEntry struct {
+	data    *SmartData
+	err     error
+	expires time.Time
+	done    chan struct{}
+}
+
+var smartCache = struct {
+	sync.Mutex
+	entries map[string]*smartCacheEntry
+}{entries: make(map[string]*smartCacheEntry)}
+
+// SmartScrapeCached behaves like SmartScrape but remembers each result in
+// memory for ttl, so repeated calls for the same URL (e.g. from an
+// interactive UI) skip the network. Concurrent calls for a URL share one
+// fetch. Failed scrapes are not cached. The returned SmartData is shared
+// between callers and must not be modified.
+func SmartScrapeCached(url string, ttl time.Duration) (*SmartData, error) {
+	smartCache.Lock()
+	now := time.Now()
+	if entry, ok := smartCache.entries[url]; ok {
+		select {
+		case <-entry.done:
+			if now.Before(entry.expires) {
+				smartCache.Unlock()
+				return entry.data, nil
+			}
+		default:
+			// Another caller is already fetching this URL.
+			smartCache.Unlock()
+			<-entry.done
+			return entry.data, entry.err
+		}
+	}
+
+	pruneSmartCache(now)
+	entry := &smartCacheEntry{done: make(chan struct{})}
+	smartCache.entries[url] = entry
+	smartCache.Unlock()
+
+	entry.data, entry.err = SmartScrape(url)
+	entry.expires = time.Now().Add(ttl)
+
+	smartCache.Lock()
+	if entry.err != nil {
+		delete(smartCache.entries, url)
+	}
+	close(entry.done)
+	smartCache.Unlock()
+
+	return entry.data, entry.err
+}
+
+// pruneSmartCache drops expired results so the cache only ever holds URLs
+// requested within the last TTL. It must be called with smartCache locked.
+func pruneSmartCache(now time.Time) {
+	for url, entry := range smartCache.entries {
+		select {
+		case <-entry.done:
+			if !now.Before(entry.expires) {
+				delete(smartCache.entries, url)
+			}
+		default:
+		}
+	}
+}
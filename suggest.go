@@ -0,0 +1,196 @@
+package goscraper
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	minCardSiblings = 3
+	maxSuggestions  = 5
+)
+
+var (
+	pricePattern    = regexp.MustCompile(`(?i)([$€£₺¥]|\b(?:TL|USD|EUR|GBP|TRY)\b)\s?\d|\d[\d.,]*\s?([$€£₺¥]|\b(?:TL|USD|EUR|GBP|TRY)\b)`)
+	cssIdentPattern = regexp.MustCompile(`^-?[A-Za-z_][\w-]*$`)
+)
+
+// SelectorSuggestion is one candidate set of product selectors found by
+// SuggestSelectorCandidates, along with how many cards it matched.
+type SelectorSuggestion struct {
+	Selectors  ProductSelectors `json:"selectors"`
+	Card       string           `json:"card"`
+	Matches    int              `json:"matches"`
+	Confidence float64          `json:"confidence"`
+}
+
+// SuggestSelectors proposes ProductSelectors for an unsupported site by
+// looking for repeated product cards on a sample listing page. It returns
+// empty selectors when no card structure is found.
+func SuggestSelectors(resp *Response) ProductSelectors {
+	candidates := SuggestSelectorCandidates(resp)
+	if len(candidates) == 0 {
+		return ProductSelectors{}
+	}
+	return candidates[0].Selectors
+}
+
+// SuggestSelectorCandidates returns every plausible card structure on the
+// page, best first, so callers can fall back to an alternative when the top
+// suggestion picks up the wrong block (e.g. a "recently viewed" strip).
+func SuggestSelectorCandidates(resp *Response) []SelectorSuggestion {
+	if resp == nil || resp.Document == nil {
+		return nil
+	}
+
+	var suggestions []SelectorSuggestion
+	seen := make(map[string]bool)
+
+	resp.Document.Find("body *").Each(func(i int, parent *goquery.Selection) {
+		groups := make(map[string][]*goquery.Selection)
+		var order []string
+		parent.Children().Each(func(j int, child *goquery.Selection) {
+			sig := elementSelector(child)
+			if _, ok := groups[sig]; !ok {
+				order = append(order, sig)
+			}
+			groups[sig] = append(groups[sig], child)
+		})
+
+		for _, sig := range order {
+			cards := groups[sig]
+			if len(cards) < minCardSiblings {
+				continue
+			}
+
+			card := sig
+			if !strings.Contains(sig, ".") {
+				// A bare tag is too generic on its own; anchor it to the parent.
+				card = elementSelector(parent) + " > " + sig
+			}
+			if seen[card] {
+				continue
+			}
+			seen[card] = true
+
+			if suggestion, ok := suggestFromCards(card, cards); ok {
+				suggestions = append(suggestions, suggestion)
+			}
+		}
+	})
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Confidence > suggestions[j].Confidence
+	})
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions
+}
+
+func suggestFromCards(card string, cards []*goquery.Selection) (SelectorSuggestion, bool) {
+	var withPrice, withImage, withLink int
+	names := make(map[string]int)
+	prices := make(map[string]int)
+
+	for _, c := range cards {
+		if price := findPriceElement(c); price != nil {
+			withPrice++
+			prices[elementSelector(price)]++
+		}
+		if c.Find("img").Length() > 0 {
+			withImage++
+		}
+		if c.Is("a[href]") || c.Find("a[href]").Length() > 0 {
+			withLink++
+		}
+		if name := findNameElement(c); name != nil {
+			names[elementSelector(name)]++
+		}
+	}
+
+	total := float64(len(cards))
+	priceRatio := float64(withPrice) / total
+	if priceRatio < 0.5 {
+		return SelectorSuggestion{}, false
+	}
+
+	// Price and image are what distinguish product cards from other repeated
+	// blocks such as menus; sheer repetition only adds a little confidence.
+	repetition := total / 10
+	if repetition > 1 {
+		repetition = 1
+	}
+	confidence := priceRatio*0.45 +
+		float64(withImage)/total*0.25 +
+		float64(withLink)/total*0.1 +
+		repetition*0.1
+	if len(names) > 0 {
+		confidence += 0.1
+	}
+
+	selectors := ProductSelectors{
+		Price: card + " " + mostCommon(prices),
+		Image: card + " img",
+		Link:  card + " a",
+	}
+	if name := mostCommon(names); name != "" {
+		selectors.Name = card + " " + name
+	}
+
+	return SelectorSuggestion{
+		Selectors:  selectors,
+		Card:       card,
+		Matches:    len(cards),
+		Confidence: confidence,
+	}, true
+}
+
+// findPriceElement returns the innermost element whose text looks like a price.
+func findPriceElement(card *goquery.Selection) *goquery.Selection {
+	var found *goquery.Selection
+	card.Find("*").Each(func(i int, s *goquery.Selection) {
+		if found != nil {
+			return
+		}
+		if s.Children().Length() == 0 && pricePattern.MatchString(s.Text()) {
+			found = s
+		}
+	})
+	return found
+}
+
+func findNameElement(card *goquery.Selection) *goquery.Selection {
+	for _, selector := range []string{"h1, h2, h3, h4, h5, h6", "[class*='name'], [class*='title']", "a[title]"} {
+		if s := card.Find(selector).First(); s.Length() > 0 && strings.TrimSpace(s.Text()) != "" {
+			return s
+		}
+	}
+	return nil
+}
+
+// elementSelector renders a selection as tag.class1.class2, skipping class
+// names that would need escaping in CSS.
+func elementSelector(s *goquery.Selection) string {
+	selector := goquery.NodeName(s)
+	class, _ := s.Attr("class")
+	for _, name := range strings.Fields(class) {
+		if cssIdentPattern.MatchString(name) {
+			selector += "." + name
+		}
+	}
+	return selector
+}
+
+func mostCommon(counts map[string]int) string {
+	best, bestCount := "", 0
+	for key, count := range counts {
+		if count > bestCount || (count == bestCount && key < best) {
+			best, bestCount = key, count
+		}
+	}
+	return best
+}
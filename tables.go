@@ -0,0 +1,340 @@
+package goscraper
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var tableTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02.01.2006",
+	"02/01/2006",
+	"Jan 2, 2006",
+	"2 Jan 2006",
+}
+
+// CellError describes a table cell ExtractTableInto could not convert to
+// the type of its field. Row counts data rows from 0 and Column is the
+// header the field is tagged with.
+type CellError struct {
+	Row    int
+	Column string
+	Value  string
+	Err    error
+}
+
+func (e CellError) Error() string {
+	return fmt.Sprintf("row %d, column %q: cannot convert %q: %v", e.Row, e.Column, e.Value, e.Err)
+}
+
+// TableError is returned by ExtractTableInto when cells failed to convert.
+// The rows are still appended, with those fields left at their zero value.
+type TableError struct {
+	Cells []CellError
+}
+
+func (e *TableError) Error() string {
+	if len(e.Cells) == 1 {
+		return e.Cells[0].Error()
+	}
+	return fmt.Sprintf("%d cell conversion errors, first: %v", len(e.Cells), e.Cells[0])
+}
+
+// ExtractTableInto maps the rows of the first table matching selector into
+// dest, which must be a pointer to a slice of structs (or struct pointers).
+// Fields are matched to columns with a `header:"Column Name"` tag; time.Time
+// fields may carry a `layout:"..."` tag, and numeric fields a `decimal:","`
+// tag for pages that write 1.234,56. Rows are always appended, and every
+// cell that fails to convert is reported in the returned *TableError.
+func (p *Parser) ExtractTableInto(selector string, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dest must be a pointer to a slice, got %T", dest)
+	}
+
+	sliceVal := rv.Elem()
+	elemType := sliceVal.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	structType := elemType
+	if isPtr {
+		structType = elemType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return fmt.Errorf("dest elements must be structs, got %s", elemType)
+	}
+
+	table := p.doc.Find(selector).First()
+	if table.Length() == 0 {
+		return fmt.Errorf("no table found for selector %q", selector)
+	}
+
+	headers, rows := readTable(table)
+
+	columns := make(map[string]int, len(headers))
+	for i, header := range headers {
+		columns[normalizeHeader(header)] = i
+	}
+
+	var cellErrors []CellError
+	for rowIdx, row := range rows {
+		item := reflect.New(structType).Elem()
+
+		for i := 0; i < structType.NumField(); i++ {
+			field := structType.Field(i)
+			header, ok := field.Tag.Lookup("header")
+			if !ok || field.PkgPath != "" {
+				continue
+			}
+
+			col, ok := columns[normalizeHeader(header)]
+			if !ok || col >= len(row) {
+				continue
+			}
+
+			if err := setCellValue(item.Field(i), row[col], field.Tag); err != nil {
+				cellErrors = append(cellErrors, CellError{
+					Row:    rowIdx,
+					Column: header,
+					Value:  row[col],
+					Err:    err,
+				})
+			}
+		}
+
+		if isPtr {
+			sliceVal.Set(reflect.Append(sliceVal, item.Addr()))
+		} else {
+			sliceVal.Set(reflect.Append(sliceVal, item))
+		}
+	}
+
+	if len(cellErrors) > 0 {
+		return &TableError{Cells: cellErrors}
+	}
+	return nil
+}
+
+// Table is the text of an HTML table. A cell spanning several columns is
+// repeated in each of them, and short rows are padded with empty cells to
+// the width of Headers, or of the widest row when there are no headers.
+type Table struct {
+	Headers []string
+	Rows    [][]string
+}
+
+// ExtractTables returns every table on the page, in document order. A
+// table nested in another is returned separately; its rows are not part of
+// the outer table.
+func (p *Parser) ExtractTables() []Table {
+	var tables []Table
+	p.doc.Find("table").Each(func(i int, s *goquery.Selection) {
+		headers, rows := readTable(s)
+		tables = append(tables, Table{Headers: headers, Rows: rows})
+	})
+	return tables
+}
+
+// ExtractTable returns the first table matching selector, or nil if there
+// is none.
+func (p *Parser) ExtractTable(selector string) *Table {
+	table := p.doc.Find(selector).First()
+	if table.Length() == 0 {
+		return nil
+	}
+	headers, rows := readTable(table)
+	return &Table{Headers: headers, Rows: rows}
+}
+
+// maxColspan caps colspan so a bogus value can't blow up a row.
+const maxColspan = 1000
+
+// readTable returns the header cells and the data rows of a table. Headers
+// come from <thead> or, failing that, from a leading row of <th> cells.
+func readTable(table *goquery.Selection) ([]string, [][]string) {
+	var headers []string
+	var rows [][]string
+
+	sawHead := false
+	for _, tr := range tableRows(table) {
+		inHead := goquery.NodeName(tr.Parent()) == "thead"
+		if inHead {
+			if !sawHead {
+				headers = readRow(tr)
+				sawHead = true
+			}
+			continue
+		}
+
+		if headers == nil && tr.ChildrenFiltered("td").Length() == 0 {
+			headers = readRow(tr)
+			continue
+		}
+
+		if cells := readRow(tr); len(cells) > 0 {
+			rows = append(rows, cells)
+		}
+	}
+
+	width := len(headers)
+	if width == 0 {
+		for _, row := range rows {
+			if len(row) > width {
+				width = len(row)
+			}
+		}
+	}
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		rows[i] = row
+	}
+
+	return headers, rows
+}
+
+// tableRows returns the rows of table itself, in order, leaving out those
+// of tables nested in it.
+func tableRows(table *goquery.Selection) []*goquery.Selection {
+	var rows []*goquery.Selection
+	table.Children().Each(func(i int, child *goquery.Selection) {
+		switch goquery.NodeName(child) {
+		case "tr":
+			rows = append(rows, child)
+		case "thead", "tbody", "tfoot":
+			child.ChildrenFiltered("tr").Each(func(i int, tr *goquery.Selection) {
+				rows = append(rows, tr)
+			})
+		}
+	})
+	return rows
+}
+
+func readRow(tr *goquery.Selection) []string {
+	var cells []string
+	tr.ChildrenFiltered("th, td").Each(func(i int, s *goquery.Selection) {
+		text := cleanText(s.Text())
+		span, err := strconv.Atoi(strings.TrimSpace(s.AttrOr("colspan", "1")))
+		if err != nil || span < 1 {
+			span = 1
+		}
+		if span > maxColspan {
+			span = maxColspan
+		}
+		for j := 0; j < span; j++ {
+			cells = append(cells, text)
+		}
+	})
+	return cells
+}
+
+func normalizeHeader(header string) string {
+	return strings.ToLower(cleanText(header))
+}
+
+func setCellValue(field reflect.Value, raw string, tag reflect.StructTag) error {
+	value := strings.TrimSpace(raw)
+
+	if field.Type() == reflect.TypeOf(time.Time{}) {
+		if value == "" {
+			return nil
+		}
+		t, err := parseTableTime(value, tag.Get("layout"))
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(normalizeNumber(value, tag.Get("decimal")), 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value == "" {
+			return nil
+		}
+		n, err := strconv.ParseUint(normalizeNumber(value, tag.Get("decimal")), 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if value == "" {
+			return nil
+		}
+		f, err := strconv.ParseFloat(normalizeNumber(value, tag.Get("decimal")), field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		if value == "" {
+			return nil
+		}
+		b, err := strconv.ParseBool(strings.ToLower(value))
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
+
+func parseTableTime(value, layout string) (time.Time, error) {
+	if layout != "" {
+		return time.Parse(layout, value)
+	}
+	for _, l := range tableTimeLayouts {
+		if t, err := time.Parse(l, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time format")
+}
+
+// normalizeNumber rewrites a number written with decimal as its decimal
+// separator, "." when empty, in the form strconv parses. The other of '.'
+// and ',' and spaces are taken as digit grouping. A value using both '.'
+// and ',' is unambiguous, so whichever comes last is the decimal separator
+// whatever decimal says.
+func normalizeNumber(value, decimal string) string {
+	value = strings.NewReplacer(" ", "", "\u00a0", "", "_", "").Replace(value)
+
+	lastDot := strings.LastIndex(value, ".")
+	lastComma := strings.LastIndex(value, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0 && lastComma > lastDot:
+		decimal = ","
+	case lastDot >= 0 && lastComma >= 0:
+		decimal = "."
+	case decimal == "":
+		decimal = "."
+	}
+
+	group := ","
+	if decimal == "," {
+		group = "."
+	}
+	value = strings.ReplaceAll(value, group, "")
+	return strings.Replace(value, decimal, ".", 1)
+}
@@ -0,0 +1,417 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"github.com/ramusaaa/goscraper"
+	"github.com/ramusaaa/goscraper/pkg/browser"
+	"github.com/ramusaaa/goscraper/pkg/monitoring"
+)
+
+// fakeEngine is a browser.Engine serving a fixed page. Once killed it fails
+// every call, like an engine whose browser crashed.
+type fakeEngine struct {
+	mu      sync.Mutex
+	html    string
+	url     string
+	dead    bool
+	closed  bool
+	scripts []string
+	cookies []*http.Cookie
+}
+
+func (e *fakeEngine) AddInitScript(ctx context.Context, script string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scripts = append(e.scripts, script)
+	return nil
+}
+
+func (e *fakeEngine) initScripts() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.scripts...)
+}
+
+func (e *fakeEngine) kill() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dead = true
+}
+
+func (e *fakeEngine) isClosed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closed
+}
+
+func (e *fakeEngine) check() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.dead || e.closed {
+		return errors.New("browser is gone")
+	}
+	return nil
+}
+
+func (e *fakeEngine) Navigate(ctx context.Context, url string) error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.url = url
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *fakeEngine) ExecuteScript(ctx context.Context, script string) (interface{}, error) {
+	return 1, e.check()
+}
+
+func (e *fakeEngine) Screenshot(ctx context.Context) ([]byte, error) {
+	return []byte("png"), e.check()
+}
+
+func (e *fakeEngine) FullScreenshot(ctx context.Context) ([]byte, error) {
+	return []byte("full png"), e.check()
+}
+
+func (e *fakeEngine) GetHTML(ctx context.Context) (string, error) {
+	return e.html, e.check()
+}
+
+func (e *fakeEngine) WaitForSelector(ctx context.Context, selector string, timeout time.Duration) error {
+	return e.check()
+}
+
+func (e *fakeEngine) Click(ctx context.Context, selector string) error {
+	return e.check()
+}
+
+func (e *fakeEngine) Type(ctx context.Context, selector, text string) error {
+	return e.check()
+}
+
+func (e *fakeEngine) Cookies(ctx context.Context) ([]*http.Cookie, error) {
+	return e.cookies, e.check()
+}
+
+func (e *fakeEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	return nil
+}
+
+// newFakeBrowserManager returns a Manager whose engines are fakeEngines
+// serving html, and a function listing the engines created so far.
+func newFakeBrowserManager(poolSize int, html string, metrics *monitoring.Metrics, opts ...browser.ManagerOption) (*browser.Manager, func() []*fakeEngine) {
+	var mu sync.Mutex
+	var created []*fakeEngine
+	manager := browser.NewManager(&browser.Config{
+		Metrics: metrics,
+		NewEngine: func(ctx context.Context, config *browser.Config) (browser.Engine, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			engine := &fakeEngine{html: html}
+			created = append(created, engine)
+			return engine, nil
+		},
+	}, poolSize, opts...)
+	return manager, func() []*fakeEngine {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*fakeEngine(nil), created...)
+	}
+}
+
+func TestBrowserPoolReusesAndEvictsEngines(t *testing.T) {
+	metrics := monitoring.NewMetrics(zap.NewNop())
+	manager, created := newFakeBrowserManager(2, "<html></html>", metrics)
+	ctx := context.Background()
+
+	if err := manager.WarmUp(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(created()); n != 2 {
+		t.Fatalf("expected WarmUp to start 2 engines, got %d", n)
+	}
+
+	first, err := manager.GetEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.ReturnEngine(first)
+	if n := len(created()); n != 2 {
+		t.Fatalf("expected pooled engines to be reused, got %d created", n)
+	}
+
+	first.(*fakeEngine).kill()
+	var dead *fakeEngine
+	for i := 0; i < 2; i++ {
+		engine, err := manager.GetEngine(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if engine == first {
+			dead = engine.(*fakeEngine)
+		}
+		manager.ReturnEngine(engine)
+	}
+	if dead == nil || !dead.isClosed() {
+		t.Fatal("expected the dead engine to be closed when returned")
+	}
+
+	// The warmed-up pool is topped up in the background.
+	deadline := time.Now().Add(time.Second)
+	for len(created()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := len(created()); n != 3 {
+		t.Fatalf("expected the dead engine to be replaced, got %d created", n)
+	}
+	if got := testutil.ToFloat64(metrics.BrowserSessions.WithLabelValues("custom")); got != 2 {
+		t.Errorf("expected 2 open browser sessions, got %v", got)
+	}
+	for i := 0; i < 2; i++ {
+		engine, err := manager.GetEngine(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if engine == first {
+			t.Fatal("dead engine was handed out again")
+		}
+	}
+
+	manager.Close()
+}
+
+func TestBrowserInitScripts(t *testing.T) {
+	ctx := context.Background()
+	scripts := []string{"var patched = true;", "window.sdk = {disabled: true};"}
+
+	plain, _ := newFakeBrowserManager(1, "<html></html>", nil)
+	engine, err := plain.GetEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if installed := engine.(*fakeEngine).initScripts(); len(installed) != 0 {
+		t.Errorf("expected no init scripts by default, got %q", installed)
+	}
+
+	custom, _ := newFakeBrowserManager(1, "<html></html>", nil, browser.WithBrowserInitScripts(scripts))
+	engine, err = custom.GetEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed := engine.(*fakeEngine).initScripts()
+	next := 0
+	for _, script := range installed {
+		if strings.Contains(script, "navigator.plugins") {
+			t.Error("expected the navigator spoofing to be opt-in")
+		}
+		if next < len(scripts) && script == scripts[next] {
+			next++
+		}
+	}
+	if next != len(scripts) {
+		t.Errorf("expected the scripts installed verbatim and in order, got %q", installed)
+	}
+
+	stealthy, _ := newFakeBrowserManager(1, "<html></html>", nil, browser.WithNavigatorStealth(), browser.WithBrowserInitScripts(scripts))
+	engine, err = stealthy.GetEngine(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spoofing := -1
+	for i, script := range engine.(*fakeEngine).initScripts() {
+		if strings.Contains(script, "navigator.plugins") {
+			spoofing = i
+		}
+		if script == scripts[0] && spoofing < 0 {
+			t.Error("expected the navigator spoofing to run before the custom scripts")
+		}
+	}
+	if spoofing < 0 {
+		t.Error("expected WithNavigatorStealth to install the navigator spoofing")
+	}
+
+	unsupported := browser.NewManager(&browser.Config{
+		NewEngine: func(ctx context.Context, config *browser.Config) (browser.Engine, error) {
+			return struct{ browser.Engine }{&fakeEngine{}}, nil
+		},
+	}, 1, browser.WithBrowserInitScripts(scripts))
+	if _, err := unsupported.GetEngine(ctx); err == nil {
+		t.Error("expected an engine without init script support to be refused")
+	}
+}
+
+func TestScrapeWithBrowserReturnsRenderedPage(t *testing.T) {
+	manager, created := newFakeBrowserManager(1, `<html><body><h1 id="title">Rendered</h1><a href="/next">next</a></body></html>`, nil)
+
+	resp, err := goscraper.ScrapeWithBrowser(context.Background(), manager, "https://example.com/app", "#title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Document.Find("#title").Text(); got != "Rendered" {
+		t.Errorf("expected the rendered title, got %q", got)
+	}
+	if links := goscraper.NewParser(resp.Document).ExtractLinks(); len(links) != 1 || links[0].URL != "https://example.com/next" {
+		t.Errorf("expected links resolved against the page URL, got %v", links)
+	}
+
+	engines := created()
+	if len(engines) != 1 || engines[0].url != "https://example.com/app" {
+		t.Fatalf("expected one engine to load the page, got %v", engines)
+	}
+	if _, err := goscraper.ScrapeWithBrowser(context.Background(), manager, "https://example.com/other", ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(created()); n != 1 {
+		t.Errorf("expected the engine to be returned to the pool and reused, got %d created", n)
+	}
+}
+
+func TestBrowserScreenshotChoosesCapture(t *testing.T) {
+	manager, _ := newFakeBrowserManager(1, "<html></html>", nil)
+
+	for fullPage, want := range map[bool]string{false: "png", true: "full png"} {
+		shot, err := manager.Screenshot(context.Background(), "https://example.com", fullPage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(shot) != want {
+			t.Errorf("fullPage=%v: expected %q, got %q", fullPage, want, shot)
+		}
+	}
+
+	// Engines only implementing Engine still take viewport screenshots.
+	basic := browser.NewManager(&browser.Config{
+		NewEngine: func(ctx context.Context, config *browser.Config) (browser.Engine, error) {
+			return struct{ browser.Engine }{&fakeEngine{html: "<html></html>"}}, nil
+		},
+	}, 1)
+	if shot, err := basic.Screenshot(context.Background(), "https://example.com", false); err != nil || string(shot) != "png" {
+		t.Errorf("expected a viewport screenshot, got %q, %v", shot, err)
+	}
+	if _, err := basic.Screenshot(context.Background(), "https://example.com", true); err == nil {
+		t.Error("expected full-page screenshots to fail without FullScreenshotEngine")
+	}
+}
+
+// loadingEngine is a fakeEngine that loads the page over HTTP when
+// navigating, so a slow origin holds up the navigate phase.
+type loadingEngine struct {
+	*fakeEngine
+}
+
+func (e loadingEngine) Navigate(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return e.fakeEngine.Navigate(ctx, url)
+}
+
+func TestBrowserPhaseTimeouts(t *testing.T) {
+	// The origin accepts the connection but sends no headers until the
+	// test ends.
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+		w.Write([]byte("<html><body>ok</body></html>"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	newManager := func(timeouts browser.Timeouts) *browser.Manager {
+		return browser.NewManager(&browser.Config{
+			Timeouts: timeouts,
+			NewEngine: func(ctx context.Context, config *browser.Config) (browser.Engine, error) {
+				return loadingEngine{&fakeEngine{html: "<html><body>ok</body></html>"}}, nil
+			},
+		}, 1)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		timeouts browser.Timeouts
+		phase    browser.Phase
+		timeout  time.Duration
+	}{
+		{"navigate", browser.Timeouts{Navigate: 50 * time.Millisecond, Total: 5 * time.Second}, browser.PhaseNavigate, 50 * time.Millisecond},
+		{"total", browser.Timeouts{Total: 50 * time.Millisecond}, browser.PhaseTotal, 50 * time.Millisecond},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			manager := newManager(tc.timeouts)
+			defer manager.Close()
+
+			start := time.Now()
+			_, err := manager.FetchHTML(context.Background(), server.URL+"/slow", browser.FetchOptions{})
+			var phaseErr *browser.PhaseTimeoutError
+			if !errors.As(err, &phaseErr) {
+				t.Fatalf("expected a *PhaseTimeoutError, got %v", err)
+			}
+			if phaseErr.Phase != tc.phase || phaseErr.Timeout != tc.timeout {
+				t.Errorf("expected the %s phase to time out after %s, got %s after %s", tc.phase, tc.timeout, phaseErr.Phase, phaseErr.Timeout)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected the error to wrap context.DeadlineExceeded, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("expected the fetch to give up after the phase timeout, took %v", elapsed)
+			}
+
+			if html, err := manager.FetchHTML(context.Background(), server.URL+"/fast", browser.FetchOptions{}); err != nil || !strings.Contains(html, "ok") {
+				t.Errorf("expected a fast origin to load, got %q (%v)", html, err)
+			}
+		})
+	}
+}
+
+func TestChallengeSolverNeedsCookieEngine(t *testing.T) {
+	cleared := browser.NewManager(&browser.Config{
+		NewEngine: func(ctx context.Context, config *browser.Config) (browser.Engine, error) {
+			return &fakeEngine{html: "<html>ok</html>", cookies: []*http.Cookie{{Name: "cf_clearance", Value: "token"}}}, nil
+		},
+	}, 1)
+	defer cleared.Close()
+	clearance, err := browser.NewChallengeSolver(cleared).SolveChallenge(context.Background(), "https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clearance.Cookies) != 1 || clearance.Cookies[0].Value != "token" || clearance.HTML != "<html>ok</html>" {
+		t.Errorf("unexpected clearance %+v", clearance)
+	}
+
+	// Engines only implementing Engine cannot solve challenges.
+	basic := browser.NewManager(&browser.Config{
+		NewEngine: func(ctx context.Context, config *browser.Config) (browser.Engine, error) {
+			return struct{ browser.Engine }{&fakeEngine{}}, nil
+		},
+	}, 1)
+	defer basic.Close()
+	if _, err := browser.NewChallengeSolver(basic).SolveChallenge(context.Background(), "https://example.com"); err == nil {
+		t.Error("expected an engine without CookieEngine to be refused")
+	}
+}
@@ -0,0 +1,458 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/ramusaaa/goscraper"
+	"github.com/ramusaaa/goscraper/pkg/cache"
+	"github.com/ramusaaa/goscraper/pkg/monitoring"
+	"go.uber.org/zap"
+)
+
+const redisInfo = `# Memory
+used_memory:1048576
+used_memory_human:1.00M
+
+# Stats
+total_connections_received:42
+keyspace_hits:300
+keyspace_misses:100
+
+# Clients
+connected_clients:7
+
+# Keyspace
+db0:keys=12,expires=3,avg_ttl=0
+db2:keys=250,expires=250,avg_ttl=86400
+`
+
+func TestParseRedisInfo(t *testing.T) {
+	stats := cache.ParseRedisInfo(strings.ReplaceAll(redisInfo, "\n", "\r\n"), 2)
+
+	if stats.MemoryUsage != 1048576 || stats.Connections != 7 {
+		t.Errorf("memory/clients not parsed: %+v", stats)
+	}
+	if stats.HitCount != 300 || stats.MissCount != 100 || stats.HitRatio != 0.75 {
+		t.Errorf("hit stats not parsed: %+v", stats)
+	}
+	if stats.TotalKeys != 250 {
+		t.Errorf("expected 250 keys in db2, got %d", stats.TotalKeys)
+	}
+}
+
+func TestParseRedisInfoMissingSections(t *testing.T) {
+	stats := cache.ParseRedisInfo("# Memory\r\nused_memory:2048\r\n", 0)
+
+	if stats.MemoryUsage != 2048 {
+		t.Errorf("expected used_memory to be parsed, got %+v", stats)
+	}
+	if stats.TotalKeys != 0 || stats.HitRatio != 0 || stats.Connections != 0 {
+		t.Errorf("missing sections should leave stats at zero, got %+v", stats)
+	}
+}
+
+// jsonCache is a cache.MemoryCache whose values round-trip through JSON,
+// the way they do in RedisCache.
+type jsonCache struct {
+	*cache.MemoryCache
+}
+
+func newJSONCache() jsonCache {
+	return jsonCache{cache.NewMemoryCache(time.Hour, 0)}
+}
+
+func (c jsonCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	return c.MemoryCache.Set(ctx, key, decoded, ttl)
+}
+
+func TestWithCacheServesRepeatGets(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private, no-store")
+		}
+		fmt.Fprintf(w, `<html><head><title>%s %s</title></head><body></body></html>`, r.URL.Path, r.Header.Get("Accept-Language"))
+	}))
+	defer server.Close()
+
+	metrics := monitoring.NewMetrics(zap.NewNop())
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithCache(newJSONCache(), time.Minute),
+		goscraper.WithMetrics(metrics),
+	)
+	fetch := func(path string, headers map[string]string) *goscraper.Response {
+		t.Helper()
+		resp, err := scraper.Do(context.Background(), http.MethodGet, server.URL+path, nil, headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	first := fetch("/page", nil)
+	second := fetch("/page", nil)
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatalf("expected the repeat GET to be served from the cache, got %d fetches", n)
+	}
+	if second.Body != first.Body || second.StatusCode != http.StatusOK || second.Document.Find("title").Text() != "/page " {
+		t.Errorf("cached response differs: %+v", second)
+	}
+	if second.Document.Url == nil || second.Document.Url.String() != server.URL+"/page" {
+		t.Errorf("cached document lost its URL: %v", second.Document.Url)
+	}
+
+	// Different relevant headers, no-store responses and no-store
+	// requests all reach the site.
+	fetch("/page", map[string]string{"Accept-Language": "de"})
+	fetch("/private", nil)
+	fetch("/private", nil)
+	fetch("/page", map[string]string{"Cache-Control": "no-store"})
+	if n := atomic.LoadInt32(&hits); n != 5 {
+		t.Errorf("expected 5 fetches, got %d", n)
+	}
+
+	if hit := testutil.ToFloat64(metrics.CacheHits.WithLabelValues("response")); hit != 1 {
+		t.Errorf("expected 1 cache hit, got %v", hit)
+	}
+	if miss := testutil.ToFloat64(metrics.CacheMisses.WithLabelValues("response")); miss != 4 {
+		t.Errorf("expected 4 cache misses, got %v", miss)
+	}
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache(20*time.Millisecond, 0)
+
+	c.Set(ctx, "short", "a", 0)
+	c.Set(ctx, "long", "b", time.Hour)
+	if item, err := c.Get(ctx, "short"); err != nil || item.Value != "a" {
+		t.Fatalf("expected a fresh item, got %v (%v)", item, err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := c.Get(ctx, "short"); err != cache.ErrCacheExpired {
+		t.Errorf("expected the default TTL to expire the item, got %v", err)
+	}
+	if _, err := c.Get(ctx, "short"); err != cache.ErrCacheMiss {
+		t.Errorf("expected the expired item to be gone, got %v", err)
+	}
+	if ok, _ := c.Exists(ctx, "long"); !ok {
+		t.Error("expected the item with its own TTL to survive")
+	}
+	if keys, _ := c.Keys(ctx, "*"); len(keys) != 1 || keys[0] != "long" {
+		t.Errorf("expected only the live key, got %v", keys)
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache(time.Hour, 2)
+
+	c.Set(ctx, "a", 1, 0)
+	c.Set(ctx, "b", 2, 0)
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", 3, 0)
+
+	if ok, _ := c.Exists(ctx, "b"); ok {
+		t.Error("expected the least recently used key to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if ok, _ := c.Exists(ctx, key); !ok {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+
+	// Overwriting a key does not count against the limit.
+	c.Set(ctx, "c", 4, 0)
+	if keys, _ := c.Keys(ctx, "?"); len(keys) != 2 {
+		t.Errorf("expected 2 keys, got %v", keys)
+	}
+}
+
+func TestMemoryCacheTrim(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache(time.Hour, 0)
+
+	c.Set(ctx, "expired", 0, time.Nanosecond)
+	for i := 0; i < 4; i++ {
+		c.Set(ctx, fmt.Sprintf("key-%d", i), i, 0)
+	}
+	c.Get(ctx, "key-0")
+	time.Sleep(time.Millisecond)
+
+	c.Trim(0.5)
+	keys, _ := c.Keys(ctx, "*")
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "key-0,key-3" {
+		t.Errorf("expected the two most recently used keys to be kept, got %v", keys)
+	}
+
+	c.Trim(0)
+	if keys, _ := c.Keys(ctx, "*"); len(keys) != 0 {
+		t.Errorf("expected Trim(0) to empty the cache, got %v", keys)
+	}
+}
+
+func TestMemoryCacheStats(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewMemoryCache(time.Hour, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", i)
+			c.Set(ctx, key, i, 0)
+			c.Get(ctx, key)
+			c.Get(ctx, key)
+			c.Get(ctx, "missing")
+		}(i)
+	}
+	wg.Wait()
+
+	stats, err := c.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalKeys != 10 || stats.HitCount != 20 || stats.MissCount != 10 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats.HitRatio < 0.66 || stats.HitRatio > 0.67 {
+		t.Errorf("expected a hit ratio of 2/3, got %v", stats.HitRatio)
+	}
+}
+
+func TestDistributedCacheStrategies(t *testing.T) {
+	ctx := context.Background()
+	eventually := func(cond func() bool) bool {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			if cond() {
+				return true
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		return false
+	}
+
+	for _, strategy := range []cache.CacheStrategy{cache.WriteThrough, cache.WriteBack, cache.WriteAround} {
+		t.Run(string(strategy), func(t *testing.T) {
+			primary := cache.NewMemoryCache(time.Hour, 0)
+			secondary := cache.NewMemoryCache(time.Hour, 0)
+			distributed := cache.NewDistributedCache(primary, secondary, strategy)
+			defer distributed.Close()
+			var c cache.Cache = distributed
+
+			c.Set(ctx, "shared", "value", 0)
+			secondary.Set(ctx, "secondary-only", "value", 0)
+
+			if ok, err := c.Exists(ctx, "shared"); err != nil || !ok {
+				t.Errorf("expected shared to exist, got %v (%v)", ok, err)
+			}
+			if ok, err := c.Exists(ctx, "secondary-only"); err != nil || !ok {
+				t.Errorf("expected Exists to fall back to the secondary, got %v (%v)", ok, err)
+			}
+			if ok, _ := c.Exists(ctx, "missing"); ok {
+				t.Error("expected a missing key not to exist")
+			}
+
+			keys, err := c.Keys(ctx, "*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(keys)
+			if strings.Join(keys, ",") != "secondary-only,shared" {
+				t.Errorf("expected the keys of both tiers once each, got %v", keys)
+			}
+
+			primary.Get(ctx, "shared")
+			secondary.Get(ctx, "missing")
+			stats, err := c.Stats(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.HitCount < 1 || stats.MissCount < 1 || stats.TotalKeys < 1 || stats.TotalKeys > 2 {
+				t.Errorf("unexpected merged stats %+v", stats)
+			}
+
+			if err := c.Delete(ctx, "shared"); err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := primary.Exists(ctx, "shared"); ok {
+				t.Error("expected Delete to remove the key from the primary at once")
+			}
+			if !eventually(func() bool { ok, _ := secondary.Exists(ctx, "shared"); return !ok }) {
+				t.Error("expected Delete to reach the secondary")
+			}
+
+			if err := c.Clear(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if !eventually(func() bool { keys, _ := c.Keys(ctx, "*"); return len(keys) == 0 }) {
+				t.Error("expected Clear to empty both tiers")
+			}
+		})
+	}
+}
+
+// stalledCache is a MemoryCache whose Set waits for release, standing in
+// for a secondary tier that has stopped responding.
+type stalledCache struct {
+	*cache.MemoryCache
+	stalled chan struct{}
+	release chan struct{}
+}
+
+func (c stalledCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	select {
+	case c.stalled <- struct{}{}:
+	default:
+	}
+	<-c.release
+	return c.MemoryCache.Set(ctx, key, value, ttl)
+}
+
+func TestDistributedCacheWriteBackQueueAndClose(t *testing.T) {
+	ctx := context.Background()
+	primary := cache.NewMemoryCache(time.Hour, 0)
+	secondary := stalledCache{cache.NewMemoryCache(time.Hour, 0), make(chan struct{}, 1), make(chan struct{})}
+	c := cache.NewDistributedCache(primary, secondary, cache.WriteBack)
+
+	// With the secondary stalled on key-0, Sets beyond the queue are
+	// dropped rather than blocking the caller.
+	c.Set(ctx, "key-0", 0, 0)
+	<-secondary.stalled
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 2000; i++ {
+			if err := c.Set(ctx, fmt.Sprintf("key-%d", i), i, 0); err != nil {
+				t.Errorf("set %d: %v", i, err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Set not to block on a full write-back queue")
+	}
+	if dropped := c.DroppedWrites(); dropped != 2000-1024 {
+		t.Errorf("expected the Sets beyond the queue to be dropped, got %d", dropped)
+	}
+
+	// Deletes must not be lost, so they wait for room, as long as ctx allows.
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := c.Delete(waitCtx, "key-0"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Delete to give up with its context, got %v", err)
+	}
+
+	// Close applies what was queued before returning.
+	close(secondary.release)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := secondary.Exists(ctx, "key-1000"); !ok {
+		t.Error("expected the queued updates to be applied by Close")
+	}
+	if err := c.Set(ctx, "late", 1, 0); !errors.Is(err, cache.ErrCacheClosed) {
+		t.Errorf("expected ErrCacheClosed after Close, got %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("expected a second Close to be a no-op, got %v", err)
+	}
+}
+
+func TestSmartScrapeCached(t *testing.T) {
+	var pageHits, missingHits int32
+	release := make(chan struct{})
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			atomic.AddInt32(&pageHits, 1)
+			<-release
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>Cached Page</title></head><body><p>Hello</p></body></html>`))
+		default:
+			atomic.AddInt32(&missingHits, 1)
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	t.Run("concurrent calls share one fetch", func(t *testing.T) {
+		var wg sync.WaitGroup
+		results := make([]*goscraper.SmartData, 5)
+		errs := make([]error, len(results))
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i], errs[i] = goscraper.SmartScrapeCached(site.URL+"/page", time.Minute)
+			}(i)
+		}
+
+		deadline := time.Now().Add(10 * time.Second)
+		for atomic.LoadInt32(&pageHits) == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(release)
+		wg.Wait()
+
+		for i, data := range results {
+			if errs[i] != nil || data == nil || data.Title != "Cached Page" {
+				t.Fatalf("call %d: unexpected result %+v (%v)", i, data, errs[i])
+			}
+			if data != results[0] {
+				t.Errorf("call %d: expected the shared result", i)
+			}
+		}
+		if hits := atomic.LoadInt32(&pageHits); hits != 1 {
+			t.Errorf("expected one fetch for concurrent calls, got %d", hits)
+		}
+	})
+
+	t.Run("later calls hit the cache", func(t *testing.T) {
+		data, err := goscraper.SmartScrapeCached(site.URL+"/page", time.Minute)
+		if err != nil || data == nil || data.Title != "Cached Page" {
+			t.Fatalf("unexpected cached result %+v (%v)", data, err)
+		}
+		if hits := atomic.LoadInt32(&pageHits); hits != 1 {
+			t.Errorf("expected the cached result to skip the network, got %d fetches", hits)
+		}
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if _, err := goscraper.SmartScrapeCached(site.URL+"/missing", time.Minute); err == nil {
+				t.Fatalf("call %d: expected an error for a 404", i)
+			}
+		}
+		if hits := atomic.LoadInt32(&missingHits); hits < 2 {
+			t.Errorf("expected a failed scrape to be fetched again, got %d fetches", hits)
+		}
+	})
+}
@@ -0,0 +1,1478 @@
+package tests
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/ramusaaa/goscraper"
+	"github.com/ramusaaa/goscraper/pkg/cache"
+	"github.com/ramusaaa/goscraper/pkg/monitoring"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMaxTimeToFirstByteAbortsSlowOrigin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithMaxRetries(0),
+		goscraper.WithMaxTimeToFirstByte(50*time.Millisecond),
+	)
+
+	if _, err := scraper.Get(server.URL + "/slow"); !errors.Is(err, goscraper.ErrSlowOrigin) {
+		t.Fatalf("expected ErrSlowOrigin, got %v", err)
+	}
+	if _, err := scraper.Get(server.URL + "/fast"); err != nil {
+		t.Fatalf("fast origin failed: %v", err)
+	}
+}
+
+func TestRedirectPolicySameHostOnly(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>other</body></html>")
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/local":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+		default:
+			fmt.Fprint(w, "<html><body>final</body></html>")
+		}
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithRedirectPolicy(goscraper.SameHostOnly),
+	)
+
+	resp, err := scraper.Get(server.URL + "/local")
+	if err != nil {
+		t.Fatalf("same-host redirect failed: %v", err)
+	}
+	if len(resp.RedirectChain) != 2 || resp.RedirectChain[1] != server.URL+"/final" {
+		t.Errorf("unexpected redirect chain: %v", resp.RedirectChain)
+	}
+
+	_, err = scraper.Get(server.URL + "/away")
+	var policyErr *goscraper.RedirectPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected RedirectPolicyError, got %v", err)
+	}
+	if len(policyErr.Chain) != 2 || policyErr.Chain[0] != server.URL+"/away" {
+		t.Errorf("unexpected chain: %v", policyErr.Chain)
+	}
+}
+
+func TestRedirectPolicyMaxPerHost(t *testing.T) {
+	var origin string
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, origin+"/done", http.StatusFound)
+	}))
+	defer tracker.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/loop" {
+			http.Redirect(w, r, strings.Replace(tracker.URL, "127.0.0.1", "localhost", 1)+"/track", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "<html><body>done</body></html>")
+	}))
+	defer server.Close()
+	origin = server.URL
+
+	// The original request counts as a visit, so A -> B -> A returns to A
+	// for the second time.
+	strict := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0),
+		goscraper.WithRedirectPolicy(goscraper.MaxPerHost(1)))
+	_, err := strict.Get(server.URL + "/loop")
+	var policyErr *goscraper.RedirectPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected RedirectPolicyError, got %v", err)
+	}
+	if len(policyErr.Chain) != 3 || policyErr.Chain[2] != server.URL+"/done" {
+		t.Errorf("unexpected chain: %v", policyErr.Chain)
+	}
+
+	lenient := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithRedirectPolicy(goscraper.MaxPerHost(2)))
+	resp, err := lenient.Get(server.URL + "/loop")
+	if err != nil {
+		t.Fatalf("expected two visits per host to be allowed, got %v", err)
+	}
+	if len(resp.RedirectChain) != 3 {
+		t.Errorf("unexpected redirect chain: %v", resp.RedirectChain)
+	}
+}
+
+func TestProxyRotationAndFailover(t *testing.T) {
+	hits := make(map[string]int)
+	var mu sync.Mutex
+	newProxy := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits[name]++
+			mu.Unlock()
+			fmt.Fprint(w, "<html><body>ok</body></html>")
+		}))
+	}
+	first, second := newProxy("first"), newProxy("second")
+	defer first.Close()
+	defer second.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	rotating := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithProxies(first.URL, second.URL))
+	for i := 0; i < 4; i++ {
+		if _, err := rotating.Get("http://shop.example/"); err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+	}
+	if hits["first"] != 2 || hits["second"] != 2 {
+		t.Errorf("expected requests spread evenly, got %v", hits)
+	}
+
+	sticky := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithProxies(dead.URL, first.URL, second.URL),
+		goscraper.WithProxyRotation(false),
+		func(c *goscraper.Config) { c.RetryDelay = 0 },
+	)
+	for i := 0; i < 3; i++ {
+		if _, err := sticky.Get("http://shop.example/"); err != nil {
+			t.Fatalf("request %d did not fail over: %v", i, err)
+		}
+	}
+	if hits["first"] != 5 || hits["second"] != 2 {
+		t.Errorf("expected every request to stick to the first live proxy, got %v", hits)
+	}
+}
+
+func TestProxyBanDetectionAvoidsBannedProxyPerHost(t *testing.T) {
+	var blockedHits int
+	blocking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blockedHits++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer blocking.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer working.Close()
+
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithProxies(blocking.URL, working.URL),
+		goscraper.WithRotateOnRetry(true),
+		goscraper.WithProxyBanDetection(time.Minute),
+		func(c *goscraper.Config) { c.RetryDelay = 0 },
+	)
+
+	for i := 0; i < 3; i++ {
+		resp, err := scraper.Get("http://shop.example/")
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+	}
+
+	if blockedHits != 1 {
+		t.Errorf("banned proxy used %d times, want 1", blockedHits)
+	}
+	bans := scraper.ProxyBans()
+	if len(bans) != 1 || bans[0].Host != "shop.example" {
+		t.Errorf("unexpected bans: %+v", bans)
+	}
+}
+
+// newConnectProxy returns a proxy that tunnels CONNECT requests, counting
+// them in tunnels. Tunnels go to upstream, or to the requested host when
+// upstream is empty.
+func newConnectProxy(tunnels *int32, upstream string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		atomic.AddInt32(tunnels, 1)
+		target := upstream
+		if target == "" {
+			target = r.Host
+		}
+		conn, err := net.Dial("tcp", target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		client, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			conn.Close()
+			return
+		}
+		go func() {
+			io.Copy(conn, buf)
+			conn.Close()
+		}()
+		io.Copy(client, conn)
+		client.Close()
+	}))
+}
+
+func TestStealthRetriesRotateProxiesAndKeepTLSSettings(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	var firstTunnels, secondTunnels int32
+	first, second := newConnectProxy(&firstTunnels, ""), newConnectProxy(&secondTunnels, "")
+	defer first.Close()
+	defer second.Close()
+
+	// The test server's certificate is only accepted because its host is
+	// listed, so the proxied stealth requests must keep the TLS settings.
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithStealth(true),
+		goscraper.WithProxies(first.URL, second.URL),
+		goscraper.WithRotateOnRetry(true),
+		goscraper.WithInsecureHosts([]string{"localhost"}),
+		func(c *goscraper.Config) { c.RetryDelay = 0 },
+	)
+	resp, err := scraper.Get(strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	if err != nil {
+		t.Fatalf("expected the retry to succeed through the other proxy, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", resp.StatusCode)
+	}
+	if firstTunnels != 1 || secondTunnels != 1 {
+		t.Errorf("expected one attempt through each proxy, got %d and %d", firstTunnels, secondTunnels)
+	}
+}
+
+func TestStealthBlockedRetryStaysOnTheProxy(t *testing.T) {
+	t.Parallel()
+
+	// The target does not resolve, so only requests sent through the proxy
+	// can succeed.
+	var hits int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer proxy.Close()
+
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithMaxRetries(0),
+		goscraper.WithStealth(true),
+		goscraper.WithProxies(proxy.URL),
+	)
+	resp, err := scraper.Get("http://shop.invalid/")
+	if err != nil {
+		t.Fatalf("expected the blocked request to be retried through the proxy, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", resp.StatusCode)
+	}
+	if hits != 2 {
+		t.Errorf("expected both requests through the proxy, got %d", hits)
+	}
+}
+
+func TestDisableKeepAlivesOpensAConnectionPerRequest(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		options []goscraper.Option
+		want    int32
+	}{
+		{"keep-alive", nil, 1},
+		{"disabled", []goscraper.Option{goscraper.WithDisableKeepAlives(true)}, 2},
+		{"stealth keep-alive", []goscraper.Option{goscraper.WithStealth(true)}, 1},
+		{"stealth disabled", []goscraper.Option{goscraper.WithStealth(true), goscraper.WithDisableKeepAlives(true)}, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var conns int32
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "<html><body>ok</body></html>")
+			}))
+			server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&conns, 1)
+				}
+			}
+			server.Start()
+			defer server.Close()
+
+			options := append([]goscraper.Option{goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0)}, tc.options...)
+			scraper := goscraper.New(options...)
+			for i := 0; i < 2; i++ {
+				if _, err := scraper.Get(server.URL + "/"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := atomic.LoadInt32(&conns); got != tc.want {
+				t.Errorf("expected %d connections for two requests, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestInsecureHostsOnlySkipVerificationForListedHosts(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+
+	// Every host name is tunnelled to the test server, whose self-signed
+	// certificate is only accepted where verification is skipped.
+	var tunnels int32
+	proxy := newConnectProxy(&tunnels, server.Listener.Addr().String())
+	defer proxy.Close()
+
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithMaxRetries(0),
+		goscraper.WithProxies(proxy.URL),
+		goscraper.WithInsecureHosts([]string{"Shop.Internal", "cdn.internal"}),
+	)
+	for host, allowed := range map[string]bool{
+		"shop.internal":     true,
+		"cdn.internal":      true,
+		"other.internal":    false,
+		"api.shop.internal": false,
+		"internal":          false,
+	} {
+		_, err := scraper.Get("https://" + host + port)
+		if allowed && err != nil {
+			t.Errorf("%s: expected verification to be skipped, got %v", host, err)
+		}
+		var hostErr x509.HostnameError
+		var authorityErr x509.UnknownAuthorityError
+		if !allowed && !errors.As(err, &hostErr) && !errors.As(err, &authorityErr) {
+			t.Errorf("%s: expected a certificate verification error, got %v", host, err)
+		}
+	}
+
+	direct := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0))
+	if _, err := direct.Get(server.URL); err == nil {
+		t.Error("expected verification without WithInsecureHosts")
+	}
+
+	// IP hosts are dialed directly and matched on the address.
+	for _, tc := range []struct {
+		hosts   []string
+		allowed bool
+	}{
+		{[]string{"127.0.0.1"}, true},
+		{[]string{"localhost", "127.0.0.2"}, false},
+	} {
+		for _, stealthy := range []bool{false, true} {
+			scraper := goscraper.New(
+				goscraper.WithRateLimit(0),
+				goscraper.WithMaxRetries(0),
+				goscraper.WithStealth(stealthy),
+				goscraper.WithInsecureHosts(tc.hosts),
+			)
+			_, err := scraper.Get(server.URL)
+			if tc.allowed && err != nil {
+				t.Errorf("%v (stealth %v): expected verification to be skipped for %s, got %v", tc.hosts, stealthy, server.URL, err)
+			}
+			var authorityErr x509.UnknownAuthorityError
+			if !tc.allowed && !errors.As(err, &authorityErr) {
+				t.Errorf("%v (stealth %v): expected a certificate verification error for %s, got %v", tc.hosts, stealthy, server.URL, err)
+			}
+		}
+	}
+
+	// Through a proxy the address asked for is not known, so it is refused.
+	proxied := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithMaxRetries(0),
+		goscraper.WithProxies(proxy.URL),
+		goscraper.WithInsecureHosts([]string{"127.0.0.1"}),
+	)
+	if _, err := proxied.Get(server.URL); err == nil {
+		t.Error("expected an IP host to be refused through a proxy")
+	}
+}
+
+func TestResponseBodyIsRawMarkup(t *testing.T) {
+	page := `<!DOCTYPE html><html><head><script type="application/ld+json">{ "name" :  "x" }</script></head><body>Line<br/>mail: a@b.example</body></html>`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(page))
+		gz.Close()
+	}))
+	defer server.Close()
+
+	resp, err := goscraper.New(goscraper.WithRateLimit(0)).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != page {
+		t.Errorf("body was altered:\n got %q\nwant %q", resp.Body, page)
+	}
+	if resp.Document.Find("body").Text() != "Linemail: a@b.example" {
+		t.Errorf("document not parsed from body: %q", resp.Document.Find("body").Text())
+	}
+}
+
+func TestContentEncodings(t *testing.T) {
+	const page = "<html><head><title>Encoded</title></head><body></body></html>"
+
+	goscraper.RegisterContentDecoder("x-reverse", func(r io.Reader) (io.ReadCloser, error) {
+		data, err := io.ReadAll(r)
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+		return io.NopCloser(bytes.NewReader(data)), err
+	})
+	defer goscraper.UnregisterContentDecoder("x-reverse")
+
+	encoders := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"raw-deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+		"br": func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	}
+
+	var accepted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted = r.Header.Get("Accept-Encoding")
+		encoding := strings.TrimPrefix(r.URL.Path, "/")
+		switch encoding {
+		case "identity":
+			fmt.Fprint(w, page)
+		case "x-reverse":
+			w.Header().Set("Content-Encoding", encoding)
+			reversed := []byte(page)
+			for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+				reversed[i], reversed[j] = reversed[j], reversed[i]
+			}
+			w.Write(reversed)
+		case "x-unknown":
+			w.Header().Set("Content-Encoding", encoding)
+			fmt.Fprint(w, page)
+		default:
+			w.Header().Set("Content-Encoding", strings.TrimPrefix(encoding, "raw-"))
+			enc := encoders[encoding](w)
+			io.WriteString(enc, page)
+			enc.Close()
+		}
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0))
+	for _, encoding := range []string{"identity", "gzip", "deflate", "raw-deflate", "br", "x-reverse"} {
+		resp, err := scraper.Get(server.URL + "/" + encoding)
+		if err != nil {
+			t.Errorf("%s: %v", encoding, err)
+			continue
+		}
+		if title := resp.Document.Find("title").Text(); title != "Encoded" {
+			t.Errorf("%s: parsed title %q", encoding, title)
+		}
+	}
+
+	if accepted != "gzip, deflate, br, x-reverse" {
+		t.Errorf("Accept-Encoding should list exactly the decodable encodings, got %q", accepted)
+	}
+	if _, err := scraper.Get(server.URL + "/x-unknown"); !errors.Is(err, goscraper.ErrUnsupportedEncoding) {
+		t.Errorf("expected ErrUnsupportedEncoding for an encoding without a decoder, got %v", err)
+	}
+
+	goscraper.UnregisterContentDecoder("x-reverse")
+	goscraper.UnregisterContentDecoder("gzip")
+	if _, err := scraper.Get(server.URL + "/x-reverse"); !errors.Is(err, goscraper.ErrUnsupportedEncoding) {
+		t.Errorf("expected an unregistered decoder to be gone, got %v", err)
+	}
+	if strings.Contains(accepted, "x-reverse") || !strings.Contains(accepted, "gzip") {
+		t.Errorf("expected only the built-in encodings to stay advertised, got %q", accepted)
+	}
+}
+
+func TestExpectedContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" {
+			w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+			fmt.Fprint(w, `{"status": 404}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>Please log in</body></html>")
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithExpectedContentType("application/json"),
+	)
+
+	if _, err := scraper.Get(server.URL + "/api"); err != nil {
+		t.Errorf("+json response should satisfy application/json: %v", err)
+	}
+	_, err := scraper.Get(server.URL + "/login")
+	if !errors.Is(err, goscraper.ErrUnexpectedContentType) {
+		t.Errorf("expected ErrUnexpectedContentType, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "attempts") {
+		t.Errorf("expected a request that was not retried not to report attempts, got %v", err)
+	}
+
+	rotating := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithMaxRetries(1),
+		goscraper.WithExpectedContentType("application/json"),
+		goscraper.WithRotateOnRetry(true),
+	)
+	if _, err := rotating.Get(server.URL + "/login"); err == nil || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Errorf("expected the retried request to report 2 attempts, got %v", err)
+	}
+}
+
+func TestNonHTMLContentIsNotParsed(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/image" {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write(png)
+			return
+		}
+		fmt.Fprint(w, "<html><body>caf\xe9</body></html>")
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0))
+
+	_, err := scraper.Get(server.URL + "/image")
+	var nonHTML *goscraper.NonHTMLContentError
+	if !errors.Is(err, goscraper.ErrNonHTMLContent) || !errors.As(err, &nonHTML) {
+		t.Fatalf("expected ErrNonHTMLContent, got %v", err)
+	}
+	if nonHTML.ContentType != "image/png" || !bytes.Equal(nonHTML.Body, png) {
+		t.Errorf("unexpected error details: %q, %q", nonHTML.ContentType, nonHTML.Body)
+	}
+
+	if _, err := scraper.Get(server.URL + "/latin1"); err != nil {
+		t.Errorf("non-UTF-8 text should still be parsed: %v", err)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	roomyCache := cache.NewMemoryCache(time.Hour, 0)
+	roomy := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMemoryBudget(1<<40), goscraper.WithCache(roomyCache, time.Hour))
+	defer roomy.Close()
+	if _, err := roomy.Get(server.URL); err != nil {
+		t.Fatalf("request within budget failed: %v", err)
+	}
+
+	// A tight budget on one scraper only shrinks that scraper's cache and pool.
+	ctx := context.Background()
+	tightCache := cache.NewMemoryCache(time.Hour, 0)
+	for _, key := range []string{"old", "older", "recent", "page"} {
+		tightCache.Set(ctx, key, "cached", time.Hour)
+	}
+	tightCache.Get(ctx, "recent")
+	manager, created := newFakeBrowserManager(1, "<html></html>", nil)
+	if err := manager.WarmUp(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	tight := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithMemoryBudget(1),
+		goscraper.WithCache(tightCache, time.Hour),
+		goscraper.WithChallengeSolver(manager),
+	)
+	defer tight.Close()
+	if _, err := tight.Get(server.URL); !errors.Is(err, goscraper.ErrMemoryPressure) {
+		t.Errorf("expected ErrMemoryPressure over budget, got %v", err)
+	}
+	// Half the cache is evicted, least recently used first, and only once
+	// while memory stays tight.
+	time.Sleep(600 * time.Millisecond)
+	if keys, _ := tightCache.Keys(ctx, "*"); len(keys) != 2 {
+		t.Errorf("expected half the memory cache to be evicted under pressure, got %v", keys)
+	}
+	for _, key := range []string{"recent", "page"} {
+		if ok, _ := tightCache.Exists(ctx, key); !ok {
+			t.Errorf("expected the recently used %s to be kept", key)
+		}
+	}
+	if engines := created(); len(engines) != 1 || !engines[0].isClosed() {
+		t.Error("expected the idle browser to be closed under pressure")
+	}
+	if keys, _ := roomyCache.Keys(ctx, "*"); len(keys) == 0 {
+		t.Error("expected the roomy scraper's cache to be left alone")
+	}
+}
+
+func TestContextDeadlineStopsRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(3))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := scraper.GetWithContext(ctx, server.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("request kept retrying for %s after the deadline", elapsed)
+	}
+}
+
+func TestDoSendsMethodBodyAndHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "<html><body><p id=method>%s</p><p id=body>%s</p><p id=type>%s</p></body></html>",
+			r.Method, body, r.Header.Get("Content-Type"))
+	}))
+	defer server.Close()
+
+	resp, err := goscraper.New(goscraper.WithRateLimit(0)).Do(context.Background(), http.MethodPost, server.URL,
+		strings.NewReader(`{"q":"lamp"}`), map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := resp.Document
+	if doc.Find("#method").Text() != "POST" || doc.Find("#body").Text() != `{"q":"lamp"}` || doc.Find("#type").Text() != "application/json" {
+		t.Errorf("unexpected echo: %s", resp.Body)
+	}
+}
+
+func TestGetManyCapsConcurrency(t *testing.T) {
+	var inFlight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+		fmt.Fprintf(w, "<html><body>%s</body></html>", r.URL.Path)
+	}))
+	defer server.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithMaxConcurrency(3),
+		goscraper.WithMaxRetries(0),
+	)
+
+	urls := []string{dead.URL + "/down"}
+	for i := 0; i < 9; i++ {
+		urls = append(urls, fmt.Sprintf("%s/page/%d", server.URL, i))
+	}
+	responses, errs := scraper.GetMany(context.Background(), urls)
+
+	if errs[0] == nil || responses[0] != nil {
+		t.Errorf("expected the unreachable URL to fail on its own, got %v", errs[0])
+	}
+	for i := 1; i < len(urls); i++ {
+		if errs[i] != nil {
+			t.Fatalf("url %d failed: %v", i, errs[i])
+		}
+		if want := fmt.Sprintf("/page/%d", i-1); !strings.Contains(responses[i].Body, want) {
+			t.Errorf("response %d out of order: %q", i, responses[i].Body)
+		}
+	}
+	if peak < 2 || peak > 3 {
+		t.Errorf("expected up to 3 requests in flight, saw %d", peak)
+	}
+}
+
+func TestRequestsPerSecondSpacesConcurrentRequests(t *testing.T) {
+	var mu sync.Mutex
+	var arrivals []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		mu.Unlock()
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(goscraper.WithRequestsPerSecond(20, 1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := scraper.Get(server.URL); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(arrivals, func(i, j int) bool { return arrivals[i].Before(arrivals[j]) })
+	if span := arrivals[len(arrivals)-1].Sub(arrivals[0]); span < 180*time.Millisecond {
+		t.Errorf("5 requests at 20 rps should span at least 200ms, took %s", span)
+	}
+	for i := 1; i < len(arrivals); i++ {
+		if gap := arrivals[i].Sub(arrivals[i-1]); gap < 35*time.Millisecond {
+			t.Errorf("requests %d and %d only %s apart", i-1, i, gap)
+		}
+	}
+}
+
+func TestRateLimitWaitHonorsContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(goscraper.WithRateLimit(time.Hour))
+	if _, err := scraper.Get(server.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := scraper.GetWithContext(ctx, server.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("rate limit wait ignored the context")
+	}
+}
+
+func TestBlockStatsClassifiesBlocks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/datadome":
+			w.Header().Set("X-DataDome", "protected")
+			w.WriteHeader(http.StatusForbidden)
+		case "/captcha":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<html><body><div class="g-recaptcha"></div></body></html>`)
+		case "/challenge":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `<html><body><div id="cf-browser-verification"></div></body></html>`)
+		default:
+			fmt.Fprint(w, "<html><body>ok</body></html>")
+		}
+	}))
+	defer server.Close()
+
+	core, logs := observer.New(zap.WarnLevel)
+	metrics := monitoring.NewMetrics(zap.NewNop())
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithMaxRetries(0),
+		goscraper.WithLogger(zap.New(core)),
+		goscraper.WithMetrics(metrics),
+	)
+
+	for _, path := range []string{"/limited", "/limited", "/datadome", "/captcha", "/challenge", "/ok"} {
+		scraper.Get(server.URL + path)
+	}
+
+	host := strings.Split(strings.TrimPrefix(server.URL, "http://"), ":")[0]
+	want := map[goscraper.BlockType]int{
+		goscraper.BlockRateLimited:  2,
+		goscraper.BlockDataDome:     1,
+		goscraper.BlockCaptcha:      1,
+		goscraper.BlockCloudflareJS: 1,
+	}
+	stats := scraper.BlockStats()
+	if len(stats) != 1 || len(stats[host]) != len(want) {
+		t.Fatalf("unexpected block stats %v", stats)
+	}
+	for blockType, count := range want {
+		if stats[host][blockType] != count {
+			t.Errorf("expected %d %s blocks, got %d", count, blockType, stats[host][blockType])
+		}
+	}
+
+	if got := testutil.ToFloat64(metrics.BlocksTotal.WithLabelValues(host, "429")); got != 2 {
+		t.Errorf("expected goscraper_blocks_total to count 2 rate limits, got %v", got)
+	}
+	if entries := logs.FilterMessage("Request blocked").All(); len(entries) != 5 {
+		t.Errorf("expected 5 block log entries, got %d", len(entries))
+	} else if entries[0].ContextMap()["block_type"] != "429" {
+		t.Errorf("expected the block type to be logged, got %v", entries[0].ContextMap())
+	}
+}
+
+func TestStealthBlocksAreCountedOnce(t *testing.T) {
+	// Stealth requests wait a human delay, so run alongside other tests.
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	core, logs := observer.New(zap.WarnLevel)
+	metrics := monitoring.NewMetrics(zap.NewNop())
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithMaxRetries(0),
+		goscraper.WithStealth(true),
+		goscraper.WithLogger(zap.New(core)),
+		goscraper.WithMetrics(metrics),
+	)
+	// The stealth client retries the blocked request once more before
+	// giving up; the attempt is still a single block.
+	scraper.Get(server.URL)
+
+	host := strings.Split(strings.TrimPrefix(server.URL, "http://"), ":")[0]
+	if got := scraper.BlockStats()[host][goscraper.BlockRateLimited]; got != 1 {
+		t.Errorf("expected 1 rate limit block, got %d", got)
+	}
+	if got := testutil.ToFloat64(metrics.BlocksTotal.WithLabelValues(host, "429")); got != 1 {
+		t.Errorf("expected goscraper_blocks_total to count 1 block, got %v", got)
+	}
+	if entries := logs.FilterMessage("Request blocked").All(); len(entries) != 1 {
+		t.Errorf("expected 1 block log entry, got %d", len(entries))
+	}
+}
+
+func TestMetricsRecordRequestsAndRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body><h1>Hello</h1></body></html>")
+	}))
+	defer server.Close()
+
+	metrics := monitoring.NewMetrics(zap.NewNop())
+	scraper := goscraper.New(
+		goscraper.WithMaxRetries(2),
+		func(c *goscraper.Config) { c.RetryDelay = 0 },
+		goscraper.WithMetrics(metrics),
+	)
+
+	resp, err := scraper.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scraper.Get(server.URL + "/again"); err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.Split(strings.TrimPrefix(server.URL, "http://"), ":")[0]
+	if got := testutil.ToFloat64(metrics.RequestsTotal.WithLabelValues("GET", "200", host)); got != 2 {
+		t.Errorf("expected 2 successful requests, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.ResponseStatus.WithLabelValues("200", host)); got != 2 {
+		t.Errorf("expected 2 responses with status 200, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.HostRetries.WithLabelValues("http", host, "503")); got != 1 {
+		t.Errorf("expected 1 retry after a 503, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.RetryAttempts.WithLabelValues("http", "503")); got != 1 {
+		t.Errorf("expected the retry in goscraper_retry_attempts_total too, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.RequestsInFlight.WithLabelValues(host)); got != 0 {
+		t.Errorf("expected no requests in flight, got %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.ResponseSize); got != 1 {
+		t.Errorf("expected response sizes for one host, got %d", got)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	failing := goscraper.New(goscraper.WithMaxRetries(0), goscraper.WithMetrics(metrics))
+	if _, err := failing.Get("http://127.0.0.1:1/"); err == nil {
+		t.Fatal("expected an error for an unreachable host")
+	}
+	if got := testutil.ToFloat64(metrics.RequestsTotal.WithLabelValues("GET", "error", "127.0.0.1")); got != 1 {
+		t.Errorf("expected the failed request to be counted, got %v", got)
+	}
+}
+
+func TestHTMLPreprocessorsRunBeforeParsing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "\ufeff<html><body><p id=\"price\">10&amp;nbsp;EUR</p><div class=\"ad\">Buy now</div><a href=\"page2\">next</a></body></html>")
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithHTMLPreprocessor(func(html string) string {
+			html = strings.Replace(html, `<div class="ad">Buy now</div>`, "", 1)
+			return strings.Replace(html, "<body>", `<body><base href="https://cdn.example/catalog/">`, 1)
+		}),
+	)
+
+	resp, err := scraper.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if !strings.HasPrefix(resp.Body, "\ufeff<html><body><p id=\"price\">10&amp;nbsp;EUR</p><div class=\"ad\">") {
+		t.Errorf("expected Body to hold the page as fetched, got %q", resp.Body)
+	}
+	if got := resp.Document.Find("#price").Text(); got != "10\u00a0EUR" {
+		t.Errorf("expected the double-escaped nbsp to be repaired, got %q", got)
+	}
+	if resp.Document.Find(".ad").Length() != 0 {
+		t.Error("expected the custom preprocessor to remove the ad")
+	}
+	if links := goscraper.NewParser(resp.Document).ExtractLinks(); len(links) != 1 || links[0].URL != "https://cdn.example/catalog/page2" {
+		t.Errorf("expected links to resolve against the injected base, got %+v", links)
+	}
+}
+
+func TestRespectRobots(t *testing.T) {
+	var robotsFetches, pageHits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddInt32(&robotsFetches, 1)
+			fmt.Fprint(w, `# test site
+User-agent: *
+Disallow: /private/
+Allow: /private/press$
+Crawl-delay: 0.2
+
+User-agent: OtherBot
+Disallow: /
+`)
+			return
+		}
+		atomic.AddInt32(&pageHits, 1)
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithRespectRobots(true))
+
+	_, err := scraper.Get(server.URL + "/private/accounts")
+	var robotsErr *goscraper.RobotsDisallowedError
+	if !errors.Is(err, goscraper.ErrDisallowedByRobots) || !errors.As(err, &robotsErr) || robotsErr.Rule != "/private/" {
+		t.Fatalf("expected the private path to be disallowed, got %v", err)
+	}
+	if atomic.LoadInt32(&pageHits) != 0 {
+		t.Error("expected the disallowed URL not to be requested")
+	}
+
+	start := time.Now()
+	for _, path := range []string{"/public", "/private/press"} {
+		if _, err := scraper.Get(server.URL + path); err != nil {
+			t.Fatalf("expected %s to be allowed, got %v", path, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expected requests to be spaced by the crawl delay, took %s", elapsed)
+	}
+	if delay, err := scraper.CrawlDelay(context.Background(), server.URL); err != nil || delay != 200*time.Millisecond {
+		t.Errorf("expected a 200ms crawl delay, got %v, %v", delay, err)
+	}
+	if n := atomic.LoadInt32(&robotsFetches); n != 1 {
+		t.Errorf("expected robots.txt to be fetched once, got %d", n)
+	}
+
+	if _, err := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithRespectRobots(true), goscraper.WithUserAgent("OtherBot/2.0")).Get(server.URL + "/public"); !errors.Is(err, goscraper.ErrDisallowedByRobots) {
+		t.Errorf("expected OtherBot to be disallowed everywhere, got %v", err)
+	}
+}
+
+func TestScrapeErrorsAreClassified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/403":
+			w.WriteHeader(http.StatusForbidden)
+		case "/429":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/500":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/404":
+			http.NotFound(w, r)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0))
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		want   error
+	}{
+		{"/403", http.StatusForbidden, goscraper.ErrBlocked},
+		{"/429", http.StatusTooManyRequests, goscraper.ErrBlocked},
+		{"/500", http.StatusInternalServerError, goscraper.ErrServerError},
+		{"/404", http.StatusNotFound, goscraper.ErrNotFound},
+		{"/loop", 0, goscraper.ErrTooManyRedirects},
+	} {
+		_, err := scraper.Get(server.URL + tc.path)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.path, tc.want, err)
+		}
+		var scrapeErr *goscraper.ScrapeError
+		if !errors.As(err, &scrapeErr) || scrapeErr.StatusCode != tc.status || scrapeErr.URL != server.URL+tc.path {
+			t.Errorf("%s: expected a ScrapeError with status %d, got %#v", tc.path, tc.status, err)
+		}
+		for _, other := range []error{goscraper.ErrBlocked, goscraper.ErrServerError, goscraper.ErrNotFound, goscraper.ErrTimeout} {
+			if other != tc.want && errors.Is(err, other) {
+				t.Errorf("%s: also classified as %v", tc.path, other)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := scraper.GetWithContext(ctx, server.URL+"/slow"); !errors.Is(err, goscraper.ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestScrapeErrorsKeepTheErrorPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/404":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<html><body><h1>No such product</h1></body></html>`)
+		case "/503":
+			w.Header().Set("Content-Type", "image/png")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "\x89PNG\r\n\x1a\n")
+		case "/pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprint(w, "%PDF-1.7")
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			fmt.Fprint(w, "not gzip")
+		}
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0))
+
+	resp, err := scraper.Get(server.URL + "/404")
+	var scrapeErr *goscraper.ScrapeError
+	if !errors.As(err, &scrapeErr) || !errors.Is(err, goscraper.ErrNotFound) {
+		t.Fatalf("expected a not found ScrapeError, got %v", err)
+	}
+	if resp == nil || resp != scrapeErr.Response || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected the error page to be returned with the error, got %+v", resp)
+	}
+	if got := resp.Document.Find("h1").Text(); got != "No such product" {
+		t.Errorf("expected the error page to be parsed, got %q", got)
+	}
+
+	resp, err = scraper.Get(server.URL + "/503")
+	if !errors.As(err, &scrapeErr) || scrapeErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected a ScrapeError with status 503, got %v", err)
+	}
+	if resp == nil || resp.Body != "\x89PNG\r\n\x1a\n" || resp.Document != nil {
+		t.Errorf("expected the raw body of a non-HTML error page, got %+v", resp)
+	}
+
+	_, err = scraper.Get(server.URL + "/pdf")
+	var nonHTML *goscraper.NonHTMLContentError
+	if !errors.As(err, &scrapeErr) || scrapeErr.StatusCode != 0 || !errors.As(err, &nonHTML) {
+		t.Errorf("expected a ScrapeError wrapping NonHTMLContentError, got %#v", err)
+	}
+
+	if _, err := scraper.Get(server.URL + "/gzip"); !errors.As(err, &scrapeErr) || scrapeErr.URL != server.URL+"/gzip" {
+		t.Errorf("expected a decode failure to be a ScrapeError, got %#v", err)
+	}
+}
+
+func TestRequestAndResponseHooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html><body>%s</body></html>", r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	var order []string
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithRequestHook(func(req *http.Request) error {
+			order = append(order, "request 1")
+			req.Header.Set("Authorization", "Bearer first")
+			return nil
+		}),
+		goscraper.WithRequestHook(func(req *http.Request) error {
+			order = append(order, "request 2")
+			req.Header.Set("Authorization", req.Header.Get("Authorization")+"+second")
+			return nil
+		}),
+		goscraper.WithResponseHook(func(resp *goscraper.Response) error {
+			order = append(order, "response")
+			resp.Body = strings.ToUpper(resp.Body)
+			return nil
+		}),
+	)
+
+	resp, err := scraper.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resp.Body, "BEARER FIRST+SECOND") {
+		t.Errorf("expected the hooked header in the rewritten body, got %q", resp.Body)
+	}
+	if strings.Join(order, ",") != "request 1,request 2,response" {
+		t.Errorf("hooks ran out of order: %v", order)
+	}
+
+	errHook := errors.New("no credentials")
+	failing := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithRequestHook(func(req *http.Request) error { return errHook }),
+	)
+	if _, err := failing.Get(server.URL); !errors.Is(err, errHook) {
+		t.Errorf("expected the request hook's error, got %v", err)
+	}
+
+	rejecting := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithResponseHook(func(resp *goscraper.Response) error { return errHook }),
+	)
+	if resp, err := rejecting.Get(server.URL); !errors.Is(err, errHook) || resp != nil {
+		t.Errorf("expected the response hook's error, got %v, %v", resp, err)
+	}
+}
+
+func TestCookieOptions(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		for _, cookie := range r.Cookies() {
+			names = append(names, cookie.Name+"="+cookie.Value)
+		}
+		sort.Strings(names)
+		received = append(received, strings.Join(names, "; "))
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t", Path: "/"})
+		}
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithCookieString("theme=dark; lang=en-GB"),
+		goscraper.WithCookieHeader("Cookie: consent=yes; bad cookie; id=42"),
+		goscraper.WithCookieJar(jar),
+	)
+
+	for _, path := range []string{"/login", "/account"} {
+		if _, err := scraper.Get(server.URL + path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"consent=yes; id=42; lang=en-GB; theme=dark",
+		"consent=yes; id=42; lang=en-GB; session=s3cr3t; theme=dark",
+	}
+	if strings.Join(received, " | ") != strings.Join(want, " | ") {
+		t.Errorf("expected cookies %q, got %q", want, received)
+	}
+}
+
+func TestMaxHTMLNodes(t *testing.T) {
+	pages := map[string]string{
+		"/small": "<html><body><p>one</p><p>two</p></body></html>",
+		"/flat":  "<html><body>" + strings.Repeat("<span>x</span>", 1000) + "</body></html>",
+		// Few tokens, but the parser reopens <b><i><u> inside every <p>.
+		"/misnested": "<html><body><p><b><i><u>" + strings.Repeat("<p>x", 100) + "</body></html>",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, pages[r.URL.Path])
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0), goscraper.WithMaxHTMLNodes(300))
+	if _, err := scraper.Get(server.URL + "/small"); err != nil {
+		t.Errorf("expected a small page to be parsed, got %v", err)
+	}
+	for _, path := range []string{"/flat", "/misnested"} {
+		if _, err := scraper.Get(server.URL + path); !errors.Is(err, goscraper.ErrDocumentTooComplex) {
+			t.Errorf("%s: expected ErrDocumentTooComplex, got %v", path, err)
+		}
+	}
+
+	unlimited := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxHTMLNodes(0))
+	if resp, err := unlimited.Get(server.URL + "/flat"); err != nil || resp.Document.Find("span").Length() != 1000 {
+		t.Errorf("expected no limit by default, got %v", err)
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	const limit = 1 << 20
+	page := "<html><body>" + strings.Repeat("a", 2*limit) + "</body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stream":
+			// No Content-Length: the limit has to be found while reading.
+			for i := 0; i < len(page); i += 64 << 10 {
+				io.WriteString(w, page[i:min(i+64<<10, len(page))])
+				w.(http.Flusher).Flush()
+			}
+		case "/declared":
+			w.Header().Set("Content-Length", fmt.Sprint(len(page)))
+			io.WriteString(w, page)
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			io.WriteString(gz, page)
+			gz.Close()
+		default:
+			io.WriteString(w, "<html><body>small</body></html>")
+		}
+	}))
+	defer server.Close()
+
+	if size := goscraper.DefaultConfig().MaxResponseSize; size != goscraper.DefaultMaxResponseSize {
+		t.Errorf("expected the default limit to be set, got %d", size)
+	}
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0), goscraper.WithMaxResponseSize(limit))
+	for _, path := range []string{"/stream", "/declared", "/gzip"} {
+		if _, err := scraper.Get(server.URL + path); !errors.Is(err, goscraper.ErrResponseTooLarge) {
+			t.Errorf("%s: expected ErrResponseTooLarge, got %v", path, err)
+		}
+	}
+	if resp, err := scraper.Get(server.URL + "/small"); err != nil || !strings.Contains(resp.Body, "small") {
+		t.Errorf("expected a small response to be read, got %v", err)
+	}
+
+	unlimited := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxResponseSize(0))
+	if resp, err := unlimited.Get(server.URL + "/stream"); err != nil || len(resp.Body) != len(page) {
+		t.Errorf("expected no limit with a size of 0, got %v", err)
+	}
+}
+
+func TestRetryAfterIsHonored(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string][]time.Time)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path] = append(hits[r.URL.Path], time.Now())
+		first := len(hits[r.URL.Path]) == 1
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/too-long":
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case first && r.URL.Path == "/seconds":
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case first && r.URL.Path == "/date":
+			w.Header().Set("Retry-After", time.Now().Add(2*time.Second).UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, "<html><body>ok</body></html>")
+		}
+	}))
+	// Closed only once the parallel subtests are done.
+	t.Cleanup(server.Close)
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(1),
+		func(c *goscraper.Config) { c.RetryDelay = 0 })
+
+	t.Run("seconds", func(t *testing.T) {
+		t.Parallel()
+		if _, err := scraper.Get(server.URL + "/seconds"); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if times := hits["/seconds"]; len(times) != 2 || times[1].Sub(times[0]) < 950*time.Millisecond {
+			t.Errorf("expected the retry to wait out Retry-After, got %v", times)
+		}
+	})
+	t.Run("date", func(t *testing.T) {
+		t.Parallel()
+		if _, err := scraper.Get(server.URL + "/date"); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if times := hits["/date"]; len(times) != 2 || times[1].Sub(times[0]) < 900*time.Millisecond {
+			t.Errorf("expected the retry to wait until the Retry-After date, got %v", times)
+		}
+	})
+	t.Run("too long", func(t *testing.T) {
+		t.Parallel()
+		start := time.Now()
+		if _, err := scraper.Get(server.URL + "/too-long"); !errors.Is(err, goscraper.ErrBlocked) {
+			t.Errorf("expected ErrBlocked, got %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(hits["/too-long"]) != 1 || time.Since(start) > time.Second {
+			t.Errorf("expected no retry for an hour-long Retry-After, got %d requests", len(hits["/too-long"]))
+		}
+	})
+}
+
+func TestBackoffStrategies(t *testing.T) {
+	const base = 40 * time.Millisecond
+	for _, tc := range []struct {
+		name     string
+		strategy goscraper.BackoffStrategy
+	}{{"exponential", goscraper.ExponentialBackoff}, {"linear", goscraper.LinearBackoff}} {
+		var mu sync.Mutex
+		var times []time.Time
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			times = append(times, time.Now())
+			mu.Unlock()
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+
+		scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(3), goscraper.WithBackoff(tc.strategy),
+			func(c *goscraper.Config) { c.RetryDelay = base })
+		scraper.Get(server.URL)
+		server.Close()
+
+		if len(times) != 4 {
+			t.Fatalf("%s: expected 4 attempts, got %d", tc.name, len(times))
+		}
+		for i := 1; i < len(times); i++ {
+			gap := times[i].Sub(times[i-1])
+			if tc.strategy == goscraper.LinearBackoff && gap < base*time.Duration(i) {
+				t.Errorf("linear: wait %d was %v, expected at least %v", i, gap, base*time.Duration(i))
+			}
+			if tc.strategy == goscraper.ExponentialBackoff && gap > base<<(i-1)+30*time.Millisecond {
+				t.Errorf("exponential: wait %d was %v, expected at most %v", i, gap, base<<(i-1))
+			}
+		}
+	}
+}
+
+func TestLoggerTracesRetriedRequest(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	core, logs := observer.New(zap.DebugLevel)
+	scraper := goscraper.New(
+		goscraper.WithMaxRetries(2),
+		func(c *goscraper.Config) { c.RetryDelay = 0 },
+		goscraper.WithUserAgent("logger-test/1.0"),
+		goscraper.WithLogger(zap.New(core)),
+	)
+	if _, err := scraper.Get(server.URL); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	var messages []string
+	for _, entry := range logs.All() {
+		messages = append(messages, entry.Message)
+	}
+	want := []string{"Request started", "Sending request", "Retrying request", "Sending request", "Request finished"}
+	if strings.Join(messages, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected log entries %v, got %v", want, messages)
+	}
+
+	entries := logs.All()
+	if ua := entries[1].ContextMap()["user_agent"]; ua != "logger-test/1.0" {
+		t.Errorf("expected the User-Agent to be logged, got %v", ua)
+	}
+	retry := entries[2].ContextMap()
+	if retry["reason"] != "503" || retry["attempt"] != int64(1) {
+		t.Errorf("unexpected retry entry %v", retry)
+	}
+	if attempt := entries[3].ContextMap()["attempt"]; attempt != int64(2) {
+		t.Errorf("expected the second attempt to be logged, got %v", attempt)
+	}
+	if status := entries[4].ContextMap()["status"]; status != int64(200) {
+		t.Errorf("expected the final status to be logged, got %v", status)
+	}
+}
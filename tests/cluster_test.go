@@ -0,0 +1,608 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+
+	"github.com/ramusaaa/goscraper/pkg/cluster"
+)
+
+// fakeConsul serves the parts of Consul's HTTP API the coordinator uses:
+// the KV store with check-and-set, locks and blocking queries, and sessions.
+type fakeConsul struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	index    uint64
+	kv       map[string]*api.KVPair
+	sessions map[string]*api.SessionEntry
+	changed  chan struct{}
+
+	// renewals counts session renewals; while failRenewals is set they
+	// fail with a server error.
+	renewals     int
+	failRenewals bool
+}
+
+func newFakeConsul(t *testing.T) *fakeConsul {
+	t.Helper()
+	f := &fakeConsul{
+		index:    1,
+		kv:       make(map[string]*api.KVPair),
+		sessions: make(map[string]*api.SessionEntry),
+		changed:  make(chan struct{}),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeConsul) coordinator(t *testing.T, nodeID string) *cluster.ConsulCoordinator {
+	t.Helper()
+	c, err := cluster.NewConsulCoordinator(&cluster.ConsulConfig{
+		Address:    strings.TrimPrefix(f.URL, "http://"),
+		Prefix:     "test",
+		SessionTTL: 150 * time.Millisecond,
+	}, nodeID, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// bump records a write and wakes blocking queries. f.mu must be held.
+func (f *fakeConsul) bump() uint64 {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+	return f.index
+}
+
+// put stores a raw value, as another process writing to Consul would.
+func (f *fakeConsul) put(key string, value []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pair, ok := f.kv[key]
+	if !ok {
+		pair = &api.KVPair{Key: key}
+		f.kv[key] = pair
+	}
+	pair.Value = value
+	pair.ModifyIndex = f.bump()
+}
+
+func (f *fakeConsul) get(key string) *api.KVPair {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if pair, ok := f.kv[key]; ok {
+		copy := *pair
+		return &copy
+	}
+	return nil
+}
+
+// expireSessions invalidates the sessions named name, as Consul does when a
+// node stops renewing them, releasing or deleting the keys they hold.
+func (f *fakeConsul) expireSessions(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, session := range f.sessions {
+		if session.Name == name {
+			f.destroySession(id)
+		}
+	}
+}
+
+// destroySession drops a session. f.mu must be held.
+func (f *fakeConsul) destroySession(id string) {
+	session, ok := f.sessions[id]
+	if !ok {
+		return
+	}
+	delete(f.sessions, id)
+	for key, pair := range f.kv {
+		if pair.Session != id {
+			continue
+		}
+		if session.Behavior == api.SessionBehaviorDelete {
+			delete(f.kv, key)
+		} else {
+			pair.Session = ""
+			pair.ModifyIndex = f.index + 1
+		}
+	}
+	f.bump()
+}
+
+func (f *fakeConsul) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	f.mu.Unlock()
+	w.Header().Set("X-Consul-LastContact", "0")
+	w.Header().Set("X-Consul-KnownLeader", "true")
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+		f.serveKV(w, r, strings.TrimPrefix(r.URL.Path, "/v1/kv/"))
+	case r.URL.Path == "/v1/session/create":
+		var entry api.SessionEntry
+		json.NewDecoder(r.Body).Decode(&entry)
+		f.mu.Lock()
+		entry.ID = fmt.Sprintf("session-%d", len(f.sessions)+int(f.index))
+		f.sessions[entry.ID] = &entry
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"ID": entry.ID})
+	case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"):
+		f.mu.Lock()
+		session, ok := f.sessions[strings.TrimPrefix(r.URL.Path, "/v1/session/renew/")]
+		f.renewals++
+		fail := f.failRenewals
+		f.mu.Unlock()
+		if fail {
+			http.Error(w, "rpc error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode([]*api.SessionEntry{session})
+	case strings.HasPrefix(r.URL.Path, "/v1/session/info/"):
+		f.mu.Lock()
+		session, ok := f.sessions[strings.TrimPrefix(r.URL.Path, "/v1/session/info/")]
+		f.mu.Unlock()
+		entries := []*api.SessionEntry{}
+		if ok {
+			entries = append(entries, session)
+		}
+		json.NewEncoder(w).Encode(entries)
+	case strings.HasPrefix(r.URL.Path, "/v1/session/destroy/"):
+		f.mu.Lock()
+		f.destroySession(strings.TrimPrefix(r.URL.Path, "/v1/session/destroy/"))
+		f.mu.Unlock()
+		w.Write([]byte("true"))
+	case r.URL.Path == "/v1/txn":
+		f.serveTxn(w, r)
+	case r.URL.Path == "/v1/status/leader":
+		w.Write([]byte(`"127.0.0.1:8300"`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeConsul) serveKV(w http.ResponseWriter, r *http.Request, key string) {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		f.mu.Lock()
+		if wait, _ := strconv.ParseUint(query.Get("index"), 10, 64); wait > 0 && f.index <= wait {
+			changed := f.changed
+			f.mu.Unlock()
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			f.mu.Lock()
+		}
+		var pairs []*api.KVPair
+		for k, pair := range f.kv {
+			if k == key || (query.Has("recurse") && strings.HasPrefix(k, key)) {
+				copy := *pair
+				pairs = append(pairs, &copy)
+			}
+		}
+		index := f.index
+		f.mu.Unlock()
+
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+		if len(pairs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(pairs)
+
+	case http.MethodPut:
+		value, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		pair, exists := f.kv[key]
+		switch {
+		case query.Has("cas"):
+			cas, _ := strconv.ParseUint(query.Get("cas"), 10, 64)
+			if (cas == 0 && exists) || (cas != 0 && (!exists || pair.ModifyIndex != cas)) {
+				w.Write([]byte("false"))
+				return
+			}
+		case query.Has("acquire"):
+			session := query.Get("acquire")
+			if _, ok := f.sessions[session]; !ok {
+				http.Error(w, "invalid session", http.StatusInternalServerError)
+				return
+			}
+			if exists && pair.Session != "" && pair.Session != session {
+				w.Write([]byte("false"))
+				return
+			}
+		case query.Has("release"):
+			if !exists || pair.Session != query.Get("release") {
+				w.Write([]byte("false"))
+				return
+			}
+		}
+		if !exists {
+			pair = &api.KVPair{Key: key, CreateIndex: f.index + 1}
+			f.kv[key] = pair
+		}
+		pair.Value = value
+		switch {
+		case query.Has("acquire"):
+			pair.Session = query.Get("acquire")
+			pair.LockIndex++
+		case query.Has("release"):
+			pair.Session = ""
+		}
+		pair.ModifyIndex = f.bump()
+		w.Write([]byte("true"))
+
+	case http.MethodDelete:
+		f.mu.Lock()
+		delete(f.kv, key)
+		f.bump()
+		f.mu.Unlock()
+		w.Write([]byte("true"))
+	}
+}
+
+// serveTxn applies the KV operations of a transaction, all or none.
+func (f *fakeConsul) serveTxn(w http.ResponseWriter, r *http.Request) {
+	var ops api.TxnOps
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, op := range ops {
+		pair, exists := f.kv[op.KV.Key]
+		switch op.KV.Verb {
+		case api.KVCAS, api.KVDeleteCAS:
+			if (op.KV.Index == 0 && exists) || (op.KV.Index != 0 && (!exists || pair.ModifyIndex != op.KV.Index)) {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(api.TxnResponse{Errors: api.TxnErrors{{OpIndex: i, What: "index is stale"}}})
+				return
+			}
+		case api.KVSet:
+		default:
+			http.Error(w, "unsupported verb "+string(op.KV.Verb), http.StatusBadRequest)
+			return
+		}
+	}
+
+	index := f.bump()
+	for _, op := range ops {
+		if op.KV.Verb == api.KVDeleteCAS {
+			delete(f.kv, op.KV.Key)
+			continue
+		}
+		pair, exists := f.kv[op.KV.Key]
+		if !exists {
+			pair = &api.KVPair{Key: op.KV.Key, CreateIndex: index}
+			f.kv[op.KV.Key] = pair
+		}
+		pair.Value = op.KV.Value
+		pair.ModifyIndex = index
+	}
+	json.NewEncoder(w).Encode(api.TxnResponse{})
+}
+
+func TestDistributeJobSpreadsLoad(t *testing.T) {
+	consul := newFakeConsul(t)
+	coordinator := consul.coordinator(t, "node-a")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, id := range []string{"node-a", "node-b", "node-c"} {
+		if err := coordinator.RegisterNode(ctx, &cluster.Node{ID: id, Status: cluster.NodeStatusActive}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 9)
+	for i := 0; i < 9; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			job := &cluster.Job{ID: fmt.Sprintf("job-%d", i)}
+			if _, err := coordinator.DistributeJob(ctx, job); err != nil {
+				errs <- err
+			} else if job.AssignedTo == "" {
+				errs <- fmt.Errorf("job %s was not marked as assigned", job.ID)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	nodes, err := coordinator.GetNodes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 nodes, got %d", len(nodes))
+	}
+	for _, node := range nodes {
+		if node.Load == nil || node.Load.QueueSize != 3 {
+			t.Errorf("expected node %s to hold 3 jobs, got %+v", node.ID, node.Load)
+		}
+	}
+
+	var stored cluster.Job
+	if pair := consul.get("test/jobs/job-0"); pair == nil {
+		t.Fatal("expected the assignment of job-0 to be stored")
+	} else if err := json.Unmarshal(pair.Value, &stored); err != nil || stored.AssignedTo == "" {
+		t.Fatalf("expected the stored job to name its node, got %+v (%v)", stored, err)
+	}
+
+	// Reported load keeps the claims, and finished jobs give them back.
+	if err := coordinator.UpdateNodeLoad(ctx, stored.AssignedTo, &cluster.NodeLoad{CPU: 0.5, ActiveJobs: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 9; i++ {
+		if err := coordinator.ReleaseJob(ctx, fmt.Sprintf("job-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := coordinator.ReleaseJob(ctx, "job-0"); err != nil {
+		t.Errorf("releasing a job twice should be a no-op, got %v", err)
+	}
+	if consul.get("test/jobs/job-0") != nil {
+		t.Error("expected the released job's assignment to be removed")
+	}
+	nodes, err = coordinator.GetNodes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range nodes {
+		if node.Load == nil || node.Load.QueueSize != 0 {
+			t.Errorf("expected node %s to have no queued jobs left, got %+v", node.ID, node.Load)
+		}
+		if node.ID == stored.AssignedTo && (node.Load.CPU != 0.5 || node.Load.ActiveJobs != 1) {
+			t.Errorf("expected the reported load of node %s, got %+v", node.ID, node.Load)
+		}
+	}
+}
+
+func TestUpdateNodeLoadKeepsConcurrentClaims(t *testing.T) {
+	consul := newFakeConsul(t)
+	coordinator := consul.coordinator(t, "node-a")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := coordinator.RegisterNode(ctx, &cluster.Node{ID: "node-a", Status: cluster.NodeStatusActive}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every round of check-and-sets lets one writer through, so eight
+	// writers stay within the coordinator's attempts.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := coordinator.DistributeJob(ctx, &cluster.Job{ID: fmt.Sprintf("job-%d", i)}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			if err := coordinator.UpdateNodeLoad(ctx, "node-a", &cluster.NodeLoad{ActiveJobs: i}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	node, err := coordinator.GetNode(ctx, "node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Load == nil || node.Load.QueueSize != 4 {
+		t.Errorf("expected all 4 claims to survive the load updates, got %+v", node.Load)
+	}
+}
+
+func TestWatchLeaderReelectsAfterSessionLoss(t *testing.T) {
+	consul := newFakeConsul(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := consul.coordinator(t, "node-a")
+	firstCtx, crash := context.WithCancel(ctx)
+	firstLeader, err := first.WatchLeader(firstCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leader := <-firstLeader; leader != "node-a" {
+		t.Fatalf("expected node-a to lead, got %q", leader)
+	}
+
+	second := consul.coordinator(t, "node-b")
+	secondLeader, err := second.WatchLeader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leader := <-secondLeader; leader != "node-a" {
+		t.Fatalf("expected node-b to see node-a leading, got %q", leader)
+	}
+	if isLeader, err := second.IsLeader(ctx); err != nil || isLeader {
+		t.Fatalf("expected node-b not to lead, got %v (%v)", isLeader, err)
+	}
+
+	// node-a crashes: it stops campaigning and its session expires.
+	crash()
+	consul.expireSessions("leader-node-a")
+
+	select {
+	case leader := <-secondLeader:
+		if leader != "node-b" {
+			t.Fatalf("expected node-b to take over, got %q", leader)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no new leader was elected")
+	}
+	if isLeader, err := second.IsLeader(ctx); err != nil || !isLeader {
+		t.Errorf("expected node-b to lead, got %v (%v)", isLeader, err)
+	}
+	if isLeader, err := first.IsLeader(ctx); err != nil || isLeader {
+		t.Errorf("expected node-a to have lost leadership, got %v (%v)", isLeader, err)
+	}
+}
+
+func TestLeaderSessionOutlivesTheElectingRequest(t *testing.T) {
+	consul := newFakeConsul(t)
+	coordinator := consul.coordinator(t, "node-a")
+
+	requestCtx, cancel := context.WithCancel(context.Background())
+	if leader, err := coordinator.ElectLeader(requestCtx); err != nil || leader != "node-a" {
+		t.Fatalf("expected node-a to lead, got %q (%v)", leader, err)
+	}
+	cancel()
+
+	renewals := func() int {
+		consul.mu.Lock()
+		defer consul.mu.Unlock()
+		return consul.renewals
+	}
+	before := renewals()
+	time.Sleep(300 * time.Millisecond)
+	if renewals() == before {
+		t.Fatal("expected the leader session to be renewed after the request ended")
+	}
+	ctx := context.Background()
+	if isLeader, err := coordinator.IsLeader(ctx); err != nil || !isLeader {
+		t.Fatalf("expected node-a to still lead, got %v (%v)", isLeader, err)
+	}
+
+	// A failed renewal means the session is about to expire: the node must
+	// stop believing it leads.
+	consul.mu.Lock()
+	consul.failRenewals = true
+	consul.mu.Unlock()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		isLeader, err := coordinator.IsLeader(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isLeader {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the leader session to be forgotten after a failed renewal")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Closing stops the renewals.
+	consul.mu.Lock()
+	consul.failRenewals = false
+	consul.mu.Unlock()
+	if _, err := coordinator.ElectLeader(ctx); err != nil {
+		t.Fatal(err)
+	}
+	coordinator.Close()
+	time.Sleep(100 * time.Millisecond)
+	before = renewals()
+	time.Sleep(200 * time.Millisecond)
+	if renewals() != before {
+		t.Error("expected Close to stop renewing sessions")
+	}
+}
+
+func TestWatchNodesReportsUpdatesAndFailures(t *testing.T) {
+	consul := newFakeConsul(t)
+	coordinator := consul.coordinator(t, "watcher")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := coordinator.WatchNodes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(node cluster.Node) {
+		data, err := json.Marshal(node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		consul.put("test/nodes/"+node.ID, data)
+	}
+	expect := func(want cluster.EventType, nodeID string) {
+		t.Helper()
+		select {
+		case event := <-events:
+			if event.Type != want || event.Node.ID != nodeID {
+				t.Fatalf("expected %s for %s, got %s for %s", want, nodeID, event.Type, event.Node.ID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %s for %s, got nothing", want, nodeID)
+		}
+	}
+
+	node := cluster.Node{ID: "node-a", Status: cluster.NodeStatusActive, LastSeen: time.Now()}
+	put(node)
+	expect(cluster.EventNodeJoined, "node-a")
+
+	// A heartbeat alone is not an update; a load change is.
+	node.LastSeen = time.Now()
+	put(node)
+	node.Load = &cluster.NodeLoad{ActiveJobs: 2}
+	put(node)
+	expect(cluster.EventNodeUpdated, "node-a")
+
+	node.Status = cluster.NodeStatusFailed
+	put(node)
+	expect(cluster.EventNodeFailed, "node-a")
+
+	node.Status = cluster.NodeStatusActive
+	put(node)
+	expect(cluster.EventNodeUpdated, "node-a")
+
+	stale := cluster.Node{ID: "node-b", Status: cluster.NodeStatusActive, LastSeen: time.Now().Add(-time.Hour)}
+	put(stale)
+	expect(cluster.EventNodeJoined, "node-b")
+	expect(cluster.EventNodeFailed, "node-b")
+
+	consul.mu.Lock()
+	delete(consul.kv, "test/nodes/node-a")
+	consul.bump()
+	consul.mu.Unlock()
+	expect(cluster.EventNodeLeft, "node-a")
+
+	select {
+	case event := <-events:
+		t.Errorf("unexpected %s for %s", event.Type, event.Node.ID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ramusaaa/goscraper"
+)
+
+func TestFileCrawlStateStore(t *testing.T) {
+	ctx := context.Background()
+	store := goscraper.NewFileCrawlStateStore(t.TempDir())
+
+	if _, err := store.Load(ctx, "missing"); !errors.Is(err, goscraper.ErrCrawlStateNotFound) {
+		t.Fatalf("expected ErrCrawlStateNotFound, got %v", err)
+	}
+
+	state := &goscraper.CrawlState{
+		ID:       "shop",
+		Seed:     "https://shop.example/",
+		Frontier: []goscraper.CrawlTarget{{URL: "https://shop.example/page/2", Depth: 1}},
+		Visited:  []string{"https://shop.example/"},
+		Pages:    1,
+	}
+	if err := store.Save(ctx, state); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	loaded, err := store.Load(ctx, "shop")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loaded.Seed != state.Seed || loaded.Pages != 1 || len(loaded.Visited) != 1 ||
+		len(loaded.Frontier) != 1 || loaded.Frontier[0] != state.Frontier[0] {
+		t.Errorf("loaded state %+v does not match saved %+v", loaded, state)
+	}
+
+	if err := store.Delete(ctx, "shop"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := store.Load(ctx, "shop"); !errors.Is(err, goscraper.ErrCrawlStateNotFound) {
+		t.Errorf("expected the state to be gone after Delete, got %v", err)
+	}
+	if err := store.Delete(ctx, "shop"); err != nil {
+		t.Errorf("deleting a missing state should succeed, got %v", err)
+	}
+}
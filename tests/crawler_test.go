@@ -0,0 +1,576 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ramusaaa/goscraper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTestSite(t *testing.T, pages int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		fmt.Sscanf(r.URL.Path, "/page/%d", &n)
+		w.Header().Set("Content-Type", "text/html")
+		body := fmt.Sprintf("<html><body><h1>Page %d</h1>", n)
+		if n+1 < pages {
+			body += fmt.Sprintf(`<a class="next" href="/page/%d">next</a>`, n+1)
+		}
+		body += `<a href="https://elsewhere.example/">external</a></body></html>`
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCrawlResumesFromCheckpoint(t *testing.T) {
+	server := newTestSite(t, 6)
+	store := goscraper.NewFileCrawlStateStore(t.TempDir())
+	opts := goscraper.CrawlOptions{
+		Scraper:         goscraper.New(goscraper.WithRateLimit(0)),
+		SameDomain:      true,
+		MaxPages:        3,
+		StateStore:      store,
+		StateID:         "pages",
+		CheckpointEvery: 1,
+	}
+
+	results, err := goscraper.NewCrawler(opts).Crawl(context.Background(), server.URL+"/page/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := 0
+	for result := range results {
+		if result.Err != nil {
+			t.Fatalf("%s: %v", result.URL, result.Err)
+		}
+		first++
+	}
+	if first != 3 {
+		t.Fatalf("expected 3 pages before the limit, got %d", first)
+	}
+
+	opts.MaxPages = 0
+	results, err = goscraper.ResumeCrawl(context.Background(), "pages", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resumed []string
+	for result := range results {
+		resumed = append(resumed, result.URL)
+	}
+	if len(resumed) != 3 || resumed[0] != server.URL+"/page/3" {
+		t.Fatalf("unexpected resumed pages: %v", resumed)
+	}
+}
+
+func TestCrawlDedupByCanonical(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><body>
+				<a href="/item?sid=1">a</a><a href="/item?sid=2">b</a><a href="/item?sid=3">c</a>
+			</body></html>`)
+			return
+		}
+		fmt.Fprintf(w, `<html><head><link rel="canonical" href="%s/item"></head><body>item</body></html>`, server.URL)
+	}))
+	defer server.Close()
+
+	results, err := goscraper.NewCrawler(goscraper.CrawlOptions{
+		Scraper:          goscraper.New(goscraper.WithRateLimit(0)),
+		DedupByCanonical: true,
+	}).Crawl(context.Background(), server.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pages []string
+	for result := range results {
+		pages = append(pages, result.URL)
+	}
+	if len(pages) != 2 {
+		t.Errorf("expected the seed and one item page, got %v", pages)
+	}
+}
+
+func TestCrawlDedupByRelativeAndCrossHostCanonical(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body>
+				<a href="/rel?sid=1">a</a><a href="/rel?sid=2">b</a>
+				<a href="/cross?sid=1">c</a><a href="/cross?sid=2">d</a>
+				<a href="/own">e</a>
+			</body></html>`)
+		case "/rel":
+			fmt.Fprint(w, `<html><head><link rel="canonical" href="/rel"></head><body>rel</body></html>`)
+		case "/cross":
+			fmt.Fprint(w, `<html><head><link rel="canonical" href="https://Mirror.example/cross#top"></head><body>cross</body></html>`)
+		default:
+			fmt.Fprint(w, `<html><head><link rel="canonical" href="own"></head><body>own</body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	results, err := goscraper.NewCrawler(goscraper.CrawlOptions{
+		Scraper:          goscraper.New(goscraper.WithRateLimit(0)),
+		DedupByCanonical: true,
+	}).Crawl(context.Background(), server.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pages []string
+	for result := range results {
+		pages = append(pages, strings.TrimPrefix(result.URL, server.URL))
+	}
+	if got, want := strings.Join(pages, " "), "/ /rel?sid=1 /cross?sid=1 /own"; got != want {
+		t.Errorf("expected one page per canonical, got %s", got)
+	}
+}
+
+func TestCrawlDedupWindowKeysOnFinalURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><body><a href="/old">a</a><a href="/short">b</a><a href="/other">c</a></body></html>`)
+		case "/old", "/short":
+			http.Redirect(w, r, "/item", http.StatusMovedPermanently)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><body>page</body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	crawl := func(window int) []string {
+		t.Helper()
+		results, err := goscraper.NewCrawler(goscraper.CrawlOptions{
+			Scraper:     goscraper.New(goscraper.WithRateLimit(0)),
+			DedupWindow: window,
+		}).Crawl(context.Background(), server.URL+"/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pages []string
+		for result := range results {
+			pages = append(pages, result.URL[len(server.URL):])
+		}
+		return pages
+	}
+
+	if pages := crawl(0); fmt.Sprint(pages) != "[/ /old /short /other]" {
+		t.Errorf("expected every page without a window, got %v", pages)
+	}
+	if pages := crawl(10); fmt.Sprint(pages) != "[/ /old /other]" {
+		t.Errorf("expected links redirecting to one page to be emitted once, got %v", pages)
+	}
+}
+
+func TestDedupWindowForgetsOldKeys(t *testing.T) {
+	window := goscraper.NewDedupWindow(2)
+	for i, step := range []struct {
+		key  string
+		seen bool
+	}{
+		{"a", false},
+		{"b", false},
+		{"a", true},
+		{"c", false},
+		// a was pushed out by c.
+		{"a", false},
+		{"c", true},
+	} {
+		if got := window.Seen(step.key); got != step.seen {
+			t.Errorf("step %d: Seen(%q) = %v, want %v", i, step.key, got, step.seen)
+		}
+	}
+}
+
+func TestDedupStream(t *testing.T) {
+	in := make(chan string)
+	go func() {
+		defer close(in)
+		for _, v := range []string{"a", "b", "a", "", "", "c", "b"} {
+			in <- v
+		}
+	}()
+
+	var got []string
+	for v := range goscraper.DedupStream(context.Background(), in, 10, func(v string) string { return v }) {
+		got = append(got, v)
+	}
+	if fmt.Sprint(got) != "[a b   c]" {
+		t.Errorf("unexpected stream %q", got)
+	}
+
+	// A consumer that stops reading cancels the context, which must end the
+	// stream even though in is never closed.
+	ctx, cancel := context.WithCancel(context.Background())
+	endless := make(chan string, 1)
+	endless <- "x"
+	out := goscraper.DedupStream(ctx, endless, 10, func(v string) string { return v })
+	cancel()
+	for range out {
+	}
+}
+
+func TestCrawlLimitsAndLinkSelection(t *testing.T) {
+	// A small site where every page links to the index, the next page and a
+	// filtered-out archive section, so cycles and limits are exercised.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		fmt.Sscanf(r.URL.Path, "/page/%d", &n)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body>
+			<a href="/page/0">home</a>
+			<a class="next" href="/page/%d">next</a>
+			<a href="/archive/%d">archive</a>
+		</body></html>`, n+1, n)
+	}))
+	defer server.Close()
+
+	crawl := func(ctx context.Context, opts goscraper.CrawlOptions) []string {
+		t.Helper()
+		opts.Scraper = goscraper.New(goscraper.WithRateLimit(0))
+		results, err := goscraper.NewCrawler(opts).Crawl(ctx, server.URL+"/page/0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pages []string
+		for result := range results {
+			pages = append(pages, result.URL[len(server.URL):])
+		}
+		return pages
+	}
+
+	pages := crawl(context.Background(), goscraper.CrawlOptions{
+		MaxDepth:   2,
+		FollowLink: func(link string) bool { return !strings.Contains(link, "/archive/") },
+	})
+	if fmt.Sprint(pages) != "[/page/0 /page/1 /page/2]" {
+		t.Errorf("expected a depth-limited crawl without revisits, got %v", pages)
+	}
+
+	pages = crawl(context.Background(), goscraper.CrawlOptions{NextPageSelector: "a.next", MaxPages: 4})
+	if fmt.Sprint(pages) != "[/page/0 /page/1 /page/2 /page/3]" {
+		t.Errorf("expected only next-page links up to MaxPages, got %v", pages)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if pages := crawl(ctx, goscraper.CrawlOptions{NextPageSelector: "a.next"}); len(pages) != 0 {
+		t.Errorf("expected a cancelled crawl to stop, got %v", pages)
+	}
+}
+
+func TestParseSitemapFollowsIndexesAndGzip(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := server.URL
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%[1]s/pages.xml</loc></sitemap>
+  <sitemap><loc>%[1]s/nested.xml</loc></sitemap>
+  <sitemap><loc>%[1]s/missing.xml</loc></sitemap>
+</sitemapindex>`, base)
+		case "/pages.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/a</loc><lastmod>2024-01-01</lastmod></url>
+  <url><loc> %[1]s/b </loc></url>
+  <url><loc>%[1]s/a</loc></url>
+</urlset>`, base)
+		case "/nested.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/archive.xml.gz</loc></sitemap></sitemapindex>`, base)
+		case "/archive.xml.gz":
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			fmt.Fprintf(gz, `<urlset><url><loc>%[1]s/b</loc></url><url><loc>%[1]s/c?x=1&amp;y=2</loc></url></urlset>`, base)
+			gz.Close()
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(buf.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0))
+
+	urls, err := goscraper.ParseSitemap(context.Background(), scraper, server.URL+"/sitemap.xml")
+	want := []string{server.URL + "/a", server.URL + "/b", server.URL + "/c?x=1&y=2"}
+	if strings.Join(urls, " ") != strings.Join(want, " ") {
+		t.Errorf("expected %v, got %v", want, urls)
+	}
+	if err == nil || !strings.Contains(err.Error(), "missing.xml") {
+		t.Errorf("expected the missing child sitemap to be reported, got %v", err)
+	}
+
+	urls, _ = goscraper.ParseSitemapLimit(context.Background(), scraper, server.URL+"/sitemap.xml", 2)
+	if len(urls) != 2 {
+		t.Errorf("expected the cap to stop at 2 URLs, got %v", urls)
+	}
+
+	if _, err := goscraper.ParseSitemap(context.Background(), scraper, server.URL+"/nothing.xml"); err == nil {
+		t.Error("expected a missing root sitemap to fail")
+	}
+}
+
+func TestCrawlSendsLinkingPageAsReferer(t *testing.T) {
+	var mu sync.Mutex
+	referers := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		referers[r.URL.Path] = r.Header.Get("Referer")
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/list?page=1#top">list</a><a href="/old">moved</a></body></html>`)
+		case "/list":
+			fmt.Fprint(w, `<html><body><a href="/item">item</a></body></html>`)
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			fmt.Fprint(w, `<html><body><a href="/leaf">leaf</a></body></html>`)
+		default:
+			fmt.Fprint(w, `<html><body>item</body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	results, err := goscraper.NewCrawler(goscraper.CrawlOptions{
+		Scraper: goscraper.New(goscraper.WithRateLimit(0)),
+	}).Crawl(context.Background(), server.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range results {
+	}
+
+	want := map[string]string{
+		"/":     "",
+		"/list": server.URL + "/",
+		"/item": server.URL + "/list?page=1",
+		// Links refer to the page they were found on, after redirects.
+		"/leaf": server.URL + "/new",
+	}
+	for path, referer := range want {
+		if got, ok := referers[path]; !ok || got != referer {
+			t.Errorf("expected Referer %q for %s, got %q", referer, path, got)
+		}
+	}
+}
+
+func TestRefererPolicy(t *testing.T) {
+	referer := make(chan string, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		referer <- r.Header.Get("Referer")
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	})
+	site := httptest.NewServer(handler)
+	defer site.Close()
+	other := httptest.NewServer(handler)
+	defer other.Close()
+
+	page := site.URL + "/private/page?q=1"
+	tests := []struct {
+		policy    goscraper.RefererPolicy
+		sameSite  string
+		otherSite string
+	}{
+		{goscraper.RefererStrictOriginWhenCrossOrigin, page, site.URL + "/"},
+		{goscraper.RefererNoReferrer, "", ""},
+		{goscraper.RefererSameOrigin, page, ""},
+		{goscraper.RefererStrictOrigin, site.URL + "/", site.URL + "/"},
+	}
+
+	for _, tt := range tests {
+		scraper := goscraper.New(
+			goscraper.WithRateLimit(0),
+			goscraper.WithReferer("https://ignored.example/"),
+			goscraper.WithRefererPolicy(tt.policy),
+		)
+		ctx := goscraper.ContextWithReferer(context.Background(), "http://user:pass@"+strings.TrimPrefix(page, "http://")+"#section")
+
+		if _, err := scraper.GetWithContext(ctx, site.URL+"/next"); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-referer; got != tt.sameSite {
+			t.Errorf("%q: expected same-origin Referer %q, got %q", tt.policy, tt.sameSite, got)
+		}
+		if _, err := scraper.GetWithContext(ctx, other.URL+"/"); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-referer; got != tt.otherSite {
+			t.Errorf("%q: expected cross-origin Referer %q, got %q", tt.policy, tt.otherSite, got)
+		}
+	}
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithReferer(page))
+	if _, err := scraper.Get(other.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-referer; got != site.URL+"/" {
+		t.Errorf("expected WithReferer to send the origin cross-origin, got %q", got)
+	}
+}
+
+func TestCrawlResumeAfterCancelLosesNoPages(t *testing.T) {
+	var block atomic.Bool
+	block.Store(true)
+	reached := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		fmt.Sscanf(r.URL.Path, "/page/%d", &n)
+		if n == 2 && block.Load() {
+			reached <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		body := fmt.Sprintf("<html><body><h1>Page %d</h1>", n)
+		if n+1 < 6 {
+			body += fmt.Sprintf(`<a href="/page/%d">next</a>`, n+1)
+		}
+		fmt.Fprint(w, body+"</body></html>")
+	}))
+	defer server.Close()
+
+	store := goscraper.NewFileCrawlStateStore(t.TempDir())
+	opts := goscraper.CrawlOptions{
+		Scraper:         goscraper.New(goscraper.WithRateLimit(0)),
+		StateStore:      store,
+		StateID:         "cancelled",
+		CheckpointEvery: 100,
+	}
+	seen := make(map[string]int)
+
+	// Cancel while page 2 is being fetched.
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := goscraper.NewCrawler(opts).Crawl(ctx, server.URL+"/page/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		<-reached
+		cancel()
+	}()
+	for result := range results {
+		seen[result.URL]++
+	}
+	block.Store(false)
+
+	// Cancel while the first resumed page waits to be delivered.
+	ctx, cancel = context.WithCancel(context.Background())
+	results, err = goscraper.ResumeCrawl(ctx, "cancelled", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := <-results
+	seen[first.URL]++
+	cancel()
+	for result := range results {
+		seen[result.URL]++
+	}
+
+	results, err = goscraper.ResumeCrawl(context.Background(), "cancelled", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for result := range results {
+		seen[result.URL]++
+	}
+
+	for n := 0; n < 6; n++ {
+		page := fmt.Sprintf("%s/page/%d", server.URL, n)
+		if seen[page] != 1 {
+			t.Errorf("expected %s exactly once, got %d (%v)", page, seen[page], seen)
+		}
+	}
+	if state, err := store.Load(context.Background(), "cancelled"); err != nil || !state.Done {
+		t.Errorf("expected the finished crawl to be saved as done, got %+v, %v", state, err)
+	}
+}
+
+func TestCrawlStoppedByMaxPagesIsNotDone(t *testing.T) {
+	server := newTestSite(t, 4)
+	store := goscraper.NewFileCrawlStateStore(t.TempDir())
+	results, err := goscraper.NewCrawler(goscraper.CrawlOptions{
+		Scraper:    goscraper.New(goscraper.WithRateLimit(0)),
+		SameDomain: true,
+		MaxPages:   2,
+		StateStore: store,
+		StateID:    "capped",
+	}).Crawl(context.Background(), server.URL+"/page/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range results {
+	}
+
+	state, err := store.Load(context.Background(), "capped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Done || len(state.Frontier) == 0 {
+		t.Errorf("expected a resumable state with a frontier, got %+v", state)
+	}
+}
+
+type failingStateStore struct {
+	goscraper.CrawlStateStore
+}
+
+func (failingStateStore) Save(ctx context.Context, state *goscraper.CrawlState) error {
+	return errors.New("disk full")
+}
+
+func TestCrawlLogsFailedCheckpoints(t *testing.T) {
+	server := newTestSite(t, 2)
+	core, logs := observer.New(zap.WarnLevel)
+	results, err := goscraper.NewCrawler(goscraper.CrawlOptions{
+		Scraper:    goscraper.New(goscraper.WithRateLimit(0)),
+		SameDomain: true,
+		StateStore: failingStateStore{},
+		StateID:    "failing",
+		Logger:     zap.New(core),
+	}).Crawl(context.Background(), server.URL+"/page/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := 0
+	for range results {
+		pages++
+	}
+
+	if pages != 2 {
+		t.Errorf("expected the crawl to carry on after a failed checkpoint, got %d pages", pages)
+	}
+	entries := logs.FilterMessage("Failed to checkpoint crawl").All()
+	if len(entries) == 0 || entries[0].ContextMap()["error"] != "disk full" {
+		t.Errorf("expected the failed checkpoint to be logged, got %v", logs.All())
+	}
+}
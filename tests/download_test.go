@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ramusaaa/goscraper"
+)
+
+func newFileServer(t *testing.T, content []byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadFileConcurrentChunks(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+	server := newFileServer(t, content)
+
+	dest := filepath.Join(t.TempDir(), "data.bin")
+	var lastProgress int64
+	err := goscraper.New(goscraper.WithRateLimit(0)).DownloadFile(context.Background(), server.URL, dest, goscraper.DownloadOptions{
+		Concurrency: 4,
+		ChunkSize:   10000,
+		Checksum:    "sha256:" + hex.EncodeToString(sum[:]),
+		Progress:    func(written, total int64) { lastProgress = written },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := os.ReadFile(dest)
+	if !bytes.Equal(got, content) {
+		t.Fatal("downloaded file differs from the original")
+	}
+	if lastProgress != int64(len(content)) {
+		t.Errorf("final progress %d, want %d", lastProgress, len(content))
+	}
+}
+
+func TestDownloadFileResumesAndVerifies(t *testing.T) {
+	content := bytes.Repeat([]byte("resumable "), 1000)
+	server := newFileServer(t, content)
+	scraper := goscraper.New(goscraper.WithRateLimit(0))
+
+	dest := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(dest+".part", content[:3000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scraper.DownloadFile(context.Background(), server.URL, dest, goscraper.DownloadOptions{Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, content) {
+		t.Fatal("resumed file differs from the original")
+	}
+
+	err := scraper.DownloadFile(context.Background(), server.URL, dest, goscraper.DownloadOptions{Checksum: "sha256:00"})
+	if !errors.Is(err, goscraper.ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
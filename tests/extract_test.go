@@ -0,0 +1,1046 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/ramusaaa/goscraper"
+	"github.com/ramusaaa/goscraper/pkg/ai"
+	"github.com/ramusaaa/goscraper/pkg/monitoring"
+	"go.uber.org/zap"
+)
+
+func newTestResponse(t *testing.T, url, html string) *goscraper.Response {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("failed to parse HTML: %v", err)
+	}
+	return &goscraper.Response{
+		URL:        url,
+		StatusCode: 200,
+		Body:       html,
+		Document:   doc,
+	}
+}
+
+func TestExtractSmartMergesPartialJSONLD(t *testing.T) {
+	resp := newTestResponse(t, "https://www.bbc.com/news/story", `
+		<html><head>
+			<title>Story</title>
+			<script type="application/ld+json">
+				{"@context": "https://schema.org", "@type": "NewsArticle",
+				 "headline": "Structured Headline", "datePublished": "2024-05-01"}
+			</script>
+		</head><body>
+			<h1>Selector Headline</h1>
+			<span class="author">Jane Reporter</span>
+			<div class="article-body">Body text from the page.</div>
+		</body></html>`)
+
+	data := goscraper.NewSmartExtractor().ExtractSmart(resp)
+	if data.Article == nil {
+		t.Fatalf("Expected article for news page, got content type %s", data.ContentType)
+	}
+
+	if data.Article.Headline != "Structured Headline" {
+		t.Errorf("Expected JSON-LD headline to win, got %q", data.Article.Headline)
+	}
+	if data.Article.Author != "Jane Reporter" {
+		t.Errorf("Expected selector author to fill the gap, got %q", data.Article.Author)
+	}
+
+	expected := map[string]string{
+		"article.headline":     goscraper.SourceJSONLD,
+		"article.publish_date": goscraper.SourceJSONLD,
+		"article.author":       goscraper.SourceSelector,
+		"article.content":      goscraper.SourceSelector,
+	}
+	for field, source := range expected {
+		if got := data.FieldSources[field]; got != source {
+			t.Errorf("Expected %s from %s, got %q", field, source, got)
+		}
+	}
+}
+
+func TestExtractSmartWithoutJSONLD(t *testing.T) {
+	resp := newTestResponse(t, "https://www.bbc.com/news/other", `
+		<html><body><h1>Only Selectors</h1><div class="article-body">Text.</div></body></html>`)
+
+	data := goscraper.NewSmartExtractor().ExtractSmart(resp)
+	if data.Article == nil || data.Article.Headline != "Only Selectors" {
+		t.Fatalf("Unexpected article: %+v", data.Article)
+	}
+	if data.FieldSources["article.headline"] != goscraper.SourceSelector {
+		t.Errorf("Expected selector source, got %q", data.FieldSources["article.headline"])
+	}
+}
+
+func TestSuggestSelectorsFindsProductCards(t *testing.T) {
+	html := `<html><body>
+		<ul class="menu"><li>Home</li><li>Shop</li><li>About</li></ul>
+		<div class="grid">
+			<div class="card"><a href="/p/1"><img src="1.jpg"><h3 class="title">Lamp</h3></a><span class="price">$19.99</span></div>
+			<div class="card"><a href="/p/2"><img src="2.jpg"><h3 class="title">Chair</h3></a><span class="price">$49.00</span></div>
+			<div class="card"><a href="/p/3"><img src="3.jpg"><h3 class="title">Desk</h3></a><span class="price">$120.00</span></div>
+		</div>
+	</body></html>`
+
+	selectors := goscraper.SuggestSelectors(newTestResponse(t, "https://shop.example/", html))
+	if selectors.Price != "div.card span.price" || selectors.Name != "div.card h3.title" {
+		t.Fatalf("unexpected selectors: %+v", selectors)
+	}
+
+	products := goscraper.ExtractProducts(newTestResponse(t, "https://shop.example/", html), selectors)
+	if len(products) != 3 || products[1].Name != "Chair" || products[1].Price != "$49.00" {
+		t.Fatalf("suggested selectors did not extract products: %+v", products)
+	}
+}
+
+func TestExtractContacts(t *testing.T) {
+	html := `<html><head>
+		<script type="application/ld+json">{"@type":"Organization","telephone":"+1 555 010 9999",
+			"address":{"@type":"PostalAddress","streetAddress":"1 Main St","addressLocality":"Springfield"},
+			"sameAs":["https://www.linkedin.com/company/acme/"]}</script>
+	</head><body>
+		<a href="mailto:Sales@Acme.example?subject=hi">Email us</a>
+		<p>Support: support@acme.example <img src="logo@2x.png"></p>
+		<a href="https://twitter.com/acme">Twitter</a>
+		<a href="https://twitter.com/intent/tweet?url=x">Share</a>
+		<a href="https://facebook.com/">Facebook</a>
+	</body></html>`
+
+	info := goscraper.ExtractContacts(newTestResponse(t, "https://acme.example/contact", html))
+
+	if len(info.Emails) != 2 || info.Emails[0] != "sales@acme.example" || info.Emails[1] != "support@acme.example" {
+		t.Errorf("emails = %v", info.Emails)
+	}
+	if len(info.Phones) != 1 || info.Phones[0] != "+15550109999" {
+		t.Errorf("phones = %v", info.Phones)
+	}
+	if len(info.Addresses) != 1 || info.Addresses[0] != "1 Main St, Springfield" {
+		t.Errorf("addresses = %v", info.Addresses)
+	}
+	if len(info.SocialProfiles) != 2 || info.SocialProfiles[1].URL != "https://twitter.com/acme" {
+		t.Errorf("social profiles = %v", info.SocialProfiles)
+	}
+}
+
+func TestProductPricesInSeveralCurrencies(t *testing.T) {
+	html := `<html><head><script type="application/ld+json">{
+		"@type": "Product", "name": "Kettle",
+		"offers": [
+			{"@type": "Offer", "price": "19.99", "priceCurrency": "EUR"},
+			{"@type": "Offer", "price": "21.50", "priceCurrency": "USD"}
+		]}</script></head><body><h1>Kettle</h1></body></html>`
+
+	data := goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://shop.example/kettle", html))
+	if len(data.Products) != 1 {
+		t.Fatalf("expected one product, got %+v", data.Products)
+	}
+
+	product := data.Products[0]
+	if product.Price != "19.99" || product.Currency != "EUR" {
+		t.Errorf("primary price = %s %s", product.Price, product.Currency)
+	}
+	want := []goscraper.PriceValue{{Amount: "19.99", Currency: "EUR"}, {Amount: "21.50", Currency: "USD"}}
+	if len(product.Prices) != 2 || product.Prices[0] != want[0] || product.Prices[1] != want[1] {
+		t.Errorf("prices = %+v", product.Prices)
+	}
+}
+
+func TestNormalizeGTIN(t *testing.T) {
+	cases := map[string]string{
+		"036000291452":       "0036000291452",
+		"0036000291452":      "0036000291452",
+		"400-638-133393-1":   "4006381333931",
+		"96385074":           "0000096385074",
+		"ISBN 0-306-40615-2": "9780306406157",
+		"978-0-306-40615-7":  "9780306406157",
+		"4006381333932":      "",
+		"0306406153":         "",
+		"12345":              "",
+	}
+	for raw, want := range cases {
+		got, ok := goscraper.NormalizeGTIN(raw)
+		if got != want || ok != (want != "") {
+			t.Errorf("NormalizeGTIN(%q) = %q, %v; want %q", raw, got, ok, want)
+		}
+	}
+}
+
+func TestProductIdentifiers(t *testing.T) {
+	html := `<html><head><script type="application/ld+json">{
+		"@type": "Product", "name": "Kettle", "gtin13": "4006381333932", "mpn": "KT-200",
+		"offers": {"@type": "Offer", "price": "19.99", "sku": "SHOP-123", "gtin12": "036000291452"}
+		}</script></head><body><h1>Kettle</h1></body></html>`
+
+	data := goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://shop.example/kettle", html))
+	if len(data.Products) != 1 {
+		t.Fatalf("expected one product, got %+v", data.Products)
+	}
+
+	product := data.Products[0]
+	if product.GTIN != "0036000291452" {
+		t.Errorf("expected the valid offer GTIN over the bad product one, got %q", product.GTIN)
+	}
+	if product.SKU != "SHOP-123" || product.MPN != "KT-200" {
+		t.Errorf("sku = %q, mpn = %q", product.SKU, product.MPN)
+	}
+}
+
+func TestAIExtractorTokensPerMinuteLimit(t *testing.T) {
+	extractor := ai.NewAIExtractor(&ai.AIConfig{
+		DefaultModel:    "mock",
+		Models:          map[string]ai.ModelConfig{"mock": {Type: "local"}},
+		MaxTokens:       100,
+		TokensPerMinute: 150,
+	})
+	input := &ai.ExtractionInput{
+		HTML:    "<html><body>hi</body></html>",
+		Schema:  &ai.ExtractionSchema{},
+		Options: &ai.ExtractionOptions{UseAI: true},
+	}
+
+	if _, err := extractor.Extract(context.Background(), input); err != nil {
+		t.Fatalf("first call should fit the budget: %v", err)
+	}
+	if _, err := extractor.Extract(context.Background(), input); !errors.Is(err, ai.ErrAIRateLimited) {
+		t.Fatalf("expected ErrAIRateLimited, got %v", err)
+	}
+}
+
+func TestSmartScrapeManyKeepsInputOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		fmt.Fprintf(w, "<html><head><title>Page %s</title></head><body></body></html>", r.URL.Path[1:])
+	}))
+	defer server.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	urls := []string{server.URL + "/1", dead.URL + "/2", server.URL + "/3", server.URL + "/4", server.URL + "/missing"}
+	results, errs := goscraper.SmartScrapeMany(context.Background(), urls,
+		goscraper.WithStealth(false),
+		goscraper.WithHumanDelay(false),
+		goscraper.WithRateLimit(0),
+		goscraper.WithMaxRetries(0),
+	)
+
+	if len(results) != len(urls) || len(errs) != len(urls) {
+		t.Fatalf("expected %d aligned results, got %d results and %d errors", len(urls), len(results), len(errs))
+	}
+	if errs[1] == nil || results[1] != nil {
+		t.Errorf("expected only an error for the unreachable URL, got %v, %v", results[1], errs[1])
+	}
+	var scrapeErr *goscraper.ScrapeError
+	if !errors.As(errs[4], &scrapeErr) || scrapeErr.StatusCode != http.StatusNotFound || results[4] != nil {
+		t.Errorf("expected only a ScrapeError for the missing page, got %v, %v", results[4], errs[4])
+	}
+	for _, i := range []int{0, 2, 3} {
+		if errs[i] != nil {
+			t.Fatalf("url %d failed: %v", i, errs[i])
+		}
+		if want := fmt.Sprintf("Page %d", i+1); results[i].Title != want {
+			t.Errorf("result %d has title %q, want %q", i, results[i].Title, want)
+		}
+	}
+}
+
+func TestExtractSmartPrefersJSONLDType(t *testing.T) {
+	recipe := `<html><head><script type="application/ld+json">{
+		"@type": "Recipe", "name": "Pancakes",
+		"recipeIngredient": ["flour", "milk", "eggs"],
+		"recipeInstructions": [{"@type": "HowToStep", "text": "Mix."}, {"@type": "HowToStep", "text": "Fry."}]
+		}</script></head><body><h1>Breaking news: pancakes</h1><p>news article news report</p></body></html>`
+
+	data := goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://example.com/pancakes", recipe))
+	if data.ContentType != goscraper.ContentTypeRecipe || data.Recipe == nil {
+		t.Fatalf("expected recipe content, got %s", data.ContentType)
+	}
+	if data.Recipe.Name != "Pancakes" || len(data.Recipe.Ingredients) != 3 || len(data.Recipe.Instructions) != 2 {
+		t.Errorf("unexpected recipe: %+v", data.Recipe)
+	}
+
+	product := `<html><head><script type="application/ld+json">{
+		"@type": "Product", "name": "Kettle", "offers": {"@type": "Offer", "price": "19.99", "priceCurrency": "EUR"}
+		}</script></head><body><h1>Kettle</h1></body></html>`
+
+	data = goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://example.com/kettle", product))
+	if data.ContentType != goscraper.ContentTypeEcommerce || len(data.Products) != 1 {
+		t.Fatalf("expected one product, got %s %+v", data.ContentType, data.Products)
+	}
+	if data.Products[0].Name != "Kettle" || data.Products[0].Price != "19.99" {
+		t.Errorf("unexpected product: %+v", data.Products[0])
+	}
+}
+
+func TestExtractSmartIncludesAllOGImages(t *testing.T) {
+	html := `<html><head>
+		<meta property="og:image" content="/first.jpg">
+		<meta property="og:image:alt" content="First">
+		<meta property="og:image" content="https://cdn.example/second.jpg">
+	</head><body><img src="/first.jpg" alt="Inline"></body></html>`
+
+	data := goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://news.example/story", html))
+	var urls []string
+	for _, img := range data.Images {
+		urls = append(urls, img.URL)
+	}
+	if strings.Join(urls, " ") != "https://news.example/first.jpg https://cdn.example/second.jpg" {
+		t.Errorf("unexpected images: %v", urls)
+	}
+}
+
+func TestSchemaSourceKeepsLastValidSchema(t *testing.T) {
+	var mu sync.Mutex
+	body := `{"fields": [{"name": "title", "type": "string", "selector": "h1"}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+	setBody := func(s string) {
+		mu.Lock()
+		body = s
+		mu.Unlock()
+	}
+
+	scraper := goscraper.New(goscraper.WithSchemaSource(server.URL, time.Hour))
+	resp := newTestResponse(t, "https://shop.example/item", `<html><body><h1>Lamp</h1><p class="price">$20</p></body></html>`)
+
+	data, errs := scraper.ExtractWithSchema(resp)
+	if len(errs) > 0 || data["title"] != "Lamp" {
+		t.Fatalf("expected the initial schema to extract the title, got %v, %v", data, errs)
+	}
+
+	source := scraper.SchemaSource()
+	for _, invalid := range []string{`{"fields": [`, `{"fields": [{"name": "title", "selector": "h1["}]}`, `{"fields": []}`} {
+		setBody(invalid)
+		if err := source.Refresh(context.Background()); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+		if data, _ := scraper.ExtractWithSchema(resp); data["title"] != "Lamp" {
+			t.Errorf("previous schema was not kept after %q: %v", invalid, data)
+		}
+	}
+
+	setBody(`{"fields": [{"name": "price", "type": "number", "selector": ".price"}]}`)
+	if err := source.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if source.LastError() != nil {
+		t.Errorf("expected LastError to clear, got %v", source.LastError())
+	}
+	data, _ = scraper.ExtractWithSchema(resp)
+	if data["price"] != "$20" || data["title"] != nil {
+		t.Errorf("expected the new schema to be used, got %v", data)
+	}
+
+	if _, errs := goscraper.New().ExtractWithSchema(resp); len(errs) != 1 || !errors.Is(errs[0], goscraper.ErrNoSchema) {
+		t.Errorf("expected ErrNoSchema without a source, got %v", errs)
+	}
+}
+
+func TestSchemaSourceLoadsInTheBackground(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{"fields": [{"name": "title", "type": "string", "selector": "h1"}]}`)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	started := time.Now()
+	scraper := goscraper.New(goscraper.WithSchemaSource(server.URL, time.Hour))
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("expected New not to wait for the schema, took %s", elapsed)
+	}
+	if scraper.SchemaSource().Schema() != nil {
+		t.Fatal("expected no schema while the source is still loading")
+	}
+
+	// The first extraction waits for the load started by New.
+	time.AfterFunc(50*time.Millisecond, func() { release <- struct{}{} })
+	resp := newTestResponse(t, "https://shop.example/item", `<html><body><h1>Lamp</h1></body></html>`)
+	if data, errs := scraper.ExtractWithSchema(resp); len(errs) > 0 || data["title"] != "Lamp" {
+		t.Errorf("expected the background schema to be used, got %v, %v", data, errs)
+	}
+}
+
+func TestOpenAIModelExtractsSchemaFields(t *testing.T) {
+	var request struct {
+		Model       string  `json:"model"`
+		Temperature float64 `json:"temperature"`
+		Messages    []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, `{"error": {"message": "bad request"}}`, http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		fmt.Fprint(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant",
+			"content": "{\"title\": \"Desk Lamp\", \"price\": \"$24.50\", \"tags\": [\"home\", \"lighting\"], \"brand\": null, \"_confidence\": 0.9}"}}]}`)
+	}))
+	defer server.Close()
+
+	extractor := ai.NewAIExtractor(&ai.AIConfig{
+		DefaultModel: "gpt",
+		Models: map[string]ai.ModelConfig{"gpt": {
+			Type:       "openai",
+			Endpoint:   server.URL + "/v1",
+			APIKey:     "test-key",
+			Parameters: map[string]interface{}{"model": "gpt-test"},
+		}},
+		MaxTokens:   200,
+		Temperature: 0.2,
+	})
+	input := &ai.ExtractionInput{
+		HTML: "<html><head><script>var tracking = 1;</script></head><body><h1>Desk Lamp</h1>" +
+			strings.Repeat("<p>filler</p>", 500) + "</body></html>",
+		Schema: &ai.ExtractionSchema{Fields: []ai.FieldSchema{
+			{Name: "title", Type: "string", Required: true},
+			{Name: "price", Type: "number", Required: true},
+			{Name: "tags", Type: "string", Multiple: true},
+			{Name: "brand", Type: "string"},
+		}},
+		Options: &ai.ExtractionOptions{UseAI: true, Timeout: 5},
+	}
+
+	result, err := extractor.Extract(context.Background(), input)
+	if err != nil {
+		t.Fatalf("extraction failed: %v", err)
+	}
+	if result.Method != "openai" || result.Data["title"] != "Desk Lamp" || result.Data["price"] != 24.5 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if tags, _ := result.Data["tags"].([]interface{}); len(tags) != 2 {
+		t.Errorf("expected two tags, got %v", result.Data["tags"])
+	}
+	// title and price count double, brand is missing: 5/6 of the weight,
+	// scaled by the model's own 0.9.
+	if want := 0.75; result.Confidence < want-0.001 || result.Confidence > want+0.001 {
+		t.Errorf("expected confidence %.2f, got %.3f", want, result.Confidence)
+	}
+
+	if request.Model != "gpt-test" || request.Temperature != 0.2 || len(request.Messages) != 2 {
+		t.Fatalf("unexpected request %+v", request)
+	}
+	prompt := request.Messages[1].Content
+	if !strings.Contains(prompt, "- price (number, required)") || strings.Contains(prompt, "tracking") || len(prompt) > 200*4 {
+		t.Errorf("expected a condensed prompt within the token budget, got %d chars:\n%s", len(prompt), prompt)
+	}
+
+	keyless := ai.NewOpenAIModel(ai.ModelConfig{Type: "openai", Endpoint: server.URL + "/v1"}, 200, 0)
+	if _, err := keyless.Extract(context.Background(), input); !errors.Is(err, ai.ErrMissingAPIKey) {
+		t.Errorf("expected ErrMissingAPIKey without a key, got %v", err)
+	}
+}
+
+func TestAIExtractorAppliesSchemaRules(t *testing.T) {
+	html := `<html><body>
+		<h1>  Desk LAMP  </h1>
+		<span class="price">Now 1.299,00 EUR</span>
+		<span class="color">Teal</span>
+		<span class="sku">ab-1234</span>
+	</body></html>`
+	fields := []ai.FieldSchema{
+		{Name: "title", Selector: "h1"},
+		{Name: "price", Selector: ".price"},
+		{Name: "color", Selector: ".color"},
+		{Name: "sku", Selector: ".sku"},
+	}
+
+	tests := []struct {
+		name       string
+		validation *ai.ValidationRules
+		rules      []ai.PostProcessRule
+		want       map[string]interface{}
+		dropped    string
+	}{
+		{name: "trim and lowercase", rules: []ai.PostProcessRule{
+			{Field: "title", Operation: "trim"}, {Field: "title", Operation: "lowercase"},
+		}, want: map[string]interface{}{"title": "desk lamp"}},
+		{name: "regex replace", rules: []ai.PostProcessRule{
+			{Field: "sku", Operation: "regex_replace", Value: `^([a-z]+)-(\d+)$=>$2-$1`},
+		}, want: map[string]interface{}{"sku": "1234-ab"}},
+		{name: "to number", rules: []ai.PostProcessRule{
+			{Field: "price", Operation: "to_number"},
+		}, want: map[string]interface{}{"price": 1299.0}},
+		{name: "min length", validation: &ai.ValidationRules{MinLength: 5}, dropped: "color"},
+		{name: "max length", validation: &ai.ValidationRules{MaxLength: 9}, dropped: "price"},
+		{name: "pattern", validation: &ai.ValidationRules{Pattern: `^[^-]*$`}, dropped: "sku"},
+		{name: "allowed values", rules: []ai.PostProcessRule{{Field: "title", Operation: "trim"}}, dropped: "color",
+			validation: &ai.ValidationRules{AllowedValues: []string{"Desk LAMP", "Now 1.299,00 EUR", "ab-1234"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor := ai.NewAIExtractor(&ai.AIConfig{})
+			result, err := extractor.Extract(context.Background(), &ai.ExtractionInput{
+				HTML:    html,
+				Schema:  &ai.ExtractionSchema{Fields: fields, Validation: tt.validation, PostProcess: tt.rules},
+				Options: &ai.ExtractionOptions{FallbackToCSS: true},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.want {
+				if got := result.Data[name]; got != want {
+					t.Errorf("%s: expected %v, got %v", name, want, got)
+				}
+			}
+			if tt.dropped == "" {
+				if len(result.Errors) != 0 || result.Confidence != 0.8 || len(result.Data) != len(fields) {
+					t.Errorf("expected a clean result, got %+v", result)
+				}
+				return
+			}
+			if _, ok := result.Data[tt.dropped]; ok || len(result.Data) != len(fields)-1 {
+				t.Errorf("expected only %s to be dropped, got %v", tt.dropped, result.Data)
+			}
+			if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], tt.dropped) {
+				t.Errorf("expected one error about %s, got %v", tt.dropped, result.Errors)
+			}
+			// One of four fields failed.
+			if result.Confidence < 0.599 || result.Confidence > 0.601 {
+				t.Errorf("expected confidence lowered to 0.6, got %v", result.Confidence)
+			}
+		})
+	}
+}
+
+func TestSelectorProductsBrandRatingAndOriginalPrice(t *testing.T) {
+	card := func(brand, name, price, original, rating, reviews string) string {
+		html := `<div class="p-card-wrppr"><a href="/p"><div class="prdct-desc-cntnr">`
+		html += `<span class="prdct-desc-cntnr-ttl">` + brand + `</span><span class="prdct-desc-cntnr-name">` + name + `</span></div>`
+		if rating != "" {
+			html += `<div class="ratings"><span class="rating-score">` + rating + `</span><span class="ratingCount">` + reviews + `</span></div>`
+		}
+		if original != "" {
+			html += `<div class="prc-box-orgnl">` + original + `</div>`
+		}
+		return html + `<div class="prc-box-dscntd">` + price + `</div></a></div>`
+	}
+	html := `<html><head><title>Lamba</title></head><body><div class="search-results">` +
+		card("Lumo", "Desk Lamp", "249,90 TL", "", "4,6", "(1.204)") +
+		card("Arta", "Floor Lamp", "899,00 TL", "1.199,00 TL", "", "") +
+		card("Lumo", "Wall Lamp", "129,50 TL", "159,50 TL", "3.8", "(17)") +
+		`</div></body></html>`
+
+	data := goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://www.trendyol.com/sr?q=lamba", html))
+	if len(data.Products) != 3 {
+		t.Fatalf("expected three products, got %+v", data.Products)
+	}
+
+	want := []struct{ brand, price, original, rating, reviews string }{
+		{"Lumo", "249,90 TL", "", "4.6", "1204"},
+		{"Arta", "899,00 TL", "1.199,00 TL", "", ""},
+		{"Lumo", "129,50 TL", "159,50 TL", "3.8", "17"},
+	}
+	for i, w := range want {
+		p := data.Products[i]
+		if p.Brand != w.brand || p.Price != w.price || p.OriginalPrice != w.original || p.Rating != w.rating || p.Reviews != w.reviews {
+			t.Errorf("product %d = %+v, want %+v", i, p, w)
+		}
+	}
+}
+
+func TestRegisterProductSelectors(t *testing.T) {
+	html := `<html><head><title>Catalog</title></head><body><ul>
+		<li class="tile"><b class="tile-name">Oak Shelf</b><i class="tile-cost">€45.00</i><em class="maker">Holz</em></li>
+		<li class="tile"><b class="tile-name">Pine Shelf</b><i class="tile-cost">€32.00</i><em class="maker">Holz</em></li>
+	</ul></body></html>`
+	selectors := goscraper.ProductSelectors{Name: ".tile-name", Price: ".tile-cost", Brand: ".maker"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		defer goscraper.UnregisterProductSelectors(fmt.Sprintf("othershop%d.com", i))
+		go func(i int) {
+			defer wg.Done()
+			goscraper.RegisterProductSelectors(fmt.Sprintf("othershop%d.com", i), goscraper.ProductSelectors{Name: "h1"})
+			goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://othershop.com/", html))
+		}(i)
+	}
+	goscraper.RegisterProductSelectors("shop.com", goscraper.ProductSelectors{Name: "h1"})
+	goscraper.RegisterProductSelectors("MyNewShop.com", selectors)
+	defer goscraper.UnregisterProductSelectors("shop.com")
+	defer goscraper.UnregisterProductSelectors("MyNewShop.com")
+	wg.Wait()
+
+	data := goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://www.mynewshop.com/shelves", html))
+	if len(data.Products) != 2 {
+		t.Fatalf("expected the registered selectors to find two products, got %+v", data.Products)
+	}
+	if p := data.Products[1]; p.Name != "Pine Shelf" || p.Price != "€32.00" || p.Brand != "Holz" {
+		t.Errorf("unexpected product %+v", p)
+	}
+
+	// Only the shop's product pages are known to be e-commerce.
+	detector := goscraper.NewContentDetector()
+	if got := detector.DetectContentType("https://www.mynewshop.com/shelves", html); got != goscraper.ContentTypeEcommerce {
+		t.Errorf("expected a registered product page to be e-commerce, got %s", got)
+	}
+	blog := `<html><head><title>Our blog</title></head><body><article><h1>How we dry oak</h1>
+		<p>Posted by Ada in our news blog. Read the article and comment below.</p></article></body></html>`
+	if got := detector.DetectContentType("https://www.mynewshop.com/blog/oak", blog); got == goscraper.ContentTypeEcommerce {
+		t.Errorf("expected the shop's blog not to be e-commerce, got %s", got)
+	}
+
+	goscraper.UnregisterProductSelectors("mynewshop.com")
+	data = goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://www.mynewshop.com/shelves", html))
+	for _, p := range data.Products {
+		if p.Brand == "Holz" {
+			t.Fatalf("expected unregistered selectors to be dropped, got %+v", data.Products)
+		}
+	}
+}
+
+// detectorFixtures are mostly pages the old detector, which counted
+// substrings across the raw HTML, got wrong.
+var detectorFixtures = []struct {
+	name, url, html string
+	want            goscraper.ContentType
+	minConfidence   float64
+}{
+	{
+		// Share widgets and "posted"/"postal"/"likely" wording outnumber the
+		// recipe keywords.
+		name: "recipe with social widgets",
+		url:  "https://kitchen.example/recipes/lemon-tart",
+		html: `<html><head><title>Lemon tart recipe</title>
+			<script>function shareOn(n){share(n);share.track('share','like','follow','tweet','post');}` +
+			strings.Repeat(`shareButtons.push({share:true,like:true,follow:true,profile:"post"});`, 10) + `</script></head>
+			<body><h1>Lemon tart</h1><p>Posted by Ada. Likely the best tart; postal orders shared widely.</p>
+			<h2>Ingredients</h2><ul class="recipe-ingredients"><li>3 lemons</li><li>200g flour</li></ul>
+			<p>Preparation: 20 minutes. Serves 8.</p>
+			<div class="social-share"><a>Share</a><a>Tweet</a></div></body></html>`,
+		want:          goscraper.ContentTypeRecipe,
+		minConfidence: 0.3,
+	},
+	{
+		name: "product page mentioning news",
+		url:  "https://gadgets.example/item/42",
+		html: `<html><head><title>Kettle</title><meta property="og:type" content="product"></head><body>
+			<h1>Kettle</h1>` + strings.Repeat(`<p>As seen in the news: read the article and story from our reporter.</p>`, 5) + `
+			</body></html>`,
+		want:          goscraper.ContentTypeEcommerce,
+		minConfidence: 0.8,
+	},
+	{
+		name: "job posting in microdata",
+		url:  "https://acme.example/team",
+		html: `<html><body><div itemscope itemtype="https://schema.org/JobPosting">
+			<h1 itemprop="title">Backend engineer</h1></div>` + strings.Repeat(`<p>Our blog post and comment section.</p>`, 5) + `</body></html>`,
+		want:          goscraper.ContentTypeJob,
+		minConfidence: 0.9,
+	},
+	{
+		// youtube is listed for both social media and video.
+		name:          "video on a social domain",
+		url:           "https://www.youtube.com/watch?v=abc",
+		html:          `<html><head><meta property="og:type" content="video.other"><title>Clip</title></head><body>Share, like and follow.</body></html>`,
+		want:          goscraper.ContentTypeVideo,
+		minConfidence: 0.8,
+	},
+	{
+		name:          "page without signals",
+		url:           "https://example.com/about",
+		html:          `<html><head><title>About us</title></head><body><p>We are a small team.</p></body></html>`,
+		want:          goscraper.ContentTypeGeneral,
+		minConfidence: 0.5,
+	},
+}
+
+func TestDetectContentTypeWeighsSignals(t *testing.T) {
+	detector := goscraper.NewContentDetector()
+	for _, tt := range detectorFixtures {
+		contentType, confidence := detector.DetectContentTypeWithConfidence(tt.url, tt.html)
+		if contentType != tt.want || confidence < tt.minConfidence || confidence > 1 {
+			t.Errorf("%s: got %s (%.2f), want %s with confidence >= %.2f", tt.name, contentType, confidence, tt.want, tt.minConfidence)
+		}
+		if got := detector.DetectContentType(tt.url, tt.html); got != contentType {
+			t.Errorf("%s: DetectContentType = %s, want %s", tt.name, got, contentType)
+		}
+	}
+}
+
+func TestDetectContentTypesRanksCandidates(t *testing.T) {
+	detector := goscraper.NewContentDetector()
+	for _, tt := range detectorFixtures {
+		candidates, err := detector.DetectContentTypes(tt.url, tt.html)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candidates) == 0 || candidates[0].Type != tt.want {
+			t.Errorf("%s: expected %s first, got %+v", tt.name, tt.want, candidates)
+			continue
+		}
+		for i, c := range candidates {
+			if c.Score <= 0 || c.Score > 1 || (i > 0 && c.Score > candidates[i-1].Score) {
+				t.Errorf("%s: candidates not ranked by score in (0, 1]: %+v", tt.name, candidates)
+				break
+			}
+		}
+	}
+
+	// A review article about a product declares both types.
+	review := `<html><head><title>Review: the Kettle 2</title><script type="application/ld+json">[
+		{"@type": "NewsArticle", "headline": "Review: the Kettle 2", "author": {"@type": "Person", "name": "Ada"}},
+		{"@type": "Product", "name": "Kettle 2", "offers": {"@type": "Offer", "price": "39.00", "priceCurrency": "EUR"}}
+		]</script></head><body><article><h1>Review: the Kettle 2</h1><p>Our reporter tested the kettle for a week.</p></article></body></html>`
+	candidates, _ := detector.DetectContentTypes("https://reviews.example/kettle-2", review)
+	if len(candidates) < 2 || candidates[1].Score < candidates[0].Score*0.8 {
+		t.Fatalf("expected two close candidates, got %+v", candidates)
+	}
+	data := goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://reviews.example/kettle-2", review))
+	if data.Article == nil || len(data.Products) != 1 || data.Products[0].Price != "39.00" {
+		t.Errorf("expected both the article and the product, got article %+v and products %+v", data.Article, data.Products)
+	}
+
+	// A runner-up far behind gets no extractor.
+	product := detectorFixtures[1]
+	candidates, _ = detector.DetectContentTypes(product.url, product.html)
+	if len(candidates) < 2 || candidates[1].Type != goscraper.ContentTypeNews || candidates[1].Score >= candidates[0].Score*0.8 {
+		t.Fatalf("expected news as a distant runner-up, got %+v", candidates)
+	}
+	if data := goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, product.url, product.html)); data.Article != nil {
+		t.Errorf("expected no article for a distant runner-up, got %+v", data.Article)
+	}
+}
+
+func TestExtractVideoMedia(t *testing.T) {
+	html := `<html><head><base href="https://cdn.example/media/">
+		<script type="application/ld+json">{"@type": "VideoObject", "name": "Clip",
+			"contentUrl": "clip.mp4", "embedUrl": "/embed/1"}</script>
+		</head><body>
+		<video poster="poster.jpg">
+			<source src="clip-720.webm"><source src="clip.mp4">
+			<track kind="subtitles" src="subs/en.vtt">
+		</video>
+		<audio src="https://audio.example/theme.mp3"></audio>
+	</body></html>`
+
+	data := goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://videos.example/watch/1", html))
+	if data.ContentType != goscraper.ContentTypeVideo || data.Video == nil {
+		t.Fatalf("expected video content, got %s", data.ContentType)
+	}
+	video := data.Video
+
+	wantSources := []string{
+		"https://cdn.example/media/clip.mp4",
+		"https://cdn.example/media/clip-720.webm",
+		"https://audio.example/theme.mp3",
+	}
+	if strings.Join(video.Sources, " ") != strings.Join(wantSources, " ") {
+		t.Errorf("expected sources %v resolved against <base>, got %v", wantSources, video.Sources)
+	}
+	if video.EmbedURL != "https://cdn.example/embed/1" {
+		t.Errorf("expected the embed URL kept apart from the sources, got %q", video.EmbedURL)
+	}
+	if video.URL != "https://cdn.example/media/clip.mp4" {
+		t.Errorf("expected the content URL, got %q", video.URL)
+	}
+	if len(video.Subtitles) != 1 || video.Subtitles[0] != "https://cdn.example/media/subs/en.vtt" {
+		t.Errorf("unexpected subtitles %v", video.Subtitles)
+	}
+	if video.Thumbnail != "https://cdn.example/media/poster.jpg" {
+		t.Errorf("expected the poster as thumbnail, got %q", video.Thumbnail)
+	}
+}
+
+func TestExtractPhoneNumbersByRegion(t *testing.T) {
+	international := `<p>Paris: +33 1 42 68 53 00 &middot; Istanbul: 0090 532 123 45 67</p>
+		<p>Order 123456789012345678 shipped, ref A1234567890, invoice 2024-05-01.</p>`
+
+	for _, tc := range []struct {
+		region string
+		html   string
+		want   []string
+	}{
+		{"US", `<p>Call (415) 555-0123 or 1-415-555-0123, fax 415.555.0199.</p>
+			<p>Not numbers: (015) 555-0123, 415 055 0123.</p>`,
+			[]string{"+14155550123", "+14155550199"}},
+		{"gb", `<p>London: 020 7946 0958, mobile 07400 123456.</p>
+			<p>Not numbers: 07700 900123 is reserved for drama.</p>`,
+			[]string{"+442079460958", "+447400123456"}},
+		{"TR", `<p>Tel: 0212 555 11 22 / 0532 123 45 67 &ndash; 0532 1234567</p>`,
+			[]string{"+902125551122", "+905321234567"}},
+		{"DE", `<p>Berlin: 030 901820, mobil 0151 23456789.</p>
+			<p>Not numbers: order 123 456 789, 01.05.2024, 0123 456789.</p>`,
+			[]string{"+4930901820", "+4915123456789"}},
+		// Regions are not limited to a built-in list.
+		{"JP", `<p>Tokyo: 03-1234-5678, order 1234 5678.</p>`,
+			[]string{"+81312345678"}},
+		// The Paris number below, written nationally.
+		{"FR", `<p>Standard: 01 42 68 53 00.</p><p>Not numbers: order 123 456 789, 01/05/2024.</p>`,
+			nil},
+	} {
+		got := goscraper.ExtractPhoneNumbers(tc.html+international, tc.region)
+		want := append(tc.want, "+33142685300")
+		if tc.region != "TR" {
+			want = append(want, "+905321234567")
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: expected %v, got %v", tc.region, want, got)
+		}
+	}
+
+	if got := goscraper.ExtractPhoneNumbers(international+"<p>020 7946 0958</p>", ""); len(got) != 2 {
+		t.Errorf("expected only international numbers without a region, got %v", got)
+	}
+}
+
+func TestSmartExtractorReusesLearnedPatterns(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		fmt.Fprint(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant",
+			"content": "{\"title\": \"Desk Lamp\", \"price\": \"$24.50\"}"}}]}`)
+	}))
+	defer server.Close()
+
+	extractor := ai.NewAIExtractor(&ai.AIConfig{
+		DefaultModel: "gpt",
+		Models: map[string]ai.ModelConfig{"gpt": {
+			Type: "openai", Endpoint: server.URL, APIKey: "test-key",
+		}},
+		MaxTokens: 200,
+	})
+	page := func(title, price string) string {
+		return `<html><body><div class="product"><h1 class="name">` + title + `</h1>
+			<span class="price">` + price + `</span></div>
+			<div class="related"><span class="price">$9.99</span></div></body></html>`
+	}
+	input := func(url, html string) *ai.ExtractionInput {
+		return &ai.ExtractionInput{
+			URL:  url,
+			HTML: html,
+			Schema: &ai.ExtractionSchema{Fields: []ai.FieldSchema{
+				{Name: "title", Type: "string", Required: true},
+				{Name: "price", Type: "number", Required: true},
+			}},
+			Options: &ai.ExtractionOptions{UseAI: true, Timeout: 5},
+		}
+	}
+
+	learner := ai.NewAISmartExtractor(extractor)
+	result, err := learner.Extract(context.Background(), input("https://shop.example/lamp", page("Desk Lamp", "$24.50")))
+	if err != nil || result.Method != "openai" || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("expected the first page to go to the model, got %+v (%v)", result, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "patterns.json")
+	if err := learner.SavePatterns(path); err != nil {
+		t.Fatal(err)
+	}
+
+	smart := ai.NewAISmartExtractor(extractor)
+	if err := smart.LoadPatterns(path); err != nil {
+		t.Fatal(err)
+	}
+	result, err = smart.Extract(context.Background(), input("https://shop.example/chair", page("Office Chair", "$120.00")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&calls) != 1 || result.Method != "pattern" || result.Metadata["pattern"] != "shop.example" {
+		t.Fatalf("expected the reloaded pattern to be applied, got %+v after %d model calls", result, calls)
+	}
+	if result.Data["title"] != "Office Chair" || result.Data["price"] != 120.0 {
+		t.Errorf("unexpected data %v", result.Data)
+	}
+
+	// Other domains, and pages the pattern no longer fits, need the model.
+	smart.Extract(context.Background(), input("https://other.example/lamp", page("Desk Lamp", "$24.50")))
+	smart.Extract(context.Background(), input("https://shop.example/sale", `<html><body><p>Sold out</p></body></html>`))
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("expected 3 model calls, got %d", n)
+	}
+}
+
+func TestExtractWithSchemaUsesCSSSelectors(t *testing.T) {
+	resp := newTestResponse(t, "https://shop.example/lamp", `<html><body>
+		<h1 class="name"> Desk Lamp </h1>
+		<span class="price">$24.50</span>
+		<ul><li class="tag">home</li><li class="tag">lighting</li></ul>
+		<a class="brand" href="/brands/lumen">Lumen</a>
+	</body></html>`)
+	schema := &ai.ExtractionSchema{
+		Fields: []ai.FieldSchema{
+			{Name: "title", Type: "string", Selector: "h1.name", Required: true},
+			{Name: "price", Type: "number", Selector: ".price", Required: true},
+			{Name: "tags", Type: "string", Selector: "li.tag", Multiple: true},
+			{Name: "brand", Type: "string", Selector: "a.brand", Attribute: "href"},
+		},
+		PostProcess: []ai.PostProcessRule{{Field: "price", Operation: "to_number"}},
+	}
+
+	result, err := goscraper.ExtractWithSchema(resp, schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Method != "css" || len(result.Errors) > 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if result.Data["title"] != "Desk Lamp" || result.Data["price"] != 24.5 || result.Data["brand"] != "/brands/lumen" {
+		t.Errorf("unexpected data %v", result.Data)
+	}
+	if tags, _ := result.Data["tags"].([]string); strings.Join(tags, ",") != "home,lighting" {
+		t.Errorf("unexpected tags %v", result.Data["tags"])
+	}
+
+	missing := &ai.ExtractionSchema{Fields: []ai.FieldSchema{{Name: "sku", Type: "string", Selector: ".sku", Required: true}}}
+	if result, err := goscraper.ExtractWithSchema(resp, missing, nil); err != nil || len(result.Errors) != 1 {
+		t.Errorf("expected the missing required field to be reported, got %+v (%v)", result, err)
+	}
+	if _, err := goscraper.ExtractWithSchema(resp, schema, &ai.ExtractionOptions{UseAI: true}); !errors.Is(err, goscraper.ErrNoModel) {
+		t.Errorf("expected model extraction to fail with ErrNoModel, got %v", err)
+	}
+	for _, opts := range []*ai.ExtractionOptions{{Timeout: 10}, {UseAI: true, FallbackToCSS: true}} {
+		if result, err := goscraper.ExtractWithSchema(resp, schema, opts); err != nil || result.Data["title"] != "Desk Lamp" {
+			t.Errorf("%+v: expected CSS extraction, got %+v (%v)", opts, result, err)
+		}
+	}
+
+	// Fields failing validation are dropped the same way by the scraper's
+	// schema source.
+	strict := &ai.ExtractionSchema{
+		Fields: []ai.FieldSchema{
+			{Name: "title", Type: "string", Selector: "h1.name"},
+			{Name: "brand", Type: "string", Selector: "a.brand"},
+		},
+		Validation: &ai.ValidationRules{MaxLength: 6},
+	}
+	result, err = goscraper.ExtractWithSchema(resp, strict, nil)
+	if err != nil || result.Data["title"] != nil || result.Data["brand"] != "Lumen" || len(result.Errors) != 1 || result.Confidence >= 0.8 {
+		t.Errorf("expected the long title to be dropped, got %+v (%v)", result, err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(strict)
+	}))
+	defer server.Close()
+	data, errs := goscraper.New(goscraper.WithSchemaSource(server.URL, time.Hour)).ExtractWithSchema(resp)
+	if data["title"] != nil || data["brand"] != "Lumen" || len(errs) != 1 {
+		t.Errorf("expected the scraper to drop the long title too, got %v, %v", data, errs)
+	}
+	if _, err := goscraper.ExtractWithSchema(resp, nil, nil); !errors.Is(err, goscraper.ErrNoSchema) {
+		t.Errorf("expected ErrNoSchema, got %v", err)
+	}
+}
+
+func TestExtractionMetrics(t *testing.T) {
+	metrics := monitoring.NewMetrics(zap.NewNop())
+	extractor := goscraper.NewSmartExtractor()
+	extractor.SetExtractionHook(metrics)
+
+	page := func(price string) string {
+		return `<html><head><script type="application/ld+json">{"@type": "Product", "name": "Desk Lamp",
+			"offers": {"@type": "Offer", "price": "` + price + `", "priceCurrency": "EUR"}}</script></head>
+			<body><h1>Desk Lamp</h1></body></html>`
+	}
+	for _, price := range []string{"24.50", "24.50", "see store"} {
+		data := extractor.ExtractSmart(newTestResponse(t, "https://shop.example/lamp", page(price)))
+		if data.ContentType != goscraper.ContentTypeEcommerce {
+			t.Fatalf("expected an e-commerce page, got %s", data.ContentType)
+		}
+	}
+
+	families, err := metrics.Registry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var confidence *dto.Histogram
+	for _, family := range families {
+		if family.GetName() == "goscraper_extraction_confidence" {
+			confidence = family.GetMetric()[0].GetHistogram()
+		}
+	}
+	if confidence == nil || confidence.GetSampleCount() != 3 {
+		t.Fatalf("expected 3 confidence observations, got %v", confidence)
+	}
+	// The invalid price shows as a drop below full confidence rather than
+	// vanishing into an average.
+	var belowFull uint64
+	for _, bucket := range confidence.GetBucket() {
+		if bucket.GetUpperBound() == 0.9 {
+			belowFull = bucket.GetCumulativeCount()
+		}
+	}
+	if belowFull != 1 {
+		t.Errorf("expected one extraction below 0.9 confidence, got %d", belowFull)
+	}
+
+	if got := testutil.ToFloat64(metrics.ExtractionErrors.WithLabelValues("ecommerce", "product_price")); got != 1 {
+		t.Errorf("expected the invalid price to count as an extraction error, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.ExtractionsTotal.WithLabelValues("ecommerce", "success")); got != 3 {
+		t.Errorf("expected 3 successful extractions, got %v", got)
+	}
+}
+
+func TestExtractSmartMatchesProductsAcrossSources(t *testing.T) {
+	goscraper.RegisterProductSelectors("matchshop.example", goscraper.ProductSelectors{
+		Name: ".card-name", Price: ".card-price", Brand: ".card-brand", Link: ".card-link",
+	})
+	defer goscraper.UnregisterProductSelectors("matchshop.example")
+
+	// The cards list the products in the opposite order to the JSON-LD.
+	html := `<html><head>
+		<script type="application/ld+json">{"@type": "Product", "name": "Oak Shelf", "sku": "OAK-1",
+			"offers": {"@type": "Offer", "price": "45.00", "priceCurrency": "EUR"}}</script>
+		<script type="application/ld+json">{"@type": "Product", "name": "Pine Shelf",
+			"offers": {"@type": "Offer", "price": "32.00", "priceCurrency": "EUR"}}</script>
+	</head><body>
+		<div class="card"><a class="card-link" href="/pine"><b class="card-name">Pine  Shelf</b></a>
+			<i class="card-price">€32.00</i><em class="card-brand">Kiefer</em></div>
+		<div class="card"><a class="card-link" href="/oak"><b class="card-name">Oak Shelf</b></a>
+			<i class="card-price">€45.00</i><em class="card-brand">Holz</em></div>
+	</body></html>`
+
+	data := goscraper.NewSmartExtractor().ExtractSmart(newTestResponse(t, "https://www.matchshop.example/shelves", html))
+	if len(data.Products) != 2 {
+		t.Fatalf("expected the two JSON-LD products, got %+v", data.Products)
+	}
+	for i, want := range []struct{ name, brand string }{{"Oak Shelf", "Holz"}, {"Pine Shelf", "Kiefer"}} {
+		if p := data.Products[i]; p.Name != want.name || p.Brand != want.brand {
+			t.Errorf("product %d: expected %s by %s, got %+v", i, want.name, want.brand, p)
+		}
+	}
+
+	expected := map[string]string{
+		"products":          goscraper.SourceJSONLD,
+		"products[0].name":  goscraper.SourceJSONLD,
+		"products[0].sku":   goscraper.SourceJSONLD,
+		"products[0].brand": goscraper.SourceSelector,
+		"products[1].brand": goscraper.SourceSelector,
+		"products[1].url":   goscraper.SourceSelector,
+	}
+	for field, source := range expected {
+		if got := data.FieldSources[field]; got != source {
+			t.Errorf("expected %s from %s, got %q", field, source, got)
+		}
+	}
+	if _, ok := data.FieldSources["products[1].sku"]; ok {
+		t.Errorf("expected no SKU source for a product without one, got %v", data.FieldSources)
+	}
+}
@@ -3,9 +3,11 @@ package tests
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/ramusaaa/goscraper/config"
@@ -117,4 +119,25 @@ func TestCLICommands(t *testing.T) {
 	if loadedCfg.AI.Enabled != cfg.AI.Enabled {
 		t.Error("Config not loaded correctly")
 	}
-}
\ No newline at end of file
+}
+
+func TestConfigCustomValidators(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.AddValidator(func(c *config.Config) error {
+		if !c.Proxy.Enabled {
+			return errors.New("proxy is required")
+		}
+		return nil
+	})
+	cfg.AddValidator(func(c *config.Config) error {
+		return errors.New("stealth must be on")
+	})
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation to fail")
+	}
+	if !strings.Contains(err.Error(), "proxy is required") || !strings.Contains(err.Error(), "stealth must be on") {
+		t.Errorf("expected both validator errors, got: %v", err)
+	}
+}
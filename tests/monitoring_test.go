@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"github.com/ramusaaa/goscraper/pkg/monitoring"
+)
+
+func TestAlertTriggersWhenGaugeExceedsThreshold(t *testing.T) {
+	metrics := monitoring.NewMetrics(zap.NewNop())
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "test_queue_depth",
+		Help: "Queue depth for alert tests",
+	}, []string{"queue"})
+	metrics.Registry().MustRegister(gauge)
+
+	var notified []float64
+	alerts := monitoring.NewAlertManager(metrics, zap.NewNop(),
+		monitoring.WithAlertNotifier(func(ctx context.Context, alert *monitoring.Alert, value float64) {
+			notified = append(notified, value)
+		}),
+	)
+	alerts.AddAlert(&monitoring.Alert{
+		Name:      "QueueBacklog",
+		Query:     `test_queue_depth{queue="jobs"}`,
+		Threshold: 100,
+		Duration:  50 * time.Millisecond,
+	})
+
+	ctx := context.Background()
+	gauge.WithLabelValues("jobs").Set(10)
+	gauge.WithLabelValues("other").Set(500)
+	if firing := alerts.Evaluate(ctx); len(firing) != 0 {
+		t.Fatalf("alert fired below threshold: %v", firing)
+	}
+
+	gauge.WithLabelValues("jobs").Set(150)
+	if firing := alerts.Evaluate(ctx); len(firing) != 0 {
+		t.Fatal("alert fired before its duration elapsed")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	firing := alerts.Evaluate(ctx)
+	if len(firing) != 1 || firing[0].Name != "QueueBacklog" {
+		t.Fatalf("expected QueueBacklog to fire, got %v", firing)
+	}
+	alerts.Evaluate(ctx)
+	if len(notified) != 1 || notified[0] != 150 {
+		t.Fatalf("expected one notification with value 150, got %v", notified)
+	}
+
+	gauge.WithLabelValues("jobs").Set(20)
+	if firing := alerts.Evaluate(ctx); len(firing) != 0 {
+		t.Fatal("alert kept firing after recovering")
+	}
+}
+
+func TestAlertOnCounterRate(t *testing.T) {
+	metrics := monitoring.NewMetrics(zap.NewNop())
+	alerts := monitoring.NewAlertManager(metrics, zap.NewNop())
+	alerts.AddAlert(&monitoring.Alert{
+		Name:      "ErrorRate",
+		Query:     `rate(goscraper_errors_total{component="http"}[1m])`,
+		Threshold: 10,
+	})
+
+	ctx := context.Background()
+	metrics.RecordError("timeout", "http")
+	if firing := alerts.Evaluate(ctx); len(firing) != 0 {
+		t.Fatal("rate alert fired without a previous sample")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 50; i++ {
+		metrics.RecordError("timeout", "http")
+	}
+	if firing := alerts.Evaluate(ctx); len(firing) != 1 {
+		t.Fatal("expected the error rate alert to fire")
+	}
+}
+
+func TestReadinessReportsEachDependency(t *testing.T) {
+	checks := map[string]monitoring.HealthCheck{
+		"cache": func(ctx context.Context) error { return nil },
+		"queue": func(ctx context.Context) error { return errors.New("connection refused") },
+		"coordinator": func(ctx context.Context) error {
+			// Ignores its context; the probe must still return on time.
+			time.Sleep(time.Second)
+			return nil
+		},
+	}
+
+	server := httptest.NewServer(monitoring.ReadinessHandler(checks, 50*time.Millisecond))
+	defer server.Close()
+
+	start := time.Now()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("readiness probe took %s despite the timeout", elapsed)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 with a dependency down, got %d", resp.StatusCode)
+	}
+
+	var report monitoring.ReadinessReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Dependencies["cache"].Status != "up" ||
+		report.Dependencies["queue"].Status != "down" || report.Dependencies["queue"].Error != "connection refused" ||
+		report.Dependencies["coordinator"].Status != "down" {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	delete(checks, "queue")
+	delete(checks, "coordinator")
+	if report := monitoring.CheckReadiness(context.Background(), checks, time.Second); report.Status != "ready" {
+		t.Errorf("expected ready when every check passes, got %+v", report)
+	}
+}
+
+func TestHostLabelStrategies(t *testing.T) {
+	hosts := []string{"a.example", "b.example", "c.example", "a.example", "d.example"}
+
+	unlimited := monitoring.NewMetrics(zap.NewNop())
+	for _, host := range hosts {
+		if got := unlimited.HostLabel(host); got != host {
+			t.Errorf("expected %s to be kept without a limit, got %s", host, got)
+		}
+	}
+
+	firstN := monitoring.NewMetrics(zap.NewNop(), monitoring.WithMetricsCardinalityLimit(2))
+	var labels []string
+	for _, host := range hosts {
+		labels = append(labels, firstN.HostLabel(host))
+	}
+	if got, want := strings.Join(labels, ","), "a.example,b.example,other,a.example,other"; got != want {
+		t.Errorf("first_n: expected %s, got %s", want, got)
+	}
+
+	strip := monitoring.NewMetrics(zap.NewNop(), monitoring.WithHostLabelStrategy(monitoring.HostLabelStrip))
+	for _, host := range hosts {
+		if got := strip.HostLabel(host); got != monitoring.HostLabelAll {
+			t.Errorf("strip: expected %s for %s, got %s", monitoring.HostLabelAll, host, got)
+		}
+	}
+
+	hash := monitoring.NewMetrics(zap.NewNop(),
+		monitoring.WithHostLabelStrategy(monitoring.HostLabelHash),
+		monitoring.WithMetricsCardinalityLimit(3),
+	)
+	buckets := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		host := fmt.Sprintf("host-%d.example", i)
+		label := hash.HostLabel(host)
+		if !strings.HasPrefix(label, "bucket-") {
+			t.Fatalf("hash: expected a bucket label for %s, got %s", host, label)
+		}
+		if again := hash.HostLabel(host); again != label {
+			t.Errorf("hash: %s moved from %s to %s", host, label, again)
+		}
+		buckets[label] = true
+	}
+	if len(buckets) > 3 {
+		t.Errorf("hash: expected at most 3 buckets, got %v", buckets)
+	}
+}
+
+func TestCardinalityLimitFoldsRequestMetrics(t *testing.T) {
+	metrics := monitoring.NewMetrics(zap.NewNop(), monitoring.WithMetricsCardinalityLimit(2))
+	for i := 0; i < 10; i++ {
+		metrics.RecordRequest("GET", fmt.Sprintf("host-%d.example", i), "200", time.Millisecond, 100)
+	}
+
+	if got := testutil.CollectAndCount(metrics.RequestsTotal); got != 3 {
+		t.Errorf("expected two hosts and the overflow series, got %d series", got)
+	}
+	if got := testutil.ToFloat64(metrics.RequestsTotal.WithLabelValues("GET", "200", monitoring.HostLabelOther)); got != 8 {
+		t.Errorf("expected 8 requests in the overflow series, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.RequestsTotal.WithLabelValues("GET", "200", "host-0.example")); got != 1 {
+		t.Errorf("expected the first host to keep its own series, got %v", got)
+	}
+}
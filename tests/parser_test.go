@@ -0,0 +1,563 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ramusaaa/goscraper"
+	"github.com/ramusaaa/goscraper/pkg/ai"
+)
+
+func newTestParser(t *testing.T, html string) *goscraper.Parser {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("failed to parse HTML: %v", err)
+	}
+	return goscraper.NewParser(doc)
+}
+
+func TestExtractTableInto(t *testing.T) {
+	parser := newTestParser(t, `
+		<table id="stock">
+			<thead><tr><th>Product</th><th>Qty</th><th>Price</th><th>Updated</th></tr></thead>
+			<tbody>
+				<tr><td>Widget</td><td>1,200</td><td>9.99</td><td>2024-03-01</td></tr>
+				<tr><td>Gadget</td><td>n/a</td><td>19.5</td><td>2024-03-02</td></tr>
+			</tbody>
+		</table>`)
+
+	type row struct {
+		Name    string    `header:"Product"`
+		Qty     int       `header:"qty"`
+		Price   float64   `header:"Price"`
+		Updated time.Time `header:"Updated"`
+	}
+
+	var rows []row
+	err := parser.ExtractTableInto("#stock", &rows)
+
+	var tableErr *goscraper.TableError
+	if !errors.As(err, &tableErr) {
+		t.Fatalf("Expected *TableError, got %v", err)
+	}
+	if len(tableErr.Cells) != 1 || tableErr.Cells[0].Row != 1 || tableErr.Cells[0].Column != "qty" {
+		t.Errorf("Unexpected cell errors: %+v", tableErr.Cells)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].Name != "Widget" || rows[0].Qty != 1200 || rows[0].Price != 9.99 {
+		t.Errorf("Unexpected first row: %+v", rows[0])
+	}
+	if rows[1].Updated.Day() != 2 {
+		t.Errorf("Expected parsed date, got %v", rows[1].Updated)
+	}
+}
+
+func TestExtractTableIntoDecimalComma(t *testing.T) {
+	parser := newTestParser(t, `
+		<table id="prices">
+			<thead><tr><th>Qty</th><th>Price</th><th>Total</th></tr></thead>
+			<tbody>
+				<tr><td>1.234</td><td>1,5</td><td>1.234,56</td></tr>
+			</tbody>
+		</table>`)
+
+	type row struct {
+		Qty   int     `header:"Qty" decimal:","`
+		Price float64 `header:"Price" decimal:","`
+		Total float64 `header:"Total"`
+	}
+
+	var rows []row
+	if err := parser.ExtractTableInto("#prices", &rows); err != nil {
+		t.Fatalf("ExtractTableInto failed: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("Expected 1 row, got %d", len(rows))
+	}
+	if rows[0].Qty != 1234 || rows[0].Price != 1.5 || rows[0].Total != 1234.56 {
+		t.Errorf("Unexpected row: %+v", rows[0])
+	}
+}
+
+func TestExtractTables(t *testing.T) {
+	parser := newTestParser(t, `
+		<table id="simple">
+			<thead><tr><th>Name</th><th>Age</th></tr></thead>
+			<tbody>
+				<tr><td>Ada</td><td>36</td></tr>
+				<tr><td>Alan</td></tr>
+			</tbody>
+		</table>
+		<table id="spans">
+			<tr><th>Region</th><th colspan="2">Sales</th></tr>
+			<tr><td>North</td><td>10</td><td>12</td></tr>
+			<tr><td colspan="3">Total <table><tr><td>nested</td></tr></table></td></tr>
+		</table>
+		<table id="bare">
+			<tr><td>a</td><td>b</td><td>c</td></tr>
+			<tr><td>d</td></tr>
+		</table>`)
+
+	tables := parser.ExtractTables()
+	if len(tables) != 4 {
+		t.Fatalf("expected 4 tables including the nested one, got %d", len(tables))
+	}
+
+	simple := tables[0]
+	if fmt.Sprint(simple.Headers) != "[Name Age]" || fmt.Sprint(simple.Rows) != "[[Ada 36] [Alan ]]" {
+		t.Errorf("unexpected simple table %q", simple)
+	}
+
+	spans := parser.ExtractTable("#spans")
+	if spans == nil {
+		t.Fatal("expected #spans to be found")
+	}
+	if fmt.Sprint(spans.Headers) != "[Region Sales Sales]" || len(spans.Rows) != 2 ||
+		fmt.Sprint(spans.Rows[0]) != "[North 10 12]" || len(spans.Rows[1]) != 3 {
+		t.Errorf("unexpected colspan table %q", spans)
+	}
+
+	bare := parser.ExtractTable("#bare")
+	if bare == nil || bare.Headers != nil || fmt.Sprint(bare.Rows) != "[[a b c] [d  ]]" {
+		t.Errorf("unexpected headerless table %q", bare)
+	}
+
+	if parser.ExtractTable("#missing") != nil {
+		t.Error("expected nil for a missing table")
+	}
+}
+
+func TestExtractMicroformats(t *testing.T) {
+	parser := newTestParser(t, `<html><body>
+		<article class="h-entry">
+			<h1 class="p-name">Hello IndieWeb</h1>
+			<a class="p-author h-card" href="https://jane.example/">Jane Doe</a>
+			<time class="dt-published" datetime="2024-05-01T10:00:00Z">May 1</time>
+			<div class="e-content"><p>First post.</p></div>
+			<span class="p-category">indieweb</span>
+		</article>
+		<a rel="me" href="https://social.example/@jane">Social</a>
+	</body></html>`)
+
+	mf := parser.ExtractMicroformats()
+	items := mf["items"].([]interface{})
+	if len(items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(items))
+	}
+	entry := items[0].(map[string]interface{})
+	props := entry["properties"].(map[string]interface{})
+
+	if name := props["name"].([]interface{})[0]; name != "Hello IndieWeb" {
+		t.Errorf("name = %v", name)
+	}
+	if published := props["published"].([]interface{})[0]; published != "2024-05-01T10:00:00Z" {
+		t.Errorf("published = %v", published)
+	}
+	author := props["author"].([]interface{})[0].(map[string]interface{})
+	if author["value"] != "Jane Doe" {
+		t.Errorf("author value = %v", author["value"])
+	}
+	authorProps := author["properties"].(map[string]interface{})
+	if u := authorProps["url"].([]interface{})[0]; u != "https://jane.example/" {
+		t.Errorf("implied author url = %v", u)
+	}
+	content := props["content"].([]interface{})[0].(map[string]interface{})
+	if content["html"] != "<p>First post.</p>" || content["value"] != "First post." {
+		t.Errorf("content = %v", content)
+	}
+	if me := mf["rels"].(map[string]interface{})["me"].([]string); len(me) != 1 {
+		t.Errorf("rels = %v", mf["rels"])
+	}
+}
+
+func TestExtractInlineJSON(t *testing.T) {
+	parser := newTestParser(t, `<html><head>
+		<script>window.__STATE__ = {"product": {"id": 42, "name": "Lamp {deluxe}"}};</script>
+		<script>var cfg = {debug: true, items: [1, 2, 3]};</script>
+		<script src="/app.js">{"ignored": true}</script>
+	</head><body></body></html>`)
+
+	values := parser.ExtractInlineJSON()
+	if len(values) != 2 {
+		t.Fatalf("expected 2 JSON values, got %d: %v", len(values), values)
+	}
+
+	state := values[0].(map[string]interface{})
+	product := state["product"].(map[string]interface{})
+	if product["name"] != "Lamp {deluxe}" || product["id"] != float64(42) {
+		t.Errorf("unexpected state: %v", state)
+	}
+	if items := values[1].([]interface{}); len(items) != 3 {
+		t.Errorf("expected nested array from JS object, got %v", values[1])
+	}
+}
+
+func TestExtractInlineJSONSkipsCommentsAndRegexLiterals(t *testing.T) {
+	parser := newTestParser(t, `<html><head><script>
+		// don't stop at { or "quotes" in comments
+		/* [ unbalanced ' */
+		var slug = /[{"']+/g, half = (total) / 2, opts = {"page": 2}, third = total / 3;
+		if (/^\/p\/[^/]+$/.test(path)) { window.__DATA__ = {"sku": "A-1", "tags": ["x"]}; }
+		var cfg = {"url": "https://shop.example/{id}"}; // trailing comment ]
+	</script></head><body></body></html>`)
+
+	values := parser.ExtractInlineJSON()
+	if len(values) != 3 {
+		t.Fatalf("expected 3 JSON values, got %d: %v", len(values), values)
+	}
+	if opts, ok := values[0].(map[string]interface{}); !ok || opts["page"] != float64(2) {
+		t.Errorf("expected the options between two divisions, got %v", values[0])
+	}
+	if data, ok := values[1].(map[string]interface{}); !ok || data["sku"] != "A-1" {
+		t.Errorf("expected the state object, got %v", values[1])
+	}
+	if cfg, ok := values[2].(map[string]interface{}); !ok || cfg["url"] != "https://shop.example/{id}" {
+		t.Errorf("expected the config object, got %v", values[2])
+	}
+}
+
+func TestExtractInlineJSONHandlesLargeUnbalancedScripts(t *testing.T) {
+	script := strings.Repeat("{[", 100000) + `{"last": true}`
+	parser := newTestParser(t, "<html><head><script>"+script+"</script></head><body></body></html>")
+
+	values := parser.ExtractInlineJSON()
+	if len(values) != 1 {
+		t.Fatalf("expected only the balanced literal, got %d values", len(values))
+	}
+}
+
+func TestExtractLinksResolvesAgainstBaseURL(t *testing.T) {
+	parser := newTestParser(t, `<html><body>
+		<a href="/product/123">Relative</a>
+		<a href="//cdn.example.com/file.pdf">Protocol-relative</a>
+		<a href="https://other.example/page">Absolute</a>
+		<img src="img/photo.jpg" alt="Photo">
+	</body></html>`)
+	parser.SetBaseURL("https://shop.example/category/index.html")
+
+	links := parser.ExtractLinks()
+	want := []string{
+		"https://shop.example/product/123",
+		"https://cdn.example.com/file.pdf",
+		"https://other.example/page",
+	}
+	if len(links) != len(want) {
+		t.Fatalf("expected %d links, got %+v", len(want), links)
+	}
+	for i, link := range links {
+		if link.URL != want[i] {
+			t.Errorf("link %d = %q, want %q", i, link.URL, want[i])
+		}
+	}
+	if links[0].RawURL != "/product/123" {
+		t.Errorf("raw href not kept: %q", links[0].RawURL)
+	}
+
+	images := parser.ExtractImages()
+	if len(images) != 1 || images[0].URL != "https://shop.example/category/img/photo.jpg" || images[0].RawURL != "img/photo.jpg" {
+		t.Errorf("unexpected images: %+v", images)
+	}
+}
+
+func TestExtractLinksHonorsBaseTag(t *testing.T) {
+	parser := newTestParser(t, `<html><head><base href="/assets/"></head><body>
+		<a href="guide.html">Guide</a>
+	</body></html>`)
+	parser.SetBaseURL("https://shop.example/category/page")
+
+	links := parser.ExtractLinks()
+	if len(links) != 1 || links[0].URL != "https://shop.example/assets/guide.html" {
+		t.Errorf("expected link resolved against <base href>, got %+v", links)
+	}
+}
+
+func TestExtractJSONLDFlattensGraph(t *testing.T) {
+	parser := newTestParser(t, `<html><head>
+		<script type="application/ld+json"><!--
+		{"@context": "https://schema.org", "@graph": [
+			{"@type": "WebSite", "name": "Shop"},
+			{"@type": "Product", "name": "Kettle"}
+		]}
+		--></script>
+		<script type="application/ld+json">[{"@type": "Organization", "name": "Acme"}]</script>
+		<script type="application/ld+json">{not json</script>
+	</head></html>`)
+
+	objects := parser.ExtractJSONLD()
+	var types []string
+	for _, obj := range objects {
+		if t, ok := obj["@type"].(string); ok {
+			types = append(types, t)
+		}
+	}
+	if strings.Join(types, ",") != "WebSite,Product,Organization" {
+		t.Errorf("unexpected JSON-LD objects: %v", types)
+	}
+}
+
+func TestExtractMetaTagsMulti(t *testing.T) {
+	parser := newTestParser(t, `<html><head>
+		<meta property="og:image" content="/first.jpg">
+		<meta property="og:image:alt" content="First">
+		<meta property="og:image" content="https://cdn.example/second.jpg">
+		<meta name="description" content="A page">
+	</head></html>`)
+
+	multi := parser.ExtractMetaTagsMulti()
+	if images := multi["og:image"]; len(images) != 2 || images[0] != "/first.jpg" {
+		t.Errorf("expected both og:image values, got %v", images)
+	}
+	if single := parser.ExtractMetaTags(); single["og:image"] != "https://cdn.example/second.jpg" {
+		t.Errorf("single-valued map changed behaviour: %v", single["og:image"])
+	}
+}
+
+const xpathFixture = `<html><body>
+	<div class="product" data-sku="A1">
+		<h2 class="name">Desk Lamp</h2>
+		<span class="price">24.50</span>
+		<a class="more" href="/lamp">Details</a>
+	</div>
+	<div class="product sale" data-sku="B2">
+		<h2 class="name">Floor Lamp</h2>
+		<span class="price">89.00</span>
+		<a class="more" href="/floor">Details</a>
+	</div>
+	<p class="note">Prices include <b>VAT</b>.</p>
+</body></html>`
+
+func TestXPathMatchesCSS(t *testing.T) {
+	parser := newTestParser(t, xpathFixture)
+
+	equivalents := []struct{ css, xpath string }{
+		{".product .name", "//div[contains(concat(' ', @class, ' '), ' product ')]//*[@class='name']"},
+		{".product.sale .price", "//div[contains(@class, 'sale')]/span[@class='price']"},
+		{".product:first-child h2", "//body/div[1]/h2"},
+		{"p.note", "//p[b]"},
+	}
+	for _, eq := range equivalents {
+		css, xp := parser.ExtractTexts(eq.css), parser.ExtractTextsXPath(eq.xpath)
+		if len(css) == 0 || strings.Join(css, "|") != strings.Join(xp, "|") {
+			t.Errorf("%s gave %q but %s gave %q", eq.css, css, eq.xpath, xp)
+		}
+	}
+
+	if css, xp := parser.ExtractAttrs("a.more", "href"), parser.ExtractAttrsXPath("//a[@class='more']", "href"); strings.Join(css, "|") != strings.Join(xp, "|") {
+		t.Errorf("expected the same hrefs, got %v and %v", css, xp)
+	}
+	if got := parser.ExtractTextXPath("//div[.//span > 50]/@data-sku"); got != "B2" {
+		t.Errorf("expected an attribute step to yield its value, got %q", got)
+	}
+	if got := parser.ExtractTextXPath("//div[@class='product'"); got != "" {
+		t.Errorf("expected an invalid expression to select nothing, got %q", got)
+	}
+	if got := parser.ExtractTextXPath("count(//a)"); got != "2" {
+		t.Errorf("expected a scalar expression to yield its value, got %q", got)
+	}
+}
+
+func TestSchemaFieldsAcceptXPath(t *testing.T) {
+	fields := func(prefix string, selectors ...string) []ai.FieldSchema {
+		return []ai.FieldSchema{
+			{Name: "names", Selector: prefix + selectors[0], Multiple: true},
+			{Name: "link", Selector: prefix + selectors[1], Attribute: "href"},
+		}
+	}
+	extract := func(schema *ai.ExtractionSchema) map[string]interface{} {
+		t.Helper()
+		if err := schema.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		result, err := ai.NewAIExtractor(&ai.AIConfig{}).Extract(context.Background(), &ai.ExtractionInput{
+			HTML:    xpathFixture,
+			Schema:  schema,
+			Options: &ai.ExtractionOptions{FallbackToCSS: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Data
+	}
+
+	css := extract(&ai.ExtractionSchema{Fields: fields("", "h2.name", ".sale a")})
+	xp := extract(&ai.ExtractionSchema{Fields: fields("xpath:", "//h2[@class='name']", "//div[2]/a")})
+	if fmt.Sprint(css) != fmt.Sprint(xp) || css["link"] != "/floor" {
+		t.Errorf("expected CSS and XPath fields to agree, got %v and %v", css, xp)
+	}
+
+	invalid := &ai.ExtractionSchema{Fields: []ai.FieldSchema{{Name: "name", Selector: "xpath://h2["}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("expected an invalid XPath selector to fail validation")
+	}
+}
+
+func TestExtractOpenGraphAndTwitterCard(t *testing.T) {
+	page := `<html><head>
+		<meta property="og:title" content="Desk Lamp">
+		<meta property="og:title" content="Duplicate title">
+		<meta name="og:type" content="product">
+		<meta property="OG:Image" content="/img/lamp.jpg">
+		<meta property="og:url" content="https://shop.example/lamp">
+		<meta property="og:description" content="A lamp for your desk.">
+		<meta property="og:site_name" content="Shop">
+		<meta name="twitter:card" content="summary_large_image">
+		<meta property="twitter:site" content="@shop">
+		<meta name="twitter:creator" content="@designer">
+		<meta name="twitter:title" content="Desk Lamp on Shop">
+		<meta name="twitter:description" content="">
+		<meta name="twitter:image:src" content="https://cdn.example/lamp-card.jpg">
+	</head><body><p>No images here.</p></body></html>`
+	parser := newTestParser(t, page)
+	parser.SetBaseURL("https://shop.example/products/lamp")
+
+	og := parser.ExtractOpenGraph()
+	want := goscraper.OpenGraph{
+		Title:       "Desk Lamp",
+		Type:        "product",
+		Image:       "https://shop.example/img/lamp.jpg",
+		URL:         "https://shop.example/lamp",
+		Description: "A lamp for your desk.",
+		SiteName:    "Shop",
+	}
+	if og != want {
+		t.Errorf("unexpected Open Graph data:\n got %+v\nwant %+v", og, want)
+	}
+
+	card := parser.ExtractTwitterCard()
+	wantCard := goscraper.TwitterCard{
+		Card:    "summary_large_image",
+		Site:    "@shop",
+		Creator: "@designer",
+		Title:   "Desk Lamp on Shop",
+		Image:   "https://cdn.example/lamp-card.jpg",
+	}
+	if card != wantCard {
+		t.Errorf("unexpected Twitter card:\n got %+v\nwant %+v", card, wantCard)
+	}
+
+	if empty := newTestParser(t, "<html><head></head></html>").ExtractOpenGraph(); empty != (goscraper.OpenGraph{}) {
+		t.Errorf("expected no Open Graph data, got %+v", empty)
+	}
+
+	// Smart extraction falls back to the social tags.
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(strings.Replace(page, `property="OG:Image"`, `property="og:audio"`, 1)))
+	data := goscraper.NewSmartExtractor().ExtractSmart(&goscraper.Response{URL: "https://shop.example/products/lamp", Body: page, Document: doc})
+	if data.Description != "A lamp for your desk." {
+		t.Errorf("expected the og:description, got %q", data.Description)
+	}
+	if len(data.Images) != 1 || data.Images[0].URL != "https://cdn.example/lamp-card.jpg" {
+		t.Errorf("expected the Twitter card image, got %+v", data.Images)
+	}
+}
+
+func TestExtractImagesFiltersAndDedupes(t *testing.T) {
+	parser := newTestParser(t, `<html><body>
+		<img src="/img/small.jpg" srcset="/img/small.jpg 320w, /img/large.jpg 1280w, /img/medium.jpg 640w" width="640" height="480" alt="Responsive">
+		<img src="/img/logo.png" srcset="/img/logo.png, /img/logo@2x.png 2x">
+		<img srcset="https://cdn.example/w_800,h_600/photo.jpg 800w, https://cdn.example/w_400,h_300/photo.jpg 400w">
+		<img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=" data-src="/img/lazy.jpg" alt="Lazy">
+		<img src="/img/placeholder.gif" data-original="/img/original.jpg">
+		<img src="data:image/png;base64,iVBORw0KGgo=">
+		<img src="https://tracker.example/pixel.gif" width="1" height="1">
+		<img src="https://tracker.example/zero.gif" width="0" height="0">
+		<img src="https://tracker.example/beacon.gif" style="display:none" width="1px">
+		<img src="/img/large.jpg" alt="Duplicate">
+		<img src="/img/banner.jpg" width="100%">
+		<img alt="No source">
+	</body></html>`)
+	parser.SetBaseURL("https://shop.example/")
+
+	images := parser.ExtractImages()
+	want := []goscraper.Image{
+		{URL: "https://shop.example/img/large.jpg", RawURL: "/img/large.jpg", Alt: "Responsive", Width: 640, Height: 480},
+		{URL: "https://shop.example/img/logo@2x.png", RawURL: "/img/logo@2x.png"},
+		{URL: "https://cdn.example/w_800,h_600/photo.jpg", RawURL: "https://cdn.example/w_800,h_600/photo.jpg"},
+		{URL: "https://shop.example/img/lazy.jpg", RawURL: "/img/lazy.jpg", Alt: "Lazy"},
+		{URL: "https://shop.example/img/original.jpg", RawURL: "/img/original.jpg"},
+		{URL: "https://shop.example/img/banner.jpg", RawURL: "/img/banner.jpg"},
+	}
+	if len(images) != len(want) {
+		t.Fatalf("expected %d images, got %+v", len(want), images)
+	}
+	for i := range want {
+		if images[i] != want[i] {
+			t.Errorf("image %d:\n got %+v\nwant %+v", i, images[i], want[i])
+		}
+	}
+}
+
+func TestDetectPaywall(t *testing.T) {
+	longArticle := `<article>` + strings.Repeat("The full story goes on. ", 100) + `</article>`
+
+	for _, tc := range []struct {
+		name       string
+		html       string
+		paywalled  bool
+		confidence float64
+	}{
+		{
+			name: "not accessible for free",
+			html: `<html><head><script type="application/ld+json">
+				{"@type": "NewsArticle", "hasPart": {"@type": "WebPageElement", "isAccessibleForFree": "False"}}
+			</script></head><body>` + longArticle + `</body></html>`,
+			paywalled:  true,
+			confidence: 0.6,
+		},
+		{
+			name: "paywall markup and vendor script",
+			html: `<html><head><script src="https://cdn.tinypass.com/api/tinypass.min.js"></script></head>
+				<body>` + longArticle + `<div class="article-paywall">Subscribe</div></body></html>`,
+			paywalled:  true,
+			confidence: 0.5,
+		},
+		{
+			name: "teaser with subscribe prompt",
+			html: `<html><head><script src="/assets/metering.js"></script></head><body>
+				<article>Only the first paragraph.</article>
+				<p>Subscribe to continue reading.</p></body></html>`,
+			paywalled:  false,
+			confidence: 0.4,
+		},
+		{
+			name: "inline config mentioning a paywall",
+			html: `<html><head><script>window.config = {"paywall": false, "metered": false};</script></head>
+				<body>` + longArticle + `</body></html>`,
+		},
+		{
+			name: "free article",
+			html: `<html><head><script type="application/ld+json">{"@type": "NewsArticle", "isAccessibleForFree": true}</script></head>
+				<body>` + longArticle + `<p>Already a subscriber? Sign in.</p></body></html>`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			paywalled, confidence := newTestParser(t, tc.html).DetectPaywall()
+			if paywalled != tc.paywalled || math.Abs(confidence-tc.confidence) > 1e-9 {
+				t.Errorf("expected (%v, %.1f), got (%v, %.1f)", tc.paywalled, tc.confidence, paywalled, confidence)
+			}
+		})
+	}
+}
+
+func TestExtractCanonical(t *testing.T) {
+	for html, want := range map[string]string{
+		`<link rel="canonical" href=" /articles/42 ">`:                                          "/articles/42",
+		`<link rel="alternate" href="/amp"><link rel="Canonical" href="https://example.com/a">`: "https://example.com/a",
+		`<link rel="preload canonical" href="../b">`:                                            "../b",
+		`<link rel="canonical">`:                                                                "",
+		`<title>No canonical</title>`:                                                           "",
+	} {
+		if got := newTestParser(t, "<html><head>"+html+"</head></html>").ExtractCanonical(); got != want {
+			t.Errorf("%s: expected %q, got %q", html, want, got)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2/registry"
+
+	"github.com/ramusaaa/goscraper/pkg/queue"
+)
+
+const jobSchema = `{
+	"type": "record",
+	"name": "ScrapingJob",
+	"fields": [
+		{"name": "id", "type": "string"},
+		{"name": "url", "type": "string"},
+		{"name": "priority", "type": "int"},
+		{"name": "headers", "type": {"type": "map", "values": "string"}, "default": {}}
+	]
+}`
+
+// newSchemaRegistry serves schemas as a Confluent schema registry does,
+// registering each subject's schema under id.
+func newSchemaRegistry(t *testing.T, id int, schema string) *registry.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/subjects/"):
+			fmt.Fprintf(w, `{"id": %d}`, id)
+		case r.Method == http.MethodGet && r.URL.Path == fmt.Sprintf("/schemas/ids/%d", id):
+			json.NewEncoder(w).Encode(map[string]string{"schema": schema})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := registry.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestAvroSerializerRoundTrip(t *testing.T) {
+	serializer, err := queue.NewAvroSerializer(newSchemaRegistry(t, 7, jobSchema), jobSchema)
+	if err != nil {
+		t.Fatalf("Failed to create serializer: %v", err)
+	}
+
+	job := &queue.ScrapingJob{
+		ID:       "job-1",
+		URL:      "https://example.com",
+		Priority: 5,
+		Headers:  map[string]string{"X-Test": "1"},
+	}
+
+	ctx := context.Background()
+	data, err := serializer.Serialize(ctx, "jobs", job)
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if data[0] != 0 || data[4] != 7 {
+		t.Errorf("Expected confluent header with schema id 7, got %v", data[:5])
+	}
+
+	value, err := serializer.Deserialize(ctx, "jobs", data)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+
+	record := value.(map[string]interface{})
+	if record["id"] != "job-1" || record["priority"] != 5 {
+		t.Errorf("Unexpected record: %v", record)
+	}
+	if headers := record["headers"].(map[string]interface{}); headers["X-Test"] != "1" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+
+	if _, err := serializer.Deserialize(ctx, "jobs", []byte(strings.Repeat("x", 8))); err == nil {
+		t.Error("Expected error for non-avro payload")
+	}
+	if _, err := queue.NewAvroSerializer(nil, `{"type": "record"}`); err == nil {
+		t.Error("Expected error for an invalid schema")
+	}
+}
+
+func TestAvroSerializerLogicalTypes(t *testing.T) {
+	const schema = `{"type": "record", "name": "Event", "fields": [
+		{"name": "at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "id", "type": {"type": "string", "logicalType": "uuid"}}
+	]}`
+	type event struct {
+		At time.Time `json:"at"`
+		ID string    `json:"id"`
+	}
+
+	serializer, err := queue.NewAvroSerializer(newSchemaRegistry(t, 3, schema), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	data, err := serializer.Serialize(context.Background(), "events", event{At: at, ID: "0b7c5a3e-1f0e-4b61-9d2a-5c1b2a3d4e5f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := serializer.Deserialize(context.Background(), "events", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := value.(map[string]interface{})["at"].(time.Time); !ok || !got.Equal(at) {
+		t.Errorf("expected the timestamp to round-trip, got %v", value)
+	}
+}
+
+func TestRetryHandlerRetriesUntilSuccess(t *testing.T) {
+	calls := 0
+	flaky := func(ctx context.Context, message *queue.Message) error {
+		calls++
+		if calls <= 2 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}
+
+	handler := queue.RetryHandler(flaky, 3, time.Millisecond)
+	if err := handler(context.Background(), &queue.Message{ID: "job-1"}); err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+
+	calls = 0
+	handler = queue.RetryHandler(flaky, 1, time.Millisecond)
+	if err := handler(context.Background(), &queue.Message{ID: "job-2"}); err == nil {
+		t.Error("expected the error once retries are exhausted")
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestMemoryQueueDeliversInOrder(t *testing.T) {
+	q := queue.NewMemoryQueue(0)
+	defer q.Close()
+	ctx := context.Background()
+
+	jobs := queue.NewJobQueue(q, "jobs")
+	for i := 0; i < 5; i++ {
+		if err := jobs.Enqueue(ctx, &queue.ScrapingJob{ID: fmt.Sprintf("job-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := make(chan string, 5)
+	err := jobs.Subscribe(ctx, func(ctx context.Context, job *queue.ScrapingJob) error {
+		received <- job.ID
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		select {
+		case id := <-received:
+			if want := fmt.Sprintf("job-%d", i); id != want {
+				t.Fatalf("expected %s, got %s", want, id)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for job-%d", i)
+		}
+	}
+}
+
+func TestMemoryQueueSharesMessagesBetweenSubscribers(t *testing.T) {
+	q := queue.NewMemoryQueue(0)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	var wg sync.WaitGroup
+	wg.Add(100)
+	for i := 0; i < 4; i++ {
+		q.Subscribe(ctx, "jobs", func(ctx context.Context, message *queue.Message) error {
+			mu.Lock()
+			seen[message.ID]++
+			mu.Unlock()
+			wg.Done()
+			return nil
+		})
+	}
+	for i := 0; i < 100; i++ {
+		q.Publish(ctx, "jobs", &queue.Message{ID: fmt.Sprint(i)})
+	}
+	wg.Wait()
+	q.Close()
+
+	if len(seen) != 100 {
+		t.Fatalf("expected 100 distinct messages, got %d", len(seen))
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("message %s delivered %d times", id, n)
+		}
+	}
+}
+
+func TestMemoryQueueCloseUnblocks(t *testing.T) {
+	q := queue.NewMemoryQueue(1)
+	ctx := context.Background()
+
+	q.Publish(ctx, "full", &queue.Message{ID: "1"})
+	published := make(chan error, 1)
+	go func() {
+		published <- q.Publish(ctx, "full", &queue.Message{ID: "2"})
+	}()
+
+	handled := make(chan string, 10)
+	q.Subscribe(ctx, "idle", func(ctx context.Context, message *queue.Message) error {
+		handled <- message.ID
+		return nil
+	})
+
+	closed := make(chan struct{})
+	go func() {
+		q.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not stop the subscriber")
+	}
+
+	select {
+	case err := <-published:
+		if !errors.Is(err, queue.ErrQueueClosed) {
+			t.Errorf("expected the blocked Publish to fail with ErrQueueClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not unblock Publish")
+	}
+
+	if err := q.Publish(ctx, "idle", &queue.Message{ID: "late"}); !errors.Is(err, queue.ErrQueueClosed) {
+		t.Errorf("expected Publish after Close to fail, got %v", err)
+	}
+	if err := q.Subscribe(ctx, "idle", func(context.Context, *queue.Message) error { return nil }); !errors.Is(err, queue.ErrQueueClosed) {
+		t.Errorf("expected Subscribe after Close to fail, got %v", err)
+	}
+	if len(handled) != 0 {
+		t.Errorf("expected no messages to be handled, got %d", len(handled))
+	}
+}
+
+func TestPriorityQueueDrainsHigherPrioritiesFirst(t *testing.T) {
+	q := queue.NewMemoryQueue(0)
+	defer q.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pq := queue.NewPriorityQueue(q, []int{0, 5, 10})
+	for i := 0; i < 5; i++ {
+		for _, priority := range []int{0, 10} {
+			job := &queue.ScrapingJob{ID: fmt.Sprintf("p%d-%d", priority, i), Priority: priority}
+			if err := pq.Enqueue(ctx, job); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	var order []int
+	done := make(chan struct{})
+	err := pq.Subscribe(ctx, func(ctx context.Context, job *queue.ScrapingJob) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, job.Priority)
+		if len(order) == 10 {
+			close(done)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for jobs")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, priority := range order {
+		if want := map[bool]int{true: 10, false: 0}[i < 5]; priority != want {
+			t.Fatalf("expected all P10 jobs before P0 jobs, got %v", order)
+		}
+	}
+}
+
+func TestPriorityQueueRunsJobsConcurrently(t *testing.T) {
+	q := queue.NewMemoryQueue(0)
+	defer q.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pq := queue.NewPriorityQueue(q, []int{0, 10})
+	pq.Concurrency = 4
+	for i := 0; i < 8; i++ {
+		if err := pq.Enqueue(ctx, &queue.ScrapingJob{ID: fmt.Sprintf("job-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	running, maxRunning, handled := 0, 0, 0
+	done := make(chan struct{})
+	started := time.Now()
+	err := pq.Subscribe(ctx, func(ctx context.Context, job *queue.ScrapingJob) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		running--
+		if handled++; handled == 8 {
+			close(done)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for jobs")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if maxRunning != 4 {
+		t.Errorf("expected 4 jobs at once, got %d", maxRunning)
+	}
+	if elapsed := time.Since(started); elapsed > 300*time.Millisecond {
+		t.Errorf("expected 8 jobs of 50ms on 4 workers to take about 100ms, took %s", elapsed)
+	}
+}
+
+func TestPriorityQueueDefaultsUnknownPriorities(t *testing.T) {
+	q := queue.NewMemoryQueue(0)
+	defer q.Close()
+	ctx := context.Background()
+
+	pq := queue.NewPriorityQueue(q, []int{5, 1})
+	if err := pq.Enqueue(ctx, &queue.ScrapingJob{ID: "unknown", Priority: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if got := q.Len("scraping-jobs-p1"); got != 1 {
+		t.Errorf("expected the job on the lowest priority, got %d", got)
+	}
+
+	if err := queue.NewPriorityQueue(q, nil).Enqueue(ctx, &queue.ScrapingJob{ID: "none"}); err == nil {
+		t.Error("expected an error without any priorities")
+	}
+}
+
+func TestKafkaQueueSecurityConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		security *queue.SecurityConfig
+		wantErr  string
+	}{
+		{"plaintext", &queue.SecurityConfig{Protocol: queue.ProtocolPlaintext}, ""},
+		{"scram-sha-256", &queue.SecurityConfig{Protocol: queue.ProtocolSASLPlaintext, Mechanism: queue.MechanismSCRAMSHA256, Username: "user", Password: "secret"}, ""},
+		{"scram-sha-512", &queue.SecurityConfig{Protocol: queue.ProtocolSASLSSL, Mechanism: queue.MechanismSCRAMSHA512, Username: "user", Password: "secret"}, ""},
+		{"missing username", &queue.SecurityConfig{Protocol: queue.ProtocolSASLPlaintext, Mechanism: queue.MechanismPlain}, "username"},
+		{"unknown mechanism", &queue.SecurityConfig{Protocol: queue.ProtocolSASLPlaintext, Mechanism: "GSSAPI", Username: "user"}, "unsupported SASL mechanism"},
+		{"unknown protocol", &queue.SecurityConfig{Protocol: "QUIC"}, "unsupported kafka security protocol"},
+		{"missing CA file", &queue.SecurityConfig{Protocol: queue.ProtocolSSL, CAFile: "/nonexistent/ca.pem"}, "CA file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := queue.NewKafkaQueue(&queue.KafkaConfig{Security: tt.security})
+			defer q.Close()
+
+			// With no brokers a valid configuration only fails to find one.
+			err := q.Ping(context.Background())
+			if tt.wantErr == "" {
+				if err == nil || !strings.Contains(err.Error(), "no kafka brokers") {
+					t.Fatalf("expected the configuration to be accepted, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+			if err := q.Publish(context.Background(), "jobs", &queue.Message{Value: "x"}); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected Publish to fail with the configuration error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+//go:build browser
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ramusaaa/goscraper/pkg/browser"
+)
+
+// TestBrowserScreenshotCapturesFullPage needs a local Chrome; run it with
+// go test -tags browser.
+func TestBrowserScreenshotCapturesFullPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body style="margin:0"><div style="height:3000px;background:#c33">tall</div></body></html>`)
+	}))
+	defer server.Close()
+
+	manager := browser.NewManager(&browser.Config{
+		Engine:         browser.ChromeDP,
+		Headless:       true,
+		ViewportWidth:  800,
+		ViewportHeight: 600,
+		Timeout:        30 * time.Second,
+	}, 1)
+	defer manager.Close()
+
+	for _, fullPage := range []bool{false, true} {
+		shot, err := manager.Screenshot(context.Background(), server.URL, fullPage)
+		if err != nil {
+			if strings.Contains(err.Error(), "executable file not found") {
+				t.Skip("no Chrome installed")
+			}
+			t.Fatal(err)
+		}
+		config, err := png.DecodeConfig(bytes.NewReader(shot))
+		if err != nil {
+			t.Fatalf("fullPage=%v: screenshot is not a PNG: %v", fullPage, err)
+		}
+		if fullPage && config.Height < 3000 {
+			t.Errorf("expected the full page to be captured, got %dx%d", config.Width, config.Height)
+		}
+		if !fullPage && config.Height >= 3000 {
+			t.Errorf("expected only the viewport to be captured, got %dx%d", config.Width, config.Height)
+		}
+	}
+}
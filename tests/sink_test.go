@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ramusaaa/goscraper"
+)
+
+func TestNDJSONSinkConcurrentWritesAndRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.ndjson")
+	sink, err := goscraper.NewNDJSONSink(path, goscraper.WithSinkMaxSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if err := sink.Write(map[string]int{"worker": worker, "item": i}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(path + "*")
+	if len(files) < 2 {
+		t.Fatalf("expected rotated files, got %v", files)
+	}
+
+	lines := 0
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var item map[string]int
+			if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+				t.Fatalf("%s: corrupt line %q", file, scanner.Text())
+			}
+			lines++
+		}
+		f.Close()
+	}
+	if lines != 200 {
+		t.Errorf("expected 200 items, got %d", lines)
+	}
+}
@@ -0,0 +1,757 @@
+package tests
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ramusaaa/goscraper"
+	"github.com/ramusaaa/goscraper/pkg/stealth"
+)
+
+type fakeChallengeSolver struct {
+	calls int
+}
+
+func (f *fakeChallengeSolver) SolveChallenge(ctx context.Context, url string) (*stealth.ChallengeClearance, error) {
+	f.calls++
+	return &stealth.ChallengeClearance{
+		Cookies:   []*http.Cookie{{Name: "cf_clearance", Value: "solved"}},
+		UserAgent: "SolverBrowser/1.0",
+	}, nil
+}
+
+func TestJSChallengeEscalatesToSolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("cf_clearance")
+		if err != nil || cookie.Value != "solved" || r.UserAgent() != "SolverBrowser/1.0" {
+			w.Header().Set("Cf-Mitigated", "challenge")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "<html><title>Just a moment...</title></html>")
+			return
+		}
+		fmt.Fprint(w, "<html><body>content</body></html>")
+	}))
+	defer server.Close()
+
+	solver := &fakeChallengeSolver{}
+	evasion := stealth.NewBotDetectionEvasion(func(sc *stealth.StealthConfig) {
+		sc.SimulateHuman = false
+		sc.JSChallengeBypass = true
+		sc.ChallengeSolver = solver
+	})
+
+	for i := 0; i < 2; i++ {
+		resp, err := evasion.MakeRequestContext(context.Background(), server.URL)
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: expected the challenge to be cleared, got %d", i, resp.StatusCode)
+		}
+	}
+
+	if solver.calls != 1 {
+		t.Errorf("expected the clearance to be reused over HTTP, solver called %d times", solver.calls)
+	}
+}
+
+func TestChallengeDetectedFromPageBody(t *testing.T) {
+	challenge := `<html><head><title>Just a moment...</title></head>
+<body><div id="cf-browser-verification"><script src="/cdn-cgi/challenge-platform/h/b/orchestrate/jsch/v1"></script></div></body></html>`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("cf_clearance"); err != nil || cookie.Value != "solved" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, challenge)
+			return
+		}
+		fmt.Fprint(w, "<html><body>real page</body></html>")
+	}))
+	defer server.Close()
+
+	solver := &fakeChallengeSolver{}
+	evasion := stealth.NewBotDetectionEvasion(func(sc *stealth.StealthConfig) {
+		sc.SimulateHuman = false
+		sc.JSChallengeBypass = true
+		sc.ChallengeSolver = solver
+	})
+
+	resp, err := evasion.MakeRequestContext(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if solver.calls != 1 || !strings.Contains(string(body), "real page") {
+		t.Errorf("expected the challenge page to be solved once, got %d calls and %q", solver.calls, body)
+	}
+
+	if !stealth.DetectCloudflareChallenge(&http.Response{StatusCode: 403, Header: http.Header{}}, []byte(challenge)) {
+		t.Error("expected challenge markers to be detected on a 403 response")
+	}
+	if stealth.DetectCloudflareChallenge(&http.Response{StatusCode: 200, Header: http.Header{}}, []byte(challenge)) {
+		t.Error("did not expect the body of a 200 response to be trusted")
+	}
+	if !stealth.DetectCloudflareChallenge(&http.Response{StatusCode: 200, Header: http.Header{"Cf-Mitigated": {"challenge"}}}, nil) {
+		t.Error("expected cf-mitigated: challenge to be detected whatever the status")
+	}
+	if stealth.DetectCloudflareChallenge(&http.Response{StatusCode: 503, Header: http.Header{}}, []byte("<html><body>Down for maintenance</body></html>")) {
+		t.Error("did not expect an ordinary error page to be treated as a challenge")
+	}
+}
+
+func TestOrdinaryCloudflarePageIsNotAChallenge(t *testing.T) {
+	// Cloudflare injects its JS detection script into ordinary pages.
+	page := `<html><head><title>Shop</title></head><body>products
+<script src="/cdn-cgi/challenge-platform/scripts/jsd/main.js"></script></body></html>`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "cloudflare")
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	solver := &fakeChallengeSolver{}
+	evasion := stealth.NewBotDetectionEvasion(func(sc *stealth.StealthConfig) {
+		sc.SimulateHuman = false
+		sc.JSChallengeBypass = true
+		sc.ChallengeSolver = solver
+	})
+
+	resp, err := evasion.MakeRequestContext(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if solver.calls != 0 || string(body) != page {
+		t.Errorf("expected the page as served without the solver, got %d calls and %q", solver.calls, body)
+	}
+}
+
+type htmlChallengeSolver struct{}
+
+func (htmlChallengeSolver) SolveChallenge(ctx context.Context, url string) (*stealth.ChallengeClearance, error) {
+	return &stealth.ChallengeClearance{
+		Cookies: []*http.Cookie{{Name: "cf_clearance", Value: "browser-only"}},
+		HTML:    "<html><body>rendered by the browser</body></html>",
+	}, nil
+}
+
+func TestChallengeFallsBackToBrowserHTML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<html><body><script>window._cf_chl_opt={}</script></body></html>`)
+	}))
+	defer server.Close()
+
+	evasion := stealth.NewBotDetectionEvasion(func(sc *stealth.StealthConfig) {
+		sc.SimulateHuman = false
+		sc.JSChallengeBypass = true
+		sc.ChallengeSolver = htmlChallengeSolver{}
+	})
+
+	resp, err := evasion.MakeRequestContext(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "rendered by the browser") {
+		t.Errorf("expected the browser's page, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestSessionCookiesSurviveSaveAndLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "logged-in", Path: "/", MaxAge: 3600})
+			http.SetCookie(w, &http.Cookie{Name: "admin", Value: "yes", Path: "/admin"})
+			http.SetCookie(w, &http.Cookie{Name: "stale", Value: "old", Path: "/", Expires: time.Now().Add(-time.Hour)})
+		default:
+			var names []string
+			for _, cookie := range r.Cookies() {
+				names = append(names, cookie.Name+"="+cookie.Value)
+			}
+			fmt.Fprint(w, strings.Join(names, ";"))
+		}
+	}))
+	defer server.Close()
+
+	domain := strings.TrimPrefix(server.URL, "http://")
+	path := filepath.Join(t.TempDir(), "cookies.json")
+
+	sessions := stealth.NewSessionManager()
+	resp, err := sessions.GetSession(domain).Get(server.URL + "/login")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	resp.Body.Close()
+	if err := sessions.SaveCookies(domain, path); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	restored := stealth.NewSessionManager()
+	if err := restored.LoadCookies(domain, path); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	get := func(p string) string {
+		resp, err := restored.GetSession(domain).Get(server.URL + p)
+		if err != nil {
+			t.Fatalf("request to %s failed: %v", p, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if got := get("/account"); got != "session=logged-in" {
+		t.Errorf("expected only the session cookie outside /admin, got %q", got)
+	}
+	if got := get("/admin/users"); !strings.Contains(got, "admin=yes") || !strings.Contains(got, "session=logged-in") {
+		t.Errorf("expected both cookies under /admin, got %q", got)
+	}
+}
+
+func TestTLSFingerprintProfiles(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>secure</body></html>")
+	}))
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	var dials int32
+	stealth.RegisterTLSProfile("test-browser", func(ctx context.Context, network, addr string, config *tls.Config) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		if config.ServerName != "127.0.0.1" {
+			t.Errorf("expected the server name to be set, got %q", config.ServerName)
+		}
+		config.RootCAs = roots
+		return (&tls.Dialer{Config: config}).DialContext(ctx, network, addr)
+	})
+	t.Cleanup(stealth.ResetTLSProfiles)
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithTLSFingerprint("test-browser"))
+	if resp, err := scraper.Get(server.URL); err != nil || !strings.Contains(resp.Body, "secure") {
+		t.Fatalf("expected the request to succeed over the profile, got %v", err)
+	}
+	if atomic.LoadInt32(&dials) != 1 {
+		t.Fatalf("expected the profile to make the connection, got %d dials", dials)
+	}
+
+	evasion := stealth.NewBotDetectionEvasion(func(sc *stealth.StealthConfig) {
+		sc.SimulateHuman = false
+		sc.TLSProfile = "test-browser"
+	})
+	resp, err := evasion.MakeRequest(server.URL)
+	if err != nil {
+		t.Fatalf("stealth request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || atomic.LoadInt32(&dials) != 2 {
+		t.Errorf("expected the stealth transport to use the profile, got %d after %d dials", resp.StatusCode, dials)
+	}
+
+	// The built-in profile keeps the scraper's own TLS settings.
+	builtin := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithTLSFingerprint(stealth.TLSProfileGo),
+		goscraper.WithInsecureHosts([]string{"localhost"}))
+	if _, err := builtin.Get(strings.Replace(server.URL, "127.0.0.1", "localhost", 1)); err != nil {
+		t.Errorf("expected the built-in profile to honor WithInsecureHosts, got %v", err)
+	}
+
+	missing := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0), goscraper.WithTLSFingerprint("missing"))
+	if _, err := missing.Get(server.URL); !errors.Is(err, stealth.ErrUnknownTLSProfile) {
+		t.Errorf("expected ErrUnknownTLSProfile, got %v", err)
+	}
+
+	stealth.UnregisterTLSProfile("test-browser")
+	unregistered := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0), goscraper.WithTLSFingerprint("test-browser"))
+	if _, err := unregistered.Get(server.URL); !errors.Is(err, stealth.ErrUnknownTLSProfile) {
+		t.Errorf("expected an unregistered profile to fail, got %v", err)
+	}
+	stealth.UnregisterTLSProfile(stealth.TLSProfileGo)
+	if _, err := builtin.Get(strings.Replace(server.URL, "127.0.0.1", "localhost", 1)); err != nil {
+		t.Errorf("expected the built-in profile to stay registered, got %v", err)
+	}
+}
+
+func TestBrowserTLSProfiles(t *testing.T) {
+	hellos := make(chan *tls.ClientHelloInfo, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html><body>%s</body></html>", r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		hellos <- hello
+		return nil, nil
+	}}
+	server.StartTLS()
+	defer server.Close()
+	target := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	isGrease := func(v uint16) bool { return v&0x0f0f == 0x0a0a }
+	hasGrease := func(values []uint16) bool {
+		for _, v := range values {
+			if isGrease(v) {
+				return true
+			}
+		}
+		return false
+	}
+	hasExtension := func(hello *tls.ClientHelloInfo, ext uint16) bool {
+		for _, e := range hello.Extensions {
+			if e == ext {
+				return true
+			}
+		}
+		return false
+	}
+	const recordSizeLimit = 28
+
+	for _, tc := range []struct {
+		profile string
+		check   func(hello *tls.ClientHelloInfo) bool
+	}{
+		// Go sends neither GREASE nor Firefox's record_size_limit.
+		{stealth.TLSProfileGo, func(h *tls.ClientHelloInfo) bool {
+			return !hasGrease(h.CipherSuites) && !hasExtension(h, recordSizeLimit)
+		}},
+		{stealth.TLSProfileChrome, func(h *tls.ClientHelloInfo) bool {
+			return hasGrease(h.CipherSuites) && isGrease(h.Extensions[0])
+		}},
+		{stealth.TLSProfileFirefox, func(h *tls.ClientHelloInfo) bool {
+			return !hasGrease(h.CipherSuites) && hasExtension(h, recordSizeLimit)
+		}},
+	} {
+		// The test server is only trusted through WithInsecureHosts, so the
+		// profiles have to keep the scraper's verification settings.
+		scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0),
+			goscraper.WithTLSFingerprint(tc.profile), goscraper.WithInsecureHosts([]string{"localhost"}))
+		resp, err := scraper.Get(target)
+		if err != nil {
+			t.Errorf("%s: request failed: %v", tc.profile, err)
+			continue
+		}
+		hello := <-hellos
+		if !tc.check(hello) {
+			t.Errorf("%s: unexpected ClientHello, cipher suites %x, extensions %v", tc.profile, hello.CipherSuites, hello.Extensions)
+		}
+		if tc.profile != stealth.TLSProfileGo && !strings.Contains(resp.Body, "HTTP/1.1") {
+			t.Errorf("%s: expected HTTP/1.1 over a uTLS connection, got %s", tc.profile, resp.Body)
+		}
+	}
+
+	strict := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithMaxRetries(0), goscraper.WithTLSFingerprint(stealth.TLSProfileChrome))
+	if _, err := strict.Get(target); err == nil {
+		t.Error("expected the browser profile to verify certificates")
+	}
+	<-hellos
+}
+
+func TestHTTP2Negotiation(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html><body>%s</body></html>", r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	localURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	for _, tc := range []struct {
+		enabled bool
+		want    string
+	}{{true, "HTTP/2.0"}, {false, "HTTP/1.1"}} {
+		scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithHTTP2(tc.enabled),
+			goscraper.WithInsecureHosts([]string{"localhost"}))
+		resp, err := scraper.Get(localURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Document.Find("body").Text(); got != tc.want {
+			t.Errorf("WithHTTP2(%v): expected %s, got %s", tc.enabled, tc.want, got)
+		}
+	}
+
+	// Stealth connections negotiate the same way, also over a TLS profile.
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	stealth.RegisterTLSProfile("test-h2", func(ctx context.Context, network, addr string, config *tls.Config) (net.Conn, error) {
+		config.RootCAs = roots
+		return (&tls.Dialer{Config: config}).DialContext(ctx, network, addr)
+	})
+	t.Cleanup(stealth.ResetTLSProfiles)
+	for _, tc := range []struct {
+		force, disable bool
+		want           string
+	}{{true, false, "HTTP/2.0"}, {false, true, "HTTP/1.1"}} {
+		evasion := stealth.NewBotDetectionEvasion(func(sc *stealth.StealthConfig) {
+			sc.SimulateHuman = false
+			sc.TLSProfile = "test-h2"
+			sc.ForceHTTP2 = tc.force
+			sc.DisableHTTP2 = tc.disable
+		})
+		resp, err := evasion.MakeRequest(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.Proto != tc.want || (tc.force && resp.TLS.NegotiatedProtocol != "h2") {
+			t.Errorf("stealth force=%v disable=%v: expected %s, got %s", tc.force, tc.disable, tc.want, resp.Proto)
+		}
+	}
+}
+
+func TestDeviceProfileFiltersUserAgents(t *testing.T) {
+	const (
+		desktopChrome = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+		androidChrome = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"
+		iPhoneSafari  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	)
+
+	client := stealth.NewStealthClient(&stealth.StealthConfig{
+		RotateUserAgents: true,
+		UserAgents:       []string{desktopChrome, androidChrome, iPhoneSafari},
+		DeviceProfile:    stealth.DeviceMobile,
+	})
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		req, err := client.CreateStealthRequest("GET", "https://example.com/")
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		ua := req.Header.Get("User-Agent")
+		seen[ua] = true
+		switch ua {
+		case androidChrome:
+			if req.Header.Get("Sec-CH-UA-Mobile") != "?1" || req.Header.Get("Sec-CH-UA-Platform") != `"Android"` {
+				t.Fatalf("client hints don't match %q: %v", ua, req.Header)
+			}
+		case iPhoneSafari:
+			if req.Header.Get("Sec-CH-UA") != "" {
+				t.Fatalf("Safari should send no client hints, got %v", req.Header)
+			}
+		default:
+			t.Fatalf("mobile profile picked %q", ua)
+		}
+	}
+	if !seen[androidChrome] || !seen[iPhoneSafari] {
+		t.Errorf("expected both mobile User-Agents to be used, got %v", seen)
+	}
+
+	desktop := stealth.NewStealthClient(&stealth.StealthConfig{
+		RotateUserAgents: true,
+		UserAgents:       []string{androidChrome},
+		DeviceProfile:    stealth.DeviceDesktop,
+	})
+	req, err := desktop.CreateStealthRequest("GET", "https://example.com/")
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if ua := req.Header.Get("User-Agent"); strings.Contains(ua, "Mobi") || ua == "" {
+		t.Errorf("expected a built-in desktop User-Agent when none of the list matches, got %q", ua)
+	}
+	if mobile := req.Header.Get("Sec-CH-UA-Mobile"); mobile == "?1" {
+		t.Errorf("desktop request sent Sec-CH-UA-Mobile %q", mobile)
+	}
+}
+
+func TestRealisticHeadersMatchUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		accept    string
+		hints     bool
+		platform  string
+	}{
+		{
+			name:      "chrome",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			accept:    "image/apng",
+			hints:     true,
+			platform:  `"Windows"`,
+		},
+		{
+			name:      "firefox",
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:125.0) Gecko/20100101 Firefox/125.0",
+			accept:    "image/webp,*/*",
+		},
+		{
+			name:      "safari",
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+			accept:    "application/xml;q=0.9,*/*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := stealth.NewStealthClient(&stealth.StealthConfig{
+				RotateUserAgents: true,
+				RandomizeHeaders: true,
+				UserAgents:       []string{tt.userAgent},
+			})
+			for i := 0; i < 20; i++ {
+				req, err := client.CreateStealthRequest("GET", "https://example.com/")
+				if err != nil {
+					t.Fatalf("failed to create request: %v", err)
+				}
+				h := req.Header
+
+				if !strings.Contains(h.Get("Accept"), tt.accept) {
+					t.Fatalf("Accept %q does not match %s", h.Get("Accept"), tt.name)
+				}
+				if h.Get("Sec-Fetch-Dest") != "document" || h.Get("Sec-Fetch-Mode") != "navigate" ||
+					h.Get("Sec-Fetch-Site") != "none" || h.Get("Sec-Fetch-User") != "?1" {
+					t.Fatalf("Sec-Fetch headers don't describe a navigation: %v", h)
+				}
+				if h.Get("Cache-Control") != "" {
+					t.Fatalf("a fresh navigation sends no Cache-Control, got %q", h.Get("Cache-Control"))
+				}
+				if !strings.HasPrefix(h.Get("Accept-Language"), "tr") {
+					t.Fatalf("unexpected Accept-Language %q", h.Get("Accept-Language"))
+				}
+
+				if !tt.hints {
+					if h.Get("Sec-CH-UA") != "" || h.Get("Sec-CH-UA-Platform") != "" {
+						t.Fatalf("%s sends no client hints, got %v", tt.name, h)
+					}
+					continue
+				}
+				if h.Get("Sec-CH-UA-Platform") != tt.platform || h.Get("Sec-CH-UA-Mobile") != "?0" ||
+					!strings.Contains(h.Get("Sec-CH-UA"), `"Chromium";v="124"`) {
+					t.Fatalf("client hints don't match the User-Agent: %v", h)
+				}
+			}
+		})
+	}
+}
+
+func TestStealthRequestsNavigateFromReferer(t *testing.T) {
+	type navigation struct{ referer, site string }
+	seen := make(chan navigation, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- navigation{r.Header.Get("Referer"), r.Header.Get("Sec-Fetch-Site")}
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	})
+	site := httptest.NewServer(handler)
+	defer site.Close()
+	other := httptest.NewServer(handler)
+	defer other.Close()
+
+	evasion := stealth.NewBotDetectionEvasion(func(sc *stealth.StealthConfig) {
+		sc.SimulateHuman = false
+	})
+	page := site.URL + "/list"
+	tests := []struct {
+		target  string
+		referer string
+		site    string
+	}{
+		{site.URL + "/item", page, "same-origin"},
+		{other.URL + "/", page, "same-site"},
+		{strings.Replace(other.URL, "127.0.0.1", "localhost", 1) + "/", page, "cross-site"},
+		{site.URL + "/", "", "none"},
+	}
+	for _, tt := range tests {
+		resp, err := evasion.MakeRequestWithOptions(context.Background(), tt.target, stealth.RequestOptions{Referer: tt.referer})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.target, err)
+		}
+		resp.Body.Close()
+		if got := <-seen; got.referer != tt.referer || got.site != tt.site {
+			t.Errorf("%s: expected Referer %q and Sec-Fetch-Site %q, got %+v", tt.target, tt.referer, tt.site, got)
+		}
+	}
+}
+
+func TestStealthScraperSendsReferer(t *testing.T) {
+	// Stealth requests wait a human delay, so run alongside other tests.
+	t.Parallel()
+
+	seen := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Header.Get("Referer") + " " + r.Header.Get("Sec-Fetch-Site")
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(goscraper.WithRateLimit(0), goscraper.WithStealth(true))
+	ctx := goscraper.ContextWithReferer(context.Background(), server.URL+"/list")
+	if _, err := scraper.GetWithContext(ctx, server.URL+"/item"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-seen, server.URL+"/list same-origin"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestStealthScraperAppliesHeadersCookiesAndHooks(t *testing.T) {
+	t.Parallel()
+
+	seen := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithStealth(true),
+		goscraper.WithHeaders(map[string]string{"X-Config": "1"}),
+		goscraper.WithCookieString("session=abc"),
+		goscraper.WithRequestHook(func(req *http.Request) error {
+			req.Header.Set("X-Hook", req.Header.Get("Sec-Fetch-Mode"))
+			return nil
+		}),
+	)
+	if _, err := scraper.Do(context.Background(), http.MethodGet, server.URL, nil, map[string]string{"Accept-Language": "de"}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-seen
+	// The hook sees the stealth headers, so the request was a stealth one.
+	if req.Header.Get("X-Hook") != "navigate" {
+		t.Errorf("expected the hook to run on the stealth request, got %v", req.Header)
+	}
+	if req.Header.Get("X-Config") != "1" || req.Header.Get("Accept-Language") != "de" {
+		t.Errorf("expected the configured and per-request headers, got %v", req.Header)
+	}
+	if cookie, err := req.Cookie("session"); err != nil || cookie.Value != "abc" {
+		t.Errorf("expected the configured cookie, got %v", req.Header["Cookie"])
+	}
+
+	failing := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithStealth(true),
+		goscraper.WithRequestHook(func(req *http.Request) error { return errors.New("signing failed") }),
+	)
+	if _, err := failing.Get(server.URL); err == nil || !strings.Contains(err.Error(), "signing failed") {
+		t.Errorf("expected the hook error, got %v", err)
+	}
+}
+
+func TestStealthBlockedRetryKeepsHeadersCookiesAndHooks(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	seen := make(chan *http.Request, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	var hooks int32
+	scraper := goscraper.New(
+		goscraper.WithRateLimit(0),
+		goscraper.WithMaxRetries(0),
+		goscraper.WithStealth(true),
+		goscraper.WithHeaders(map[string]string{"X-Config": "1"}),
+		goscraper.WithCookieString("session=abc"),
+		goscraper.WithRequestHook(func(req *http.Request) error {
+			req.Header.Set("X-Hook", fmt.Sprint(atomic.AddInt32(&hooks, 1)))
+			return nil
+		}),
+	)
+	resp, err := scraper.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the retry to succeed, got %d", resp.StatusCode)
+	}
+
+	<-seen
+	retry := <-seen
+	// The hook runs again for the retry, as it does for every request sent.
+	if retry.Header.Get("X-Hook") != "2" {
+		t.Errorf("expected the hook to run on the retry, got %q", retry.Header.Get("X-Hook"))
+	}
+	if retry.Header.Get("X-Config") != "1" {
+		t.Errorf("expected the configured header on the retry, got %v", retry.Header)
+	}
+	if cookie, err := retry.Cookie("session"); err != nil || cookie.Value != "abc" {
+		t.Errorf("expected the configured cookie on the retry, got %v", retry.Header["Cookie"])
+	}
+}
+
+func TestUserAgentProviderLoadsRefreshesAndFallsBack(t *testing.T) {
+	const first = "Mozilla/5.0 (X11; Linux x86_64) Firefox/140.0"
+	const second = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) Safari/605.1.15"
+	var current atomic.Value
+	current.Store(first)
+	var loads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&loads, 1)
+		switch r.URL.Path {
+		case "/broken":
+			http.Error(w, "gone", http.StatusNotFound)
+		case "/huge":
+			fmt.Fprint(w, strings.Repeat(first+"\n", (1<<20)/len(first)+1))
+		default:
+			fmt.Fprintf(w, "# current browsers\n%s\n", current.Load())
+		}
+	}))
+	defer server.Close()
+
+	wait := func(provider *stealth.UserAgentProvider) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.WaitFirstLoad(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The list is loaded on construction, before anything asks for it.
+	provider := stealth.NewUserAgentProvider(server.URL, 50*time.Millisecond)
+	wait(provider)
+	if atomic.LoadInt32(&loads) != 1 {
+		t.Fatalf("expected one load on construction, got %d", loads)
+	}
+	if agents := provider.UserAgents(); len(agents) != 1 || agents[0] != first {
+		t.Fatalf("expected the loaded list, got %v", agents)
+	}
+
+	// Once stale, the list is refreshed in the background.
+	current.Store(second)
+	time.Sleep(60 * time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for provider.UserAgents()[0] != second {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the list to be refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, path := range []string{"/broken", "/huge"} {
+		failing := stealth.NewUserAgentProvider(server.URL+path, time.Hour)
+		wait(failing)
+		if failing.LastError() == nil {
+			t.Errorf("%s: expected a load error", path)
+		}
+		if agents := failing.UserAgents(); len(agents) == 0 || agents[0] == first {
+			t.Errorf("%s: expected the built-in list, got %d agents", path, len(agents))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package goscraper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ramusaaa/goscraper/pkg/stealth"
+)
+
+// errUnverifiableIPHost is returned for HTTPS requests to IP addresses that
+// go through a proxy while WithInsecureHosts is set: the handshake does not
+// reveal which address was asked for, so the certificate cannot be checked.
+var errUnverifiableIPHost = errors.New("cannot verify the certificate of an IP address host through a proxy")
+
+func insecureHostSet(hosts []string) map[string]bool {
+	allowed := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		allowed[strings.ToLower(host)] = true
+	}
+	return allowed
+}
+
+// newHostAwareTLSConfig skips certificate verification only for the hosts in
+// insecureHosts. Go's built-in verification is turned off so that
+// VerifyConnection can make the decision per server name; every other host
+// is still verified against the system roots exactly as the default would.
+//
+// The server name is empty for IP addresses, so this config is only used
+// where the dialed host is not known, i.e. through proxies, and IP hosts are
+// refused there. Direct connections go through hostAwareTLSDialer.
+func newHostAwareTLSConfig(insecureHosts []string) *tls.Config {
+	allowed := insecureHostSet(insecureHosts)
+
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if cs.ServerName == "" {
+				return errUnverifiableIPHost
+			}
+			if allowed[strings.ToLower(cs.ServerName)] {
+				return nil
+			}
+
+			if len(cs.PeerCertificates) == 0 {
+				return x509.CertificateInvalidError{Reason: x509.NotAuthorizedToSign}
+			}
+
+			opts := x509.VerifyOptions{
+				DNSName:       cs.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+}
+
+// hostAwareTLSDialer returns a DialTLSContext function that connects with a
+// copy of base made for the dialed host: verification is skipped when the
+// host is in insecureHosts and otherwise left to Go, which checks names and
+// IP addresses alike. profile, if set, is the TLS profile to connect with.
+func hostAwareTLSDialer(base *tls.Config, insecureHosts []string, profile string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	allowed := insecureHostSet(insecureHosts)
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := base.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		cfg.ServerName = host
+		cfg.InsecureSkipVerify = allowed[strings.ToLower(host)]
+		cfg.VerifyConnection = nil
+
+		if profile != "" {
+			return stealth.TLSProfileDialer(profile, cfg)(ctx, network, addr)
+		}
+		dialer := &tls.Dialer{
+			NetDialer: &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+			Config:    cfg,
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}